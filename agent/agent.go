@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"encoding/base64"
 	"fmt"
 	"strings"
 
@@ -52,12 +53,29 @@ func NewAgent(apiClient *api.Client, systemPrompt string, opts ...AgentOption) *
 	for _, opt := range opts {
 		opt(agent)
 	}
+
+	// Let tools report status while they run (cache hits, long operations)
+	if agent.progressCallback != nil {
+		tools.SetProgressReporter(agent.progressCallback)
+	}
 	
 	return agent
 }
 
 // HandleMessage processes a user message and returns the response
 func (a *Agent) HandleMessage(userInput string) (string, error) {
+	// Files this turn changes are saved first so it can be rewound
+	tools.BeginCheckpoint(userInput, len(a.history))
+
+	// In auto-commit mode the files this turn changes are committed when it ends
+	if commit := tools.BeginAutoCommit(userInput); commit != nil {
+		defer func() {
+			if msg := commit(a.apiClient); msg != "" && a.progressCallback != nil {
+				a.progressCallback(msg)
+			}
+		}()
+	}
+
 	// Add user message to history
 	a.history = append(a.history, api.Message{
 		Role:    "user",
@@ -146,11 +164,11 @@ func (a *Agent) HandleMessage(userInput string) (string, error) {
 				
 				// Check for IMAGE_LOADED marker
 				if strings.HasPrefix(output, "IMAGE_LOADED:") {
-					// Parse: IMAGE_LOADED:<media_type>:<size_kb>:<base64_data>
+					// Parse: IMAGE_LOADED:<media_type>:<details>:<base64_data>
 					parts := strings.SplitN(output, ":", 4)
 					if len(parts) == 4 {
 						mediaType := parts[1]
-						sizeKB := parts[2]
+						details := parts[2]
 						imageData := parts[3]
 						
 						// Store image for inclusion in this turn's response
@@ -164,7 +182,31 @@ func (a *Agent) HandleMessage(userInput string) (string, error) {
 						})
 						
 						// Update result content to confirmation message
-						resultContent = fmt.Sprintf("Image loaded successfully (%s, %s KB)", mediaType, sizeKB)
+						resultContent = fmt.Sprintf("Image loaded successfully (%s, %s)", mediaType, details)
+					}
+				}
+
+				// Check for DOCUMENT_LOADED marker
+				if strings.HasPrefix(output, "DOCUMENT_LOADED:") {
+					// Parse: DOCUMENT_LOADED:<source_type>:<media_type>:<title>:<summary>:<data>
+					// (title, summary and data are base64)
+					parts := strings.SplitN(output, ":", 6)
+					if len(parts) == 6 {
+						title, _ := base64.StdEncoding.DecodeString(parts[3])
+						summary, _ := base64.StdEncoding.DecodeString(parts[4])
+						source := &api.ImageSource{Type: parts[1], MediaType: parts[2], Data: parts[5]}
+						if source.Type == "text" {
+							text, _ := base64.StdEncoding.DecodeString(parts[5])
+							source.Data = string(text)
+						}
+
+						// Documents travel like images, after the tool results
+						pendingImages = append(pendingImages, api.ContentBlock{
+							Type:   "document",
+							Source: source,
+							Title:  string(title),
+						})
+						resultContent = string(summary)
 					}
 				}
 			}
@@ -190,6 +232,20 @@ func (a *Agent) HandleMessage(userInput string) (string, error) {
 	}
 }
 
+// Close releases resources held by tools for this session, such as the
+// persistent shell. Call it when the agent is no longer needed.
+func (a *Agent) Close() {
+	tools.Shutdown()
+}
+
+// RewindHistory drops the conversation after its first n messages, such as
+// when files are rewound to a checkpoint
+func (a *Agent) RewindHistory(n int) {
+	if n >= 0 && n < len(a.history) {
+		a.history = a.history[:n]
+	}
+}
+
 // GetHistory returns the conversation history
 func (a *Agent) GetHistory() []api.Message {
 	return a.history
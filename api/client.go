@@ -27,6 +27,20 @@ func NewClient(apiKey, apiURL, modelID string, maxTokens int) *Client {
 	}
 }
 
+// WithModel returns a copy of the client that uses a different model and
+// token limit. Tools use it for secondary calls (extraction, summaries)
+// that can run on a smaller model than the conversation.
+func (c *Client) WithModel(modelID string, maxTokens int) *Client {
+	clone := *c
+	if modelID != "" {
+		clone.modelID = modelID
+	}
+	if maxTokens > 0 {
+		clone.maxTokens = maxTokens
+	}
+	return &clone
+}
+
 // Call sends a request to the Claude API with the given messages and tools
 func (c *Client) Call(systemPrompt string, messages []Message, tools []Tool) (*Response, error) {
 	reqBody := Request{
@@ -28,7 +28,8 @@ type Request struct {
 	Tools        []Tool        `json:"tools,omitempty"`
 }
 
-// ImageSource represents the source of an image in a content block
+// ImageSource represents the source of an image or document in a content
+// block
 type ImageSource struct {
 	Type      string `json:"type"`                // "base64" or "url"
 	MediaType string `json:"media_type"`          // "image/jpeg", "image/png", "image/webp", "image/gif"
@@ -46,7 +47,8 @@ type ContentBlock struct {
 	Content   interface{}            `json:"content,omitempty"`
 	ToolUseID string                 `json:"tool_use_id,omitempty"`
 	IsError   bool                   `json:"is_error,omitempty"`
-	Source    *ImageSource           `json:"source,omitempty"`  // For type="image"
+	Source    *ImageSource           `json:"source,omitempty"`  // For type="image" and type="document"
+	Title     string                 `json:"title,omitempty"`   // For type="document"
 }
 
 // Usage represents token usage information in a response
@@ -1,14 +1,21 @@
 module github.com/this-is-alpha-iota/clyde
 
-go 1.24.0
+go 1.25.0
 
 require (
 	github.com/JohannesKaufmann/html-to-markdown v1.6.0
+	github.com/PuerkitoBio/goquery v1.9.2
+	github.com/google/pprof v0.0.0-20260115054156-294ebfa9ad83
 	github.com/joho/godotenv v1.5.1
+	github.com/ledongthuc/pdf v0.0.0-20250511090121-5959a4027728
+	golang.org/x/image v0.25.0
+	golang.org/x/net v0.53.0
+	golang.org/x/tools v0.44.0
 )
 
 require (
-	github.com/PuerkitoBio/goquery v1.9.2 // indirect
 	github.com/andybalholm/cascadia v1.3.2 // indirect
-	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/mod v0.35.0 // indirect
+	golang.org/x/sync v0.20.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
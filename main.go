@@ -5,14 +5,18 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/this-is-alpha-iota/clyde/agent"
 	"github.com/this-is-alpha-iota/clyde/api"
 	"github.com/this-is-alpha-iota/clyde/config"
 	"github.com/this-is-alpha-iota/clyde/prompts"
-	_ "github.com/this-is-alpha-iota/clyde/tools" // Import tools to register them
+	"github.com/this-is-alpha-iota/clyde/tools" // Also registers all tools
 )
 
 func main() {
@@ -87,9 +91,11 @@ func runCLIMode(args []string, hasStdinInput bool) {
 			fmt.Fprintln(os.Stderr, msg) // Print progress to stderr
 		}),
 	)
+	closeOnSignal(agentInstance)
 
 	// Execute prompt
 	response, err := agentInstance.HandleMessage(prompt)
+	agentInstance.Close()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -123,13 +129,24 @@ func runREPLMode() {
 			fmt.Println(msg) // REPL prints progress to stdout
 		}),
 	)
+	defer agentInstance.Close()
+	closeOnSignal(agentInstance)
 
 	// Start REPL
-	fmt.Println("Clyde - AI Coding Agent - Type 'exit' or 'quit' to exit")
+	fmt.Println("Clyde - AI Coding Agent - Type 'exit' or 'quit' to exit, '/ps' to list background processes")
+	fmt.Println("'/checkpoints' lists file checkpoints, '/undo' reverts the last turn's edits, '/rewind N' goes back further")
 	fmt.Println("==========================================================")
 
 	reader := bufio.NewReader(os.Stdin)
 
+	// Operations that can lose work ask before going ahead
+	tools.SetApprover(func(question string) bool {
+		fmt.Printf("\n⚠️  %s [y/N]: ", question)
+		answer, _ := reader.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	})
+
 	for {
 		fmt.Print("\nYou: ")
 		input, err := reader.ReadString('\n')
@@ -152,11 +169,136 @@ func runREPLMode() {
 			break
 		}
 
+		if input == "/ps" {
+			printProcesses()
+			continue
+		}
+
+		if input == "/checkpoints" {
+			printCheckpoints()
+			continue
+		}
+
+		if command, args, _ := strings.Cut(input, " "); command == "/undo" || command == "/rewind" {
+			rewindCheckpoint(agentInstance, command, strings.Fields(args))
+			continue
+		}
+
 		response, _ := agentInstance.HandleMessage(input)
 		fmt.Printf("\nClaude: %s\n", response)
 	}
 }
 
+// closeOnSignal stops background processes and the persistent shell when
+// Clyde is interrupted, so no children outlive it
+func closeOnSignal(a *agent.Agent) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		a.Close()
+		os.Exit(130)
+	}()
+}
+
+// printProcesses lists the agent's background processes
+func printProcesses() {
+	list := tools.ListProcesses()
+	if len(list) == 0 {
+		fmt.Println("No background processes")
+		return
+	}
+	for _, p := range list {
+		state := "running"
+		if !p.Running {
+			state = fmt.Sprintf("exited (%d)", p.ExitCode)
+		}
+		fmt.Printf("  %-4s pid %-7d %-12s %8s  %s\n", p.ID, p.PID, state, p.Uptime.Round(time.Second), p.Command)
+	}
+}
+
+// printCheckpoints lists this session's turns and the files each changed
+func printCheckpoints() {
+	list := tools.ListCheckpoints()
+	if len(list) == 0 {
+		fmt.Println("No checkpoints yet")
+		return
+	}
+	for _, c := range list {
+		prompt, _, _ := strings.Cut(c.Prompt, "\n")
+		if len(prompt) > 50 {
+			prompt = prompt[:47] + "..."
+		}
+		files := "no file changes"
+		if len(c.Files) > 0 {
+			var names []string
+			for _, f := range c.Files {
+				names = append(names, filepath.Base(f))
+			}
+			files = strings.Join(names, ", ")
+		}
+		fmt.Printf("  %3d  %s  %-50s  %s\n", c.Turn, c.Time.Format("15:04:05"), prompt, files)
+	}
+	fmt.Println("\n'/rewind N' restores files to before checkpoint N; add --history to also drop the conversation since then")
+}
+
+// rewindCheckpoint handles /undo and /rewind N, restoring the files the
+// agent changed and, with --history, the conversation
+func rewindCheckpoint(a *agent.Agent, command string, args []string) {
+	turn, history := 0, false
+	for _, arg := range args {
+		if arg == "--history" {
+			history = true
+		} else if n, err := strconv.Atoi(arg); err == nil && command == "/rewind" {
+			turn = n
+		} else {
+			fmt.Println("Usage: /undo [--history] or /rewind N [--history] (see /checkpoints)")
+			return
+		}
+	}
+	if command == "/undo" {
+		if turn = tools.LastChangedTurn(); turn == 0 {
+			fmt.Println("Nothing to undo: no files have been changed in this session")
+			return
+		}
+	} else if turn == 0 {
+		fmt.Println("Usage: /rewind N [--history] (see /checkpoints)")
+		return
+	}
+
+	result, err := tools.RewindCheckpoint(turn)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, f := range result.Restored {
+		fmt.Printf("  ↩ restored %s\n", f)
+	}
+	for _, f := range result.Deleted {
+		fmt.Printf("  ✗ deleted %s (created by the agent)\n", f)
+	}
+	for _, f := range result.Failed {
+		fmt.Printf("  ⚠️ could not restore %s\n", f)
+	}
+	if result.Saved == 0 {
+		fmt.Printf("No files were changed from checkpoint %d on\n", turn)
+	} else {
+		fmt.Printf("Files are back to before checkpoint %d. The replaced versions are in checkpoint %d ('/rewind %d' brings them back)\n", turn, result.Saved, result.Saved)
+	}
+
+	switch {
+	case !history:
+		if result.Saved > 0 {
+			fmt.Println("The conversation still remembers those edits; tell Clyde, or use --history to drop them from the conversation too")
+		}
+	case result.History < 0:
+		fmt.Printf("Checkpoint %d was saved by a rewind, so the conversation was left as it is\n", turn)
+	default:
+		a.RewindHistory(result.History)
+		fmt.Printf("Conversation rewound to before checkpoint %d\n", turn)
+	}
+}
+
 // readPromptFromFile reads a prompt from a file
 func readPromptFromFile(path string) (string, error) {
 	content, err := os.ReadFile(path)
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/api"
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+func TestAutoCommit(t *testing.T) {
+	useTempWorkspace(t)
+	dir, git := gitRepo(t)
+	t.Chdir(dir)
+	t.Setenv("CLYDE_EDIT_CHECK", "false")
+	t.Setenv("CLYDE_AUTO_COMMIT", "true")
+	tools.Shutdown()
+	defer tools.Shutdown()
+
+	// The user's own work in progress
+	os.WriteFile("notes.txt", []byte("first\nsecond\nuser edit\n"), 0644)
+	os.WriteFile("todo.txt", []byte("user's list\n"), 0644)
+	os.WriteFile("staged.txt", []byte("staged by the user\n"), 0644)
+	git("add", "staged.txt")
+
+	call := func(id, name string, input map[string]interface{}) api.ContentBlock {
+		return api.ContentBlock{Type: "tool_use", ID: id, Name: name, Input: input}
+	}
+	script := map[string][]api.ContentBlock{
+		"add a greeting": {
+			call("t1", "write_file", map[string]interface{}{"path": "greet/greet.go", "content": "package greet\n\nfunc Hello() string { return \"hello\" }\n"}),
+			call("t2", "patch_file", map[string]interface{}{"path": "main.go", "old_text": "println(\"hi\")", "new_text": "println(\"hello\")"}),
+			call("t3", "patch_file", map[string]interface{}{"path": "notes.txt", "old_text": "user edit", "new_text": "user edit, agent edit"}),
+			call("t4", "run_bash", map[string]interface{}{"command": "echo generated > gen.txt"}),
+		},
+		"just explain": nil,
+		"tweak it": {
+			call("t5", "patch_file", map[string]interface{}{"path": "main.go", "old_text": "hello", "new_text": "hello there"}),
+		},
+	}
+	var mu sync.Mutex
+	var progress []string
+	var duringTurn func() // runs while a tool call is shown, standing in for the user's editor
+	newAgent := func(secondary ...string) (*agent.Agent, func()) {
+		model := scriptedModel(t, script, secondary...)
+		a := agent.NewAgent(api.NewClient("test-key", model.URL, "test-model", 1024), "system",
+			agent.WithProgressCallback(func(msg string) {
+				mu.Lock()
+				defer mu.Unlock()
+				progress = append(progress, msg)
+				if duringTurn != nil && strings.HasPrefix(msg, "→") {
+					duringTurn()
+				}
+			}))
+		return a, model.Close
+	}
+	lastProgress := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return progress[len(progress)-1]
+	}
+	committedFiles := func(ref string) []string {
+		files := strings.Fields(git("show", "--name-only", "--format=", ref))
+		sort.Strings(files)
+		return files
+	}
+
+	t.Run("commits only the turn's files", func(t *testing.T) {
+		a, stop := newAgent("```\nfeat(greet): add a greeting package\n\nMain now says hello.\n```")
+		defer stop()
+		if _, err := a.HandleMessage("add a greeting"); err != nil {
+			t.Fatal(err)
+		}
+		hash := strings.TrimSpace(git("rev-parse", "--short", "HEAD"))
+		msg := lastProgress()
+		for _, want := range []string{
+			"📝 Auto-committed " + hash + " on main: feat(greet): add a greeting package (3 files)",
+			"Including changes from shell commands: gen.txt",
+			"Not committed, since they had uncommitted changes before the turn: notes.txt",
+		} {
+			if !strings.Contains(msg, want) {
+				t.Errorf("expected %q in %q", want, msg)
+			}
+		}
+		if got := git("log", "-1", "--format=%B"); got != "feat(greet): add a greeting package\n\nMain now says hello.\n\n" {
+			t.Errorf("unexpected commit message %q", got)
+		}
+		if files := committedFiles("HEAD"); strings.Join(files, " ") != "gen.txt greet/greet.go main.go" {
+			t.Errorf("unexpected committed files: %v", files)
+		}
+		status := git("status", "--porcelain")
+		for _, want := range []string{" M notes.txt", "A  staged.txt", "?? todo.txt"} {
+			if !strings.Contains(status, want) {
+				t.Errorf("expected %q to stay as the user left it:\n%s", want, status)
+			}
+		}
+	})
+
+	t.Run("turns without changes make no commit", func(t *testing.T) {
+		a, stop := newAgent("feat: nothing")
+		defer stop()
+		before := git("rev-parse", "HEAD")
+		if _, err := a.HandleMessage("just explain"); err != nil {
+			t.Fatal(err)
+		}
+		if git("rev-parse", "HEAD") != before {
+			t.Errorf("expected no commit for a turn without changes")
+		}
+	})
+
+	t.Run("dedicated branch and fallback message", func(t *testing.T) {
+		tools.Shutdown()
+		t.Setenv("CLYDE_AUTO_COMMIT_BRANCH", "clyde/session")
+		main := git("rev-parse", "main")
+		a, stop := newAgent("Tweaked the greeting")
+		defer stop()
+		mu.Lock()
+		duringTurn = func() { os.WriteFile("editor.txt", []byte("saved in an editor\n"), 0644) }
+		mu.Unlock()
+		if _, err := a.HandleMessage("tweak it"); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		duringTurn = nil
+		mu.Unlock()
+		if branch := strings.TrimSpace(git("branch", "--show-current")); branch != "clyde/session" {
+			t.Errorf("expected to be on the dedicated branch, got %s", branch)
+		}
+		if git("rev-parse", "main") != main {
+			t.Errorf("expected main to be left alone")
+		}
+		if got := git("log", "-1", "--format=%s"); got != "chore: Tweaked the greeting\n" {
+			t.Errorf("expected a non-conventional reply to be prefixed, got %q", got)
+		}
+		if !strings.Contains(lastProgress(), "on clyde/session: chore: Tweaked the greeting (1 file)") {
+			t.Errorf("unexpected progress: %q", lastProgress())
+		}
+		if files := committedFiles("HEAD"); strings.Join(files, " ") != "main.go" {
+			t.Errorf("expected only the agent's edit to be committed, got %v", files)
+		}
+		if !strings.Contains(lastProgress(), "Not committed, since the agent didn't change them: editor.txt") {
+			t.Errorf("expected the editor's change to be reported, got %q", lastProgress())
+		}
+		mu.Lock()
+		joined := strings.Join(progress, "\n")
+		mu.Unlock()
+		if !strings.Contains(joined, "🌿 Auto-commit: switched from main to branch clyde/session") {
+			t.Errorf("expected the branch switch to be reported:\n%s", joined)
+		}
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		t.Setenv("CLYDE_AUTO_COMMIT", "")
+		if tools.BeginAutoCommit("anything") != nil {
+			t.Errorf("expected auto-commit to be off unless enabled")
+		}
+		t.Setenv("CLYDE_AUTO_COMMIT", "true")
+		t.Chdir(t.TempDir())
+		if tools.BeginAutoCommit("anything") != nil {
+			t.Errorf("expected auto-commit to be off outside a repository")
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// benchRepo commits a module with a cheap benchmark, then makes Sum much
+// slower and allocating in the working tree
+func benchRepo(t *testing.T) string {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/bench\n\ngo 1.21\n")
+	write("sum/sum.go", "package sum\n\nfunc Sum(n int) int {\n\ttotal := 0\n\tfor i := 0; i < n; i++ {\n\t\ttotal += i\n\t}\n\treturn total\n}\n")
+	write("sum/sum_test.go", `package sum
+
+import "testing"
+
+var sink int
+
+func BenchmarkSum(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		sink = Sum(100)
+	}
+}
+
+func BenchmarkConst(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		sink = i
+	}
+}
+`)
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	write("sum/sum.go", "package sum\n\nfunc Sum(n int) int {\n\tvalues := make([]int, n*1000)\n\ttotal := 0\n\tfor i := range values {\n\t\ttotal += i\n\t}\n\treturn total\n}\n")
+	return dir
+}
+
+func TestBench(t *testing.T) {
+	useTempWorkspace(t)
+	dir := benchRepo(t)
+
+	t.Run("compare with a ref", func(t *testing.T) {
+		result, err := executeTool("bench", map[string]interface{}{"dir": filepath.Join(dir, "sum"), "base": "HEAD", "benchtime": "200x"})
+		if err != nil {
+			t.Fatalf("bench failed: %v", err)
+		}
+		for _, want := range []string{"Comparing HEAD (", "→ working tree, 6 runs each", "ns/op", "allocs/op", "0 ± 0%", "+1 (p=0.00", "allocs/op 1 more, 1 unchanged", "geomean", "Raw results:", "benchstat old.txt new.txt"} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %q in:\n%s", want, result)
+			}
+		}
+		// Sum does a thousand times the work, so the slowdown is
+		// significant however noisy the machine. Ties between runs move p
+		// off its exact minimum, and Const is too fast to compare reliably.
+		for _, line := range strings.Split(result, "\n") {
+			if strings.HasPrefix(line, "Sum") && strings.Contains(line, "µs") && !regexp.MustCompile(`%\)? \(p=0\.00\d n=6\)`).MatchString(line) {
+				t.Errorf("expected a significant change for Sum: %s", line)
+			}
+		}
+		if !regexp.MustCompile(`Summary: ns/op[^;]* slower`).MatchString(result) {
+			t.Errorf("expected the slowdown in the summary:\n%s", result)
+		}
+
+		out, _ := exec.Command("git", "-C", dir, "worktree", "list").Output()
+		if n := len(strings.Split(strings.TrimSpace(string(out)), "\n")); n != 1 {
+			t.Errorf("expected the temporary worktree to be removed, got:\n%s", out)
+		}
+	})
+
+	t.Run("working tree only", func(t *testing.T) {
+		result, err := executeTool("bench", map[string]interface{}{"dir": dir, "packages": []interface{}{"./sum"}, "bench": "Const", "count": float64(3), "benchtime": "100x"})
+		if err != nil {
+			t.Fatalf("bench failed: %v", err)
+		}
+		for _, want := range []string{"Benchmarks on the working tree, 3 runs each", "Const", "± ∞", "at least 6 runs"} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %q in:\n%s", want, result)
+			}
+		}
+		if strings.Contains(result, "Sum") {
+			t.Errorf("expected only the selected benchmark:\n%s", result)
+		}
+
+		// The raw output is readable without widening the workspace, and
+		// removed when the session ends
+		t.Setenv("CLYDE_WORKSPACE_ROOTS", dir)
+		_, raw, ok := strings.Cut(result, "Raw results: ")
+		if !ok {
+			t.Fatalf("expected the raw results path in:\n%s", result)
+		}
+		raw, _, _ = strings.Cut(raw, "\n")
+		if out, err := executeReadFile(raw); err != nil || !strings.Contains(out, "BenchmarkConst") {
+			t.Errorf("expected read_file to open %s, got: %s (%v)", raw, out, err)
+		}
+		tools.Shutdown()
+		if _, err := os.Stat(raw); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed at shutdown, got: %v", raw, err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := executeTool("bench", map[string]interface{}{"dir": dir, "packages": []interface{}{"./sum"}, "base": "no-such-branch"}); err == nil || !strings.Contains(err.Error(), "unknown git ref") {
+			t.Errorf("expected an unknown ref error, got: %v", err)
+		}
+		if _, err := executeTool("bench", map[string]interface{}{"dir": dir, "packages": []interface{}{"./sum"}, "bench": "Nothing", "benchtime": "1x"}); err == nil || !strings.Contains(err.Error(), "no benchmarks matched") {
+			t.Errorf("expected no matches, got: %v", err)
+		}
+		if _, err := executeTool("bench", map[string]interface{}{"dir": dir, "benchtime": "forever"}); err == nil || !strings.Contains(err.Error(), "benchtime") {
+			t.Errorf("expected a benchtime error, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// minimalPDF builds a valid single-font PDF with one text line per page
+func minimalPDF(pages ...string) []byte {
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+	for i, text := range pages {
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func TestBrowseContentTypes(t *testing.T) {
+	const issues = `{"total": 3, "items": [
+		{"number": 1, "title": "Crash on start", "state": "open", "labels": ["bug"]},
+		{"number": 2, "title": "Add dark mode", "state": "closed", "labels": []},
+		{"number": 3, "title": "Typo in docs", "state": "open", "labels": ["docs"]}]}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/issues":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(issues))
+		case "/raw/main.go":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte("package main\n\n// <b>not html</b>\nfunc main() {}\n"))
+		case "/rss":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel>
+				<title>Project Blog</title><description>News and releases</description>
+				<item><title>Release 1.2</title><link>/blog/1.2</link><pubDate>Mon, 02 Sep 2024 10:00:00 GMT</pubDate>
+					<description><![CDATA[<p>Faster <b>builds</b> and fewer bugs.</p>]]></description></item>
+				<item><title>Release 1.1</title><link>https://example.com/blog/1.1</link></item>
+			</channel></rss>`))
+		case "/atom":
+			w.Header().Set("Content-Type", "application/atom+xml")
+			w.Write([]byte(`<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom">
+				<title>Changelog</title>
+				<entry><title>v2 shipped</title><link rel="alternate" href="https://example.com/v2"/>
+					<updated>2024-09-01T00:00:00Z</updated><summary>Breaking changes ahead.</summary></entry>
+			</feed>`))
+		case "/paper.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write(minimalPDF("Abstract of the paper", "Conclusion section"))
+		case "/download":
+			// Generic type: browse has to sniff
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte(`[{"id": 1}]`))
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0x00, 0x01, 0x02, 0xff, 0xfe})
+		}
+	}))
+	defer server.Close()
+
+	t.Run("JSON is pretty-printed in original key order", func(t *testing.T) {
+		output, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/issues"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "(JSON)") {
+			t.Errorf("Expected JSON label, got: %s", output)
+		}
+		if !strings.Contains(output, "{\n  \"total\": 3,\n  \"items\": [") {
+			t.Errorf("Expected indented JSON with total before items, got: %s", output)
+		}
+	})
+
+	t.Run("JSON filter", func(t *testing.T) {
+		output, err := executeTool("browse", map[string]interface{}{
+			"url":    server.URL + "/issues",
+			"filter": `.items[] | select(.state == "open") | .title`,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "\"Crash on start\"\n\"Typo in docs\"") || strings.Contains(output, "dark mode") {
+			t.Errorf("Expected only open titles, got: %s", output)
+		}
+
+		output, err = executeTool("browse", map[string]interface{}{"url": server.URL + "/issues", "filter": ".items | length"})
+		if err != nil || !strings.Contains(output, "\n3") {
+			t.Errorf("Expected length 3, got: %s (%v)", output, err)
+		}
+
+		output, err = executeTool("browse", map[string]interface{}{"url": server.URL + "/issues", "filter": ".items[-1].labels[0]"})
+		if err != nil || !strings.Contains(output, `"docs"`) {
+			t.Errorf("Expected negative index, got: %s (%v)", output, err)
+		}
+
+		_, err = executeTool("browse", map[string]interface{}{"url": server.URL + "/issues", "filter": ".total[]"})
+		if err == nil || !strings.Contains(err.Error(), "cannot iterate over number") {
+			t.Errorf("Expected type error, got: %v", err)
+		}
+
+		_, err = executeTool("browse", map[string]interface{}{"url": server.URL + "/raw/main.go", "filter": ".x"})
+		if err == nil || !strings.Contains(err.Error(), "only applies to JSON") {
+			t.Errorf("Expected filter rejection for text, got: %v", err)
+		}
+	})
+
+	t.Run("Plain text passes through", func(t *testing.T) {
+		output, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/raw/main.go"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "// <b>not html</b>\nfunc main() {}") {
+			t.Errorf("Expected text unchanged, got: %s", output)
+		}
+	})
+
+	t.Run("RSS feed becomes a followable item list", func(t *testing.T) {
+		output, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/rss"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, want := range []string{
+			"# Project Blog",
+			"1. **Release 1.2 [1]**",
+			"Mon, 02 Sep 2024",
+			"Faster builds and fewer bugs.",
+			"2. **Release 1.1 [2]**",
+			"[1] " + server.URL + "/blog/1.2",
+		} {
+			if !strings.Contains(output, want) {
+				t.Errorf("Expected %q in feed output, got: %s", want, output)
+			}
+		}
+	})
+
+	t.Run("Atom feed", func(t *testing.T) {
+		output, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/atom"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "**v2 shipped [1]**") || !strings.Contains(output, "Breaking changes ahead.") {
+			t.Errorf("Expected Atom entry, got: %s", output)
+		}
+	})
+
+	t.Run("Feed item cap", func(t *testing.T) {
+		t.Setenv("CLYDE_BROWSE_MAX_FEED_ITEMS", "1")
+		output, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/rss"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if strings.Contains(output, "Release 1.1") || !strings.Contains(output, "1 more items omitted") {
+			t.Errorf("Expected feed to be capped, got: %s", output)
+		}
+	})
+
+	t.Run("PDF text is extracted per page", func(t *testing.T) {
+		output, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/paper.pdf"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "## Page 1\n\nAbstract of the paper") || !strings.Contains(output, "## Page 2\n\nConclusion section") {
+			t.Errorf("Expected text of both pages, got: %s", output)
+		}
+
+		t.Setenv("CLYDE_BROWSE_MAX_PDF_PAGES", "1")
+		output, err = executeTool("browse", map[string]interface{}{"url": server.URL + "/paper.pdf"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if strings.Contains(output, "Conclusion") || !strings.Contains(output, "Stopped after 1 of 2 pages") {
+			t.Errorf("Expected page cap, got: %s", output)
+		}
+	})
+
+	t.Run("Generic content type is sniffed", func(t *testing.T) {
+		output, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/download"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "(JSON)") || !strings.Contains(output, "\"id\": 1") {
+			t.Errorf("Expected sniffed JSON, got: %s", output)
+		}
+
+		_, err = executeTool("browse", map[string]interface{}{"url": server.URL + "/binary"})
+		if err == nil || !strings.Contains(err.Error(), "unsupported content type") {
+			t.Errorf("Expected binary to be rejected, got: %v", err)
+		}
+	})
+}
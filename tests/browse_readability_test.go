@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const articlePage = `<!DOCTYPE html>
+<html>
+<head><title>Widget Guide</title></head>
+<body>
+	<header class="site-header"><a href="/">Home</a> <a href="/login">Log in</a></header>
+	<nav><a href="/docs">Docs</a> <a href="/blog">Blog</a></nav>
+	<div class="cookie-banner">We use cookies to improve your experience. Accept all?</div>
+	<div id="content">
+		<h1>Configuring widgets</h1>
+		<p>Widgets are configured through a single file, which is read at startup, validated, and then applied to every running instance.</p>
+		<p>See the <a href="/docs/reference#options">option reference</a> for every setting, or the <a href="https://example.com/faq">FAQ</a> for common problems, pitfalls and workarounds.</p>
+		<p>Jump to <a href="#top">the top</a> or run <a href="javascript:void(0)">the demo</a>.</p>
+	</div>
+	<footer>Copyright 2024 Widget Corp. <a href="/privacy">Privacy</a></footer>
+</body>
+</html>`
+
+func TestBrowseReadability(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/docs/reference":
+			w.Write([]byte(`<html><head><title>Option Reference</title></head><body><p>All options.</p></body></html>`))
+		case "/long":
+			var b strings.Builder
+			b.WriteString("<html><head><title>Long</title></head><body><main>")
+			for i := 1; i <= 200; i++ {
+				fmt.Fprintf(&b, "<p>Paragraph %d explains one more detail of the system in a full sentence.</p>", i)
+			}
+			b.WriteString("</main></body></html>")
+			w.Write([]byte(b.String()))
+		case "/tie":
+			// Two sections that score the same
+			var b strings.Builder
+			b.WriteString("<html><head><title>Tie</title></head><body>")
+			for _, section := range []string{"alpha", "bravo"} {
+				fmt.Fprintf(&b, "<div class=%q>", section)
+				for i := 1; i <= 3; i++ {
+					fmt.Fprintf(&b, "<p>Section %s paragraph %d describes its part of the system in one plain sentence of text.</p>", section, i)
+				}
+				b.WriteString("</div>")
+			}
+			b.WriteString("</body></html>")
+			w.Write([]byte(b.String()))
+		default:
+			w.Write([]byte(articlePage))
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Boilerplate is stripped", func(t *testing.T) {
+		output, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/guide"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(output, "# Widget Guide\n") {
+			t.Errorf("Expected title header, got: %s", output)
+		}
+		if !strings.Contains(output, "configured through a single file") {
+			t.Errorf("Expected main content, got: %s", output)
+		}
+		for _, chrome := range []string{"cookies", "Copyright", "Log in", "Blog"} {
+			if strings.Contains(output, chrome) {
+				t.Errorf("Expected %q to be stripped, got: %s", chrome, output)
+			}
+		}
+	})
+
+	t.Run("Ties are resolved the same way every time", func(t *testing.T) {
+		first, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/tie"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 20; i++ {
+			if output, _ := executeTool("browse", map[string]interface{}{"url": server.URL + "/tie"}); output != first {
+				t.Fatalf("Expected the same extraction on every run, got:\n%s\nthen:\n%s", first, output)
+			}
+		}
+	})
+
+	t.Run("Full page keeps everything", func(t *testing.T) {
+		output, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/guide", "full_page": true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "Copyright") || !strings.Contains(output, "cookies") {
+			t.Errorf("Expected page chrome with full_page, got: %s", output)
+		}
+	})
+
+	t.Run("Links are numbered and followable", func(t *testing.T) {
+		output, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/guide"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "option reference [1]") || !strings.Contains(output, "FAQ [2]") {
+			t.Errorf("Expected inline link markers, got: %s", output)
+		}
+		if !strings.Contains(output, "[1] "+server.URL+"/docs/reference\n") {
+			t.Errorf("Expected resolved link without fragment, got: %s", output)
+		}
+		if strings.Contains(output, "javascript:") || strings.Contains(output, "#top") {
+			t.Errorf("Expected javascript and in-page links to be skipped, got: %s", output)
+		}
+
+		followed, err := executeTool("browse", map[string]interface{}{"link": float64(1)})
+		if err != nil {
+			t.Fatalf("Unexpected error following link: %v", err)
+		}
+		if !strings.Contains(followed, "# Option Reference") {
+			t.Errorf("Expected to land on the reference page, got: %s", followed)
+		}
+
+		_, err = executeTool("browse", map[string]interface{}{"url": server.URL + "/guide", "link": float64(99)})
+		if err == nil || !strings.Contains(err.Error(), "link 99 does not exist") {
+			t.Errorf("Expected out of range error, got: %v", err)
+		}
+	})
+
+	t.Run("Long pages are paginated", func(t *testing.T) {
+		first, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/long", "max_length": float64(4)})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(first, "Paragraph 1 ") || strings.Contains(first, "Paragraph 200") {
+			t.Errorf("Expected only the first chunk, got: %s", first)
+		}
+		if !strings.Contains(first, "[Page 1 of ") || !strings.Contains(first, "use page=2 to continue") {
+			t.Errorf("Expected page footer, got: %s", first)
+		}
+
+		second, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/long", "max_length": float64(4), "page": float64(2)})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if strings.Contains(second, "Paragraph 1 ") || !strings.Contains(second, "[Page 2 of ") {
+			t.Errorf("Expected the second chunk, got: %s", second)
+		}
+
+		fromOffset, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/long", "max_length": float64(4), "offset": float64(100)})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(fromOffset, "characters 100-") {
+			t.Errorf("Expected offset footer, got: %s", fromOffset)
+		}
+
+		_, err = executeTool("browse", map[string]interface{}{"url": server.URL + "/long", "page": float64(50)})
+		if err == nil || !strings.Contains(err.Error(), "page 50 does not exist") {
+			t.Errorf("Expected page out of range error, got: %v", err)
+		}
+	})
+}
+
+func TestBrowseTables(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><main>
+			<table>
+				<caption>Supported platforms</caption>
+				<thead><tr><th>OS</th><th colspan="2">Architectures</th></tr></thead>
+				<tbody>
+					<tr><td rowspan="2">Linux</td><td>amd64</td><td>arm64</td></tr>
+					<tr><td>riscv64</td><td>a|b</td></tr>
+					<tr><td>Windows</td><td>amd64<br>386</td><td></td></tr>
+				</tbody>
+			</table>
+			<table><tr><td>Layout cell one</td></tr><tr><td>Layout cell two</td></tr></table>
+		</main></body></html>`))
+	}))
+	defer server.Close()
+
+	output, err := executeTool("browse", map[string]interface{}{"url": server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		"*Supported platforms*",
+		"| OS | Architectures |  |",
+		"| --- | --- | --- |",
+		"| Linux | amd64 | arm64 |",
+		"| Linux | riscv64 | a\\|b |",
+		"| Windows | amd64<br>386 |  |",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in table output, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "| Layout cell") {
+		t.Errorf("Expected single-column table to render as text, got:\n%s", output)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/api"
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+func TestCheckpoints(t *testing.T) {
+	useTempWorkspace(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("CLYDE_CHECKPOINTS", "true")
+	t.Setenv("CLYDE_CHECKPOINT_DIR", filepath.Join(dir, ".checkpoints"))
+	t.Setenv("CLYDE_EDIT_CHECK", "false")
+	tools.Shutdown()
+	defer tools.Shutdown()
+
+	os.WriteFile("config.txt", []byte("mode=safe\n"), 0600)
+	os.WriteFile("notes.txt", []byte("original notes\n"), 0644)
+	read := func(name string) string {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+	call := func(id, name string, input map[string]interface{}) api.ContentBlock {
+		return api.ContentBlock{Type: "tool_use", ID: id, Name: name, Input: input}
+	}
+	model := scriptedModel(t, map[string][]api.ContentBlock{
+		"add a feature": {
+			call("t1", "write_file", map[string]interface{}{"path": "feature.go", "content": "package feature\n"}),
+			call("t2", "patch_file", map[string]interface{}{"path": "config.txt", "old_text": "mode=safe", "new_text": "mode=fast"}),
+		},
+		"looks good, thanks": nil,
+		"refactor it": {
+			call("t3", "multi_patch", map[string]interface{}{"patches": []interface{}{
+				map[string]interface{}{"path": "config.txt", "old_text": "mode=fast", "new_text": "mode=broken"},
+				map[string]interface{}{"path": "feature.go", "old_text": "package feature", "new_text": "package feature // refactored"},
+			}}),
+			call("t4", "write_file", map[string]interface{}{"path": "notes.txt", "content": "rewritten notes\n"}),
+			call("t5", "write_file", map[string]interface{}{"path": "sub/extra.go", "content": "package sub\n"}),
+		},
+	})
+	defer model.Close()
+	a := agent.NewAgent(api.NewClient("test-key", model.URL, "test-model", 1024), "system")
+	for _, prompt := range []string{"add a feature", "looks good, thanks", "refactor it"} {
+		if _, err := a.HandleMessage(prompt); err != nil {
+			t.Fatalf("%s: %v", prompt, err)
+		}
+	}
+	if read("config.txt") != "mode=broken\n" || read("notes.txt") != "rewritten notes\n" || read("sub/extra.go") != "package sub\n" {
+		t.Fatalf("the scripted edits did not happen")
+	}
+
+	t.Run("list", func(t *testing.T) {
+		list := tools.ListCheckpoints()
+		if len(list) != 3 {
+			t.Fatalf("expected one checkpoint per turn, got %+v", list)
+		}
+		if list[0].Prompt != "add a feature" || list[0].History != 0 || len(list[0].Files) != 2 {
+			t.Errorf("unexpected first checkpoint: %+v", list[0])
+		}
+		if len(list[1].Files) != 0 || list[1].History != 4 {
+			t.Errorf("expected the second turn to change nothing: %+v", list[1])
+		}
+		if len(list[2].Files) != 4 || !strings.HasSuffix(list[2].Files[2], "notes.txt") {
+			t.Errorf("expected each file once in the third checkpoint: %+v", list[2].Files)
+		}
+		if tools.LastChangedTurn() != 3 {
+			t.Errorf("expected turn 3 to be the last one changing files, got %d", tools.LastChangedTurn())
+		}
+		matches, _ := filepath.Glob(filepath.Join(dir, ".checkpoints", "*", "003", "checkpoint.json"))
+		if len(matches) != 1 {
+			t.Errorf("expected the third checkpoint on disk, got %v", matches)
+		}
+	})
+
+	t.Run("undo the last turn", func(t *testing.T) {
+		result, err := tools.RewindCheckpoint(tools.LastChangedTurn())
+		if err != nil {
+			t.Fatalf("rewind failed: %v", err)
+		}
+		if read("config.txt") != "mode=fast\n" || read("feature.go") != "package feature\n" || read("notes.txt") != "original notes\n" {
+			t.Errorf("expected the files as they were after the first turn")
+		}
+		if _, err := os.Stat("sub/extra.go"); !os.IsNotExist(err) {
+			t.Errorf("expected the file created in turn 3 to be deleted")
+		}
+		if info, _ := os.Stat("config.txt"); info.Mode().Perm() != 0600 {
+			t.Errorf("expected the file mode to be kept, got %v", info.Mode())
+		}
+		if len(result.Restored) != 3 || len(result.Deleted) != 1 || result.Deleted[0] != "sub/extra.go" || result.Saved != 4 || result.History != 6 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("rewind the rewind", func(t *testing.T) {
+		if _, err := tools.RewindCheckpoint(4); err != nil {
+			t.Fatalf("rewind failed: %v", err)
+		}
+		if read("config.txt") != "mode=broken\n" || read("sub/extra.go") != "package sub\n" {
+			t.Errorf("expected rewinding to the rewind's checkpoint to bring turn 3's edits back")
+		}
+	})
+
+	t.Run("rewind to the start with history", func(t *testing.T) {
+		result, err := tools.RewindCheckpoint(1)
+		if err != nil {
+			t.Fatalf("rewind failed: %v", err)
+		}
+		if read("config.txt") != "mode=safe\n" || read("notes.txt") != "original notes\n" {
+			t.Errorf("expected the original files back")
+		}
+		for _, name := range []string{"feature.go", "sub/extra.go"} {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("expected %s to be deleted", name)
+			}
+		}
+		if len(a.GetHistory()) != 10 {
+			t.Fatalf("expected 10 messages before rewinding the history, got %d", len(a.GetHistory()))
+		}
+		a.RewindHistory(result.History)
+		if len(a.GetHistory()) != 0 {
+			t.Errorf("expected the conversation to be empty, got %d messages", len(a.GetHistory()))
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := tools.RewindCheckpoint(42); err == nil || !strings.Contains(err.Error(), "no checkpoint 42") {
+			t.Errorf("expected an unknown checkpoint to be refused, got %v", err)
+		}
+		tools.Shutdown()
+		if _, err := tools.RewindCheckpoint(1); err == nil || !strings.Contains(err.Error(), "no checkpoints yet") {
+			t.Errorf("expected a new session to start empty, got %v", err)
+		}
+
+		// Disabled checkpoints record nothing
+		t.Setenv("CLYDE_CHECKPOINTS", "false")
+		tools.BeginCheckpoint("ignored", 0)
+		if len(tools.ListCheckpoints()) != 0 {
+			t.Errorf("expected no checkpoints when disabled")
+		}
+	})
+}
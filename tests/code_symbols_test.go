@@ -0,0 +1,191 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// shapesModule writes a small module: an interface with two
+// implementations (one with a pointer receiver), an embedded type, a
+// function calling through the interface and a second package using it
+func shapesModule(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/shapes\n\ngo 1.21\n",
+		"shapes/shapes.go": `// Package shapes measures things.
+package shapes
+
+// Shape is anything with an area.
+type Shape interface {
+	Area() float64
+}
+
+// Square is a square.
+type Square struct {
+	Side float64
+}
+
+// Area returns the side squared.
+func (s Square) Area() float64 { return s.Side * s.Side }
+
+// Circle is a circle.
+type Circle struct {
+	R float64
+}
+
+// Area returns πr².
+func (c *Circle) Area() float64 { return 3.14159 * c.R * c.R }
+
+// Named adds a name to a Square.
+type Named struct {
+	Square
+	Name string
+}
+
+// Label returns the name.
+func (n Named) Label() string { return n.Name }
+
+// Total sums the areas of shapes.
+func Total(shapes []Shape) float64 {
+	sum := 0.0
+	for _, s := range shapes {
+		sum += s.Area()
+	}
+	return sum
+}
+
+func helper() float64 {
+	return Total(nil)
+}
+`,
+		"report/report.go": `package report
+
+import (
+	"fmt"
+
+	"example.com/shapes/shapes"
+)
+
+// Print reports the total area.
+func Print() {
+	fmt.Println(shapes.Total([]shapes.Shape{shapes.Square{Side: 2}, &shapes.Circle{R: 1}}))
+}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCodeSymbols(t *testing.T) {
+	useTempWorkspace(t)
+	dir := shapesModule(t)
+	// Locations are shown relative to the working directory
+	t.Chdir(dir)
+	run := func(t *testing.T, input map[string]interface{}) string {
+		t.Helper()
+		input["dir"] = dir
+		result, err := executeTool("code_symbols", input)
+		if err != nil {
+			t.Fatalf("code_symbols failed: %v", err)
+		}
+		return result
+	}
+	expect := func(t *testing.T, result string, want ...string) {
+		t.Helper()
+		for _, w := range want {
+			if !strings.Contains(result, w) {
+				t.Errorf("expected %q in:\n%s", w, result)
+			}
+		}
+	}
+
+	t.Run("definition", func(t *testing.T) {
+		result := run(t, map[string]interface{}{"action": "definition", "symbol": "Total"})
+		expect(t, result, "shapes.Total (func)", "shapes/shapes.go:35", "func Total(shapes []Shape) float64", "Total sums the areas of shapes.")
+		if strings.Contains(result, "sum +=") {
+			t.Errorf("expected the body to be left out:\n%s", result)
+		}
+
+		result = run(t, map[string]interface{}{"action": "definition", "symbol": "Circle.Area"})
+		expect(t, result, "(*shapes.Circle).Area (method)", "func (c *Circle) Area() float64", "Area returns πr².")
+	})
+
+	t.Run("ambiguous symbol", func(t *testing.T) {
+		_, err := executeTool("code_symbols", map[string]interface{}{"action": "references", "symbol": "Area", "dir": dir})
+		if err == nil || !strings.Contains(err.Error(), "ambiguous") || !strings.Contains(err.Error(), "shapes.Square.Area") {
+			t.Errorf("expected an ambiguity error listing candidates, got: %v", err)
+		}
+	})
+
+	t.Run("references", func(t *testing.T) {
+		result := run(t, map[string]interface{}{"action": "references", "symbol": "shapes.Total"})
+		expect(t, result, "report/report.go:11", "shapes/shapes.go:44", "2 uses in 2 files")
+	})
+
+	t.Run("position lookup", func(t *testing.T) {
+		result := run(t, map[string]interface{}{"action": "definition", "symbol": "Area", "file": filepath.Join(dir, "shapes", "shapes.go"), "line": float64(38)})
+		expect(t, result, "shapes.Shape.Area (method)", "shapes/shapes.go:6")
+	})
+
+	t.Run("implementations", func(t *testing.T) {
+		result := run(t, map[string]interface{}{"action": "implementations", "symbol": "Shape"})
+		expect(t, result, "Implementations of shapes.Shape", "shapes.Square", "shapes.Named", "shapes.Circle", "pointer receiver: *Circle")
+
+		result = run(t, map[string]interface{}{"action": "implementations", "symbol": "Square"})
+		expect(t, result, "shapes.Shape")
+	})
+
+	t.Run("methods", func(t *testing.T) {
+		result := run(t, map[string]interface{}{"action": "methods", "symbol": "Named"})
+		expect(t, result, "2 methods", "Area() float64  (promoted from Square)", "Label() string", "Label returns the name.")
+
+		result = run(t, map[string]interface{}{"action": "methods", "symbol": "Circle"})
+		expect(t, result, "Area() float64  (pointer receiver)")
+	})
+
+	t.Run("outline", func(t *testing.T) {
+		result := run(t, map[string]interface{}{"action": "outline", "symbol": "shapes"})
+		expect(t, result, `package shapes // import "example.com/shapes/shapes"`, "Package shapes measures things.", "func Total(shapes []Shape) float64  // shapes/shapes.go:35", "func (n Named) Label() string")
+		if strings.Contains(result, "helper") {
+			t.Errorf("expected unexported functions to be left out:\n%s", result)
+		}
+		result = run(t, map[string]interface{}{"action": "outline", "symbol": "shapes", "all": true})
+		expect(t, result, "func helper() float64")
+	})
+
+	t.Run("callgraph", func(t *testing.T) {
+		result := run(t, map[string]interface{}{"action": "callgraph", "symbol": "Total"})
+		expect(t, result, "Callers:\n  report.Print  report/report.go:11", "shapes.helper  shapes/shapes.go:44", "Callees:\n  shapes.Shape.Area  shapes/shapes.go:38  (dynamic)")
+
+		// Calls through the interface count as callers of the method
+		result = run(t, map[string]interface{}{"action": "callgraph", "symbol": "Square.Area", "direction": "callers", "depth": float64(2)})
+		expect(t, result, "shapes.Total  shapes/shapes.go:38  (via shapes.Shape.Area)", "    report.Print  report/report.go:11")
+	})
+
+	t.Run("edits are picked up", func(t *testing.T) {
+		path := filepath.Join(dir, "shapes", "extra.go")
+		os.WriteFile(path, []byte("package shapes\n\n// Triangle is new.\ntype Triangle struct{}\n\nfunc (Triangle) Area() float64 { return 0 }\n"), 0644)
+		result := run(t, map[string]interface{}{"action": "implementations", "symbol": "Shape"})
+		expect(t, result, "shapes.Triangle")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := executeTool("code_symbols", map[string]interface{}{"action": "definition", "symbol": "Nope", "dir": dir}); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("expected not found, got: %v", err)
+		}
+		if _, err := executeTool("code_symbols", map[string]interface{}{"action": "methods", "symbol": "Total", "dir": dir}); err == nil || !strings.Contains(err.Error(), "needs a type") {
+			t.Errorf("expected a kind error, got: %v", err)
+		}
+		if _, err := executeTool("code_symbols", map[string]interface{}{"action": "outline", "symbol": "missing", "dir": dir}); err == nil || !strings.Contains(err.Error(), "example.com/shapes/shapes") {
+			t.Errorf("expected the loaded packages to be listed, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// docsSite serves a small documentation site: an index linking to two
+// pages, a page two levels deeper, a section robots.txt disallows, a
+// redirect into that section, a noindex guide index and pages outside the
+// /docs/ prefix
+func docsSite(t *testing.T) (*httptest.Server, *sync.Map) {
+	requested := &sync.Map{}
+	page := func(title, body string) string {
+		return fmt.Sprintf(`<html><head><title>%s</title></head><body>
+<nav><a href="/docs/">Home</a> <a href="/docs/a">Retries</a> <a href="/docs/b">Timeouts</a> <a href="/docs/private/x">Private</a> <a href="/blog/post">Blog</a> <a href="/docs/logo.png">Logo</a></nav>
+<main><h1>%s</h1>%s</main></body></html>`, title, title, body)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested.Store(r.URL.Path, r.Header.Get("User-Agent"))
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "User-agent: *\nDisallow: /docs/private\n")
+		case "/docs/":
+			fmt.Fprint(w, page("Overview", "<p>Welcome to the client library documentation.</p>"))
+		case "/docs/a":
+			fmt.Fprint(w, page("Retries", `<p>Requests are retried with exponential backoff.</p><h2>Configuring backoff</h2><p>Set the backoff multiplier and the maximum number of retry attempts. See <a href="/docs/a/deep">advanced retry settings</a>.</p>`))
+		case "/docs/b":
+			fmt.Fprint(w, page("Timeouts", `<p>Every call has a 30 second timeout by default. <a href="/docs/moved">Old limits</a>.</p>`))
+		case "/docs/moved":
+			http.Redirect(w, r, "/docs/private/limits", http.StatusMovedPermanently)
+		case "/docs/private/limits":
+			fmt.Fprint(w, page("Internal limits", "<p>Not for crawlers.</p>"))
+		case "/docs/a/deep":
+			fmt.Fprint(w, page("Advanced retries", `<p>Jitter spreads retries out. <a href="/docs/a/deep/deeper">Even more</a>.</p>`))
+		case "/docs/guide/":
+			fmt.Fprint(w, `<html><head><title>Guide</title><meta name="robots" content="noindex, follow"></head><body>
+<ul><li><a href="/docs/guide/setup">Setup</a></li></ul></body></html>`)
+		case "/docs/guide/setup":
+			fmt.Fprint(w, page("Setup", "<p>Install the client and set an API key.</p>"))
+		case "/docs/a/deep/deeper":
+			fmt.Fprint(w, page("Deeper", "<p>Too deep to reach with max_depth 2.</p>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server, requested
+}
+
+func TestCrawl(t *testing.T) {
+	server, requested := docsSite(t)
+	defer server.Close()
+	docs := t.TempDir()
+	t.Setenv("CLYDE_DOCS_DIR", docs)
+	t.Setenv("CLYDE_CRAWL_DELAY_MS", "0")
+
+	t.Run("scope, depth and robots.txt", func(t *testing.T) {
+		result, err := executeTool("crawl", map[string]interface{}{"url": server.URL + "/docs/", "name": "client", "max_depth": float64(2)})
+		if err != nil {
+			t.Fatalf("crawl failed: %v", err)
+		}
+		if !strings.Contains(result, "Crawled 4 pages") {
+			t.Errorf("expected 4 pages, got:\n%s", result)
+		}
+		if !strings.Contains(result, "2 blocked by robots.txt") || !strings.Contains(result, "raise max_depth") {
+			t.Errorf("expected robots and depth notes, got:\n%s", result)
+		}
+		for _, path := range []string{"/docs/private/x", "/blog/post", "/docs/logo.png", "/docs/a/deep/deeper"} {
+			if _, ok := requested.Load(path); ok {
+				t.Errorf("%s should not have been fetched", path)
+			}
+		}
+		if ua, _ := requested.Load("/docs/a"); !strings.Contains(fmt.Sprint(ua), "clyde-crawler") {
+			t.Errorf("expected crawler user agent, got %v", ua)
+		}
+
+		for _, file := range []string{"index.json", "docs/index.md", "docs/a.md", "docs/b.md", "docs/a/deep.md"} {
+			if _, err := os.Stat(filepath.Join(docs, "client", file)); err != nil {
+				t.Errorf("expected %s in the corpus: %v", file, err)
+			}
+		}
+		for _, file := range []string{"docs/moved.md", "docs/private/limits.md"} {
+			if _, err := os.Stat(filepath.Join(docs, "client", file)); err == nil {
+				t.Errorf("expected %s, reached through a redirect robots.txt disallows, to be left out", file)
+			}
+		}
+		stored, _ := os.ReadFile(filepath.Join(docs, "client", "docs", "a.md"))
+		if !strings.HasPrefix(string(stored), "# Retries\nURL: "+server.URL+"/docs/a\n") || strings.Contains(string(stored), "Blog") {
+			t.Errorf("expected the main content converted like browse, got:\n%s", stored)
+		}
+	})
+
+	t.Run("noindex pages are followed", func(t *testing.T) {
+		result, err := executeTool("crawl", map[string]interface{}{"url": server.URL + "/docs/guide/", "name": "guide"})
+		if err != nil {
+			t.Fatalf("crawl failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(docs, "guide", "docs", "guide", "setup.md")); err != nil {
+			t.Errorf("expected the page linked from the noindex index in the corpus: %v\n%s", err, result)
+		}
+		if _, err := os.Stat(filepath.Join(docs, "guide", "docs", "guide", "index.md")); err == nil {
+			t.Errorf("expected the noindex page itself to be left out")
+		}
+	})
+
+	t.Run("page limit", func(t *testing.T) {
+		result, err := executeTool("crawl", map[string]interface{}{"url": server.URL + "/docs/", "name": "small", "max_pages": float64(2)})
+		if err != nil {
+			t.Fatalf("crawl failed: %v", err)
+		}
+		if !strings.Contains(result, "Crawled 2 pages") || !strings.Contains(result, "raise max_pages") {
+			t.Errorf("expected the page limit to stop the crawl, got:\n%s", result)
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		result, err := executeTool("search_docs", map[string]interface{}{"query": "backoff multiplier", "name": "client"})
+		if err != nil {
+			t.Fatalf("search_docs failed: %v", err)
+		}
+		if !strings.Contains(result, "1. Retries › Configuring backoff\n   "+server.URL+"/docs/a\n   file: docs/a.md") {
+			t.Errorf("expected the backoff section first, got:\n%s", result)
+		}
+		if !strings.Contains(result, "multiplier") {
+			t.Errorf("expected an excerpt, got:\n%s", result)
+		}
+
+		result, err = executeTool("search_docs", map[string]interface{}{"query": "nonexistentword"})
+		if err != nil || !strings.Contains(result, "No matches") {
+			t.Errorf("expected no matches, got: %s (%v)", result, err)
+		}
+	})
+
+	t.Run("read page and follow link", func(t *testing.T) {
+		result, err := executeTool("search_docs", map[string]interface{}{"name": "client", "file": "docs/a.md"})
+		if err != nil {
+			t.Fatalf("search_docs failed: %v", err)
+		}
+		if !strings.Contains(result, "# Retries") || !strings.Contains(result, "advanced retry settings [1]") {
+			t.Errorf("expected the stored page, got:\n%s", result)
+		}
+		browsed, err := executeTool("browse", map[string]interface{}{"link": float64(1)})
+		if err != nil || !strings.Contains(browsed, "Jitter spreads retries out") {
+			t.Errorf("expected browse to follow the stored page's link, got: %s (%v)", browsed, err)
+		}
+
+		if _, err := executeTool("search_docs", map[string]interface{}{"name": "client", "file": "../small/index.json"}); err == nil {
+			t.Error("expected files outside the index to be refused")
+		}
+	})
+
+	t.Run("list and errors", func(t *testing.T) {
+		result, err := executeTool("search_docs", map[string]interface{}{})
+		if err != nil || !strings.Contains(result, "client: 4 pages") || !strings.Contains(result, "small: 2 pages") {
+			t.Errorf("expected corpus list, got: %s (%v)", result, err)
+		}
+		if _, err := executeTool("search_docs", map[string]interface{}{"name": "missing", "query": "x"}); err == nil || !strings.Contains(err.Error(), "Available: client, guide, small") {
+			t.Errorf("expected unknown corpus error, got: %v", err)
+		}
+		if _, err := executeTool("crawl", map[string]interface{}{"url": server.URL + "/docs/", "name": "../escape"}); err == nil || !strings.Contains(err.Error(), "invalid corpus name") {
+			t.Errorf("expected invalid name error, got: %v", err)
+		}
+		if _, err := executeTool("crawl", map[string]interface{}{"url": server.URL + "/nothing/"}); err == nil || !strings.Contains(err.Error(), "no pages could be crawled") {
+			t.Errorf("expected crawl failure, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEditChecks(t *testing.T) {
+	useTempWorkspace(t)
+	dir := t.TempDir()
+	// Findings are shown relative to the working directory
+	t.Chdir(dir)
+	os.WriteFile("go.mod", []byte("module example.com/edits\n\ngo 1.21\n"), 0644)
+	os.WriteFile("main.go", []byte("package main\n\nfunc main() {\n\tgreet()\n}\n"), 0644)
+	os.WriteFile("greet.go", []byte("package main\n\nimport \"fmt\"\n\nfunc greet() {\n\tfmt.Println(\"hi\")\n}\n"), 0644)
+
+	expect := func(t *testing.T, result string, want ...string) {
+		t.Helper()
+		for _, w := range want {
+			if !strings.Contains(result, w) {
+				t.Errorf("expected %q in:\n%s", w, result)
+			}
+		}
+	}
+
+	t.Run("new problems are reported", func(t *testing.T) {
+		result, err := executePatchFile("main.go", "\tgreet()\n", "\tgreet()\n\tmissing()\n")
+		if err != nil {
+			t.Fatalf("patch failed: %v", err)
+		}
+		expect(t, result, "Successfully patched main.go", "⚠️ Post-edit checks found 1 new problem:", "main.go:5:2: undefined: missing  (go vet)")
+	})
+
+	t.Run("fixes are acknowledged", func(t *testing.T) {
+		result, err := executePatchFile("main.go", "\tmissing()\n", "")
+		if err != nil {
+			t.Fatalf("patch failed: %v", err)
+		}
+		expect(t, result, "✓ No new problems from gofmt -l, go vet (fixed 1)")
+	})
+
+	t.Run("existing problems are not repeated", func(t *testing.T) {
+		executeWriteFile("greet.go", "package main\n\nfunc greet() {\n\tundefinedHelper()\n}\n")
+		// A later edit moves the existing problem down a line
+		result, err := executePatchFile("greet.go", "package main\n", "package main\n\n// greet says hello.\n")
+		if err != nil {
+			t.Fatalf("patch failed: %v", err)
+		}
+		expect(t, result, "✓ No new problems from gofmt -l, go vet (1 problem from before the edit still reported)")
+		if strings.Contains(result, "undefinedHelper") {
+			t.Errorf("expected the existing problem to be left out:\n%s", result)
+		}
+		executeWriteFile("greet.go", "package main\n\nfunc greet() {}\n")
+	})
+
+	t.Run("problems in other files of the package", func(t *testing.T) {
+		result, err := executeMultiPatch([]interface{}{
+			map[string]interface{}{"path": "greet.go", "old_text": "func greet()", "new_text": "func welcome()"},
+		})
+		if err != nil {
+			t.Fatalf("multi_patch failed: %v", err)
+		}
+		expect(t, result, "main.go:4:2: undefined: greet  (go vet)")
+		executeMultiPatch([]interface{}{
+			map[string]interface{}{"path": "greet.go", "old_text": "func welcome()", "new_text": "func greet()"},
+		})
+	})
+
+	t.Run("formatting", func(t *testing.T) {
+		result, _ := executeWriteFile("greet.go", "package main\n\nfunc greet()   {}\n")
+		expect(t, result, "greet.go: needs formatting  (gofmt -l)")
+
+		t.Setenv("CLYDE_EDIT_FORMAT", "true")
+		result, _ = executeWriteFile("greet.go", "package main\n\nfunc greet()   {\n}\n")
+		expect(t, result, "✓ Formatted greet.go", "fixed 1")
+		if data, _ := os.ReadFile("greet.go"); string(data) != "package main\n\nfunc greet() {\n}\n" {
+			t.Errorf("expected the file to be formatted, got %q", data)
+		}
+	})
+
+	t.Run("configured checks", func(t *testing.T) {
+		os.WriteFile("check.sh", []byte("grep -n TODO \"$1\" | sed \"s|^|$1:|; s|:TODO.*|: leftover TODO|\"\n"), 0755)
+		t.Setenv("CLYDE_EDIT_CHECKS", "txt,md=sh check.sh {file};go=off")
+		result, _ := executeWriteFile("notes.txt", "one\nTODO two\n")
+		expect(t, result, "notes.txt:2: leftover TODO  (sh check.sh)")
+
+		result, _ = executePatchFile("main.go", "\tgreet()\n", "\tgreet()\n\tmissing()\n")
+		if strings.Contains(result, "Post-edit") {
+			t.Errorf("expected go=off to disable the Go checks:\n%s", result)
+		}
+		executePatchFile("main.go", "\tmissing()\n", "")
+
+		t.Setenv("CLYDE_EDIT_CHECKS", "txt=definitely-not-a-linter {file}")
+		result, _ = executeWriteFile(filepath.Join(dir, "other.txt"), "x\n")
+		expect(t, result, "ℹ️ definitely-not-a-linter could not run:", "command not found")
+
+		t.Setenv("CLYDE_EDIT_CHECK", "false")
+		result, _ = executeWriteFile("notes.txt", "TODO\n")
+		if strings.Contains(result, "\n\n") {
+			t.Errorf("expected no checks with CLYDE_EDIT_CHECK=false:\n%s", result)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+func executeIncludeFileURL(url string) (string, error) {
+	reg, _ := tools.GetTool("include_file")
+	return reg.Execute(map[string]interface{}{"path": url}, nil, nil)
+}
+
+// TestEgressPolicy tests the SSRF protections shared by browse and include_file
+func TestEgressPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<h1>Internal admin</h1>"))
+	}))
+	defer server.Close()
+
+	t.Run("Loopback is blocked by default", func(t *testing.T) {
+		t.Setenv("CLYDE_FETCH_ALLOW_PRIVATE", "false")
+		_, err := executeBrowse(server.URL, "", 500, "", nil)
+		if err == nil || !strings.Contains(err.Error(), "loopback address") {
+			t.Errorf("Expected loopback block, got: %v", err)
+		}
+	})
+
+	t.Run("Cloud metadata address is blocked", func(t *testing.T) {
+		t.Setenv("CLYDE_FETCH_ALLOW_PRIVATE", "false")
+		_, err := executeBrowse("http://169.254.169.254/latest/meta-data/", "", 500, "", nil)
+		if err == nil || !strings.Contains(err.Error(), "link-local") {
+			t.Errorf("Expected link-local block, got: %v", err)
+		}
+		_, err = executeIncludeFileURL("http://169.254.169.254/image.png")
+		if err == nil || !strings.Contains(err.Error(), "blocked by egress policy") {
+			t.Errorf("Expected include_file to be blocked too, got: %v", err)
+		}
+	})
+
+	t.Run("Hostnames are checked after DNS resolution", func(t *testing.T) {
+		t.Setenv("CLYDE_FETCH_ALLOW_PRIVATE", "false")
+		url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+		_, err := executeBrowse(url, "", 500, "", nil)
+		if err == nil || !strings.Contains(err.Error(), "blocked by egress policy") {
+			t.Errorf("Expected localhost to be blocked after resolution, got: %v", err)
+		}
+	})
+
+	t.Run("Redirects are re-checked", func(t *testing.T) {
+		t.Setenv("CLYDE_FETCH_DENY_DOMAINS", "localhost")
+		target := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+		redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target, http.StatusFound)
+		}))
+		defer redirect.Close()
+
+		_, err := executeBrowse(redirect.URL, "", 500, "", nil)
+		if err == nil || !strings.Contains(err.Error(), "deny rule 'localhost'") {
+			t.Errorf("Expected redirect to denied host to be blocked, got: %v", err)
+		}
+	})
+
+	t.Run("Allow list restricts domains", func(t *testing.T) {
+		t.Setenv("CLYDE_FETCH_ALLOW_DOMAINS", "example.com,*.golang.org")
+		_, err := executeBrowse(server.URL, "", 500, "", nil)
+		if err == nil || !strings.Contains(err.Error(), "not in CLYDE_FETCH_ALLOW_DOMAINS") {
+			t.Errorf("Expected allow list block, got: %v", err)
+		}
+	})
+
+	t.Run("Image downloads are size capped", func(t *testing.T) {
+		t.Setenv("CLYDE_FETCH_MAX_IMAGE_MB", "1")
+		big := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			// Stream without Content-Length so only the read limit can stop it
+			w.(http.Flusher).Flush()
+			w.Write(bytes.Repeat([]byte{0}, 2*1024*1024))
+		}))
+		defer big.Close()
+
+		_, err := executeIncludeFileURL(big.URL + "/huge.png")
+		if err == nil || !strings.Contains(err.Error(), "exceeded 1 MB") {
+			t.Errorf("Expected size cap error, got: %v", err)
+		}
+	})
+
+	t.Run("Every fetch is logged", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "fetch.log")
+		t.Setenv("CLYDE_FETCH_LOG", logPath)
+
+		if _, err := executeBrowse(server.URL, "", 500, "", nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		t.Setenv("CLYDE_FETCH_ALLOW_PRIVATE", "false")
+		executeBrowse(server.URL, "", 500, "", nil)
+
+		data, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatalf("Expected fetch log: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 log entries, got %d: %s", len(lines), data)
+		}
+
+		var ok, blocked map[string]interface{}
+		json.Unmarshal([]byte(lines[0]), &ok)
+		json.Unmarshal([]byte(lines[1]), &blocked)
+		if ok["tool"] != "browse" || ok["status"] != float64(200) || ok["bytes"] == nil {
+			t.Errorf("Unexpected success entry: %s", lines[0])
+		}
+		if blocked["blocked"] == nil {
+			t.Errorf("Expected blocked entry, got: %s", lines[1])
+		}
+	})
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// gitRepo creates a repository with two commits and returns a helper that
+// runs git in it
+func gitRepo(t *testing.T) (string, func(args ...string) string) {
+	dir := t.TempDir()
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	git("init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("first\n"), 0644)
+	git("add", ".")
+	git("commit", "-q", "-m", "Initial commit")
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("first\nsecond\n"), 0644)
+	git("commit", "-q", "-am", "Add second note")
+	return dir, git
+}
+
+func TestGit(t *testing.T) {
+	useTempWorkspace(t)
+	dir, git := gitRepo(t)
+	t.Chdir(dir)
+	expect := func(t *testing.T, result string, want ...string) {
+		t.Helper()
+		for _, w := range want {
+			if !strings.Contains(result, w) {
+				t.Errorf("expected %q in:\n%s", w, result)
+			}
+		}
+	}
+	var questions []string
+	approve := func(answer bool) {
+		tools.SetApprover(func(q string) bool {
+			questions = append(questions, q)
+			return answer
+		})
+	}
+	defer tools.SetApprover(nil)
+
+	t.Run("status", func(t *testing.T) {
+		os.WriteFile("main.go", []byte("package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n"), 0644)
+		os.WriteFile("new.go", []byte("package main\n"), 0644)
+		os.WriteFile("scratch.txt", []byte("x\n"), 0644)
+		git("add", "new.go")
+		git("mv", "notes.txt", "NOTES.txt")
+
+		result, err := executeTool("git", map[string]interface{}{"action": "status"})
+		if err != nil {
+			t.Fatalf("status failed: %v", err)
+		}
+		var status struct {
+			Branch    string
+			Commit    string
+			Clean     bool
+			Staged    []struct{ Path, From, Status string }
+			Unstaged  []struct{ Path, Status string }
+			Untracked []string
+		}
+		if err := json.Unmarshal([]byte(result), &status); err != nil {
+			t.Fatalf("status is not JSON: %v\n%s", err, result)
+		}
+		if status.Branch != "main" || status.Clean || len(status.Commit) != 7 {
+			t.Errorf("unexpected branch state: %+v", status)
+		}
+		expect(t, result, `"path": "NOTES.txt"`, `"from": "notes.txt"`, `"status": "renamed"`, `"status": "added"`, `"untracked": [`, `"scratch.txt"`)
+		if len(status.Unstaged) != 1 || status.Unstaged[0].Path != "main.go" || status.Unstaged[0].Status != "modified" {
+			t.Errorf("expected main.go modified in the working tree: %+v", status.Unstaged)
+		}
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		result, err := executeTool("git", map[string]interface{}{"action": "diff"})
+		if err != nil {
+			t.Fatalf("diff failed: %v", err)
+		}
+		expect(t, result, "Diff of unstaged changes:", "main.go | 2 +-", "-\tprintln(\"hi\")", "+\tprintln(\"hello\")")
+
+		result, _ = executeTool("git", map[string]interface{}{"action": "diff", "staged": true, "stat": true})
+		expect(t, result, "Diff of staged changes:", "new.go", "notes.txt => NOTES.txt")
+		if strings.Contains(result, "@@") {
+			t.Errorf("expected only a stat:\n%s", result)
+		}
+
+		result, _ = executeTool("git", map[string]interface{}{"action": "diff", "ref": "HEAD~1", "paths": []interface{}{"main.go"}})
+		expect(t, result, "Diff of working tree against HEAD~1 in main.go:", "+\tprintln(\"hello\")")
+
+		result, _ = executeTool("git", map[string]interface{}{"action": "diff", "paths": []interface{}{"new.go"}})
+		expect(t, result, "No differences: unstaged changes in new.go (staged changes are shown with staged=true)")
+	})
+
+	t.Run("log, blame and show", func(t *testing.T) {
+		result, err := executeTool("git", map[string]interface{}{"action": "log"})
+		if err != nil {
+			t.Fatalf("log failed: %v", err)
+		}
+		expect(t, result, "Test  Add second note (HEAD -> main)", "Test  Initial commit")
+
+		result, _ = executeTool("git", map[string]interface{}{"action": "log", "paths": []interface{}{"main.go"}})
+		if strings.Contains(result, "second note") {
+			t.Errorf("expected the path filter to leave out the second commit:\n%s", result)
+		}
+		result, _ = executeTool("git", map[string]interface{}{"action": "log", "grep": "SECOND"})
+		if !strings.Contains(result, "Add second note") || strings.Contains(result, "Initial") {
+			t.Errorf("expected grep to match only the second commit:\n%s", result)
+		}
+
+		result, err = executeTool("git", map[string]interface{}{"action": "blame", "file": "main.go", "start_line": float64(3), "end_line": float64(4)})
+		if err != nil {
+			t.Fatalf("blame failed: %v", err)
+		}
+		expect(t, result, "(Test ", " 3) func main() {", "Not Committed Yet", " 4) \tprintln(\"hello\")")
+		if strings.Contains(result, "package main") {
+			t.Errorf("expected only lines 3-4:\n%s", result)
+		}
+
+		result, err = executeTool("git", map[string]interface{}{"action": "show", "ref": "HEAD"})
+		if err != nil {
+			t.Fatalf("show failed: %v", err)
+		}
+		expect(t, result, "Add second note", "notes.txt | 1 +", "+second")
+	})
+
+	t.Run("stage and commit", func(t *testing.T) {
+		if _, err := executeTool("git", map[string]interface{}{"action": "unstage", "paths": []interface{}{"new.go"}}); err != nil {
+			t.Fatalf("unstage failed: %v", err)
+		}
+		result, err := executeTool("git", map[string]interface{}{"action": "stage", "paths": []interface{}{"main.go"}})
+		if err != nil {
+			t.Fatalf("stage failed: %v", err)
+		}
+		expect(t, result, "✓ Staged. 2 files ready to commit:", "modified: main.go", "renamed: notes.txt → NOTES.txt")
+		if strings.Contains(result, "new.go") {
+			t.Errorf("expected new.go to be unstaged:\n%s", result)
+		}
+
+		if _, err := executeTool("git", map[string]interface{}{"action": "commit", "message": "Say hello", "co_authors": []interface{}{"Ada"}}); err == nil || !strings.Contains(err.Error(), "Name <email@example.com>") {
+			t.Errorf("expected a malformed co-author to be refused, got %v", err)
+		}
+		t.Setenv("CLYDE_GIT_CO_AUTHORS", "Pair Partner <pair@example.com>")
+		result, err = executeTool("git", map[string]interface{}{"action": "commit", "message": "Say hello\n\nGreets more warmly."})
+		if err != nil {
+			t.Fatalf("commit failed: %v", err)
+		}
+		expect(t, result, "✓ Committed ", " Say hello on main", "Co-authored-by: Pair Partner <pair@example.com>", "2 files changed")
+		body := git("log", "-1", "--format=%B")
+		expect(t, body, "Say hello\n\nGreets more warmly.\n\nCo-authored-by: Pair Partner <pair@example.com>")
+		if status := git("status", "--porcelain"); !strings.Contains(status, "?? new.go") || !strings.Contains(status, "?? scratch.txt") {
+			t.Errorf("expected the unstaged files to stay out of the commit:\n%s", status)
+		}
+
+		if _, err := executeTool("git", map[string]interface{}{"action": "commit", "message": "Again"}); err == nil || !strings.Contains(err.Error(), "nothing is staged") {
+			t.Errorf("expected an empty commit to be refused, got %v", err)
+		}
+	})
+
+	t.Run("branches", func(t *testing.T) {
+		result, err := executeTool("git", map[string]interface{}{"action": "switch", "name": "feature", "create": true})
+		if err != nil {
+			t.Fatalf("switch failed: %v", err)
+		}
+		expect(t, result, "✓ Switched to feature", "Say hello", "Uncommitted changes carried over: 0 staged, 0 unstaged, 2 untracked")
+		os.WriteFile("feature.txt", []byte("wip\n"), 0644)
+		git("add", "feature.txt")
+		git("commit", "-q", "-m", "Feature work")
+		if _, err := executeTool("git", map[string]interface{}{"action": "switch", "name": "main"}); err != nil {
+			t.Fatalf("switch failed: %v", err)
+		}
+		if _, err := executeTool("git", map[string]interface{}{"action": "branch", "name": "release", "ref": "HEAD~1"}); err != nil {
+			t.Fatalf("branch failed: %v", err)
+		}
+
+		result, err = executeTool("git", map[string]interface{}{"action": "branch"})
+		if err != nil {
+			t.Fatalf("branch list failed: %v", err)
+		}
+		expect(t, result, "* main", "  feature", "Feature work", "  release", "Add second note")
+
+		if _, err := executeTool("git", map[string]interface{}{"action": "branch", "name": "bad..name"}); err == nil || !strings.Contains(err.Error(), "not a valid branch name") {
+			t.Errorf("expected an invalid name to be refused, got %v", err)
+		}
+		if result, err := executeTool("git", map[string]interface{}{"action": "branch", "name": "release", "delete": true}); err != nil || !strings.Contains(result, "✓ Deleted branch release") {
+			t.Errorf("expected a merged branch to be deleted, got %s (%v)", result, err)
+		}
+
+		// Deleting an unmerged branch needs approval
+		tools.SetApprover(nil)
+		if _, err := executeTool("git", map[string]interface{}{"action": "branch", "name": "feature", "delete": true}); err == nil || !strings.Contains(err.Error(), "refused") || !strings.Contains(err.Error(), "Feature work") {
+			t.Errorf("expected deleting an unmerged branch to be refused, got %v", err)
+		}
+		questions = nil
+		approve(true)
+		result, err = executeTool("git", map[string]interface{}{"action": "branch", "name": "feature", "delete": true})
+		if err != nil || !strings.Contains(result, "✓ Deleted unmerged branch feature") {
+			t.Errorf("expected the approved delete to go ahead, got %s (%v)", result, err)
+		}
+		if len(questions) != 1 || !strings.Contains(questions[0], "Feature work") {
+			t.Errorf("expected the question to list the lost commits: %q", questions)
+		}
+	})
+
+	t.Run("discard needs approval", func(t *testing.T) {
+		os.WriteFile("main.go", []byte("package main\n\n// broken\n"), 0644)
+		questions = nil
+		approve(false)
+		if _, err := executeTool("git", map[string]interface{}{"action": "discard", "paths": []interface{}{"main.go"}}); err == nil || !strings.Contains(err.Error(), "refused") {
+			t.Errorf("expected a declined discard to be refused, got %v", err)
+		}
+		if data, _ := os.ReadFile("main.go"); !strings.Contains(string(data), "broken") {
+			t.Errorf("expected the change to survive a declined discard")
+		}
+		approve(true)
+		result, err := executeTool("git", map[string]interface{}{"action": "discard", "paths": []interface{}{"main.go"}})
+		if err != nil {
+			t.Fatalf("discard failed: %v", err)
+		}
+		expect(t, result, "✓ Discarded changes to main.go")
+		if data, _ := os.ReadFile("main.go"); strings.Contains(string(data), "broken") {
+			t.Errorf("expected the change to be discarded")
+		}
+		if len(questions) != 2 || !strings.Contains(questions[0], "main.go (1 file changed") {
+			t.Errorf("unexpected questions: %q", questions)
+		}
+	})
+
+	t.Run("amending a pushed commit", func(t *testing.T) {
+		remote := t.TempDir()
+		git("init", "-q", "--bare", remote)
+		git("remote", "add", "origin", remote)
+		git("push", "-q", "origin", "main")
+		git("fetch", "-q", "origin")
+		git("add", "new.go")
+		tools.SetApprover(nil)
+		if _, err := executeTool("git", map[string]interface{}{"action": "commit", "message": "Say hello", "amend": true}); err == nil || !strings.Contains(err.Error(), "already pushed") {
+			t.Errorf("expected amending a pushed commit to be refused, got %v", err)
+		}
+		result, err := executeTool("git", map[string]interface{}{"action": "commit", "message": "Add new.go", "co_authors": ""})
+		if err != nil || strings.Contains(result, "Co-authored-by") {
+			t.Fatalf("expected a commit without co-authors, got %s (%v)", result, err)
+		}
+		result, err = executeTool("git", map[string]interface{}{"action": "commit", "message": "Add new.go\n\nWith a body.", "amend": true, "co_authors": ""})
+		if err != nil || !strings.Contains(result, "✓ Amended ") {
+			t.Errorf("expected an unpushed commit to be amended, got %s (%v)", result, err)
+		}
+	})
+
+	t.Run("refusals", func(t *testing.T) {
+		tools.SetApprover(nil)
+		for _, action := range []string{"reset", "push"} {
+			if _, err := executeTool("git", map[string]interface{}{"action": action}); err == nil || !strings.Contains(err.Error(), "is not available") {
+				t.Errorf("expected %s to be refused, got %v", action, err)
+			}
+		}
+		if _, err := executeTool("git", map[string]interface{}{"action": "diff", "ref": "--output=/tmp/x"}); err == nil || !strings.Contains(err.Error(), "must not start with '-'") {
+			t.Errorf("expected an option-like ref to be refused, got %v", err)
+		}
+
+		bash, _ := tools.GetTool("run_bash")
+		for _, command := range []string{
+			"git reset --hard HEAD~1",
+			"cd . && git -C . push --force origin main",
+			"git push origin +main",
+			"git clean -fdx",
+			"git checkout -- main.go",
+			"git restore main.go",
+			"git branch -D feature",
+			"git stash drop",
+		} {
+			if _, err := bash.Execute(map[string]interface{}{"command": command}, nil, nil); err == nil || !strings.Contains(err.Error(), "refused") {
+				t.Errorf("expected run_bash to refuse %q, got %v", command, err)
+			}
+		}
+		process, _ := tools.GetTool("process")
+		if _, err := process.Execute(map[string]interface{}{"action": "start", "command": "git reset --hard"}, nil, nil); err == nil || !strings.Contains(err.Error(), "refused") {
+			t.Errorf("expected process to refuse starting a destructive git command, got %v", err)
+		}
+		started, err := process.Execute(map[string]interface{}{"action": "start", "command": "bash"}, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to start a shell: %v", err)
+		}
+		defer tools.Shutdown()
+		if _, err := process.Execute(map[string]interface{}{"action": "send_stdin", "id": strings.Fields(started)[2], "input": "git push --force\n"}, nil, nil); err == nil || !strings.Contains(err.Error(), "refused") {
+			t.Errorf("expected process to refuse typing a destructive git command into a shell, got %v", err)
+		}
+		for _, command := range []string{"git status --short", "git restore --staged new.go", "git log --oneline -1"} {
+			if _, err := bash.Execute(map[string]interface{}{"command": command}, nil, nil); err != nil {
+				t.Errorf("expected run_bash to allow %q, got %v", command, err)
+			}
+		}
+
+		outside := t.TempDir()
+		if _, err := executeTool("git", map[string]interface{}{"action": "status", "dir": outside}); err == nil {
+			t.Errorf("expected a directory outside any repository to fail")
+		}
+	})
+}
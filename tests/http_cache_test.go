@@ -0,0 +1,208 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// enableCache points the HTTP cache at a fresh directory and collects
+// progress messages
+func enableCache(t *testing.T) (dir string, progress func() []string) {
+	dir = t.TempDir()
+	t.Setenv("CLYDE_CACHE", "true")
+	t.Setenv("CLYDE_CACHE_DIR", dir)
+
+	var mu sync.Mutex
+	var messages []string
+	tools.SetProgressReporter(func(msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		messages = append(messages, msg)
+	})
+	t.Cleanup(func() { tools.SetProgressReporter(nil) })
+
+	return dir, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), messages...)
+	}
+}
+
+func TestHTTPCache(t *testing.T) {
+	var hits atomic.Int32
+	var lastIfNoneMatch atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		lastIfNoneMatch.Store(r.Header.Get("If-None-Match"))
+		w.Header().Set("Content-Type", "text/plain")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/fresh"):
+			w.Header().Set("Cache-Control", "max-age=300")
+		case r.URL.Path == "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case r.URL.Path == "/private":
+			w.Header().Set("Cache-Control", "no-store")
+		case strings.HasPrefix(r.URL.Path, "/big"):
+			w.Write([]byte(strings.Repeat("x", 250*1024)))
+			return
+		case r.URL.Path == "/huge":
+			w.Write([]byte(strings.Repeat("y\n", 1024*1024)))
+			return
+		}
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	browse := func(t *testing.T, path string, extra ...interface{}) string {
+		t.Helper()
+		input := map[string]interface{}{"url": server.URL + path}
+		for i := 0; i+1 < len(extra); i += 2 {
+			input[extra[i].(string)] = extra[i+1]
+		}
+		output, err := executeTool("browse", input)
+		if err != nil {
+			t.Fatalf("browse %s: %v", path, err)
+		}
+		return output
+	}
+
+	t.Run("Fresh responses are served from cache", func(t *testing.T) {
+		_, progress := enableCache(t)
+		hits.Store(0)
+		browse(t, "/fresh")
+		output := browse(t, "/fresh")
+		if hits.Load() != 1 {
+			t.Errorf("Expected 1 request, got %d", hits.Load())
+		}
+		if !strings.Contains(output, "content of /fresh") {
+			t.Errorf("Expected cached content, got: %s", output)
+		}
+		messages := progress()
+		if len(messages) != 1 || !strings.Contains(messages[0], "Cache hit: "+server.URL+"/fresh") {
+			t.Errorf("Expected one cache hit message, got: %v", messages)
+		}
+	})
+
+	t.Run("Refresh bypasses the cache", func(t *testing.T) {
+		enableCache(t)
+		hits.Store(0)
+		browse(t, "/fresh")
+		browse(t, "/fresh", "refresh", true)
+		browse(t, "/fresh")
+		if hits.Load() != 2 {
+			t.Errorf("Expected 2 requests, got %d", hits.Load())
+		}
+	})
+
+	t.Run("Stale entries are revalidated with ETag", func(t *testing.T) {
+		_, progress := enableCache(t)
+		hits.Store(0)
+		browse(t, "/etag")
+		output := browse(t, "/etag")
+		if hits.Load() != 2 {
+			t.Errorf("Expected a revalidation request, got %d requests", hits.Load())
+		}
+		if lastIfNoneMatch.Load() != `"v1"` {
+			t.Errorf("Expected If-None-Match, got %q", lastIfNoneMatch.Load())
+		}
+		if !strings.Contains(output, "content of /etag") {
+			t.Errorf("Expected cached body after 304, got: %s", output)
+		}
+		if messages := progress(); len(messages) != 1 || !strings.Contains(messages[0], "revalidated") {
+			t.Errorf("Expected revalidation message, got: %v", messages)
+		}
+	})
+
+	t.Run("no-store is respected", func(t *testing.T) {
+		dir, _ := enableCache(t)
+		hits.Store(0)
+		browse(t, "/private")
+		browse(t, "/private")
+		if hits.Load() != 2 {
+			t.Errorf("Expected 2 requests, got %d", hits.Load())
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("Expected nothing stored, found %d files", len(entries))
+		}
+	})
+
+	t.Run("TTL applies without freshness headers", func(t *testing.T) {
+		enableCache(t)
+		t.Setenv("CLYDE_CACHE_TTL_MINUTES", "0")
+		hits.Store(0)
+		browse(t, "/plain")
+		browse(t, "/plain")
+		if hits.Load() != 2 {
+			t.Errorf("Expected expired entries to be refetched, got %d requests", hits.Load())
+		}
+	})
+
+	t.Run("Truncated downloads are not cached", func(t *testing.T) {
+		enableCache(t)
+		t.Setenv("CLYDE_BROWSE_MAX_DOWNLOAD_MB", "1")
+		hits.Store(0)
+		browse(t, "/huge")
+		browse(t, "/huge")
+		if hits.Load() != 2 {
+			t.Errorf("Expected partial body to be refetched, got %d requests", hits.Load())
+		}
+	})
+
+	t.Run("Hits follow the current egress policy and are logged", func(t *testing.T) {
+		enableCache(t)
+		logPath := filepath.Join(t.TempDir(), "fetch.log")
+		t.Setenv("CLYDE_FETCH_LOG", logPath)
+		hits.Store(0)
+		browse(t, "/fresh-policy")
+		browse(t, "/fresh-policy")
+		log, _ := os.ReadFile(logPath)
+		lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+		if len(lines) != 2 || strings.Contains(lines[0], `"cached"`) || !strings.Contains(lines[1], `"cached":true`) || !strings.Contains(lines[1], `"remote_ip":"127.0.0.1"`) {
+			t.Errorf("Expected the hit in the fetch log, got:\n%s", log)
+		}
+
+		t.Setenv("CLYDE_FETCH_ALLOW_PRIVATE", "false")
+		output, err := executeTool("browse", map[string]interface{}{"url": server.URL + "/fresh-policy"})
+		if err == nil || !strings.Contains(err.Error(), "loopback") {
+			t.Errorf("Expected the cached loopback response to be refused, got %v: %s", err, output)
+		}
+		if hits.Load() != 1 {
+			t.Errorf("Expected no further requests, got %d", hits.Load())
+		}
+	})
+
+	t.Run("Least recently used entries are evicted", func(t *testing.T) {
+		enableCache(t)
+		t.Setenv("CLYDE_CACHE_MAX_MB", "1")
+		hits.Store(0)
+		for _, p := range []string{"/big1", "/big2", "/big3", "/big4"} {
+			browse(t, p)
+		}
+		browse(t, "/big1") // hit: big1 is now the most recently used
+		browse(t, "/big5") // pushes the cache over 1 MB
+		if hits.Load() != 5 {
+			t.Fatalf("Expected 5 requests so far, got %d", hits.Load())
+		}
+		browse(t, "/big1")
+		if hits.Load() != 5 {
+			t.Errorf("Expected recently used entry to survive, got %d requests", hits.Load())
+		}
+		browse(t, "/big2")
+		if hits.Load() != 6 {
+			t.Errorf("Expected least recently used entry to be evicted, got %d requests", hits.Load())
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseDocumentMarker decodes DOCUMENT_LOADED:<source>:<media>:<title>:<summary>:<data>
+func parseDocumentMarker(t *testing.T, output string) (source, mediaType, title, summary string, data []byte) {
+	t.Helper()
+	parts := strings.SplitN(output, ":", 6)
+	if len(parts) != 6 || parts[0] != "DOCUMENT_LOADED" {
+		t.Fatalf("expected a DOCUMENT_LOADED marker, got: %.80s", output)
+	}
+	decode := func(s string) []byte {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("invalid base64 in marker: %v", err)
+		}
+		return b
+	}
+	return parts[1], parts[2], string(decode(parts[3])), string(decode(parts[4])), decode(parts[5])
+}
+
+func TestIncludeDocuments(t *testing.T) {
+	useTempWorkspace(t)
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	pdfData := minimalPDF("Introduction", "Installation steps", "Configuration reference")
+
+	t.Run("PDF as document", func(t *testing.T) {
+		// A misleading extension doesn't matter; the content is sniffed
+		path := write("report.dat", pdfData)
+		output, err := executeTool("include_file", map[string]interface{}{"path": path})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		source, mediaType, _, summary, data := parseDocumentMarker(t, output)
+		if source != "base64" || mediaType != "application/pdf" || string(data) != string(pdfData) {
+			t.Errorf("expected the PDF as a base64 document, got %s %s", source, mediaType)
+		}
+		if !strings.Contains(summary, "3 pages") {
+			t.Errorf("expected page count in summary, got: %s", summary)
+		}
+	})
+
+	t.Run("PDF page range", func(t *testing.T) {
+		path := write("manual.pdf", pdfData)
+		output, err := executeTool("include_file", map[string]interface{}{"path": path, "pages": "2-3"})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		source, _, title, _, data := parseDocumentMarker(t, output)
+		text := string(data)
+		if source != "text" || !strings.Contains(text, "## Page 2\n\nInstallation steps") || !strings.Contains(text, "Configuration reference") || strings.Contains(text, "Introduction") {
+			t.Errorf("expected text of pages 2-3, got %s:\n%s", source, text)
+		}
+		if !strings.Contains(title, "pages 2-3 of 3") {
+			t.Errorf("expected page range in title, got: %s", title)
+		}
+
+		for _, bad := range []string{"4", "3-1", "x", "0"} {
+			if _, err := executeTool("include_file", map[string]interface{}{"path": path, "pages": bad}); err == nil {
+				t.Errorf("expected pages=%q to be rejected", bad)
+			}
+		}
+	})
+
+	t.Run("text file framing", func(t *testing.T) {
+		path := write("main.go", []byte("package main\n\n// Example:\n// ```\n// code\n// ```\nfunc main() {}\n"))
+		output, err := executeTool("include_file", map[string]interface{}{"path": path})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		if !strings.HasPrefix(output, "File: "+filepath.ToSlash(path)+" (Go · 7 lines · ") {
+			t.Errorf("expected header with language and line count, got:\n%s", output)
+		}
+		// The fence must be longer than the backticks inside the file
+		if !strings.Contains(output, "````go\npackage main") || !strings.HasSuffix(output, "func main() {}\n````") {
+			t.Errorf("expected a four-backtick go fence, got:\n%s", output)
+		}
+
+		if _, err := executeTool("include_file", map[string]interface{}{"path": path, "pages": "1"}); err == nil || !strings.Contains(err.Error(), "only applies to PDFs") {
+			t.Errorf("expected pages to be refused for text, got: %v", err)
+		}
+	})
+
+	t.Run("large text is truncated", func(t *testing.T) {
+		t.Setenv("CLYDE_INCLUDE_MAX_TEXT_KB", "1")
+		path := write("big.txt", []byte(strings.Repeat("line of text\n", 500)))
+		output, err := executeTool("include_file", map[string]interface{}{"path": path})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		if !strings.Contains(output, "[Showing the first 1.0 KB of 6.3 KB (CLYDE_INCLUDE_MAX_TEXT_KB)]") {
+			t.Errorf("expected truncation note, got:\n%s", output[len(output)-200:])
+		}
+	})
+
+	t.Run("directory bundle", func(t *testing.T) {
+		pkg := filepath.Join(dir, "pkg")
+		write("pkg/a.go", []byte("package pkg\n\nfunc A() {}\n"))
+		write("pkg/b.go", []byte("package pkg\n\nfunc B() {}\n"))
+		write("pkg/sub/c.go", []byte("package sub\n\n"+strings.Repeat("// filler\n", 200)))
+		write("pkg/sub/d.go", []byte("package sub\n\nfunc D() {}\n"))
+		write("pkg/README.md", []byte("# pkg\n"))
+		write("pkg/logo.go", []byte{0x89, 'P', 'N', 'G', 0, 0, 0, 0})
+		write("pkg/.git/config", []byte("[core]\n"))
+
+		output, err := executeTool("include_file", map[string]interface{}{"path": pkg, "glob": "*.go"})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		for _, want := range []string{"4 of 5 files", "File: " + filepath.ToSlash(pkg) + "/a.go (Go", "func B() {}", "File: " + filepath.ToSlash(pkg) + "/sub/c.go", "Skipped binary files (1): logo.go"} {
+			if !strings.Contains(output, want) {
+				t.Errorf("expected %q in bundle, got:\n%s", want, output)
+			}
+		}
+		if strings.Contains(output, "README") || strings.Contains(output, "[core]") {
+			t.Errorf("glob and hidden directories should be respected, got:\n%s", output)
+		}
+
+		output, err = executeTool("include_file", map[string]interface{}{"path": pkg, "glob": "*.go", "max_kb": float64(1)})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		if !strings.Contains(output, "3 of 5 files") || !strings.Contains(output, "Omitted over budget (1): sub/c.go") {
+			t.Errorf("expected budget to omit the large file, got:\n%s", output)
+		}
+		if !strings.Contains(output, "func D() {}") {
+			t.Errorf("expected the small file after the large one to be included, got:\n%s", output)
+		}
+
+		if _, err := executeTool("include_file", map[string]interface{}{"path": pkg, "glob": "*.rs"}); err == nil || !strings.Contains(err.Error(), "no files") {
+			t.Errorf("expected no-match error, got: %v", err)
+		}
+	})
+
+	t.Run("remote files are sniffed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			switch r.URL.Path {
+			case "/spec":
+				w.Write(pdfData)
+			case "/config.yaml":
+				w.Write([]byte("name: clyde\nversion: 2\n"))
+			}
+		}))
+		defer server.Close()
+
+		output, err := executeIncludeFileURL(server.URL + "/spec")
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		if source, mediaType, _, _, _ := parseDocumentMarker(t, output); source != "base64" || mediaType != "application/pdf" {
+			t.Errorf("expected a PDF document, got %s %s", source, mediaType)
+		}
+
+		output, err = executeIncludeFileURL(server.URL + "/config.yaml")
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		if !strings.HasPrefix(output, "File: config.yaml (YAML · 2 lines") || !strings.Contains(output, "```yaml\nname: clyde") {
+			t.Errorf("expected framed YAML, got:\n%s", output)
+		}
+	})
+}
@@ -13,6 +13,7 @@ import (
 
 // TestExecuteIncludeFile tests the include_file tool execution
 func TestExecuteIncludeFile(t *testing.T) {
+	useTempWorkspace(t)
 	// Create a temporary directory for test files
 	tmpDir := t.TempDir()
 
@@ -32,6 +33,11 @@ func TestExecuteIncludeFile(t *testing.T) {
 		t.Fatalf("Failed to create test image: %v", err)
 	}
 
+	binaryPath := filepath.Join(tmpDir, "data.bin")
+	if err := os.WriteFile(binaryPath, []byte{0x00, 0x01, 0x02, 0xff, 0xfe, 0x00}, 0644); err != nil {
+		t.Fatalf("Failed to create binary file: %v", err)
+	}
+
 	tests := []struct {
 		name        string
 		input       map[string]interface{}
@@ -58,10 +64,10 @@ func TestExecuteIncludeFile(t *testing.T) {
 			errContains: "not found",
 		},
 		{
-			name:        "unsupported file type",
-			input:       map[string]interface{}{"path": filepath.Join(tmpDir, "test.txt")},
+			name:        "unsupported binary file",
+			input:       map[string]interface{}{"path": binaryPath},
 			wantErr:     true,
-			errContains: "only image files are currently supported",
+			errContains: "is a binary file",
 		},
 		{
 			name:    "load valid PNG image",
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestPNG writes a w×h PNG. noisy fills it with random pixels so it
+// compresses badly, like a photo; alpha makes it partly transparent.
+func writeTestPNG(t *testing.T, path string, w, h int, noisy, alpha bool) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rng := rand.New(rand.NewSource(1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{uint8(x), uint8(y), 128, 255}
+			if noisy {
+				c = color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+			}
+			if alpha && x < w/2 {
+				c.A = 100
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// parseImageMarker splits IMAGE_LOADED:<media>:<details>:<data> and decodes
+// the image
+func parseImageMarker(t *testing.T, output string) (mediaType, details string, data []byte, img image.Image) {
+	t.Helper()
+	parts := strings.SplitN(output, ":", 4)
+	if len(parts) != 4 || parts[0] != "IMAGE_LOADED" {
+		t.Fatalf("expected an IMAGE_LOADED marker, got: %.80s", output)
+	}
+	data, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		t.Fatalf("invalid base64: %v", err)
+	}
+	img, _, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("sent image doesn't decode: %v", err)
+	}
+	return parts[1], parts[2], data, img
+}
+
+func TestIncludeImage(t *testing.T) {
+	useTempWorkspace(t)
+	dir := t.TempDir()
+
+	t.Run("large photo-like PNG is downscaled and sent as JPEG", func(t *testing.T) {
+		path := filepath.Join(dir, "photo.png")
+		original := writeTestPNG(t, path, 3000, 2000, true, false)
+
+		output, err := executeTool("include_file", map[string]interface{}{"path": path})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		mediaType, details, data, img := parseImageMarker(t, output)
+		if mediaType != "image/jpeg" {
+			t.Errorf("expected JPEG, got %s", mediaType)
+		}
+		if b := img.Bounds(); b.Dx() != 1568 || b.Dy() != 1045 {
+			t.Errorf("expected 1568×1045, got %d×%d", b.Dx(), b.Dy())
+		}
+		for _, want := range []string{"3000×2000 → 1568×1045", "downscaled", "re-encoded from png", "~2185 tokens"} {
+			if !strings.Contains(details, want) {
+				t.Errorf("expected %q in details, got: %s", want, details)
+			}
+		}
+		if len(data) >= len(original) {
+			t.Errorf("expected the sent image to be smaller than %d bytes, got %d", len(original), len(data))
+		}
+	})
+
+	t.Run("transparent PNG stays PNG", func(t *testing.T) {
+		path := filepath.Join(dir, "overlay.png")
+		writeTestPNG(t, path, 2000, 1000, true, true)
+
+		output, err := executeTool("include_file", map[string]interface{}{"path": path})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		mediaType, details, _, img := parseImageMarker(t, output)
+		if mediaType != "image/png" || strings.Contains(details, "re-encoded") {
+			t.Errorf("expected PNG to keep its alpha channel, got %s (%s)", mediaType, details)
+		}
+		if b := img.Bounds(); b.Dx() != 1568 || b.Dy() != 784 {
+			t.Errorf("expected 1568×784, got %d×%d", b.Dx(), b.Dy())
+		}
+	})
+
+	t.Run("small image is sent unchanged", func(t *testing.T) {
+		path := filepath.Join(dir, "icon.png")
+		original := writeTestPNG(t, path, 100, 50, false, false)
+
+		output, err := executeTool("include_file", map[string]interface{}{"path": path})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		mediaType, details, data, _ := parseImageMarker(t, output)
+		if mediaType != "image/png" || !bytes.Equal(data, original) {
+			t.Errorf("expected the original bytes, got %s with %d bytes", mediaType, len(data))
+		}
+		if !strings.Contains(details, "100×50 · ~7 tokens") || strings.Contains(details, "→") {
+			t.Errorf("unexpected details: %s", details)
+		}
+	})
+
+	t.Run("max_edge", func(t *testing.T) {
+		path := filepath.Join(dir, "wide.jpg")
+		img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+		var buf bytes.Buffer
+		jpeg.Encode(&buf, img, nil)
+		os.WriteFile(path, buf.Bytes(), 0644)
+
+		output, err := executeTool("include_file", map[string]interface{}{"path": path, "max_edge": float64(100)})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		mediaType, details, _, sent := parseImageMarker(t, output)
+		if mediaType != "image/jpeg" || sent.Bounds().Dx() != 100 || sent.Bounds().Dy() != 50 {
+			t.Errorf("expected a 100×50 JPEG, got %s %v", mediaType, sent.Bounds())
+		}
+		if !strings.Contains(details, "400×200 → 100×50") {
+			t.Errorf("unexpected details: %s", details)
+		}
+
+		if _, err := executeTool("include_file", map[string]interface{}{"path": path, "max_edge": float64(4)}); err == nil {
+			t.Error("expected a tiny max_edge to be refused")
+		}
+	})
+
+	t.Run("crop", func(t *testing.T) {
+		path := filepath.Join(dir, "screen.png")
+		writeTestPNG(t, path, 100, 50, false, false)
+
+		crop := map[string]interface{}{"x": float64(10), "y": float64(20), "width": float64(40), "height": float64(20)}
+		output, err := executeTool("include_file", map[string]interface{}{"path": path, "crop": crop})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		_, details, _, img := parseImageMarker(t, output)
+		if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 20 {
+			t.Errorf("expected 40×20, got %d×%d", b.Dx(), b.Dy())
+		}
+		if !strings.Contains(details, "100×50 → 40×20") || !strings.Contains(details, "cropped") {
+			t.Errorf("unexpected details: %s", details)
+		}
+		// The top-left pixel of the crop is (10, 20) of the original
+		if r, g, _, _ := img.At(img.Bounds().Min.X, img.Bounds().Min.Y).RGBA(); r>>8 != 10 || g>>8 != 20 {
+			t.Errorf("expected the crop to start at (10, 20), got color %d,%d", r>>8, g>>8)
+		}
+
+		// A region running off the edge is clipped
+		crop = map[string]interface{}{"x": float64(80), "y": float64(0), "width": float64(100), "height": float64(100)}
+		output, err = executeTool("include_file", map[string]interface{}{"path": path, "crop": crop})
+		if err != nil {
+			t.Fatalf("include_file failed: %v", err)
+		}
+		if _, _, _, img := parseImageMarker(t, output); img.Bounds().Dx() != 20 || img.Bounds().Dy() != 50 {
+			t.Errorf("expected the crop clipped to 20×50, got %v", img.Bounds())
+		}
+
+		crop = map[string]interface{}{"x": float64(500), "y": float64(0), "width": float64(10), "height": float64(10)}
+		if _, err := executeTool("include_file", map[string]interface{}{"path": path, "crop": crop}); err == nil || !strings.Contains(err.Error(), "outside") {
+			t.Errorf("expected an out-of-bounds crop error, got: %v", err)
+		}
+		if _, err := executeTool("include_file", map[string]interface{}{"path": path, "crop": map[string]interface{}{"x": float64(0)}}); err == nil {
+			t.Error("expected an incomplete crop to be refused")
+		}
+	})
+
+	t.Run("image options on other files", func(t *testing.T) {
+		path := filepath.Join(dir, "notes.txt")
+		os.WriteFile(path, []byte("hello\n"), 0644)
+		if _, err := executeTool("include_file", map[string]interface{}{"path": path, "max_edge": float64(100)}); err == nil || !strings.Contains(err.Error(), "only apply to images") {
+			t.Errorf("expected image options to be refused for text, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// runFakeLSPServer is a small language server for .fake files, run by
+// TestMain when the test binary is started as one. In the language,
+// "def name" declares a function, indented "var name" lines declare
+// variables inside it and "call a b" uses names. Calls to undeclared names
+// are errors and TODO is a warning. Positions are UTF-16, as LSP defaults.
+func runFakeLSPServer() {
+	in := bufio.NewReader(os.Stdin)
+	docs := make(map[string]string)
+	nextID := 1000
+
+	send := func(msg map[string]interface{}) {
+		msg["jsonrpc"] = "2.0"
+		body, _ := json.Marshal(msg)
+		fmt.Fprintf(os.Stdout, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	word := regexp.MustCompile(`[A-Za-z_]+`)
+	units := func(s string) int { return len(utf16.Encode([]rune(s))) }
+	// tokens lists identifier positions in a document
+	type token struct {
+		name       string
+		line, char int
+		def        bool
+	}
+	tokens := func(text string) []token {
+		var out []token
+		for i, line := range strings.Split(text, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || fields[0] == "#" {
+				continue
+			}
+			for _, m := range word.FindAllStringIndex(line, -1) {
+				name := line[m[0]:m[1]]
+				if name == fields[0] {
+					continue
+				}
+				out = append(out, token{name, i, units(line[:m[0]]), fields[0] == "def" || fields[0] == "var"})
+			}
+		}
+		return out
+	}
+	rangeOf := func(t token) map[string]interface{} {
+		return map[string]interface{}{
+			"start": map[string]int{"line": t.line, "character": t.char},
+			"end":   map[string]int{"line": t.line, "character": t.char + units(t.name)},
+		}
+	}
+	at := func(params map[string]interface{}) (string, token, bool) {
+		uri := params["textDocument"].(map[string]interface{})["uri"].(string)
+		pos := params["position"].(map[string]interface{})
+		line, char := int(pos["line"].(float64)), int(pos["character"].(float64))
+		for _, t := range tokens(docs[uri]) {
+			if t.line == line && char >= t.char && char <= t.char+units(t.name) {
+				return uri, t, true
+			}
+		}
+		return uri, token{}, false
+	}
+	publish := func(uri string, version float64) {
+		declared := make(map[string]bool)
+		for _, t := range tokens(docs[uri]) {
+			if t.def {
+				declared[t.name] = true
+			}
+		}
+		diags := []map[string]interface{}{}
+		for _, t := range tokens(docs[uri]) {
+			if !t.def && !declared[t.name] {
+				diags = append(diags, map[string]interface{}{"range": rangeOf(t), "severity": 1, "source": "fake", "code": "undeclared", "message": "undefined: " + t.name})
+			}
+		}
+		for i, line := range strings.Split(docs[uri], "\n") {
+			if j := strings.Index(line, "TODO"); j >= 0 {
+				diags = append(diags, map[string]interface{}{"range": rangeOf(token{"TODO", i, units(line[:j]), false}), "severity": 2, "message": "unfinished work"})
+			}
+		}
+		send(map[string]interface{}{"method": "textDocument/publishDiagnostics", "params": map[string]interface{}{"uri": uri, "version": version, "diagnostics": diags}})
+	}
+
+	for {
+		length := 0
+		for {
+			line, err := in.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				break
+			}
+			if v, ok := strings.CutPrefix(line, "Content-Length: "); ok {
+				length, _ = strconv.Atoi(v)
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(in, body); err != nil {
+			return
+		}
+		var msg struct {
+			ID     interface{}            `json:"id"`
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		json.Unmarshal(body, &msg)
+		reply := func(result interface{}) { send(map[string]interface{}{"id": msg.ID, "result": result}) }
+
+		switch msg.Method {
+		case "initialize":
+			reply(map[string]interface{}{"capabilities": map[string]interface{}{
+				"textDocumentSync": 1, "hoverProvider": true, "definitionProvider": true, "referencesProvider": true,
+				"documentSymbolProvider": true, "workspaceSymbolProvider": true, "renameProvider": map[string]bool{"prepareProvider": true},
+			}})
+		case "initialized":
+			// Servers often ask for settings before doing anything else
+			nextID++
+			send(map[string]interface{}{"id": nextID, "method": "workspace/configuration", "params": map[string]interface{}{"items": []interface{}{map[string]string{"section": "fake"}}}})
+		case "textDocument/didOpen":
+			doc := msg.Params["textDocument"].(map[string]interface{})
+			docs[doc["uri"].(string)] = doc["text"].(string)
+			publish(doc["uri"].(string), doc["version"].(float64))
+		case "textDocument/didChange":
+			doc := msg.Params["textDocument"].(map[string]interface{})
+			changes := msg.Params["contentChanges"].([]interface{})
+			docs[doc["uri"].(string)] = changes[len(changes)-1].(map[string]interface{})["text"].(string)
+			publish(doc["uri"].(string), doc["version"].(float64))
+		case "textDocument/hover":
+			_, t, ok := at(msg.Params)
+			if !ok {
+				reply(nil)
+				continue
+			}
+			reply(map[string]interface{}{"contents": map[string]string{"kind": "markdown", "value": "```fake\ndef " + t.name + "\n```\nA fake function."}})
+		case "textDocument/definition":
+			uri, t, ok := at(msg.Params)
+			var links []interface{}
+			for _, d := range tokens(docs[uri]) {
+				if ok && d.def && d.name == t.name {
+					links = append(links, map[string]interface{}{"targetUri": uri, "targetRange": rangeOf(d), "targetSelectionRange": rangeOf(d)})
+				}
+			}
+			reply(links)
+		case "textDocument/references":
+			_, t, ok := at(msg.Params)
+			includeDecl := msg.Params["context"].(map[string]interface{})["includeDeclaration"].(bool)
+			var locations []interface{}
+			for uri, text := range docs {
+				for _, r := range tokens(text) {
+					if ok && r.name == t.name && (includeDecl || !r.def) {
+						locations = append(locations, map[string]interface{}{"uri": uri, "range": rangeOf(r)})
+					}
+				}
+			}
+			reply(locations)
+		case "textDocument/documentSymbol":
+			uri := msg.Params["textDocument"].(map[string]interface{})["uri"].(string)
+			var symbols []map[string]interface{}
+			for _, t := range tokens(docs[uri]) {
+				if !t.def {
+					continue
+				}
+				line := strings.Split(docs[uri], "\n")[t.line]
+				s := map[string]interface{}{"name": t.name, "kind": 12, "range": rangeOf(t), "selectionRange": rangeOf(t), "children": []interface{}{}}
+				if strings.HasPrefix(line, " ") && len(symbols) > 0 {
+					s["kind"] = 13
+					parent := symbols[len(symbols)-1]
+					parent["children"] = append(parent["children"].([]interface{}), s)
+					continue
+				}
+				symbols = append(symbols, s)
+			}
+			reply(symbols)
+		case "workspace/symbol":
+			query := strings.ToLower(msg.Params["query"].(string))
+			var symbols []interface{}
+			for uri, text := range docs {
+				for _, t := range tokens(text) {
+					if t.def && strings.Contains(strings.ToLower(t.name), query) {
+						symbols = append(symbols, map[string]interface{}{"name": t.name, "kind": 12, "containerName": "fake", "location": map[string]interface{}{"uri": uri, "range": rangeOf(t)}})
+					}
+				}
+			}
+			reply(symbols)
+		case "textDocument/prepareRename":
+			_, t, ok := at(msg.Params)
+			if !ok {
+				reply(nil)
+				continue
+			}
+			reply(map[string]interface{}{"range": rangeOf(t), "placeholder": t.name})
+		case "textDocument/rename":
+			_, t, _ := at(msg.Params)
+			var changes []interface{}
+			for uri, text := range docs {
+				var edits []interface{}
+				for _, r := range tokens(text) {
+					if r.name == t.name {
+						edits = append(edits, map[string]interface{}{"range": rangeOf(r), "newText": msg.Params["newName"]})
+					}
+				}
+				if len(edits) > 0 {
+					changes = append(changes, map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri, "version": nil}, "edits": edits})
+				}
+			}
+			reply(map[string]interface{}{"documentChanges": changes})
+		case "shutdown":
+			reply(nil)
+		case "exit":
+			return
+		default:
+			if msg.ID != nil && msg.Method != "" {
+				send(map[string]interface{}{"id": msg.ID, "error": map[string]interface{}{"code": -32601, "message": "unsupported"}})
+			}
+		}
+	}
+}
+
+func TestLSP(t *testing.T) {
+	useTempWorkspace(t)
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CLYDE_FAKE_LSP", "1")
+	t.Setenv("CLYDE_LSP_SERVERS", "fake="+exe+";go=off")
+	defer tools.Shutdown()
+
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, ".git"), 0755)
+	main := filepath.Join(dir, "main.fake")
+	os.WriteFile(main, []byte("def greet\n  var name\ncall 😀 greet missing\n# TODO tidy up\ndef farewell\ncall greet\n"), 0644)
+
+	t.Run("diagnostics", func(t *testing.T) {
+		result, err := executeTool("lsp", map[string]interface{}{"action": "diagnostics", "file": main})
+		if err != nil {
+			t.Fatalf("diagnostics failed: %v", err)
+		}
+		// "missing" is the 14th character of line 3 but the 15th UTF-16
+		// unit, after the emoji
+		for _, want := range []string{"1 error, 1 warning in", "main.fake:3:14: error: undefined: missing [fake undeclared]", "main.fake:4:3: warning: unfinished work"} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %q in:\n%s", want, result)
+			}
+		}
+	})
+
+	t.Run("edits are synced", func(t *testing.T) {
+		os.WriteFile(main, []byte("def greet\n  var name\ncall 😀 greet\ndef farewell\ncall greet\n"), 0644)
+		result, err := executeTool("lsp", map[string]interface{}{"action": "diagnostics", "file": main})
+		if err != nil || !strings.Contains(result, "No diagnostics for") {
+			t.Errorf("expected the fixed file to be clean, got: %s (%v)", result, err)
+		}
+	})
+
+	t.Run("hover and definition", func(t *testing.T) {
+		result, err := executeTool("lsp", map[string]interface{}{"action": "hover", "file": main, "line": float64(3), "symbol": "greet"})
+		if err != nil || !strings.Contains(result, "def greet") || !strings.Contains(result, "A fake function.") {
+			t.Errorf("unexpected hover: %s (%v)", result, err)
+		}
+		result, err = executeTool("lsp", map[string]interface{}{"action": "definition", "file": main, "line": float64(5), "column": float64(6)})
+		if err != nil || !strings.Contains(result, "main.fake:1:5  def greet") {
+			t.Errorf("unexpected definition: %s (%v)", result, err)
+		}
+		if _, err := executeTool("lsp", map[string]interface{}{"action": "hover", "file": main, "line": float64(3), "symbol": "absent"}); err == nil || !strings.Contains(err.Error(), "does not appear on line 3") {
+			t.Errorf("expected a missing symbol error, got: %v", err)
+		}
+	})
+
+	t.Run("references", func(t *testing.T) {
+		result, err := executeTool("lsp", map[string]interface{}{"action": "references", "file": main, "line": float64(1), "symbol": "greet"})
+		if err != nil {
+			t.Fatalf("references failed: %v", err)
+		}
+		for _, want := range []string{"References (3, including the declaration)", "main.fake:1:5  def greet", "main.fake:3:8  call 😀 greet", "main.fake:5:6  call greet"} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %q in:\n%s", want, result)
+			}
+		}
+	})
+
+	t.Run("symbols", func(t *testing.T) {
+		result, err := executeTool("lsp", map[string]interface{}{"action": "document_symbols", "file": main})
+		if err != nil || !strings.Contains(result, "  function greet  :1\n    variable name  :2\n  function farewell  :4") {
+			t.Errorf("unexpected outline: %s (%v)", result, err)
+		}
+		result, err = executeTool("lsp", map[string]interface{}{"action": "workspace_symbols", "query": "fare"})
+		if err != nil || !strings.Contains(result, "function farewell (in fake)  ") || !strings.Contains(result, "main.fake:4") {
+			t.Errorf("unexpected workspace symbols: %s (%v)", result, err)
+		}
+	})
+
+	t.Run("rename preview", func(t *testing.T) {
+		result, err := executeTool("lsp", map[string]interface{}{"action": "rename", "file": main, "line": float64(1), "symbol": "greet", "new_name": "welcome"})
+		if err != nil {
+			t.Fatalf("rename failed: %v", err)
+		}
+		for _, want := range []string{"Rename greet → welcome: 3 edits in 1 files (preview only", "3 - call 😀 greet\n  3 + call 😀 welcome", "5 - call greet\n  5 + call welcome"} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %q in:\n%s", want, result)
+			}
+		}
+		data, _ := os.ReadFile(main)
+		if strings.Contains(string(data), "welcome") {
+			t.Error("rename preview must not write the file")
+		}
+	})
+
+	t.Run("post-edit check", func(t *testing.T) {
+		t.Setenv("CLYDE_EDIT_CHECKS", "fake=lsp")
+		result, err := executePatchFile(main, "call greet\n", "call greet unknown\n")
+		if err != nil {
+			t.Fatalf("patch failed: %v", err)
+		}
+		if !strings.Contains(result, "⚠️ Post-edit checks found 1 new problem:") || !strings.Contains(result, "main.fake:5:12: error: undefined: unknown [fake undeclared]  (lsp)") {
+			t.Errorf("expected the new diagnostic in the patch result, got:\n%s", result)
+		}
+		result, _ = executePatchFile(main, "call greet unknown\n", "call greet\n")
+		if !strings.Contains(result, "✓ No new problems from lsp (fixed 1)") {
+			t.Errorf("expected the fix to be acknowledged, got:\n%s", result)
+		}
+	})
+
+	t.Run("lifecycle", func(t *testing.T) {
+		result, _ := executeTool("lsp", map[string]interface{}{"action": "servers"})
+		if !strings.Contains(result, ".fake: "+exe+" (installed)") || !strings.Contains(result, "Running:\n  "+filepath.Base(exe)+" for "+dir) || !strings.Contains(result, "1 open files") {
+			t.Errorf("expected one running server for the workspace, got:\n%s", result)
+		}
+		if strings.Contains(result, ".go:") {
+			t.Errorf("expected go=off to disable gopls, got:\n%s", result)
+		}
+		result, err := executeTool("lsp", map[string]interface{}{"action": "stop"})
+		if err != nil || !strings.Contains(result, "Stopped 1 language server") {
+			t.Errorf("unexpected stop result: %s (%v)", result, err)
+		}
+		result, _ = executeTool("lsp", map[string]interface{}{"action": "servers"})
+		if !strings.Contains(result, "No servers running") {
+			t.Errorf("expected no running servers, got:\n%s", result)
+		}
+		// The next request starts it again
+		if _, err := executeTool("lsp", map[string]interface{}{"action": "document_symbols", "file": main}); err != nil {
+			t.Errorf("expected the server to restart, got: %v", err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		other := filepath.Join(dir, "notes.unknownext")
+		os.WriteFile(other, []byte("x"), 0644)
+		if _, err := executeTool("lsp", map[string]interface{}{"action": "hover", "file": other, "line": float64(1)}); err == nil || !strings.Contains(err.Error(), "CLYDE_LSP_SERVERS") {
+			t.Errorf("expected a configuration hint, got: %v", err)
+		}
+		t.Setenv("CLYDE_LSP_SERVERS", "fake=definitely-not-a-server")
+		if _, err := executeTool("lsp", map[string]interface{}{"action": "diagnostics", "file": filepath.Join(dir, "x.fake")}); err == nil {
+			t.Error("expected an error for a missing file")
+		}
+		os.WriteFile(filepath.Join(dir, "x.fake"), nil, 0644)
+		if _, err := executeTool("lsp", map[string]interface{}{"action": "diagnostics", "file": filepath.Join(dir, "x.fake")}); err == nil || !strings.Contains(err.Error(), "not installed") {
+			t.Errorf("expected a not installed error, got: %v", err)
+		}
+	})
+}
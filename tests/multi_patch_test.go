@@ -3,12 +3,14 @@ package main
 import (
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
 
 // Unit tests for executeMultiPatch
 func TestExecuteMultiPatch(t *testing.T) {
+	useTempWorkspace(t)
 	// Create a temporary test directory with git repo
 	tmpDir := t.TempDir()
 	oldDir, _ := os.Getwd()
@@ -92,7 +94,7 @@ func TestExecuteMultiPatch(t *testing.T) {
 		}
 	})
 
-	t.Run("Rollback on failure", func(t *testing.T) {
+	t.Run("Validation failure leaves all files untouched", func(t *testing.T) {
 		// Create test files
 		os.WriteFile("rollback1.txt", []byte("alpha beta gamma"), 0644)
 		os.WriteFile("rollback2.txt", []byte("one two three"), 0644)
@@ -121,19 +123,143 @@ func TestExecuteMultiPatch(t *testing.T) {
 		if !strings.Contains(errMsg, "FAILED") {
 			t.Errorf("Expected failure message, got: %s", errMsg)
 		}
-
-		if !strings.Contains(errMsg, "rollback") || !strings.Contains(errMsg, "Rolling back") {
-			t.Errorf("Expected rollback message, got: %s", errMsg)
+		if !strings.Contains(errMsg, "Patch 2/2") {
+			t.Errorf("Expected failing patch to be identified, got: %s", errMsg)
+		}
+		if !strings.Contains(errMsg, "No files were modified") {
+			t.Errorf("Expected 'No files were modified', got: %s", errMsg)
 		}
 
-		// Verify first file was rolled back
+		// Verify first file was never written
 		content, _ := os.ReadFile("rollback1.txt")
-		if strings.Contains(string(content), "BETA") {
-			t.Errorf("Expected file to be rolled back to 'beta', but found 'BETA': %s", string(content))
+		if string(content) != "alpha beta gamma" {
+			t.Errorf("Expected rollback1.txt to be unchanged, got: %s", string(content))
+		}
+	})
+
+	t.Run("Missing file fails before any write", func(t *testing.T) {
+		os.WriteFile("present.txt", []byte("keep me"), 0644)
+
+		patches := []interface{}{
+			map[string]interface{}{
+				"path":     "present.txt",
+				"old_text": "keep",
+				"new_text": "KEEP",
+			},
+			map[string]interface{}{
+				"path":     "missing.txt",
+				"old_text": "x",
+				"new_text": "y",
+			},
+		}
+
+		_, err := executeMultiPatch(patches)
+		if err == nil {
+			t.Fatal("Expected error for missing file")
+		}
+		if !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("Expected 'does not exist' error, got: %v", err)
+		}
+
+		content, _ := os.ReadFile("present.txt")
+		if string(content) != "keep me" {
+			t.Errorf("Expected present.txt to be unchanged, got: %s", string(content))
+		}
+		os.Remove("present.txt")
+	})
+
+	t.Run("Multiple patches to the same file apply in sequence", func(t *testing.T) {
+		os.WriteFile("seq.txt", []byte("func oldName() {}\n\nvar x = oldName\n"), 0644)
+
+		patches := []interface{}{
+			map[string]interface{}{
+				"path":     "seq.txt",
+				"old_text": "func oldName()",
+				"new_text": "func newName()",
+			},
+			map[string]interface{}{
+				// Only unique after the first patch has been applied
+				"path":     "seq.txt",
+				"old_text": "oldName",
+				"new_text": "newName",
+			},
+		}
+
+		result, err := executeMultiPatch(patches)
+		if err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		if !strings.Contains(result, "2 patches to 1 files") {
+			t.Errorf("Expected summary for 2 patches to 1 file, got: %s", result)
 		}
-		if !strings.Contains(string(content), "beta") {
-			t.Errorf("Expected original 'beta' after rollback, got: %s", string(content))
+
+		content, _ := os.ReadFile("seq.txt")
+		if string(content) != "func newName() {}\n\nvar x = newName\n" {
+			t.Errorf("Unexpected content: %q", string(content))
 		}
+		os.Remove("seq.txt")
+	})
+
+	t.Run("Different spellings of one path share a snapshot", func(t *testing.T) {
+		os.WriteFile("alias.txt", []byte("one two\n"), 0644)
+		abs, _ := filepath.Abs("alias.txt")
+
+		patches := []interface{}{
+			map[string]interface{}{
+				"path":     "alias.txt",
+				"old_text": "one",
+				"new_text": "uno",
+			},
+			map[string]interface{}{
+				"path":     "./alias.txt",
+				"old_text": "uno two",
+				"new_text": "uno dos",
+			},
+			map[string]interface{}{
+				"path":     abs,
+				"old_text": "dos",
+				"new_text": "tres",
+			},
+		}
+
+		result, err := executeMultiPatch(patches)
+		if err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		if !strings.Contains(result, "3 patches to 1 files") {
+			t.Errorf("Expected summary for 3 patches to 1 file, got: %s", result)
+		}
+
+		content, _ := os.ReadFile("alias.txt")
+		if string(content) != "uno tres\n" {
+			t.Errorf("Unexpected content: %q", string(content))
+		}
+		os.Remove("alias.txt")
+	})
+
+	t.Run("Preserves file permissions", func(t *testing.T) {
+		os.WriteFile("script.sh", []byte("#!/bin/sh\necho old\n"), 0755)
+
+		patches := []interface{}{
+			map[string]interface{}{
+				"path":     "script.sh",
+				"old_text": "echo old",
+				"new_text": "echo new",
+			},
+		}
+
+		if _, err := executeMultiPatch(patches); err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+
+		info, err := os.Stat("script.sh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("Expected mode 0755, got %o", info.Mode().Perm())
+		}
+		os.Remove("script.sh")
 	})
 
 	t.Run("Empty patches array", func(t *testing.T) {
@@ -186,34 +312,85 @@ func TestExecuteMultiPatch(t *testing.T) {
 		}
 	})
 
-	t.Run("Warn about uncommitted changes", func(t *testing.T) {
-		// Make uncommitted changes
-		os.WriteFile("dirty.txt", []byte("uncommitted content"), 0644)
+	t.Run("Applies on a dirty tree without discarding other edits", func(t *testing.T) {
+		// Tracked file with an uncommitted edit the patch does not touch
+		os.WriteFile("dirty.txt", []byte("header\nbody\n"), 0644)
+		exec.Command("git", "add", "dirty.txt").Run()
+		exec.Command("git", "commit", "-m", "dirty base").Run()
+		os.WriteFile("dirty.txt", []byte("header\nbody\nuser edit\n"), 0644)
 
 		patches := []interface{}{
 			map[string]interface{}{
 				"path":     "dirty.txt",
-				"old_text": "uncommitted",
-				"new_text": "UNCOMMITTED",
+				"old_text": "header",
+				"new_text": "HEADER",
+			},
+			map[string]interface{}{
+				"path":     "dirty.txt",
+				"old_text": "NONEXISTENT",
+				"new_text": "x",
 			},
 		}
 
-		result, err := executeMultiPatch(patches)
-		// Should not error, but should return warning
+		// A failing batch must not revert the user's uncommitted edit
+		if _, err := executeMultiPatch(patches); err == nil {
+			t.Fatal("Expected error for failing patch")
+		}
+		content, _ := os.ReadFile("dirty.txt")
+		if string(content) != "header\nbody\nuser edit\n" {
+			t.Errorf("Expected uncommitted edit to survive, got: %q", string(content))
+		}
+
+		// A valid batch is applied even though the tree is dirty
+		result, err := executeMultiPatch(patches[:1])
 		if err != nil {
-			t.Fatalf("Expected warning, not error: %v", err)
+			t.Fatalf("Expected success on dirty tree, got error: %v", err)
+		}
+		if !strings.Contains(result, "Successfully applied") {
+			t.Errorf("Expected success message, got: %s", result)
+		}
+		content, _ = os.ReadFile("dirty.txt")
+		if string(content) != "HEADER\nbody\nuser edit\n" {
+			t.Errorf("Unexpected content: %q", string(content))
 		}
+	})
+}
 
-		t.Logf("Result: %s", result)
+// TestMultiPatchOutsideGit verifies multi_patch works without a git repository
+func TestMultiPatchOutsideGit(t *testing.T) {
+	useTempWorkspace(t)
+	tmpDir := t.TempDir()
+	oldDir, _ := os.Getwd()
+	defer os.Chdir(oldDir)
+	os.Chdir(tmpDir)
 
-		if !strings.Contains(result, "uncommitted changes") && !strings.Contains(result, "commit") {
-			t.Errorf("Expected warning about uncommitted changes, got: %s", result)
-		}
+	os.WriteFile("a.txt", []byte("one"), 0644)
+	os.WriteFile("b.txt", []byte("two"), 0644)
 
-		// Clean up
-		exec.Command("git", "checkout", "--", "dirty.txt").Run()
-		os.Remove("dirty.txt")
-	})
+	patches := []interface{}{
+		map[string]interface{}{"path": "a.txt", "old_text": "one", "new_text": "ONE"},
+		map[string]interface{}{"path": "b.txt", "old_text": "two", "new_text": "TWO"},
+	}
+
+	result, err := executeMultiPatch(patches)
+	if err != nil {
+		t.Fatalf("Expected success outside git, got error: %v", err)
+	}
+	if !strings.Contains(result, "Successfully applied all 2 patches") {
+		t.Errorf("Expected success message, got: %s", result)
+	}
+
+	a, _ := os.ReadFile("a.txt")
+	b, _ := os.ReadFile("b.txt")
+	if string(a) != "ONE" || string(b) != "TWO" {
+		t.Errorf("Expected both files patched, got %q and %q", string(a), string(b))
+	}
+
+	// No temp files should be left behind
+	entries, _ := os.ReadDir(".")
+	if len(entries) != 2 {
+		t.Errorf("Expected only the two patched files, found %d entries", len(entries))
+	}
 }
 
 // Integration test for multi_patch tool
@@ -315,7 +492,7 @@ func TestMultiPatchIntegration(t *testing.T) {
 		}
 	})
 
-	t.Run("Handle uncommitted changes warning", func(t *testing.T) {
+	t.Run("Handle uncommitted changes", func(t *testing.T) {
 		// Make uncommitted changes
 		os.WriteFile("uncommitted.txt", []byte("test content"), 0644)
 
@@ -331,15 +508,15 @@ func TestMultiPatchIntegration(t *testing.T) {
 
 		t.Logf("Response: %s", response)
 
-		// Look for warning about uncommitted changes in tool result
+		// Patches apply directly even though the file is uncommitted
 		for _, msg := range updatedHistory {
 			if msg.Role == "user" {
 				if contentBlocks, ok := msg.Content.([]ContentBlock); ok {
 					for _, block := range contentBlocks {
 						if block.Type == "tool_result" {
 							if content, ok := block.Content.(string); ok {
-								if strings.Contains(content, "uncommitted") || strings.Contains(content, "commit") {
-									t.Logf("✓ Warning about uncommitted changes detected")
+								if strings.Contains(content, "Successfully applied") {
+									t.Logf("✓ multi_patch applied on a dirty tree")
 								}
 							}
 						}
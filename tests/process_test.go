@@ -0,0 +1,142 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+func executeProcess(input map[string]interface{}) (string, error) {
+	reg, _ := tools.GetTool("process")
+	return reg.Execute(input, nil, nil)
+}
+
+var processIDPattern = regexp.MustCompile(`process (p\d+)`)
+var nextOffsetPattern = regexp.MustCompile(`\[next_offset: (\d+)\]`)
+
+// TestProcessTool tests the background process manager
+func TestProcessTool(t *testing.T) {
+	defer tools.Shutdown()
+
+	start := func(t *testing.T, command string) string {
+		t.Helper()
+		output, err := executeProcess(map[string]interface{}{"action": "start", "command": command})
+		if err != nil {
+			t.Fatalf("start failed: %v", err)
+		}
+		m := processIDPattern.FindStringSubmatch(output)
+		if m == nil {
+			t.Fatalf("No process id in output: %s", output)
+		}
+		return m[1]
+	}
+
+	t.Run("Missing action", func(t *testing.T) {
+		_, err := executeProcess(map[string]interface{}{})
+		if err == nil || !strings.Contains(err.Error(), "action is required") {
+			t.Errorf("Expected action error, got: %v", err)
+		}
+	})
+
+	t.Run("Unknown id", func(t *testing.T) {
+		_, err := executeProcess(map[string]interface{}{"action": "stop", "id": "p999"})
+		if err == nil || !strings.Contains(err.Error(), "no process with id") {
+			t.Errorf("Expected unknown id error, got: %v", err)
+		}
+	})
+
+	t.Run("Incremental output and stdin", func(t *testing.T) {
+		id := start(t, "echo ready; read name; echo hello $name; sleep 30")
+
+		output, err := executeProcess(map[string]interface{}{
+			"action": "read_output", "id": id, "wait_seconds": float64(5),
+		})
+		if err != nil {
+			t.Fatalf("read_output failed: %v", err)
+		}
+		if !strings.Contains(output, "ready") {
+			t.Fatalf("Expected 'ready', got: %s", output)
+		}
+		m := nextOffsetPattern.FindStringSubmatch(output)
+		if m == nil {
+			t.Fatalf("Expected next_offset in output: %s", output)
+		}
+		offset, _ := strconv.Atoi(m[1])
+
+		if _, err := executeProcess(map[string]interface{}{
+			"action": "send_stdin", "id": id, "input": "clyde\n",
+		}); err != nil {
+			t.Fatalf("send_stdin failed: %v", err)
+		}
+
+		output, err = executeProcess(map[string]interface{}{
+			"action": "read_output", "id": id, "offset": float64(offset), "wait_seconds": float64(5),
+		})
+		if err != nil {
+			t.Fatalf("read_output failed: %v", err)
+		}
+		if !strings.Contains(output, "hello clyde") {
+			t.Errorf("Expected 'hello clyde', got: %s", output)
+		}
+		if strings.Contains(output, "ready\n") {
+			t.Errorf("Expected only new output after offset, got: %s", output)
+		}
+
+		output, err = executeProcess(map[string]interface{}{"action": "stop", "id": id})
+		if err != nil || !strings.Contains(output, "Stopped") {
+			t.Errorf("Expected stop confirmation, got %q, %v", output, err)
+		}
+
+		status, _ := executeProcess(map[string]interface{}{"action": "status", "id": id})
+		if !strings.Contains(status, "stopped") {
+			t.Errorf("Expected stopped status, got: %s", status)
+		}
+	})
+
+	t.Run("Reports immediate failure", func(t *testing.T) {
+		output, err := executeProcess(map[string]interface{}{"action": "start", "command": "echo boom; exit 4"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "exited immediately with code 4") || !strings.Contains(output, "boom") {
+			t.Errorf("Expected immediate exit report, got: %s", output)
+		}
+	})
+
+	t.Run("Ring buffer discards old output", func(t *testing.T) {
+		t.Setenv("CLYDE_PROCESS_BUFFER_KB", "1")
+		id := start(t, "sleep 0.5; seq 1 2000; sleep 30")
+
+		output, _ := executeProcess(map[string]interface{}{
+			"action": "read_output", "id": id, "wait_seconds": float64(5),
+		})
+		// Wait for the whole sequence to be written
+		for i := 0; i < 50 && !strings.Contains(output, "2000\n"); i++ {
+			output, _ = executeProcess(map[string]interface{}{
+				"action": "read_output", "id": id, "wait_seconds": float64(1),
+			})
+		}
+		if !strings.Contains(output, "older bytes were discarded") {
+			t.Errorf("Expected discarded-bytes note, got: %s", output)
+		}
+		if !strings.Contains(output, "2000\n") {
+			t.Errorf("Expected the latest output to be retained, got: %s", output)
+		}
+	})
+
+	t.Run("Shutdown stops all running processes", func(t *testing.T) {
+		start(t, "sleep 60")
+		start(t, "sleep 60")
+
+		tools.Shutdown()
+
+		for _, p := range tools.ListProcesses() {
+			if p.Running {
+				t.Errorf("Process %s still running after Shutdown", p.ID)
+			}
+		}
+	})
+}
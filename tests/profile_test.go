@@ -0,0 +1,206 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+const profileSource = `package app
+
+func handle(r string) int {
+	n := parse(r)
+	return n + render(n)
+}
+
+func parse(s string) int {
+	n := 0
+	for _, c := range s {
+		n += int(c)
+	}
+	return n
+}
+`
+
+// writeCPUProfile writes a CPU profile recorded on a build machine:
+// main → handle → parse (inlined decode at the leaf) and handle → render
+func writeCPUProfile(t *testing.T, path string) {
+	file := "/build/src/example.com/app/handler.go"
+	fns := map[string]*profile.Function{}
+	var functions []*profile.Function
+	fn := func(name string, start int64) *profile.Function {
+		f := &profile.Function{ID: uint64(len(functions) + 1), Name: name, SystemName: name, Filename: file, StartLine: start}
+		fns[name] = f
+		functions = append(functions, f)
+		return f
+	}
+	fn("main.main", 1)
+	fn("example.com/app.handle", 3)
+	fn("example.com/app.parse", 8)
+	fn("example.com/app.render", 20)
+	fn("example.com/app.decode", 30)
+
+	var locations []*profile.Location
+	loc := func(lines ...profile.Line) *profile.Location {
+		l := &profile.Location{ID: uint64(len(locations) + 1), Address: uint64(0x1000 + len(locations)), Line: lines}
+		locations = append(locations, l)
+		return l
+	}
+	line := func(name string, n int64) profile.Line { return profile.Line{Function: fns[name], Line: n} }
+	mainLoc := loc(line("main.main", 2))
+	handleParse := loc(line("example.com/app.handle", 4))
+	handleRender := loc(line("example.com/app.handle", 5))
+	parseLoop := loc(line("example.com/app.parse", 11))
+	parseDecode := loc(line("example.com/app.decode", 31), line("example.com/app.parse", 10))
+	render := loc(line("example.com/app.render", 21))
+
+	ms := int64(1_000_000)
+	sample := func(value int64, stack ...*profile.Location) *profile.Sample {
+		return &profile.Sample{Value: []int64{value / (10 * ms), value}, Location: stack}
+	}
+	p := &profile.Profile{
+		SampleType:    []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType:    &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:        10 * ms,
+		DurationNanos: 2000 * ms,
+		Sample: []*profile.Sample{
+			sample(600*ms, parseLoop, handleParse, mainLoc),
+			sample(200*ms, parseDecode, handleParse, mainLoc),
+			sample(150*ms, render, handleRender, mainLoc),
+			sample(50*ms, handleRender, mainLoc),
+		},
+		Location: locations,
+		Function: functions,
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	useTempWorkspace(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.MkdirAll("checkout/app", 0755)
+	os.WriteFile(filepath.Join("checkout", "app", "handler.go"), []byte(profileSource), 0644)
+	writeCPUProfile(t, "cpu.pprof")
+	expect := func(t *testing.T, result string, want ...string) {
+		t.Helper()
+		for _, w := range want {
+			if !strings.Contains(result, w) {
+				t.Errorf("expected %q in:\n%s", w, result)
+			}
+		}
+	}
+
+	t.Run("top", func(t *testing.T) {
+		result, err := executeTool("profile", map[string]interface{}{"file": "cpu.pprof"})
+		if err != nil {
+			t.Fatalf("profile failed: %v", err)
+		}
+		expect(t, result,
+			"Type: cpu · Duration: 2.00s · Total: 1.00s (50.0% of the duration) · 4 samples",
+			"Other sample types: samples",
+			"Top 5 of 5 functions by flat:",
+			"  600.00ms  60.00%  60.00%   800.00ms  80.00%  example.com/app.parse",
+			"  200.00ms  20.00%  80.00%   200.00ms  20.00%  example.com/app.decode",
+		)
+		if !strings.Contains(strings.Split(result, "example.com/app.parse")[1], "example.com/app.decode") {
+			t.Errorf("expected parse to rank above decode:\n%s", result)
+		}
+
+		result, err = executeTool("profile", map[string]interface{}{"file": "cpu.pprof", "sort": "cum", "n": float64(2), "sample_type": "samples"})
+		if err != nil {
+			t.Fatalf("profile failed: %v", err)
+		}
+		expect(t, result, "Type: samples", "Top 2 of 5 functions by cum:", "100.00%  main.main", "100.00%  example.com/app.handle")
+		if strings.Contains(result, "app.parse") {
+			t.Errorf("expected only two functions:\n%s", result)
+		}
+	})
+
+	t.Run("paths", func(t *testing.T) {
+		result, err := executeTool("profile", map[string]interface{}{"file": "cpu.pprof", "action": "paths", "function": `app\.parse$`})
+		if err != nil {
+			t.Fatalf("profile failed: %v", err)
+		}
+		expect(t, result,
+			"example.com/app.parse: 800.00ms cumulative (80.00%), 600.00ms in the function itself",
+			"  800.00ms 100.00%  main.main → example.com/app.handle → example.com/app.parse",
+			"Calls:",
+			"  200.00ms  25.00%  example.com/app.decode",
+		)
+
+		result, err = executeTool("profile", map[string]interface{}{"file": "cpu.pprof", "action": "paths", "function": "handle"})
+		if err != nil {
+			t.Fatalf("profile failed: %v", err)
+		}
+		expect(t, result, "example.com/app.handle: 1.00s cumulative", "  800.00ms  80.00%  example.com/app.parse", "  150.00ms  15.00%  example.com/app.render")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		result, err := executeTool("profile", map[string]interface{}{"file": "cpu.pprof", "action": "list", "function": `app\.parse$`, "source_dir": "checkout"})
+		if err != nil {
+			t.Fatalf("profile failed: %v", err)
+		}
+		expect(t, result,
+			"ROUTINE example.com/app.parse: 800.00ms cumulative (80.00%)",
+			"checkout/app/handler.go",
+			"         .          .      8  func parse(s string) int {",
+			"         .   200.00ms     10  \tfor _, c := range s {",
+			"  600.00ms   600.00ms     11  \t\tn += int(c)",
+		)
+
+		// Without the checkout the lines with samples are still listed
+		result, err = executeTool("profile", map[string]interface{}{"file": "cpu.pprof", "action": "list", "function": `app\.parse$`})
+		if err != nil {
+			t.Fatalf("profile failed: %v", err)
+		}
+		expect(t, result, "Source /build/src/example.com/app/handler.go not found locally", "set source_dir", "  600.00ms   600.00ms  11")
+	})
+
+	t.Run("runtime profiles", func(t *testing.T) {
+		f, err := os.Create("heap.pprof")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pprof.Lookup("heap").WriteTo(f, 0); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		result, err := executeTool("profile", map[string]interface{}{"file": "heap.pprof"})
+		if err != nil {
+			t.Fatalf("profile failed: %v", err)
+		}
+		expect(t, result, "Type: inuse_space", "alloc_objects, alloc_space, inuse_objects")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		os.WriteFile("notes.txt", []byte("not a profile"), 0644)
+		for _, tc := range []struct {
+			input map[string]interface{}
+			want  string
+		}{
+			{map[string]interface{}{}, "file is required"},
+			{map[string]interface{}{"file": "missing.pprof"}, "missing.pprof"},
+			{map[string]interface{}{"file": "notes.txt"}, "is not a pprof profile"},
+			{map[string]interface{}{"file": "cpu.pprof", "sample_type": "delay"}, "Available sample types: samples, cpu"},
+			{map[string]interface{}{"file": "cpu.pprof", "action": "list"}, "function is required"},
+			{map[string]interface{}{"file": "cpu.pprof", "action": "paths", "function": "nothing"}, "no function in the profile matches"},
+			{map[string]interface{}{"file": "cpu.pprof", "action": "flame"}, "unknown action"},
+		} {
+			if _, err := executeTool("profile", tc.input); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("%v: expected error containing %q, got %v", tc.input, tc.want, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/api"
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// fakeModel answers Messages API calls the way research uses them:
+// extraction calls get the page's "Fact:" lines (or NONE), synthesis calls
+// get a fixed answer citing [1]
+func fakeModel(t *testing.T) (*httptest.Server, *sync.Map) {
+	models := &sync.Map{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model     string `json:"model"`
+			MaxTokens int    `json:"max_tokens"`
+			System    string `json:"system"`
+			Messages  []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		models.Store(req.Model, true)
+		models.Store("max_tokens", req.MaxTokens)
+		prompt := req.Messages[0].Content
+
+		reply := "NONE"
+		if strings.Contains(req.System, "numbered source extracts") {
+			models.Store("synthesis-prompt", prompt)
+			reply = "The default is the number of CPUs [1]."
+		} else {
+			var facts []string
+			for _, line := range strings.Split(prompt, "\n") {
+				if strings.HasPrefix(line, "Fact:") {
+					facts = append(facts, line)
+				}
+			}
+			if len(facts) > 0 {
+				reply = strings.Join(facts, "\n")
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": reply}},
+		})
+	}))
+	return server, models
+}
+
+func TestResearch(t *testing.T) {
+	clearSearchEnv(t)
+
+	pages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/relevant":
+			fmt.Fprint(w, "<html><head><title>Runtime docs</title></head><body><main><h1>Runtime</h1><p>Fact: GOMAXPROCS defaults to the number of CPUs.</p><p>More text about the scheduler and how goroutines are run.</p></main></body></html>")
+		case "/unrelated":
+			fmt.Fprint(w, "<html><head><title>Cooking</title></head><body><main><p>How to bake bread at home with flour and water.</p></main></body></html>")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer pages.Close()
+
+	model, models := fakeModel(t)
+	defer model.Close()
+	client := api.NewClient("test-key", model.URL, "main-model", 1024)
+
+	results := fmt.Sprintf(`[{"title":"Gone","url":"%[1]s/missing"},{"title":"Runtime","url":"%[1]s/relevant"},{"title":"Cooking","url":"%[1]s/unrelated"}]`, pages.URL)
+	t.Setenv("CLYDE_SEARCH_COMMAND", "echo '"+results+"'")
+	t.Setenv("CLYDE_SECONDARY_MODEL", "small-model")
+
+	reg, err := tools.GetTool("research")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("answer with sources", func(t *testing.T) {
+		result, err := reg.Execute(map[string]interface{}{"question": "What is the default GOMAXPROCS?", "num_sources": float64(2)}, client, nil)
+		if err != nil {
+			t.Fatalf("research failed: %v", err)
+		}
+		if !strings.HasPrefix(result, "The default is the number of CPUs [1].") {
+			t.Errorf("expected the synthesized answer first, got:\n%s", result)
+		}
+		if !strings.Contains(result, "Sources:\n[1] Runtime docs - "+pages.URL+"/relevant") {
+			t.Errorf("expected numbered source, got:\n%s", result)
+		}
+		// The 404 is replaced by the next result, which has nothing relevant
+		if !strings.Contains(result, "/missing (page not found (404)") || !strings.Contains(result, "/unrelated (nothing relevant)") {
+			t.Errorf("expected skipped pages with reasons, got:\n%s", result)
+		}
+		if strings.Contains(result, "scheduler") {
+			t.Errorf("page text leaked into the result:\n%s", result)
+		}
+		synthesis, _ := models.Load("synthesis-prompt")
+		if !strings.Contains(fmt.Sprint(synthesis), "[1] Runtime docs") || strings.Contains(fmt.Sprint(synthesis), "bread") {
+			t.Errorf("synthesis should only see relevant extracts, got:\n%s", synthesis)
+		}
+		if _, ok := models.Load("small-model"); !ok {
+			t.Error("expected calls to use CLYDE_SECONDARY_MODEL")
+		}
+		if _, ok := models.Load("main-model"); ok {
+			t.Error("expected no calls on the main model")
+		}
+	})
+
+	t.Run("token limits", func(t *testing.T) {
+		if limit, _ := models.Load("max_tokens"); limit != 4096 {
+			t.Errorf("expected research to use CLYDE_SECONDARY_MAX_TOKENS' default, got %v", limit)
+		}
+		browse, _ := tools.GetTool("browse")
+		if _, err := browse.Execute(map[string]interface{}{"url": pages.URL + "/relevant", "prompt": "What is the default?"}, client, nil); err != nil {
+			t.Fatalf("browse failed: %v", err)
+		}
+		if limit, _ := models.Load("max_tokens"); limit != 1024 {
+			t.Errorf("expected browse extraction to keep the conversation's limit, got %v", limit)
+		}
+		t.Setenv("CLYDE_SECONDARY_MAX_TOKENS", "500")
+		browse.Execute(map[string]interface{}{"url": pages.URL + "/relevant", "prompt": "What is the default?"}, client, nil)
+		if limit, _ := models.Load("max_tokens"); limit != 500 {
+			t.Errorf("expected an explicit CLYDE_SECONDARY_MAX_TOKENS to apply to browse, got %v", limit)
+		}
+	})
+
+	t.Run("nothing relevant", func(t *testing.T) {
+		t.Setenv("CLYDE_SEARCH_COMMAND", fmt.Sprintf(`echo '[{"title":"Cooking","url":"%s/unrelated"}]'`, pages.URL))
+		result, err := reg.Execute(map[string]interface{}{"question": "What is the default GOMAXPROCS?"}, client, nil)
+		if err != nil {
+			t.Fatalf("research failed: %v", err)
+		}
+		if !strings.Contains(result, "None of the 1 pages read had information relevant") || strings.Contains(result, "Sources:") {
+			t.Errorf("expected no-answer message, got:\n%s", result)
+		}
+	})
+
+	t.Run("all fetches fail", func(t *testing.T) {
+		t.Setenv("CLYDE_SEARCH_COMMAND", fmt.Sprintf(`echo '[{"title":"Gone","url":"%s/missing"}]'`, pages.URL))
+		_, err := reg.Execute(map[string]interface{}{"question": "anything"}, client, nil)
+		if err == nil || !strings.Contains(err.Error(), "could not read any of the search results") {
+			t.Errorf("expected a fetch error, got: %v", err)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		if _, err := reg.Execute(map[string]interface{}{}, client, nil); err == nil || !strings.Contains(err.Error(), "question is required") {
+			t.Errorf("expected missing question error, got: %v", err)
+		}
+		if _, err := reg.Execute(map[string]interface{}{"question": "q", "freshness": "hour"}, client, nil); err == nil || !strings.Contains(err.Error(), "invalid freshness") {
+			t.Errorf("expected freshness error, got: %v", err)
+		}
+	})
+}
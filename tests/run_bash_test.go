@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// runBashWithOptions calls run_bash with extra parameters
+func runBashWithOptions(command string, opts map[string]interface{}) (string, error) {
+	reg, _ := tools.GetTool("run_bash")
+	input := map[string]interface{}{"command": command}
+	for k, v := range opts {
+		input[k] = v
+	}
+	return reg.Execute(input, nil, nil)
+}
+
+// TestRunBashOptions tests timeouts, cwd, env and output limits
+func TestRunBashOptions(t *testing.T) {
+	t.Run("Timeout kills the command and its children", func(t *testing.T) {
+		marker := filepath.Join(t.TempDir(), "child-survived")
+
+		start := time.Now()
+		_, err := runBashWithOptions(
+			"(sleep 3; touch "+marker+") & echo started; sleep 30",
+			map[string]interface{}{"timeout_seconds": float64(1)},
+		)
+		elapsed := time.Since(start)
+
+		if err == nil {
+			t.Fatal("Expected timeout error")
+		}
+		if !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("Expected 'timed out' in error, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "started") {
+			t.Errorf("Expected partial output in error, got: %v", err)
+		}
+		if elapsed > 10*time.Second {
+			t.Errorf("Timeout took too long: %s", elapsed)
+		}
+
+		// The backgrounded child belongs to the same process group and
+		// must have been killed too
+		time.Sleep(3 * time.Second)
+		if _, err := os.Stat(marker); err == nil {
+			t.Error("Child process survived the timeout")
+		}
+	})
+
+	t.Run("Runs in cwd", func(t *testing.T) {
+		dir := t.TempDir()
+		output, err := runBashWithOptions("pwd", map[string]interface{}{"cwd": dir})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resolved, _ := filepath.EvalSymlinks(dir)
+		if strings.TrimSpace(output) != dir && strings.TrimSpace(output) != resolved {
+			t.Errorf("Expected pwd %s, got %s", dir, output)
+		}
+	})
+
+	t.Run("Rejects missing cwd", func(t *testing.T) {
+		_, err := runBashWithOptions("pwd", map[string]interface{}{"cwd": "/nonexistent/dir/xyz"})
+		if err == nil || !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("Expected 'does not exist' error, got: %v", err)
+		}
+	})
+
+	t.Run("Passes extra env", func(t *testing.T) {
+		output, err := runBashWithOptions("echo $CLYDE_TEST_VAR", map[string]interface{}{
+			"env": map[string]interface{}{"CLYDE_TEST_VAR": "hello-env"},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if strings.TrimSpace(output) != "hello-env" {
+			t.Errorf("Expected 'hello-env', got %q", output)
+		}
+	})
+
+	t.Run("Separates stderr from stdout", func(t *testing.T) {
+		output, err := executeRunBash("echo out; echo err >&2")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if output != "out\n[stderr]\nerr\n" {
+			t.Errorf("Unexpected output: %q", output)
+		}
+	})
+
+	t.Run("Truncates long output and saves the full stream", func(t *testing.T) {
+		old := os.Getenv("CLYDE_BASH_MAX_OUTPUT_KB")
+		defer os.Setenv("CLYDE_BASH_MAX_OUTPUT_KB", old)
+		os.Setenv("CLYDE_BASH_MAX_OUTPUT_KB", "4")
+
+		output, err := executeRunBash("seq 1 20000")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(output) > 6*1024 {
+			t.Errorf("Expected truncated output, got %d bytes", len(output))
+		}
+		if !strings.HasPrefix(output, "1\n2\n3\n") {
+			t.Errorf("Expected head of output to be kept, got: %q", output[:20])
+		}
+		if !strings.HasSuffix(output, "19999\n20000\n") {
+			t.Errorf("Expected tail of output to be kept")
+		}
+		if !strings.Contains(output, "bytes of stdout omitted") {
+			t.Errorf("Expected truncation marker, got: %s", output)
+		}
+
+		// The marker names a file containing the complete output
+		start := strings.Index(output, "saved to ")
+		end := strings.Index(output, " (use read_file")
+		if start < 0 || end < start {
+			t.Fatalf("Expected spill file path in output: %s", output)
+		}
+		spillPath := output[start+len("saved to ") : end]
+
+		full, err := os.ReadFile(spillPath)
+		if err != nil {
+			t.Fatalf("Failed to read spill file: %v", err)
+		}
+		if strings.Count(string(full), "\n") != 20000 {
+			t.Errorf("Expected 20000 lines in spill file, got %d", strings.Count(string(full), "\n"))
+		}
+
+		// read_file can open it without widening the workspace roots
+		viewed, err := executeReadFile(spillPath)
+		if err != nil {
+			t.Fatalf("Expected read_file to open the spill file, got: %v", err)
+		}
+		if !strings.Contains(viewed, "19999") {
+			t.Errorf("Expected spill file contents from read_file, got: %.200s", viewed)
+		}
+	})
+}
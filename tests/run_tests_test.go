@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// testsModule writes a module whose packages pass, fail in a subtest,
+// panic, hang, fail to build and have no tests
+func testsModule(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":      "module example.com/rt\n\ngo 1.21\n",
+		"good/add.go": "package good\n\nfunc Add(a, b int) int { return a + b }\n\nfunc Sub(a, b int) int { return a - b }\n",
+		"good/add_test.go": `package good
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	if Add(1, 2) != 3 {
+		t.Fatal("bad")
+	}
+}
+
+func TestLater(t *testing.T) { t.Skip("not today") }
+`,
+		"bad/table_test.go": `package bad
+
+import "testing"
+
+func TestTable(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		in, want int
+	}{{"one", 1, 1}, {"two", 2, 3}} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Log("checking", tc.name)
+			if tc.in != tc.want {
+				t.Errorf("got %d, want %d", tc.in, tc.want)
+			}
+		})
+	}
+}
+
+func TestFine(t *testing.T) {}
+`,
+		"boom/index.go": "package boom\n\nfunc Index(s []int, i int) int {\n\treturn s[i]\n}\n",
+		"boom/index_test.go": `package boom
+
+import "testing"
+
+func TestIndex(t *testing.T) {
+	t.Log("before")
+	Index([]int{1, 2, 3}, 5)
+}
+`,
+		"slow/slow_test.go": `package slow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuick(t *testing.T) {}
+
+func TestStuck(t *testing.T) { time.Sleep(time.Hour) }
+`,
+		"broken/broken.go":      "package broken\n\nfunc F() int { return undefinedThing }\n",
+		"broken/broken_test.go": "package broken\n\nimport \"testing\"\n\nfunc TestF(t *testing.T) { F() }\n",
+		"notests/doc.go":        "package notests\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunTests(t *testing.T) {
+	useTempWorkspace(t)
+	dir := testsModule(t)
+	t.Chdir(dir)
+	expect := func(t *testing.T, result string, want ...string) {
+		t.Helper()
+		for _, w := range want {
+			if !strings.Contains(result, w) {
+				t.Errorf("expected %q in:\n%s", w, result)
+			}
+		}
+	}
+
+	t.Run("summary", func(t *testing.T) {
+		var mu sync.Mutex
+		var progress []string
+		tools.SetProgressReporter(func(msg string) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress = append(progress, msg)
+		})
+		defer tools.SetProgressReporter(nil)
+
+		result, err := executeTool("run_tests", map[string]interface{}{"timeout_seconds": float64(3), "count": float64(1)})
+		if err != nil {
+			t.Fatalf("run_tests failed: %v", err)
+		}
+		expect(t, result,
+			"FAIL: 4 packages failed, 1 passed",
+			"✓ example.com/rt/good",
+			"1 passed, 1 skipped",
+			"✗ example.com/rt/bad",
+			"2 passed, 2 failed",
+			"✗ example.com/rt/broken",
+			"build failed",
+			"timed out after 3s",
+			"(1 package without test files)",
+			// Only the failing subtest is listed, not its parent
+			"--- TestTable/two (bad, ",
+			"bad/table_test.go:13",
+			"got 2, want 3",
+			"--- TestIndex (boom, ",
+			"boom/index.go:4",
+			"💥 panic: runtime error: index out of range [5] with length 3",
+			"--- TestStuck (slow)  slow/slow_test.go:10",
+			"⏱️ still running when the 3s timeout hit",
+			"Build errors:",
+			"undefined: undefinedThing",
+		)
+		if strings.Contains(result, "--- TestTable (") || strings.Contains(result, "goroutine ") {
+			t.Errorf("expected parents of failing subtests and goroutine dumps to be left out:\n%s", result)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		joined := strings.Join(progress, "\n")
+		expect(t, joined, "🧪 go test -json", "✓ example.com/rt/good: 1 passed", "✗ TestTable/two (bad)")
+	})
+
+	t.Run("filters and coverage", func(t *testing.T) {
+		result, err := executeTool("run_tests", map[string]interface{}{"packages": []interface{}{"./good", "./bad"}, "run": "TestAdd|TestFine", "coverage": true})
+		if err != nil {
+			t.Fatalf("run_tests failed: %v", err)
+		}
+		expect(t, result, "PASS: 2 passed (2 tests: 2 passed, 0 failed, 0 skipped)", "coverage 50.0%")
+		if strings.Contains(result, "Failures") {
+			t.Errorf("expected the failing test to be filtered out:\n%s", result)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := executeTool("run_tests", map[string]interface{}{"packages": []interface{}{"-exec=sh"}}); err == nil || !strings.Contains(err.Error(), "not a package pattern") {
+			t.Errorf("expected flags to be refused, got: %v", err)
+		}
+		result, err := executeTool("run_tests", map[string]interface{}{"packages": []interface{}{"./missing"}})
+		if err != nil || !strings.Contains(result, "✗ ./missing  build failed") || !strings.Contains(result, "directory not found") {
+			t.Errorf("expected the missing package to be reported, got: %s (%v)", result, err)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// TestRunBashSandbox tests the namespace sandbox backend for run_bash
+func TestRunBashSandbox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox is only supported on Linux")
+	}
+	defer tools.Shutdown()
+
+	workspace := t.TempDir()
+	outside := t.TempDir()
+	t.Setenv("CLYDE_SANDBOX", "namespaces")
+	t.Setenv("CLYDE_SANDBOX_WORKSPACE", workspace)
+
+	if _, err := executeRunBash("true"); err != nil {
+		if strings.Contains(err.Error(), "cannot create user namespaces") {
+			t.Skipf("user namespaces unavailable: %v", err)
+		}
+		t.Fatalf("Sandboxed command failed: %v", err)
+	}
+
+	t.Run("Workspace is writable", func(t *testing.T) {
+		if _, err := executeRunBash("echo ok > " + filepath.Join(workspace, "out.txt")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		data, _ := os.ReadFile(filepath.Join(workspace, "out.txt"))
+		if string(data) != "ok\n" {
+			t.Errorf("Expected file written in workspace, got %q", data)
+		}
+	})
+
+	t.Run("Outside the workspace is read-only", func(t *testing.T) {
+		target := filepath.Join(outside, "blocked.txt")
+		_, err := executeRunBash("echo no > " + target)
+		if err == nil {
+			t.Fatal("Expected write outside the workspace to fail")
+		}
+		if !strings.Contains(err.Error(), "writes are only allowed in") {
+			t.Errorf("Expected sandbox explanation, got: %v", err)
+		}
+		if _, statErr := os.Stat(target); statErr == nil {
+			t.Error("File outside the workspace was created")
+		}
+	})
+
+	t.Run("Reading outside the workspace still works", func(t *testing.T) {
+		os.WriteFile(filepath.Join(outside, "readme.txt"), []byte("visible"), 0644)
+		output, err := executeRunBash("cat " + filepath.Join(outside, "readme.txt"))
+		if err != nil || output != "visible" {
+			t.Errorf("Expected to read file outside workspace, got %q, %v", output, err)
+		}
+	})
+
+	t.Run("Private TMPDIR is writable", func(t *testing.T) {
+		output, err := executeRunBash("f=$(mktemp) && echo tmp > $f && cat $f")
+		if err != nil || output != "tmp\n" {
+			t.Errorf("Expected mktemp to work, got %q, %v", output, err)
+		}
+	})
+
+	t.Run("Network is disabled by default", func(t *testing.T) {
+		_, err := executeRunBash("echo > /dev/tcp/192.0.2.1/80")
+		if err == nil || !strings.Contains(err.Error(), "network access is disabled") {
+			t.Errorf("Expected network violation, got: %v", err)
+		}
+	})
+
+	t.Run("Host processes are out of reach", func(t *testing.T) {
+		host := exec.Command("sleep", "30")
+		if err := host.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer host.Process.Kill()
+		pid := strconv.Itoa(host.Process.Pid)
+		if _, err := executeRunBash("kill -0 " + pid); err == nil {
+			t.Errorf("Expected host process %s not to be signalable from the sandbox", pid)
+		}
+	})
+
+	t.Run("CPU limit is enforced", func(t *testing.T) {
+		t.Setenv("CLYDE_SANDBOX_CPU_SECONDS", "1")
+		_, err := executeRunBash("while :; do :; done")
+		if err == nil || !strings.Contains(err.Error(), "CPU time limit of 1s exceeded") {
+			t.Errorf("Expected CPU limit violation, got: %v", err)
+		}
+	})
+
+	t.Run("Persistent shell is sandboxed", func(t *testing.T) {
+		defer tools.ResetShellSession()
+		_, err := runBashWithOptions("touch "+filepath.Join(outside, "session.txt"), map[string]interface{}{"persistent": true})
+		if err == nil || !strings.Contains(err.Error(), "Read-only file system") {
+			t.Errorf("Expected read-only error in persistent shell, got: %v", err)
+		}
+	})
+
+	t.Run("Progress message shows sandbox", func(t *testing.T) {
+		reg, _ := tools.GetTool("run_bash")
+		if msg := reg.Display(map[string]interface{}{"command": "ls"}); !strings.Contains(msg, "sandboxed") {
+			t.Errorf("Expected sandboxed in display, got: %s", msg)
+		}
+	})
+
+	t.Run("Unknown mode is rejected", func(t *testing.T) {
+		t.Setenv("CLYDE_SANDBOX", "jail")
+		_, err := executeRunBash("true")
+		if err == nil || !strings.Contains(err.Error(), "unknown CLYDE_SANDBOX value") {
+			t.Errorf("Expected unknown mode error, got: %v", err)
+		}
+	})
+}
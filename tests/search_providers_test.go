@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// clearSearchEnv removes provider settings so each test configures its own
+func clearSearchEnv(t *testing.T) {
+	for _, name := range []string{"BRAVE_SEARCH_API_KEY", "CLYDE_BRAVE_URL", "CLYDE_SEARXNG_URL", "CLYDE_SEARCH_COMMAND", "CLYDE_SEARCH_PROVIDERS"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestSearchProviders(t *testing.T) {
+	var braveQuery atomic.Value
+	var braveStatus atomic.Int32
+	brave := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		braveQuery.Store(r.URL.Query())
+		if r.Header.Get("X-Subscription-Token") != "brave-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if status := braveStatus.Load(); status != 0 {
+			w.WriteHeader(int(status))
+			return
+		}
+		results := []map[string]string{
+			{"title": "net/http", "url": "https://pkg.go.dev/net/http", "description": "Package http provides HTTP client and server implementations.", "age": "2 days ago"},
+		}
+		if r.URL.Query().Get("q") == "paging" {
+			// A full page of numbered results, as Brave pages them
+			count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+			page, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			results = nil
+			for i := 1; i <= count; i++ {
+				n := strconv.Itoa(page*count + i)
+				results = append(results, map[string]string{"title": "result " + n, "url": "https://example.com/" + n})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"web": map[string]interface{}{"results": results},
+		})
+	}))
+	defer brave.Close()
+
+	var searxQuery atomic.Value
+	searx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		searxQuery.Store(r.URL.Query())
+		if r.URL.Path != "/search" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]string{
+				{"title": "SearX result one", "url": "https://example.com/1", "content": "First snippet"},
+				{"title": "SearX result two", "url": "https://example.com/2", "content": "Second snippet"},
+				{"title": "SearX result three", "url": "https://example.com/3", "content": "Third snippet"},
+			},
+		})
+	}))
+	defer searx.Close()
+
+	t.Run("Brave receives structured options", func(t *testing.T) {
+		clearSearchEnv(t)
+		t.Setenv("BRAVE_SEARCH_API_KEY", "brave-key")
+		t.Setenv("CLYDE_BRAVE_URL", brave.URL)
+		braveStatus.Store(0)
+
+		output, err := executeTool("web_search", map[string]interface{}{
+			"query":       "http client",
+			"num_results": float64(5),
+			"site":        "https://pkg.go.dev/",
+			"freshness":   "week",
+			"language":    "en",
+			"offset":      float64(10),
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		q := braveQuery.Load().(url.Values)
+		if q.Get("q") != "site:pkg.go.dev http client" || q.Get("freshness") != "pw" || q.Get("search_lang") != "en" || q.Get("offset") != "2" || q.Get("count") != "5" {
+			t.Errorf("Unexpected Brave parameters: %v", q)
+		}
+		if !strings.Contains(output, "(via brave)") || !strings.Contains(output, "11. [net/http] - https://pkg.go.dev/net/http") || !strings.Contains(output, "2 days ago") {
+			t.Errorf("Unexpected output: %s", output)
+		}
+	})
+
+	t.Run("Brave offsets that aren't a multiple of the count", func(t *testing.T) {
+		clearSearchEnv(t)
+		t.Setenv("BRAVE_SEARCH_API_KEY", "brave-key")
+		t.Setenv("CLYDE_BRAVE_URL", brave.URL)
+		braveStatus.Store(0)
+
+		output, err := executeTool("web_search", map[string]interface{}{"query": "paging", "num_results": float64(10), "offset": float64(5)})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "6. [result 6]") || !strings.Contains(output, "15. [result 15]") || strings.Contains(output, "[result 5]") || strings.Contains(output, "[result 16]") {
+			t.Errorf("Expected results 6 to 15, numbered as such, got: %s", output)
+		}
+
+		_, err = executeTool("web_search", map[string]interface{}{"query": "paging", "num_results": float64(10), "offset": float64(195)})
+		if err == nil || !strings.Contains(err.Error(), "multiple of num_results") {
+			t.Errorf("Expected an unreachable offset to be refused, got: %v", err)
+		}
+	})
+
+	t.Run("SearXNG", func(t *testing.T) {
+		clearSearchEnv(t)
+		t.Setenv("CLYDE_SEARXNG_URL", searx.URL+"/")
+
+		output, err := executeTool("web_search", map[string]interface{}{"query": "rust async", "num_results": float64(2), "freshness": "month", "language": "de", "offset": float64(2)})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		q := searxQuery.Load().(url.Values)
+		if q.Get("format") != "json" || q.Get("time_range") != "month" || q.Get("language") != "de" || q.Get("pageno") != "2" {
+			t.Errorf("Unexpected SearXNG parameters: %v", q)
+		}
+		if !strings.Contains(output, "(via searxng)") || !strings.Contains(output, "SearX result two") || strings.Contains(output, "SearX result three") {
+			t.Errorf("Expected 2 SearXNG results, got: %s", output)
+		}
+	})
+
+	t.Run("Command provider", func(t *testing.T) {
+		clearSearchEnv(t)
+		t.Setenv("CLYDE_SEARCH_COMMAND", `printf '{"results":[{"title":"%s","url":"https://example.org/?lang=%s","snippet":"from a script"}]}' "$1" "$CLYDE_SEARCH_LANGUAGE"`)
+
+		output, err := executeTool("web_search", map[string]interface{}{"query": "sqlite wal", "site": "sqlite.org", "language": "fr"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "[site:sqlite.org sqlite wal] - https://example.org/?lang=fr") || !strings.Contains(output, "(via command)") {
+			t.Errorf("Unexpected command output: %s", output)
+		}
+
+		t.Setenv("CLYDE_SEARCH_COMMAND", "echo not json")
+		_, err = executeTool("web_search", map[string]interface{}{"query": "x"})
+		if err == nil || !strings.Contains(err.Error(), "not a JSON array") {
+			t.Errorf("Expected parse error, got: %v", err)
+		}
+	})
+
+	t.Run("Falls back when a provider fails", func(t *testing.T) {
+		clearSearchEnv(t)
+		t.Setenv("BRAVE_SEARCH_API_KEY", "brave-key")
+		t.Setenv("CLYDE_BRAVE_URL", brave.URL)
+		t.Setenv("CLYDE_SEARXNG_URL", searx.URL)
+		braveStatus.Store(http.StatusTooManyRequests)
+		defer braveStatus.Store(0)
+
+		var progress []string
+		tools.SetProgressReporter(func(msg string) { progress = append(progress, msg) })
+		defer tools.SetProgressReporter(nil)
+
+		output, err := executeTool("web_search", map[string]interface{}{"query": "fallback"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "(via searxng)") {
+			t.Errorf("Expected SearXNG fallback, got: %s", output)
+		}
+		if len(progress) != 1 || !strings.Contains(progress[0], "brave search failed, trying searxng") {
+			t.Errorf("Expected fallback progress message, got: %v", progress)
+		}
+	})
+
+	t.Run("All providers failing reports each error", func(t *testing.T) {
+		clearSearchEnv(t)
+		t.Setenv("CLYDE_SEARCH_PROVIDERS", "brave, command")
+		t.Setenv("CLYDE_SEARCH_COMMAND", "exit 3")
+
+		_, err := executeTool("web_search", map[string]interface{}{"query": "nothing works"})
+		if err == nil || !strings.Contains(err.Error(), "all search providers failed") ||
+			!strings.Contains(err.Error(), "brave: BRAVE_SEARCH_API_KEY not found") || !strings.Contains(err.Error(), "command: search command failed") {
+			t.Errorf("Expected combined error, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		clearSearchEnv(t)
+		t.Setenv("CLYDE_SEARCH_PROVIDERS", "google")
+		_, err := executeTool("web_search", map[string]interface{}{"query": "x"})
+		if err == nil || !strings.Contains(err.Error(), "unknown search provider 'google'") {
+			t.Errorf("Expected unknown provider error, got: %v", err)
+		}
+
+		_, err = executeTool("web_search", map[string]interface{}{"query": "x", "freshness": "hour"})
+		if err == nil || !strings.Contains(err.Error(), "invalid freshness") {
+			t.Errorf("Expected freshness error, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain relaxes policies that would otherwise get in the way of fixtures:
+// many tests serve pages from loopback httptest servers, and none should
+// leave entries in the real HTTP cache or checkpoints in
+// ~/.clyde/checkpoints. Tests of these features override the settings.
+// Tests that give file tools paths under t.TempDir() call useTempWorkspace.
+func TestMain(m *testing.M) {
+	// The lsp tests start this binary as a fake language server
+	if os.Getenv("CLYDE_FAKE_LSP") != "" {
+		runFakeLSPServer()
+		return
+	}
+	os.Setenv("CLYDE_FETCH_ALLOW_PRIVATE", "true")
+	os.Setenv("CLYDE_FETCH_LOG", "off")
+	os.Setenv("CLYDE_CACHE", "false")
+	os.Setenv("CLYDE_CHECKPOINTS", "false")
+	os.Exit(m.Run())
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// TestPersistentShellSession tests state carry-over in the persistent shell
+func TestPersistentShellSession(t *testing.T) {
+	defer tools.ResetShellSession()
+	persistent := map[string]interface{}{"persistent": true}
+
+	t.Run("cd and export carry over", func(t *testing.T) {
+		dir := t.TempDir()
+		if _, err := runBashWithOptions("cd "+dir+" && export CLYDE_SESSION_VAR=kept", persistent); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		output, err := runBashWithOptions("pwd; echo $CLYDE_SESSION_VAR", persistent)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resolved, _ := filepath.EvalSymlinks(dir)
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		if len(lines) != 2 || (lines[0] != dir && lines[0] != resolved) || lines[1] != "kept" {
+			t.Errorf("Expected [%s kept], got %q", dir, output)
+		}
+	})
+
+	t.Run("Progress message shows session directory", func(t *testing.T) {
+		reg, _ := tools.GetTool("run_bash")
+		msg := reg.Display(map[string]interface{}{"command": "ls", "persistent": true})
+		if !strings.Contains(msg, "(in ") {
+			t.Errorf("Expected current directory in display, got: %s", msg)
+		}
+	})
+
+	t.Run("Per-command exit codes", func(t *testing.T) {
+		_, err := runBashWithOptions("false", persistent)
+		if err == nil || !strings.Contains(err.Error(), "exit code 1") {
+			t.Errorf("Expected exit code 1 error, got: %v", err)
+		}
+
+		output, err := runBashWithOptions("echo still-alive", persistent)
+		if err != nil {
+			t.Fatalf("Session should survive a failing command: %v", err)
+		}
+		if output != "still-alive\n" {
+			t.Errorf("Expected 'still-alive', got %q", output)
+		}
+	})
+
+	t.Run("Output without trailing newline and stderr", func(t *testing.T) {
+		output, err := runBashWithOptions("printf abc; echo oops >&2", persistent)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if output != "abc\n[stderr]\noops\n" {
+			t.Errorf("Unexpected output: %q", output)
+		}
+	})
+
+	t.Run("Recovers after the shell exits", func(t *testing.T) {
+		runBashWithOptions("cd /tmp && exit 3", persistent)
+
+		output, err := runBashWithOptions("echo $CLYDE_SESSION_VAR; pwd", persistent)
+		if err != nil {
+			t.Fatalf("Expected a fresh session, got error: %v", err)
+		}
+		if !strings.Contains(output, "started a new one") {
+			t.Errorf("Expected restart note, got: %s", output)
+		}
+		if strings.Contains(output, "kept") {
+			t.Errorf("Expected exported variable to be gone after restart, got: %s", output)
+		}
+	})
+
+	t.Run("Timeout kills the session", func(t *testing.T) {
+		_, err := runBashWithOptions("sleep 30", map[string]interface{}{
+			"persistent":      true,
+			"timeout_seconds": float64(1),
+		})
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("Expected timeout error, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "losing its exported variables") {
+			t.Errorf("Expected the lost session state to be mentioned, got: %v", err)
+		}
+
+		output, err := runBashWithOptions("echo back", persistent)
+		if err != nil {
+			t.Fatalf("Expected session to restart after timeout: %v", err)
+		}
+		if !strings.HasPrefix(output, "back\n") {
+			t.Errorf("Unexpected output: %q", output)
+		}
+	})
+
+	t.Run("Reset clears state", func(t *testing.T) {
+		runBashWithOptions("export CLYDE_RESET_VAR=set", persistent)
+
+		output, err := runBashWithOptions("", map[string]interface{}{"reset": true})
+		if err != nil || !strings.Contains(output, "reset") {
+			t.Fatalf("Expected reset confirmation, got %q, %v", output, err)
+		}
+
+		output, _ = runBashWithOptions("echo \"[$CLYDE_RESET_VAR]\"", persistent)
+		if output != "[]\n" {
+			t.Errorf("Expected variable to be cleared after reset, got %q", output)
+		}
+	})
+
+	t.Run("Non-persistent calls are unaffected", func(t *testing.T) {
+		runBashWithOptions("export CLYDE_ISOLATED=1", persistent)
+		output, _ := executeRunBash("echo \"[$CLYDE_ISOLATED]\"")
+		if output != "[]\n" {
+			t.Errorf("Expected isolated shell, got %q", output)
+		}
+	})
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"github.com/this-is-alpha-iota/clyde/api"
 	"github.com/this-is-alpha-iota/clyde/config"
 	"github.com/this-is-alpha-iota/clyde/prompts"
 	"github.com/this-is-alpha-iota/clyde/tools"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
+	"testing"
 )
 
 // Test helper functions that wrap the new architecture
@@ -19,6 +23,13 @@ type ContentBlock = api.ContentBlock
 type Response = api.Response
 
 // Test helpers that call the actual tool implementations
+
+// executeTool runs any registered tool with the given input
+func executeTool(name string, input map[string]interface{}) (string, error) {
+	reg, _ := tools.GetTool(name)
+	return reg.Execute(input, nil, nil)
+}
+
 func executeListFiles(path string) (string, error) {
 	reg, _ := tools.GetTool("list_files")
 	input := map[string]interface{}{"path": path}
@@ -274,3 +285,40 @@ func (a *testAgent) HandleMessage(userInput string) (string, error) {
 		})
 	}
 }
+
+// scriptedModel answers each prompt with the tool calls scripted for it,
+// then with "done" once the tool results come back. Calls with a system
+// prompt other than the agent's "system" get the secondary reply, if any.
+func scriptedModel(t *testing.T, script map[string][]api.ContentBlock, secondary ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			System   string `json:"system"`
+			Messages []struct {
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		resp := api.Response{Type: "message", Role: "assistant", StopReason: "end_turn", Content: []api.ContentBlock{{Type: "text", Text: "done"}}}
+		if req.System != "system" && len(secondary) > 0 {
+			resp.Content[0].Text = secondary[0]
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+		var prompt string
+		if json.Unmarshal(req.Messages[len(req.Messages)-1].Content, &prompt) == nil {
+			if calls, ok := script[prompt]; ok {
+				resp.Content, resp.StopReason = calls, "tool_use"
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+// useTempWorkspace lets file tools reach the test's temporary directories,
+// which are outside the launch directory the workspace is confined to
+func useTempWorkspace(t *testing.T) {
+	t.Helper()
+	t.Setenv("CLYDE_WORKSPACE_ROOTS", os.TempDir())
+}
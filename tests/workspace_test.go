@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// TestWorkspaceConfinement tests that file tools stay inside the workspace
+func TestWorkspaceConfinement(t *testing.T) {
+	workspace := t.TempDir()
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	os.WriteFile(secret, []byte("top secret"), 0644)
+
+	// Only the launch directory and the test workspace are roots here
+	t.Setenv("CLYDE_WORKSPACE_ROOTS", workspace)
+
+	t.Run("Inside the workspace is allowed", func(t *testing.T) {
+		path := filepath.Join(workspace, "ok.txt")
+		if _, err := executeWriteFile(path, "fine"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if output, err := executeReadFile(path); err != nil || output != "fine" {
+			t.Errorf("Expected to read back file, got %q, %v", output, err)
+		}
+	})
+
+	t.Run("Outside the workspace is blocked", func(t *testing.T) {
+		_, err := executeReadFile(secret)
+		if err == nil || !strings.Contains(err.Error(), "outside the workspace") {
+			t.Errorf("Expected confinement error, got: %v", err)
+		}
+	})
+
+	t.Run("Relative escape is blocked", func(t *testing.T) {
+		cwd, _ := os.Getwd()
+		rel, _ := filepath.Rel(cwd, secret)
+		_, err := executeReadFile(rel)
+		if err == nil || !strings.Contains(err.Error(), "outside the workspace") {
+			t.Errorf("Expected confinement error for %s, got: %v", rel, err)
+		}
+	})
+
+	t.Run("Symlink pointing outside is blocked", func(t *testing.T) {
+		link := filepath.Join(workspace, "link.txt")
+		if err := os.Symlink(secret, link); err != nil {
+			t.Skipf("Cannot create symlink: %v", err)
+		}
+		_, err := executeReadFile(link)
+		if err == nil || !strings.Contains(err.Error(), "symlink target") {
+			t.Errorf("Expected symlink confinement error, got: %v", err)
+		}
+
+		_, err = executePatchFile(link, "top", "bottom")
+		if err == nil || !strings.Contains(err.Error(), "outside the workspace") {
+			t.Errorf("Expected patch_file to be blocked, got: %v", err)
+		}
+	})
+
+	t.Run("New files under a symlinked directory are checked", func(t *testing.T) {
+		dirLink := filepath.Join(workspace, "escape")
+		if err := os.Symlink(outside, dirLink); err != nil {
+			t.Skipf("Cannot create symlink: %v", err)
+		}
+		_, err := executeWriteFile(filepath.Join(dirLink, "sub", "new.txt"), "x")
+		if err == nil || !strings.Contains(err.Error(), "outside the workspace") {
+			t.Errorf("Expected write through symlinked directory to be blocked, got: %v", err)
+		}
+		if _, statErr := os.Stat(filepath.Join(outside, "sub")); statErr == nil {
+			t.Error("Directory was created outside the workspace")
+		}
+	})
+
+	t.Run("Allow glob permits outside path", func(t *testing.T) {
+		t.Setenv("CLYDE_FILE_ALLOW", filepath.Join(outside, "*.txt"))
+		if output, err := executeReadFile(secret); err != nil || output != "top secret" {
+			t.Errorf("Expected allow rule to permit read, got %q, %v", output, err)
+		}
+	})
+
+	t.Run("Default deny rule names the rule", func(t *testing.T) {
+		envFile := filepath.Join(workspace, ".env")
+		os.WriteFile(envFile, []byte("API_KEY=abc"), 0644)
+		_, err := executeReadFile(envFile)
+		if err == nil || !strings.Contains(err.Error(), "deny rule '.env'") {
+			t.Errorf("Expected deny rule error, got: %v", err)
+		}
+	})
+
+	t.Run("Custom deny glob", func(t *testing.T) {
+		t.Setenv("CLYDE_FILE_DENY", "secrets/**")
+		os.MkdirAll(filepath.Join(workspace, "secrets", "prod"), 0755)
+		path := filepath.Join(workspace, "secrets", "prod", "db.yaml")
+		os.WriteFile(path, []byte("password: hunter2"), 0644)
+
+		_, err := executeReadFile(path)
+		if err == nil || !strings.Contains(err.Error(), "deny rule 'secrets/**'") {
+			t.Errorf("Expected custom deny error, got: %v", err)
+		}
+
+		// Replacing the defaults re-allows .env
+		os.WriteFile(filepath.Join(workspace, ".env"), []byte("A=1"), 0644)
+		if _, err := executeReadFile(filepath.Join(workspace, ".env")); err != nil {
+			t.Errorf("Expected .env to be readable with custom rules, got: %v", err)
+		}
+	})
+
+	t.Run("grep omits matches in denied files", func(t *testing.T) {
+		dir := filepath.Join(workspace, "grepdir")
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, ".env"), []byte("TOKEN=needle"), 0644)
+		os.WriteFile(filepath.Join(dir, "main.go"), []byte("// needle"), 0644)
+
+		output, err := executeGrep("needle", dir, "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if strings.Contains(output, "TOKEN") {
+			t.Errorf("Expected .env match to be hidden, got: %s", output)
+		}
+		if !strings.Contains(output, "main.go") || !strings.Contains(output, "1 matches in files blocked") {
+			t.Errorf("Expected main.go match and omission note, got: %s", output)
+		}
+	})
+
+	t.Run("glob and list_files omit denied files", func(t *testing.T) {
+		dir := filepath.Join(workspace, "globdir")
+		os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+		os.WriteFile(filepath.Join(dir, ".env"), []byte("TOKEN=1"), 0644)
+		os.WriteFile(filepath.Join(dir, "sub", ".env"), []byte("TOKEN=2"), 0644)
+		os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644)
+
+		output, err := executeGlob("**/.env*", dir)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if strings.Contains(output, ".env\n") || !strings.Contains(output, "2 files blocked") {
+			t.Errorf("Expected .env files to be hidden, got: %s", output)
+		}
+
+		output, err = executeListFiles(dir)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if strings.Contains(output, ".env") || !strings.Contains(output, "main.go") || !strings.Contains(output, "1 entry blocked") {
+			t.Errorf("Expected .env to be left out of the listing, got: %s", output)
+		}
+	})
+
+	t.Run("Search tools validate their directory", func(t *testing.T) {
+		if _, err := executeGrep("x", outside, ""); err == nil || !strings.Contains(err.Error(), "outside the workspace") {
+			t.Errorf("Expected grep to be blocked, got: %v", err)
+		}
+		if _, err := executeListFiles(outside); err == nil || !strings.Contains(err.Error(), "outside the workspace") {
+			t.Errorf("Expected list_files to be blocked, got: %v", err)
+		}
+		reg, _ := tools.GetTool("glob")
+		if _, err := reg.Execute(map[string]interface{}{"pattern": "*.txt", "path": outside}, nil, nil); err == nil {
+			t.Error("Expected glob to be blocked")
+		}
+	})
+
+	t.Run("Confinement can be disabled", func(t *testing.T) {
+		t.Setenv("CLYDE_WORKSPACE_CONFINE", "false")
+		if _, err := executeReadFile(secret); err != nil {
+			t.Errorf("Expected read with confinement off, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/tools"
+)
+
+// writeFileWithOptions calls write_file with extra parameters
+func writeFileWithOptions(path, content string, opts map[string]interface{}) (string, error) {
+	reg, _ := tools.GetTool("write_file")
+	input := map[string]interface{}{
+		"path":    path,
+		"content": content,
+	}
+	for k, v := range opts {
+		input[k] = v
+	}
+	return reg.Execute(input, nil, nil)
+}
+
+// TestWriteFileAtomicBehavior tests permission, directory and format handling
+func TestWriteFileAtomicBehavior(t *testing.T) {
+	useTempWorkspace(t)
+	tmpDir := t.TempDir()
+
+	t.Run("Preserves executable bit", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "run.sh")
+		os.WriteFile(path, []byte("#!/bin/sh\necho old\n"), 0755)
+
+		if _, err := executeWriteFile(path, "#!/bin/sh\necho new\n"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		info, _ := os.Stat(path)
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("Expected mode 0755, got %o", info.Mode().Perm())
+		}
+	})
+
+	t.Run("patch_file preserves the mode too", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "build.sh")
+		os.WriteFile(path, []byte("#!/bin/sh\necho old\n"), 0750)
+
+		if _, err := executePatchFile(path, "echo old", "echo new"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		info, _ := os.Stat(path)
+		if info.Mode().Perm() != 0750 {
+			t.Errorf("Expected mode 0750, got %o", info.Mode().Perm())
+		}
+		entries, _ := os.ReadDir(tmpDir)
+		for _, e := range entries {
+			if strings.Contains(e.Name(), ".clyde-") {
+				t.Errorf("Temporary file left behind: %s", e.Name())
+			}
+		}
+	})
+
+	t.Run("Creates missing parent directories", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "a", "b", "c.txt")
+
+		output, err := executeWriteFile(path, "nested")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output, "created directory") {
+			t.Errorf("Expected directory creation note, got: %s", output)
+		}
+
+		content, _ := os.ReadFile(path)
+		if string(content) != "nested" {
+			t.Errorf("Expected 'nested', got %q", string(content))
+		}
+	})
+
+	t.Run("Refuses missing directory when create_dirs is false", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "nope", "file.txt")
+
+		_, err := writeFileWithOptions(path, "x", map[string]interface{}{"create_dirs": false})
+		if err == nil {
+			t.Fatal("Expected error for missing directory")
+		}
+		if !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("Expected 'does not exist' error, got: %v", err)
+		}
+	})
+
+	t.Run("Keeps CRLF line endings and trailing newline", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "windows.txt")
+		os.WriteFile(path, []byte("one\r\ntwo\r\n"), 0644)
+
+		if _, err := executeWriteFile(path, "uno\ndos\ntres"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		content, _ := os.ReadFile(path)
+		if string(content) != "uno\r\ndos\r\ntres\r\n" {
+			t.Errorf("Expected CRLF content with trailing newline, got %q", string(content))
+		}
+	})
+
+	t.Run("Keeps missing trailing newline", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "no_newline.txt")
+		os.WriteFile(path, []byte("a\nb"), 0644)
+
+		if _, err := executeWriteFile(path, "c\nd\n"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		content, _ := os.ReadFile(path)
+		if string(content) != "c\nd" {
+			t.Errorf("Expected no trailing newline, got %q", string(content))
+		}
+	})
+
+	t.Run("preserve_format false writes content verbatim", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "verbatim.txt")
+		os.WriteFile(path, []byte("one\r\ntwo\r\n"), 0644)
+
+		if _, err := writeFileWithOptions(path, "x\ny", map[string]interface{}{"preserve_format": false}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		content, _ := os.ReadFile(path)
+		if string(content) != "x\ny" {
+			t.Errorf("Expected verbatim content, got %q", string(content))
+		}
+	})
+
+	t.Run("Writes through symlinks", func(t *testing.T) {
+		target := filepath.Join(tmpDir, "target.txt")
+		link := filepath.Join(tmpDir, "link.txt")
+		os.WriteFile(target, []byte("old"), 0644)
+		os.Symlink(target, link)
+
+		if _, err := executeWriteFile(link, "new"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		info, _ := os.Lstat(link)
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Error("Expected link.txt to remain a symlink")
+		}
+		content, _ := os.ReadFile(target)
+		if string(content) != "new" {
+			t.Errorf("Expected target to be updated, got %q", string(content))
+		}
+	})
+
+	t.Run("Large overwrite policy", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "big.txt")
+		os.WriteFile(path, []byte(strings.Repeat("x", 3*1024)), 0644)
+
+		old := os.Getenv("CLYDE_WRITE_FILE_MAX_OVERWRITE_KB")
+		defer os.Setenv("CLYDE_WRITE_FILE_MAX_OVERWRITE_KB", old)
+		os.Setenv("CLYDE_WRITE_FILE_MAX_OVERWRITE_KB", "2")
+
+		_, err := executeWriteFile(path, "small")
+		if err == nil {
+			t.Fatal("Expected refusal for file above the limit")
+		}
+		if !strings.Contains(err.Error(), "allow_large_overwrite") {
+			t.Errorf("Expected hint about allow_large_overwrite, got: %v", err)
+		}
+
+		if _, err := writeFileWithOptions(path, "small", map[string]interface{}{"allow_large_overwrite": true}); err != nil {
+			t.Fatalf("Expected override to succeed, got: %v", err)
+		}
+
+		os.WriteFile(path, []byte(strings.Repeat("x", 3*1024)), 0644)
+		os.Setenv("CLYDE_WRITE_FILE_MAX_OVERWRITE_KB", "0")
+		if _, err := executeWriteFile(path, "small"); err != nil {
+			t.Fatalf("Expected limit 0 to disable the check, got: %v", err)
+		}
+	})
+
+	t.Run("No temp files left behind", func(t *testing.T) {
+		dir := filepath.Join(tmpDir, "clean")
+		os.Mkdir(dir, 0755)
+		path := filepath.Join(dir, "f.txt")
+
+		executeWriteFile(path, "one")
+		executeWriteFile(path, "two")
+
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Errorf("Expected exactly one file, found %d entries", len(entries))
+		}
+	})
+}
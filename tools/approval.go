@@ -0,0 +1,31 @@
+package tools
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	approvalMu sync.Mutex
+	approver   func(string) bool
+)
+
+// SetApprover sets who decides on operations that can lose work, such as
+// discarding uncommitted changes. The REPL asks the user; without an
+// approver those operations are refused.
+func SetApprover(fn func(question string) bool) {
+	approvalMu.Lock()
+	defer approvalMu.Unlock()
+	approver = fn
+}
+
+// requestApproval asks whether an operation may go ahead. It holds the lock
+// while asking so concurrent tools never prompt at the same time.
+func requestApproval(format string, args ...interface{}) bool {
+	approvalMu.Lock()
+	defer approvalMu.Unlock()
+	if approver == nil {
+		return false
+	}
+	return approver(fmt.Sprintf(format, args...))
+}
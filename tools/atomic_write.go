@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic replaces the contents of path by writing to a temporary
+// file in the same directory, syncing it, and renaming it over the original.
+// Readers never observe a half-written file. If path already exists its mode
+// and (where the platform allows) ownership are kept; otherwise the file is
+// created with mode 0644. Symlinks are followed so the link itself survives.
+func writeFileAtomic(path string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	mode := os.FileMode(0644)
+	existing, statErr := os.Stat(path)
+	if statErr == nil {
+		mode = existing.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".clyde-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	// Remove the temp file on any failure path
+	success := false
+	defer func() {
+		if !success {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return err
+	}
+	if statErr == nil {
+		preserveOwner(tmpPath, existing)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace '%s': %w", path, err)
+	}
+	success = true
+
+	// Persist the rename itself. Not every platform supports syncing a
+	// directory, so this is best effort.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package tools
+
+import "os"
+
+// preserveOwner is a no-op on platforms without POSIX ownership.
+func preserveOwner(path string, original os.FileInfo) {}
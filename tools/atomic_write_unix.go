@@ -0,0 +1,22 @@
+//go:build unix
+
+package tools
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner copies the uid/gid of the original file onto its replacement.
+// Changing ownership usually requires privileges, so failures are ignored:
+// the file then simply belongs to the current user.
+func preserveOwner(path string, original os.FileInfo) {
+	stat, ok := original.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	if int(stat.Uid) == os.Getuid() && int(stat.Gid) == os.Getgid() {
+		return
+	}
+	os.Lchown(path, int(stat.Uid), int(stat.Gid))
+}
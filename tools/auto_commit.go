@@ -0,0 +1,311 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/api"
+)
+
+// Auto-commit mode (CLYDE_AUTO_COMMIT=true): every turn that changes files
+// becomes its own commit. The commit holds the files the edit tools wrote,
+// plus other changes when the turn ran shell commands, since those may be
+// their side effects (go.sum, generated code). Files that already had
+// uncommitted changes when the turn started are never staged, so the
+// user's own work stays out of the agent's commits.
+
+const maxAutoCommitDiffKB = 24
+
+const autoCommitPrompt = `You write git commit messages in the Conventional Commits style.
+Reply with the message only. The first line is "type(scope): summary", where type is one of feat, fix, refactor, perf, test, docs, style, build, ci or chore and the scope is optional. Keep it under 72 characters, in the imperative mood, without a trailing period.
+If the change needs explaining, add a blank line and a short body wrapped at 72 columns. No code fences, no quotes.`
+
+var conventionalSubject = regexp.MustCompile(`^[a-z]+(\([^)]*\))?!?: \S`)
+
+var autoCommitState struct {
+	sync.Mutex
+	branchChecked bool            // the dedicated branch is set up once per session
+	turn          *autoCommitTurn // the turn in progress, which tools report to
+}
+
+func init() {
+	registerCleanup(func() {
+		autoCommitState.Lock()
+		defer autoCommitState.Unlock()
+		autoCommitState.branchChecked = false
+		autoCommitState.turn = nil
+	})
+}
+
+// autoCommitTurn remembers the repository state when a turn started and
+// what the turn's tools did. written and ranShell are guarded by
+// autoCommitState.
+type autoCommitTurn struct {
+	top      string
+	prompt   string
+	dirty    map[string]autoCommitStamp // files with uncommitted changes before the turn
+	written  map[string]bool            // files the edit tools wrote, relative to top
+	ranShell bool                       // run_bash or process ran a command
+}
+
+type autoCommitStamp struct {
+	exists bool
+	size   int64
+	mod    time.Time
+}
+
+func stampFile(path string) autoCommitStamp {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return autoCommitStamp{}
+	}
+	return autoCommitStamp{exists: true, size: info.Size(), mod: info.ModTime()}
+}
+
+// BeginAutoCommit notes which files are already dirty when a turn starts.
+// The returned function commits what the turn changed and describes the
+// commit for the user; it is nil when auto-commit mode is off or the
+// working directory is not in a git repository.
+func BeginAutoCommit(prompt string) func(apiClient *api.Client) string {
+	if !envBool("CLYDE_AUTO_COMMIT", false) {
+		return nil
+	}
+	out, err := runGit(".", "rev-parse", "--show-toplevel")
+	if err != nil {
+		reportProgress("⚠️ Auto-commit is on, but the current directory is not in a git repository")
+		return nil
+	}
+	top := strings.TrimSpace(out)
+	if err := autoCommitBranch(top); err != nil {
+		reportProgress("⚠️ Auto-commit is off for this turn: %v", err)
+		return nil
+	}
+	dirty, err := autoCommitDirtyFiles(top)
+	if err != nil {
+		reportProgress("⚠️ Auto-commit is off for this turn: %v", err)
+		return nil
+	}
+	turn := &autoCommitTurn{top: top, prompt: prompt, dirty: make(map[string]autoCommitStamp), written: make(map[string]bool)}
+	for _, path := range dirty {
+		turn.dirty[path] = stampFile(filepath.Join(top, path))
+	}
+	autoCommitState.Lock()
+	autoCommitState.turn = turn
+	autoCommitState.Unlock()
+	return turn.commit
+}
+
+// autoCommitNoteWrite records files write_file, patch_file or multi_patch
+// are about to change, so the commit can tell the agent's edits from
+// changes made some other way
+func autoCommitNoteWrite(paths ...string) {
+	autoCommitState.Lock()
+	defer autoCommitState.Unlock()
+	t := autoCommitState.turn
+	if t == nil {
+		return
+	}
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(t.top, resolvePath(abs)); err == nil && filepath.IsLocal(rel) {
+			t.written[filepath.ToSlash(rel)] = true
+		}
+	}
+}
+
+// autoCommitNoteShell records that the turn ran a shell command
+func autoCommitNoteShell() {
+	autoCommitState.Lock()
+	defer autoCommitState.Unlock()
+	if t := autoCommitState.turn; t != nil {
+		t.ranShell = true
+	}
+}
+
+// autoCommitBranch switches to CLYDE_AUTO_COMMIT_BRANCH, creating it from
+// the current commit, the first time a session commits
+func autoCommitBranch(top string) error {
+	branch := strings.TrimSpace(os.Getenv("CLYDE_AUTO_COMMIT_BRANCH"))
+	autoCommitState.Lock()
+	defer autoCommitState.Unlock()
+	if branch == "" || autoCommitState.branchChecked {
+		return nil
+	}
+	current, _ := runGit(top, "branch", "--show-current")
+	current = strings.TrimSpace(current)
+	if current != branch {
+		if _, err := runGit(top, "check-ref-format", "--branch", branch); err != nil || strings.HasPrefix(branch, "-") {
+			return fmt.Errorf("CLYDE_AUTO_COMMIT_BRANCH '%s' is not a valid branch name", branch)
+		}
+		args := []string{"switch", "--create", branch}
+		if _, err := runGit(top, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+			args = []string{"switch", branch}
+		}
+		if _, err := runGit(top, args...); err != nil {
+			return err
+		}
+		if current == "" {
+			current = "detached HEAD"
+		}
+		reportProgress("🌿 Auto-commit: switched from %s to branch %s", current, branch)
+	}
+	autoCommitState.branchChecked = true
+	return nil
+}
+
+// autoCommitDirtyFiles lists every path with staged, unstaged or untracked
+// changes, relative to the repository root
+func autoCommitDirtyFiles(top string) ([]string, error) {
+	out, err := runGit(top, "status", "--porcelain=v2", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	status := parseGitStatus(out)
+	var paths []string
+	for _, f := range append(append(status.Staged, status.Unstaged...), status.Conflicted...) {
+		paths = append(paths, f.Path)
+		if f.From != "" {
+			paths = append(paths, f.From)
+		}
+	}
+	paths = append(paths, status.Untracked...)
+	return paths, nil
+}
+
+// commit stages and commits the files the turn changed
+func (t *autoCommitTurn) commit(apiClient *api.Client) string {
+	autoCommitState.Lock()
+	if autoCommitState.turn == t {
+		autoCommitState.turn = nil
+	}
+	written, ranShell := t.written, t.ranShell
+	autoCommitState.Unlock()
+
+	if gitDir, err := runGit(t.top, "rev-parse", "--absolute-git-dir"); err == nil {
+		if op := gitOperationInProgress(strings.TrimSpace(gitDir)); op != "" {
+			return fmt.Sprintf("⚠️ Auto-commit skipped: a %s is in progress", op)
+		}
+	}
+	dirty, err := autoCommitDirtyFiles(t.top)
+	if err != nil {
+		return fmt.Sprintf("⚠️ Auto-commit failed: %v", err)
+	}
+	seen := make(map[string]bool)
+	var paths, fromShell, leftAlone, notEdited []string
+	for _, path := range dirty {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		switch before, ok := t.dirty[path]; {
+		case ok:
+			if stampFile(filepath.Join(t.top, path)) != before {
+				leftAlone = append(leftAlone, path)
+			}
+		case written[path]:
+			paths = append(paths, path)
+		case ranShell:
+			fromShell = append(fromShell, path)
+		default:
+			notEdited = append(notEdited, path)
+		}
+	}
+	sort.Strings(fromShell)
+	paths = append(paths, fromShell...)
+	sort.Strings(paths)
+	sort.Strings(leftAlone)
+	sort.Strings(notEdited)
+	note := ""
+	if len(leftAlone) > 0 {
+		note += fmt.Sprintf("\n⚠️ Not committed, since they had uncommitted changes before the turn: %s", strings.Join(leftAlone, ", "))
+	}
+	if len(notEdited) > 0 {
+		note += fmt.Sprintf("\n⚠️ Not committed, since the agent didn't change them: %s", strings.Join(notEdited, ", "))
+	}
+	if len(paths) == 0 {
+		return strings.TrimPrefix(note, "\n")
+	}
+
+	// Stage new and deleted files too, then commit only these paths so
+	// anything the user had staged stays staged
+	if _, err := runGit(t.top, append([]string{"add", "--all", "--"}, paths...)...); err != nil {
+		return fmt.Sprintf("⚠️ Auto-commit failed: %v%s", err, note)
+	}
+	diff, _ := runGit(t.top, append([]string{"diff", "--cached", "--patch-with-stat", "--"}, paths...)...)
+	message := autoCommitMessage(apiClient, t.prompt, diff, paths)
+	args := []string{"commit", "--file=-", "--cleanup=strip", "--only"}
+	for _, a := range envList("CLYDE_GIT_CO_AUTHORS") {
+		if coAuthorPattern.MatchString(a) {
+			args = append(args, "--trailer", "Co-authored-by: "+a)
+		}
+	}
+	if _, err := runGitInput(t.top, message+"\n", append(append(args, "--"), paths...)...); err != nil {
+		runGit(t.top, append([]string{"restore", "--staged", "--"}, paths...)...)
+		return fmt.Sprintf("⚠️ Auto-commit failed, changes left uncommitted: %v%s", err, note)
+	}
+
+	hash, _ := runGit(t.top, "rev-parse", "--short", "HEAD")
+	branch, _ := runGit(t.top, "branch", "--show-current")
+	where := strings.TrimSpace(branch)
+	if where == "" {
+		where = "detached HEAD"
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	if len(fromShell) > 0 {
+		note = fmt.Sprintf("\n   Including changes from shell commands: %s", strings.Join(fromShell, ", ")) + note
+	}
+	return fmt.Sprintf("📝 Auto-committed %s on %s: %s (%d %s)%s", strings.TrimSpace(hash), where, subject, len(paths), plural(len(paths), "file"), note)
+}
+
+// autoCommitMessage asks the secondary model for a conventional commit
+// message, falling back to one naming the files
+func autoCommitMessage(apiClient *api.Client, prompt, diff string, paths []string) string {
+	if limit := maxAutoCommitDiffKB * 1024; len(diff) > limit {
+		diff = diff[:limit] + "\n... (diff truncated)"
+	}
+	reply, err := secondaryCall(apiClient, autoCommitPrompt, fmt.Sprintf("The user asked for:\n%s\n\nThe change:\n%s", prompt, diff), secondaryMaxTokens())
+	if err == nil {
+		if message := cleanCommitMessage(reply); message != "" {
+			return message
+		}
+	}
+
+	var names []string
+	for _, p := range paths[:min(len(paths), 3)] {
+		names = append(names, filepath.Base(p))
+	}
+	subject := "chore: update " + strings.Join(names, ", ")
+	if len(paths) > 3 {
+		subject += fmt.Sprintf(" and %d more", len(paths)-3)
+	}
+	request, _, _ := strings.Cut(strings.TrimSpace(prompt), "\n")
+	return fmt.Sprintf("%s\n\nRequested: %s", subject, request)
+}
+
+// cleanCommitMessage strips code fences and quotes from a model's reply
+// and makes sure the subject is in the conventional form
+func cleanCommitMessage(reply string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(reply), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "```") {
+			lines = append(lines, strings.TrimRight(line, " \t"))
+		}
+	}
+	message := strings.Trim(strings.TrimSpace(strings.Join(lines, "\n")), "\"'`")
+	if message == "" {
+		return ""
+	}
+	if subject, _, _ := strings.Cut(message, "\n"); !conventionalSubject.MatchString(subject) {
+		message = "chore: " + message
+	}
+	return message
+}
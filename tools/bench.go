@@ -0,0 +1,509 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/api"
+)
+
+func init() {
+	Register(benchTool, executeBench, displayBench)
+}
+
+var benchTool = api.Tool{
+	Name:        "bench",
+	Description: "Run Go benchmarks several times and report medians with 95% confidence intervals for time/op, B/op and allocs/op. With base set to a git ref (e.g. \"HEAD\" or \"main\"), the same benchmarks also run on that ref in a temporary worktree and the results are compared benchstat-style: the percentage change and whether it is statistically significant. Use this to back performance claims with numbers.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"bench": map[string]interface{}{
+				"type":        "string",
+				"description": "Regular expression selecting benchmarks (go test -bench, default \".\" for all)",
+			},
+			"packages": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Package patterns (default [\".\"])",
+			},
+			"base": map[string]interface{}{
+				"type":        "string",
+				"description": "Git ref to compare the working tree against, e.g. \"HEAD\" to measure uncommitted changes or \"main\"",
+			},
+			"count": map[string]interface{}{
+				"type":        "integer",
+				"description": "Runs of each benchmark per side (default 6, max 20). At least 6 are needed for confidence intervals",
+			},
+			"benchtime": map[string]interface{}{
+				"type":        "string",
+				"description": "Time or iterations per run, e.g. \"500ms\" or \"1000x\" (go test -benchtime, default 1s)",
+			},
+			"dir": map[string]interface{}{
+				"type":        "string",
+				"description": "Directory to run in, inside the module (default: current directory)",
+			},
+			"timeout_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": "Limit for each side's run (default 600)",
+			},
+		},
+	},
+}
+
+const (
+	defaultBenchCount          = 6
+	maxBenchCount              = 20
+	defaultBenchTimeoutSeconds = 600
+)
+
+var (
+	benchLine      = regexp.MustCompile(`^(Benchmark\S+)\s+\d+\s+(.+)$`)
+	benchValue     = regexp.MustCompile(`([\d.eE+-]+) (\S+)`)
+	benchTimeValue = regexp.MustCompile(`^\d+(\.\d+)?(x|ns|us|µs|ms|s|m|h)$`)
+)
+
+// benchSamples holds every measurement of one side: package → benchmark →
+// unit → values
+type benchSamples struct {
+	values map[string]map[string]map[string][]float64
+	order  []string // package + "\x00" + benchmark, in first-seen order
+	units  []string
+	config []string // goos, goarch and cpu lines
+	raw    string
+}
+
+func parseBenchOutput(out string) *benchSamples {
+	s := &benchSamples{values: make(map[string]map[string]map[string][]float64), raw: out}
+	seenUnit := make(map[string]bool)
+	pkg := ""
+	for _, line := range strings.Split(out, "\n") {
+		if v, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = strings.TrimSpace(v)
+			continue
+		}
+		for _, key := range []string{"goos: ", "goarch: ", "cpu: "} {
+			if strings.HasPrefix(line, key) && !slices.Contains(s.config, line) {
+				s.config = append(s.config, line)
+			}
+		}
+		m := benchLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		name := strings.TrimPrefix(m[1], "Benchmark")
+		if s.values[pkg] == nil {
+			s.values[pkg] = make(map[string]map[string][]float64)
+		}
+		if s.values[pkg][name] == nil {
+			s.values[pkg][name] = make(map[string][]float64)
+			s.order = append(s.order, pkg+"\x00"+name)
+		}
+		for _, v := range benchValue.FindAllStringSubmatch(m[2], -1) {
+			f, err := strconv.ParseFloat(v[1], 64)
+			if err != nil {
+				continue
+			}
+			s.values[pkg][name][v[2]] = append(s.values[pkg][name][v[2]], f)
+			if !seenUnit[v[2]] {
+				seenUnit[v[2]] = true
+				s.units = append(s.units, v[2])
+			}
+		}
+	}
+	return s
+}
+
+func (s *benchSamples) get(key, unit string) []float64 {
+	pkg, name, _ := strings.Cut(key, "\x00")
+	return s.values[pkg][name][unit]
+}
+
+func executeBench(input map[string]interface{}, apiClient *api.Client, history []api.Message) (string, error) {
+	dir, _ := input["dir"].(string)
+	if dir == "" {
+		dir = "."
+	}
+	if err := checkWorkspacePath(dir); err != nil {
+		return "", err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	bench, _ := input["bench"].(string)
+	if bench == "" {
+		bench = "."
+	}
+	count := defaultBenchCount
+	if v, ok := input["count"].(float64); ok && v > 0 {
+		count = min(int(v), maxBenchCount)
+	}
+	timeout := defaultBenchTimeoutSeconds
+	if v, ok := input["timeout_seconds"].(float64); ok && v > 0 {
+		timeout = int(v)
+	}
+	args := []string{"test", "-run", "^$", "-bench", bench, "-benchmem", "-count", strconv.Itoa(count), "-timeout", fmt.Sprintf("%ds", timeout)}
+	if benchtime, _ := input["benchtime"].(string); benchtime != "" {
+		if !benchTimeValue.MatchString(benchtime) {
+			return "", fmt.Errorf("benchtime '%s' is not a duration like \"500ms\" or an iteration count like \"1000x\"", benchtime)
+		}
+		args = append(args, "-benchtime", benchtime)
+	}
+	packages := stringList(input["packages"])
+	if len(packages) == 0 {
+		packages = []string{"."}
+	}
+	for _, p := range packages {
+		if strings.HasPrefix(p, "-") {
+			return "", fmt.Errorf("'%s' is not a package pattern. Use the bench, count and benchtime parameters for flags", p)
+		}
+	}
+	args = append(args, packages...)
+
+	base, _ := input["base"].(string)
+	var baseDir, baseLabel string
+	if base != "" {
+		var cleanup func()
+		baseDir, baseLabel, cleanup, err = benchWorktree(absDir, base)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+	}
+
+	reportProgress("⏱️  Benchmarking the working tree (%d runs)...", count)
+	head, err := runBenchmarks(absDir, args, timeout)
+	if err != nil {
+		return "", fmt.Errorf("benchmarks failed on the working tree: %w", err)
+	}
+	if len(head.order) == 0 {
+		return "", fmt.Errorf("no benchmarks matched '%s' in %s", bench, strings.Join(packages, " "))
+	}
+	if base == "" {
+		return formatBenchResults(nil, head, "", count), nil
+	}
+
+	reportProgress("⏱️  Benchmarking %s (%d runs)...", baseLabel, count)
+	old, err := runBenchmarks(baseDir, args, timeout)
+	if err != nil {
+		return "", fmt.Errorf("benchmarks failed on %s: %w", baseLabel, err)
+	}
+	return formatBenchResults(old, head, baseLabel, count), nil
+}
+
+// benchWorktree checks out ref in a temporary git worktree and returns the
+// directory matching dir inside it
+func benchWorktree(dir, ref string) (string, string, func(), error) {
+	if strings.HasPrefix(ref, "-") {
+		return "", "", nil, fmt.Errorf("'%s' is not a git ref", ref)
+	}
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(out)))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", "", nil, fmt.Errorf("comparing against a ref needs a git repository: %w", err)
+	}
+	commit, err := git("rev-parse", "--short", "--verify", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", "", nil, fmt.Errorf("unknown git ref '%s'", ref)
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", "", nil, err
+	}
+	rel, err := filepath.Rel(top, real)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "clyde-bench-")
+	if err != nil {
+		return "", "", nil, err
+	}
+	reportProgress("🌿 Checking out %s (%s) in a temporary worktree", ref, commit)
+	if _, err := git("worktree", "add", "--detach", tmp, commit); err != nil {
+		os.RemoveAll(tmp)
+		return "", "", nil, err
+	}
+	cleanup := func() {
+		git("worktree", "remove", "--force", tmp)
+		os.RemoveAll(tmp)
+		git("worktree", "prune")
+	}
+	label := ref
+	if ref != commit {
+		label = fmt.Sprintf("%s (%s)", ref, commit)
+	}
+	return filepath.Join(tmp, rel), label, cleanup, nil
+}
+
+// runBenchmarks runs go test in dir and parses its benchmark lines
+func runBenchmarks(dir string, args []string, timeout int) (*benchSamples, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = 2 * time.Second
+	setProcessGroup(cmd)
+	if err := sandboxCommand(cmd); err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run go test: %w. Is Go installed?", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	var err error
+	select {
+	case err = <-done:
+	// go test -timeout covers the benchmarks; allow for building too
+	case <-time.After(time.Duration(timeout)*time.Second + 2*time.Minute):
+		killProcessGroup(cmd)
+		<-done
+		return nil, fmt.Errorf("killed after %ds", timeout+120)
+	}
+	if err != nil {
+		var out []string
+		scanner := bufio.NewScanner(strings.NewReader(stdout.String() + stderr.String()))
+		for scanner.Scan() {
+			if line := scanner.Text(); !benchLine.MatchString(line) {
+				out = append(out, line)
+			}
+		}
+		return nil, fmt.Errorf("%v\n\n%s", err, strings.Join(tailLines(out, 40), "\n"))
+	}
+	return parseBenchOutput(stdout.String()), nil
+}
+
+// formatBenchResults renders one table per unit. With old results, each
+// row compares the medians and tests the difference for significance.
+func formatBenchResults(old, head *benchSamples, baseLabel string, count int) string {
+	var b strings.Builder
+	if old == nil {
+		fmt.Fprintf(&b, "Benchmarks on the working tree, %d runs each (median ± 95%% confidence interval)\n", count)
+	} else {
+		fmt.Fprintf(&b, "Comparing %s → working tree, %d runs each (median ± 95%% confidence interval)\n", baseLabel, count)
+	}
+	if len(head.config) > 0 {
+		b.WriteString(strings.Join(head.config, "\n") + "\n")
+	}
+
+	keys := head.order
+	var onlyOld, onlyHead []string
+	if old != nil {
+		present := make(map[string]bool)
+		for _, k := range head.order {
+			present[k] = true
+		}
+		keys = nil
+		for _, k := range old.order {
+			if present[k] {
+				keys = append(keys, k)
+			} else {
+				onlyOld = append(onlyOld, benchDisplayName(k, true))
+			}
+			delete(present, k)
+		}
+		for _, k := range head.order {
+			if present[k] {
+				onlyHead = append(onlyHead, benchDisplayName(k, true))
+			}
+		}
+	}
+	pkgs := make(map[string]bool)
+	for _, k := range keys {
+		pkg, _, _ := strings.Cut(k, "\x00")
+		pkgs[pkg] = true
+	}
+	multiPkg := len(pkgs) > 1
+
+	var summary []string
+	for _, unit := range head.units {
+		var rows [][]string
+		var oldMedians, headMedians []float64
+		better, worse, same := 0, 0, 0
+		for _, k := range keys {
+			h := head.get(k, unit)
+			if len(h) == 0 {
+				continue
+			}
+			hs := summarize(h)
+			row := []string{benchDisplayName(k, multiPkg)}
+			if old == nil {
+				row = append(row, hs.format(unit))
+				headMedians = append(headMedians, hs.median)
+				rows = append(rows, row)
+				continue
+			}
+			o := old.get(k, unit)
+			if len(o) == 0 {
+				continue
+			}
+			ob := summarize(o)
+			oldMedians = append(oldMedians, ob.median)
+			headMedians = append(headMedians, hs.median)
+			p := mannWhitneyP(o, h)
+			n := strconv.Itoa(len(h))
+			if len(o) != len(h) {
+				n = fmt.Sprintf("%d+%d", len(o), len(h))
+			}
+			delta := fmt.Sprintf("~ (p=%.3f n=%s)", p, n)
+			if p < 0.05 && ob.median != hs.median {
+				if ob.median == 0 {
+					delta = fmt.Sprintf("+%s (p=%.3f n=%s)", formatBenchValue(hs.median, unit), p, n)
+				} else {
+					delta = fmt.Sprintf("%+.2f%% (p=%.3f n=%s)", (hs.median-ob.median)/ob.median*100, p, n)
+				}
+				if (hs.median < ob.median) == lowerIsBetter(unit) {
+					better++
+				} else {
+					worse++
+				}
+			} else {
+				same++
+			}
+			rows = append(rows, append(row, ob.format(unit), hs.format(unit), delta))
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		// A geometric mean is meaningless with zeros, such as 0 allocs/op
+		if len(rows) > 1 && !slices.Contains(oldMedians, 0) && !slices.Contains(headMedians, 0) {
+			if old == nil {
+				rows = append(rows, []string{"geomean", formatBenchValue(geomean(headMedians), unit)})
+			} else {
+				og, hg := geomean(oldMedians), geomean(headMedians)
+				row := []string{"geomean", formatBenchValue(og, unit), formatBenchValue(hg, unit)}
+				if og > 0 {
+					row = append(row, fmt.Sprintf("%+.2f%%", (hg-og)/og*100))
+				}
+				rows = append(rows, row)
+			}
+		}
+		header := []string{unit, "working tree"}
+		if old != nil {
+			header = []string{unit, baseLabel, "working tree", "vs base"}
+			summary = append(summary, benchSummary(unit, better, worse, same))
+		}
+		b.WriteString("\n")
+		writeBenchTable(&b, header, rows)
+	}
+
+	if len(onlyOld) > 0 {
+		fmt.Fprintf(&b, "\nOnly in %s: %s\n", baseLabel, strings.Join(onlyOld, ", "))
+	}
+	if len(onlyHead) > 0 {
+		fmt.Fprintf(&b, "\nOnly in the working tree: %s\n", strings.Join(onlyHead, ", "))
+	}
+	if count < 6 {
+		b.WriteString("\n± ∞: at least 6 runs are needed for a 95% confidence interval\n")
+	}
+	if old != nil {
+		b.WriteString("\n~: no significant difference (Mann-Whitney U test, p ≥ 0.05)\n")
+		fmt.Fprintf(&b, "\nSummary: %s\n", strings.Join(summary, "; "))
+	}
+	if path := saveBenchOutput(old, head); path != "" {
+		fmt.Fprintf(&b, "\nRaw results: %s\n", path)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func benchDisplayName(key string, withPkg bool) string {
+	pkg, name, _ := strings.Cut(key, "\x00")
+	if withPkg && pkg != "" {
+		return shortPackage(pkg) + "." + name
+	}
+	return name
+}
+
+// lowerIsBetter reports whether a smaller value of a unit is an
+// improvement; throughput units such as MB/s are the exception
+func lowerIsBetter(unit string) bool {
+	return !strings.HasSuffix(unit, "/s")
+}
+
+func benchSummary(unit string, better, worse, same int) string {
+	words := map[string][2]string{"ns/op": {"faster", "slower"}, "B/op": {"smaller", "larger"}, "allocs/op": {"fewer", "more"}}
+	w, ok := words[unit]
+	if !ok {
+		w = [2]string{"better", "worse"}
+	}
+	var parts []string
+	if better > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", better, w[0]))
+	}
+	if worse > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", worse, w[1]))
+	}
+	if same > 0 {
+		parts = append(parts, fmt.Sprintf("%d unchanged", same))
+	}
+	return unit + " " + strings.Join(parts, ", ")
+}
+
+func writeBenchTable(b *strings.Builder, header []string, rows [][]string) {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len([]rune(cell)))
+		}
+	}
+	for _, row := range append([][]string{header}, rows...) {
+		var line strings.Builder
+		for i, cell := range row {
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-len([]rune(cell))+3))
+			}
+		}
+		b.WriteString(strings.TrimRight(line.String(), " ") + "\n")
+	}
+}
+
+// saveBenchOutput keeps the raw go test output for use with benchstat, in
+// the session's scratch directory so read_file can open it
+func saveBenchOutput(old, head *benchSamples) string {
+	scratch, err := getScratchDir()
+	if err != nil {
+		return ""
+	}
+	dir, err := os.MkdirTemp(scratch, "bench-")
+	if err != nil {
+		return ""
+	}
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte(head.raw), 0644)
+	if old == nil {
+		return filepath.Join(dir, "new.txt")
+	}
+	os.WriteFile(filepath.Join(dir, "old.txt"), []byte(old.raw), 0644)
+	return fmt.Sprintf("%s/{old,new}.txt (benchstat old.txt new.txt)", dir)
+}
+
+func displayBench(input map[string]interface{}) string {
+	bench, _ := input["bench"].(string)
+	if bench == "" {
+		bench = "."
+	}
+	if base, _ := input["base"].(string); base != "" {
+		return fmt.Sprintf("→ Benchmarking %s: %s vs working tree", bench, base)
+	}
+	return fmt.Sprintf("→ Benchmarking %s", bench)
+}
@@ -0,0 +1,223 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Statistics for the bench tool, following benchstat: the center of a
+// sample is its median, with a distribution-free confidence interval from
+// order statistics, and two samples differ significantly when a
+// Mann-Whitney U test gives p < 0.05.
+
+// benchConfidence is the confidence level of the reported intervals
+const benchConfidence = 0.95
+
+type benchSummaryStats struct {
+	median, lo, hi float64
+	intervalOK     bool // false with too few samples for the confidence level
+}
+
+func summarize(values []float64) benchSummaryStats {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	s := benchSummaryStats{median: median(sorted)}
+
+	// The interval [x(k), x(n-k-1)] covers the median with probability
+	// 1 - 2·P(Binomial(n, ½) ≤ k); take the narrowest one that still
+	// reaches the confidence level
+	k := -1
+	for i := 0; i < n/2; i++ {
+		if 1-2*binomialCDF(i, n) < benchConfidence {
+			break
+		}
+		k = i
+	}
+	if k >= 0 {
+		s.lo, s.hi, s.intervalOK = sorted[k], sorted[n-k-1], true
+	}
+	return s
+}
+
+// format renders the median with the interval as a percentage of it
+func (s benchSummaryStats) format(unit string) string {
+	value := formatBenchValue(s.median, unit)
+	switch {
+	case !s.intervalOK:
+		return value + " ± ∞"
+	case s.median == 0:
+		return value + " ± 0%"
+	}
+	spread := math.Max(s.median-s.lo, s.hi-s.median) / s.median * 100
+	if spread < 1 {
+		return value + " ± 0%"
+	}
+	return fmt.Sprintf("%s ± %.0f%%", value, spread)
+}
+
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// binomialCDF returns P(X ≤ k) for X ~ Binomial(n, ½)
+func binomialCDF(k, n int) float64 {
+	sum := 0.0
+	for i := 0; i <= k; i++ {
+		sum += math.Exp(lchoose(n, i) - float64(n)*math.Ln2)
+	}
+	return sum
+}
+
+func lchoose(n, k int) float64 {
+	a, _ := math.Lgamma(float64(n + 1))
+	b, _ := math.Lgamma(float64(k + 1))
+	c, _ := math.Lgamma(float64(n - k + 1))
+	return a - b - c
+}
+
+// mannWhitneyP returns the two-sided p-value of a Mann-Whitney U test
+// that x and y come from the same distribution. Without ties the exact
+// distribution of U is used; with ties, the normal approximation with a
+// tie correction.
+func mannWhitneyP(x, y []float64) float64 {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	type obs struct {
+		v     float64
+		first bool
+	}
+	all := make([]obs, 0, n1+n2)
+	for _, v := range x {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range y {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// Rank with ties given their average rank
+	rankSum, tieTerm, ties := 0.0, 0.0, false
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].first {
+				rankSum += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieTerm += t*t*t - t
+		}
+		i = j
+	}
+	u := rankSum - float64(n1*(n1+1))/2
+
+	if !ties && n1*n2 <= 400 {
+		lower, upper := mannWhitneyExact(n1, n2, u)
+		return math.Min(1, 2*math.Min(lower, upper))
+	}
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		return 1
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// mannWhitneyExact returns P(U ≤ u) and P(U ≥ u) for samples of sizes n1
+// and n2 without ties, counting the arrangements that give each U
+func mannWhitneyExact(n1, n2 int, u float64) (float64, float64) {
+	maxU := n1 * n2
+	// counts[i][j][k]: arrangements of i and j observations with U = k
+	prev := make([][]float64, n2+1)
+	for j := range prev {
+		prev[j] = make([]float64, maxU+1)
+		prev[j][0] = 1
+	}
+	for i := 1; i <= n1; i++ {
+		cur := make([][]float64, n2+1)
+		cur[0] = make([]float64, maxU+1)
+		cur[0][0] = 1
+		for j := 1; j <= n2; j++ {
+			cur[j] = make([]float64, maxU+1)
+			for k := 0; k <= maxU; k++ {
+				// The largest observation is from x, beating all j of y,
+				// or from y, adding nothing
+				if k >= j {
+					cur[j][k] += prev[j][k-j]
+				}
+				cur[j][k] += cur[j-1][k]
+			}
+		}
+		prev = cur
+	}
+	dist := prev[n2]
+	total, lower, upper := 0.0, 0.0, 0.0
+	for k, c := range dist {
+		total += c
+		if float64(k) <= u+1e-9 {
+			lower += c
+		}
+		if float64(k) >= u-1e-9 {
+			upper += c
+		}
+	}
+	return lower / total, upper / total
+}
+
+// geomean returns the geometric mean of positive values
+func geomean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += math.Log(v)
+	}
+	return math.Exp(sum / float64(len(values)))
+}
+
+// formatBenchValue renders a value in its unit with four significant
+// digits, scaling times and sizes
+func formatBenchValue(v float64, unit string) string {
+	switch unit {
+	case "ns/op":
+		switch {
+		case v >= 1e9:
+			return fmt.Sprintf("%.4gs", v/1e9)
+		case v >= 1e6:
+			return fmt.Sprintf("%.4gms", v/1e6)
+		case v >= 1e3:
+			return fmt.Sprintf("%.4gµs", v/1e3)
+		}
+		return fmt.Sprintf("%.4gns", v)
+	case "B/op":
+		switch {
+		case v >= 1<<30:
+			return fmt.Sprintf("%.4gGiB", v/(1<<30))
+		case v >= 1<<20:
+			return fmt.Sprintf("%.4gMiB", v/(1<<20))
+		case v >= 1<<10:
+			return fmt.Sprintf("%.4gKiB", v/(1<<10))
+		}
+		return fmt.Sprintf("%.0fB", v)
+	}
+	return fmt.Sprintf("%.4g", v)
+}
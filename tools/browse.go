@@ -1,15 +1,13 @@
 package tools
 
 import (
-	"github.com/this-is-alpha-iota/clyde/api"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
-	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/this-is-alpha-iota/clyde/api"
 )
 
 func init() {
@@ -18,37 +16,73 @@ func init() {
 
 var browseTool = api.Tool{
 	Name:        "browse",
-	Description: "Fetch a URL and convert HTML to readable markdown. Optionally extract specific information using AI processing. Use for reading documentation pages, following up on search results, or extracting specific information from web pages.",
+	Description: "Fetch a URL and convert its main content to readable markdown. HTML, JSON (pretty-printed, optionally filtered), plain text, RSS/Atom feeds and PDFs are supported. Navigation, footers and banners are stripped, links are numbered so they can be followed with link=N, and long pages are split into pages read with page or offset. Optionally extract specific information using AI processing. Use for reading documentation pages, following up on search results, or extracting specific information from web pages.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
 			"url": map[string]interface{}{
 				"type":        "string",
-				"description": "The URL to fetch (HTTP/HTTPS)",
+				"description": "The URL to fetch (HTTP/HTTPS). Optional when following a link from the last browsed page",
+			},
+			"link": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional: follow link number N from the numbered link list of the last browsed page (or of url, if given and browsed before)",
+			},
+			"page": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional: which page of a long document to return (1-based, default 1)",
+			},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional: character offset to start reading from instead of a page number",
+			},
+			"full_page": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Optional: convert the whole page instead of just the main content (default false)",
+			},
+			"filter": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional, JSON responses only: jq-style filter to narrow the result. Supports .field, .[n], .[a:b], .[], pipes, keys, length and select(.field == value). Example: '.items[] | select(.state == \"open\") | .title'",
+			},
+			"refresh": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Optional: bypass the local cache and fetch the page again (default false)",
 			},
 			"prompt": map[string]interface{}{
 				"type":        "string",
-				"description": "Optional: What to extract/summarize from the page. If not provided, returns the full converted markdown. Example: 'List all tutorial sections' or 'What are the main features?'",
+				"description": "Optional: What to extract/summarize from the page. If not provided, returns the converted markdown. Example: 'List all tutorial sections' or 'What are the main features?'",
 			},
 			"max_length": map[string]interface{}{
 				"type":        "integer",
-				"description": "Maximum content length in KB (default 500, max 1000)",
-				"default":     500,
+				"description": "Page size in KB (default 50, max 1000)",
+				"default":     defaultBrowsePageKB,
 			},
 		},
-		"required": []string{"url"},
 	},
 }
 
+const (
+	defaultBrowsePageKB     = 50
+	defaultBrowseDownloadMB = 10
+)
+
 func executeBrowse(input map[string]interface{}, apiClient *api.Client, conversationHistory []api.Message) (string, error) {
-	urlStr, urlOk := input["url"].(string)
-	if !urlOk || urlStr == "" {
+	urlStr, _ := input["url"].(string)
+
+	if linkVal, ok := input["link"].(float64); ok {
+		target, err := resolveLinkIndex(urlStr, int(linkVal))
+		if err != nil {
+			return "", err
+		}
+		urlStr = target
+	}
+	if urlStr == "" {
 		return "", fmt.Errorf("url is required. Example: browse(\"https://example.com\")")
 	}
 
-	// Default to 500 KB if not specified
-	maxLength := 500
-	if maxVal, ok := input["max_length"].(float64); ok {
+	// Default to 50 KB pages if not specified
+	maxLength := defaultBrowsePageKB
+	if maxVal, ok := input["max_length"].(float64); ok && maxVal > 0 {
 		maxLength = int(maxVal)
 	}
 	// Cap at 1000 KB
@@ -56,47 +90,104 @@ func executeBrowse(input map[string]interface{}, apiClient *api.Client, conversa
 		maxLength = 1000
 	}
 
+	page := 1
+	if pageVal, ok := input["page"].(float64); ok {
+		page = int(pageVal)
+	}
+	offset := -1
+	if offsetVal, ok := input["offset"].(float64); ok {
+		offset = max(int(offsetVal), 0)
+	}
+	var opts browseOptions
+	opts.fullPage, _ = input["full_page"].(bool)
+	opts.filter, _ = input["filter"].(string)
+
 	// Optional prompt for AI extraction
 	prompt := ""
 	if promptVal, ok := input["prompt"].(string); ok {
 		prompt = promptVal
 	}
 
+	refresh, _ := input["refresh"].(bool)
+	converted, err := loadPage(urlStr, refresh, opts)
+	if err != nil {
+		return "", err
+	}
+	markdown := converted.markdown
+	finalURL := converted.url
+
+	// Index links under the requested URL too, so link=N works with either
+	if finalURL != urlStr {
+		rememberLinks(urlStr, converted.links)
+	}
+	rememberLinks(finalURL, converted.links)
+
+	// If no prompt provided, return the requested page of markdown
+	if prompt == "" {
+		chunk, err := paginate(markdown, maxLength*1024, page, offset)
+		if err != nil {
+			return "", fmt.Errorf("%w\n\nURL: %s", err, finalURL)
+		}
+		return formatBrowsePage(converted, chunk), nil
+	}
+
+	// AI Processing: Use Claude to extract specific information
+	// Build a message asking Claude to process the content
+	extractionPrompt := fmt.Sprintf("Given this webpage content:\n\n%s\n\nUser request: %s", markdown, prompt)
+
+	// Truncate markdown if too long for Claude context
+	if len(extractionPrompt) > 100000 {
+		// Keep first 90KB of content
+		truncatedMarkdown := markdown[:90000] + "\n\n[Content truncated to fit context]"
+		extractionPrompt = fmt.Sprintf("Given this webpage content:\n\n%s\n\nUser request: %s", truncatedMarkdown, prompt)
+	}
+
+	// Extraction runs outside the conversation, on the secondary model if
+	// one is configured. Extracts can be long, so the conversation's token
+	// limit applies unless CLYDE_SECONDARY_MAX_TOKENS is set.
+	systemPrompt := "You are a helpful AI assistant. Extract the requested information from the webpage content provided."
+	extracted, err := secondaryCall(apiClient, systemPrompt, extractionPrompt, envInt("CLYDE_SECONDARY_MAX_TOKENS", 0))
+	if err != nil {
+		return "", fmt.Errorf("failed to process page with AI: %w", err)
+	}
+	if extracted == "" {
+		return markdown, nil // Fallback to raw markdown
+	}
+
+	return extracted, nil
+}
+
+// loadPage fetches a URL through the response cache and converts it to
+// markdown according to its content type. Errors are worded for the model:
+// they say what went wrong and what to try.
+func loadPage(urlStr string, refresh bool, opts browseOptions) (*browsePage, error) {
 	// Validate URL format
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
-		return "", fmt.Errorf("invalid URL format. Must start with http:// or https://\n\nProvided: %s", urlStr)
-	}
-
-	// Create HTTP client with timeout and redirect handling
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 10 {
-				return fmt.Errorf("stopped after 10 redirects")
-			}
-			return nil
-		},
+		return nil, fmt.Errorf("invalid URL format. Must start with http:// or https://\n\nProvided: %s", urlStr)
 	}
 
 	// Make request
 	req, err := http.NewRequest("GET", urlStr, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("User-Agent", "clyde/1.0 (Go HTTP Client)")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/json;q=0.9,application/xml;q=0.9,application/pdf;q=0.9,text/plain;q=0.8,*/*;q=0.7")
 
-	resp, err := client.Do(req)
+	resp, err := cachedFetch("browse", req, 30*time.Second, cacheOptions{refresh: refresh})
 	if err != nil {
+		if isEgressBlocked(err) {
+			return nil, err
+		}
 		if strings.Contains(err.Error(), "no such host") {
-			return "", fmt.Errorf("could not resolve domain '%s'. Check the URL.\n\nError: %w", parsedURL.Host, err)
+			return nil, fmt.Errorf("could not resolve domain '%s'. Check the URL.\n\nError: %w", parsedURL.Host, err)
 		}
 		if strings.Contains(err.Error(), "timeout") {
-			return "", fmt.Errorf("request timed out after 30 seconds. The server may be slow or unreachable.\n\nURL: %s", urlStr)
+			return nil, fmt.Errorf("request timed out after 30 seconds. The server may be slow or unreachable.\n\nURL: %s", urlStr)
 		}
-		return "", fmt.Errorf("network error: %w\n\nCheck your internet connection", err)
+		return nil, fmt.Errorf("network error: %w\n\nCheck your internet connection", err)
 	}
 	defer resp.Body.Close()
 
@@ -104,103 +195,47 @@ func executeBrowse(input map[string]interface{}, apiClient *api.Client, conversa
 	if resp.StatusCode != http.StatusOK {
 		switch resp.StatusCode {
 		case 404:
-			return "", fmt.Errorf("page not found (404): %s\n\nThe URL may be incorrect or the page may have been removed", urlStr)
+			return nil, fmt.Errorf("page not found (404): %s\n\nThe URL may be incorrect or the page may have been removed", urlStr)
 		case 403:
-			return "", fmt.Errorf("access denied (403). The page may require authentication or permissions.\n\nURL: %s", urlStr)
+			return nil, fmt.Errorf("access denied (403). The page may require authentication or permissions.\n\nURL: %s", urlStr)
 		case 401:
-			return "", fmt.Errorf("authentication required (401). The page requires login credentials.\n\nURL: %s", urlStr)
+			return nil, fmt.Errorf("authentication required (401). The page requires login credentials.\n\nURL: %s", urlStr)
 		case 429:
-			return "", fmt.Errorf("rate limit exceeded (429). The server is throttling requests.\n\nURL: %s\n\nTry again later", urlStr)
+			return nil, fmt.Errorf("rate limit exceeded (429). The server is throttling requests.\n\nURL: %s\n\nTry again later", urlStr)
 		case 500, 502, 503, 504:
-			return "", fmt.Errorf("server error (%d). The server is experiencing problems.\n\nURL: %s\n\nTry again later or check https://downdetector.com", resp.StatusCode, urlStr)
+			return nil, fmt.Errorf("server error (%d). The server is experiencing problems.\n\nURL: %s\n\nTry again later or check https://downdetector.com", resp.StatusCode, urlStr)
 		default:
-			return "", fmt.Errorf("HTTP error %d\n\nURL: %s", resp.StatusCode, urlStr)
+			return nil, fmt.Errorf("HTTP error %d\n\nURL: %s", resp.StatusCode, urlStr)
 		}
 	}
 
-	// Check content length if provided
-	maxBytes := int64(maxLength) * 1024
-	if resp.ContentLength > maxBytes {
-		sizeKB := resp.ContentLength / 1024
-		return "", fmt.Errorf("page too large (%d KB). Max allowed: %d KB.\n\nIncrease max_length or try a different page.\n\nURL: %s", sizeKB, maxLength, urlStr)
+	// Huge pages are cut off rather than rejected; pagination handles the
+	// length of what remains. PDFs can't be read partially, so they get
+	// their own, larger cap.
+	maxDownloadMB := envInt("CLYDE_BROWSE_MAX_DOWNLOAD_MB", defaultBrowseDownloadMB)
+	if contentKind(resp.Header.Get("Content-Type"), nil) == kindPDF || strings.HasSuffix(strings.ToLower(resp.Request.URL.Path), ".pdf") {
+		maxDownloadMB = envInt("CLYDE_BROWSE_MAX_PDF_MB", defaultBrowseMaxPDFMB)
 	}
-
-	// Read body with limit
-	limitReader := io.LimitReader(resp.Body, maxBytes)
-	body, err := io.ReadAll(limitReader)
+	body, truncated, err := readLimited(resp.Body, int64(maxDownloadMB)*1024*1024)
 	if err != nil {
-		return "", fmt.Errorf("failed to read page content: %w", err)
+		return nil, fmt.Errorf("failed to read page content: %w", err)
 	}
 
-	// Check if we hit the limit
-	if int64(len(body)) >= maxBytes {
-		return "", fmt.Errorf("page content exceeds %d KB. Increase max_length or try a different page.\n\nURL: %s", maxLength, urlStr)
-	}
-
-	// Convert HTML to Markdown
-	converter := md.NewConverter("", true, nil)
-	markdown, err := converter.ConvertString(string(body))
+	// Convert to markdown according to the content type
+	finalURL := resp.Request.URL
+	kind := contentKind(resp.Header.Get("Content-Type"), body)
+	converted, err := convertContent(kind, body, truncated, finalURL, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to convert HTML to markdown: %w\n\nThe page may have malformed HTML", err)
+		return nil, fmt.Errorf("%w\n\nURL: %s", err, urlStr)
 	}
-
-	// Trim excessive whitespace
-	markdown = strings.TrimSpace(markdown)
-
 	// If markdown is empty, provide helpful message
-	if markdown == "" {
-		return "", fmt.Errorf("page returned no readable content. It may be:\n  - A JavaScript-heavy page (requires browser rendering)\n  - An empty page\n  - A redirect page\n\nURL: %s", urlStr)
-	}
-
-	// If no prompt provided, return the markdown
-	if prompt == "" {
-		// Truncate if still too long after conversion
-		if len(markdown) > int(maxBytes) {
-			markdown = markdown[:maxBytes-100] + "\n\n[Content truncated due to length]"
-		}
-		return markdown, nil
-	}
-
-	// AI Processing: Use Claude to extract specific information
-	// Build a message asking Claude to process the content
-	extractionPrompt := fmt.Sprintf("Given this webpage content:\n\n%s\n\nUser request: %s", markdown, prompt)
-
-	// Truncate markdown if too long for Claude context
-	if len(extractionPrompt) > 100000 {
-		// Keep first 90KB of content
-		truncatedMarkdown := markdown[:90000] + "\n\n[Content truncated to fit context]"
-		extractionPrompt = fmt.Sprintf("Given this webpage content:\n\n%s\n\nUser request: %s", truncatedMarkdown, prompt)
-	}
-
-	// Create a new conversation with the extraction prompt
-	extractionHistory := []api.Message{
-		{
-			Role:    "user",
-			Content: extractionPrompt,
-		},
-	}
-
-	// Call Claude to process the content
-	// We need the system prompt here
-	systemPrompt := "You are a helpful AI assistant. Extract the requested information from the webpage content provided."
-	resp2, err := apiClient.Call(systemPrompt, extractionHistory, []api.Tool{})
-	if err != nil {
-		return "", fmt.Errorf("failed to process page with AI: %w", err)
-	}
-
-	// Extract text response
-	var textResponses []string
-	for _, block := range resp2.Content {
-		if block.Type == "text" && block.Text != "" {
-			textResponses = append(textResponses, block.Text)
+	if strings.TrimSpace(converted.markdown) == "" {
+		if kind != kindHTML {
+			return nil, fmt.Errorf("response is empty (%s)\n\nURL: %s", kind, urlStr)
 		}
+		return nil, fmt.Errorf("page returned no readable content. It may be:\n  - A JavaScript-heavy page (requires browser rendering)\n  - An empty page\n  - A redirect page\n\nURL: %s", urlStr)
 	}
-
-	if len(textResponses) == 0 {
-		return markdown, nil // Fallback to raw markdown
-	}
-
-	return strings.Join(textResponses, "\n"), nil
+	return converted, nil
 }
 
 func displayBrowse(input map[string]interface{}) string {
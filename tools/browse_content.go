@@ -0,0 +1,420 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ledongthuc/pdf"
+)
+
+// browse dispatches on the response type. Each kind has its own converter
+// and limits; all of them produce a browsePage so pagination, link
+// following and prompt extraction work the same way for every kind.
+
+const (
+	kindHTML = "html"
+	kindJSON = "json"
+	kindText = "text"
+	kindFeed = "feed"
+	kindPDF  = "pdf"
+)
+
+const (
+	defaultBrowseMaxPDFMB    = 20
+	defaultBrowseMaxPDFPages = 50
+	defaultBrowseFeedItems   = 50
+	feedSummaryChars         = 300
+)
+
+// browseOptions are the conversion settings from the tool input
+type browseOptions struct {
+	fullPage bool
+	filter   string // jq-style, JSON only
+}
+
+// contentKind classifies a response by its Content-Type, sniffing the body
+// when the header is missing, generic or plain XML
+func contentKind(contentType string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return kindHTML
+	case mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json"):
+		return kindJSON
+	case mediaType == "application/rss+xml" || mediaType == "application/atom+xml" || mediaType == "application/rdf+xml":
+		return kindFeed
+	case mediaType == "application/pdf":
+		return kindPDF
+	case mediaType == "application/xml" || mediaType == "text/xml":
+		if looksLikeFeed(body) {
+			return kindFeed
+		}
+		return kindText
+	case strings.HasPrefix(mediaType, "text/"):
+		return kindText
+	}
+
+	// Unknown or generic types (application/octet-stream, missing header)
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case bytes.HasPrefix(body, []byte("%PDF-")):
+		return kindPDF
+	case (bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("["))) && json.Valid(trimmed):
+		return kindJSON
+	case looksLikeFeed(body):
+		return kindFeed
+	}
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(body))
+	switch {
+	case sniffed == "text/html":
+		return kindHTML
+	case strings.HasPrefix(sniffed, "text/"):
+		return kindText
+	case len(body) > 0 && utf8.Valid(body[:min(len(body), 1024)]) && !bytes.ContainsRune(body[:min(len(body), 1024)], 0):
+		return kindText
+	}
+	if mediaType == "" {
+		mediaType = sniffed
+	}
+	return mediaType
+}
+
+func looksLikeFeed(body []byte) bool {
+	head := string(body[:min(len(body), 1024)])
+	return strings.Contains(head, "<rss") || strings.Contains(head, "<feed") || strings.Contains(head, "<rdf:RDF")
+}
+
+// convertContent renders body as a browsePage according to its kind.
+// truncated reports that the download hit its size cap.
+func convertContent(kind string, body []byte, truncated bool, pageURL *url.URL, opts browseOptions) (*browsePage, error) {
+	if opts.filter != "" && kind != kindJSON {
+		return nil, fmt.Errorf("filter only applies to JSON responses; this response is %s", kind)
+	}
+
+	var page *browsePage
+	var err error
+	switch kind {
+	case kindHTML:
+		doc, parseErr := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if parseErr != nil {
+			return nil, fmt.Errorf("failed to convert HTML to markdown: %w\n\nThe page may have malformed HTML", parseErr)
+		}
+		page = convertPage(doc, pageURL, opts.fullPage)
+	case kindJSON:
+		page, err = convertJSON(body, truncated, pageURL, opts.filter)
+	case kindText:
+		page = &browsePage{url: pageURL.String(), markdown: strings.TrimSpace(strings.ToValidUTF8(string(body), "�"))}
+	case kindFeed:
+		page, err = convertFeed(body, truncated, pageURL)
+	case kindPDF:
+		page, err = convertPDF(body, truncated, pageURL)
+	default:
+		return nil, fmt.Errorf("unsupported content type '%s'. browse reads HTML, JSON, text, RSS/Atom feeds and PDFs. Use include_file for images", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	page.kind = kind
+	if truncated && (kind == kindHTML || kind == kindText) {
+		page.markdown += downloadStoppedNote()
+	}
+	return page, nil
+}
+
+func downloadStoppedNote() string {
+	return fmt.Sprintf("\n\n[Download stopped at %d MB (CLYDE_BROWSE_MAX_DOWNLOAD_MB); the rest of the content is missing]",
+		envInt("CLYDE_BROWSE_MAX_DOWNLOAD_MB", defaultBrowseDownloadMB))
+}
+
+// convertJSON pretty-prints JSON, keeping the original key order, or runs
+// the filter and prints each result. A body cut off by the download cap
+// can't be parsed, so it is shown as raw text instead.
+func convertJSON(body []byte, truncated bool, pageURL *url.URL, filter string) (*browsePage, error) {
+	page := &browsePage{url: pageURL.String()}
+
+	if truncated {
+		if filter != "" {
+			return nil, fmt.Errorf("JSON response is larger than %d MB (CLYDE_BROWSE_MAX_DOWNLOAD_MB), so it can't be parsed for filtering",
+				envInt("CLYDE_BROWSE_MAX_DOWNLOAD_MB", defaultBrowseDownloadMB))
+		}
+		page.markdown = strings.TrimSpace(string(body)) + downloadStoppedNote()
+		return page, nil
+	}
+
+	if filter == "" {
+		var out bytes.Buffer
+		if err := json.Indent(&out, bytes.TrimSpace(body), "", "  "); err != nil {
+			// Mislabelled or broken JSON is still worth reading
+			page.markdown = strings.TrimSpace(string(body)) + fmt.Sprintf("\n\n[Invalid JSON: %v]", err)
+			return page, nil
+		}
+		page.markdown = out.String()
+		return page, nil
+	}
+
+	compiled, err := parseJSONFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("response is not valid JSON: %w", err)
+	}
+	results, err := compiled.run(doc)
+	if err != nil {
+		return nil, fmt.Errorf("filter '%s' failed: %w", filter, err)
+	}
+
+	var parts []string
+	for _, r := range results {
+		out, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to format filter result: %w", err)
+		}
+		parts = append(parts, string(out))
+	}
+	page.title = fmt.Sprintf("%s (filter: %s, %d results)", pageURL.Path, filter, len(results))
+	page.markdown = strings.Join(parts, "\n")
+	if len(results) == 0 {
+		page.markdown = "(no results)"
+	}
+	return page, nil
+}
+
+// feedItem is one RSS item or Atom entry
+type feedItem struct {
+	title, link, date, summary string
+}
+
+// rssFeed covers RSS 2.0 and RSS 1.0 (RDF), whose items sit outside the
+// channel element
+type rssFeed struct {
+	Channel struct {
+		Title       string    `xml:"title"`
+		Description string    `xml:"description"`
+		Items       []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+type atomFeed struct {
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Summary   string     `xml:"summary"`
+	Content   string     `xml:"content"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+// convertFeed renders an RSS or Atom feed as a numbered item list. Item
+// links join the link index, so browse(link=N) opens item N.
+func convertFeed(body []byte, truncated bool, pageURL *url.URL) (*browsePage, error) {
+	if truncated {
+		return nil, fmt.Errorf("feed is larger than %d MB (CLYDE_BROWSE_MAX_DOWNLOAD_MB) and can't be parsed",
+			envInt("CLYDE_BROWSE_MAX_DOWNLOAD_MB", defaultBrowseDownloadMB))
+	}
+
+	var title, description string
+	var items []feedItem
+
+	var root struct{ XMLName xml.Name }
+	if err := xml.Unmarshal(body, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+	if root.XMLName.Local == "feed" {
+		var feed atomFeed
+		if err := xml.Unmarshal(body, &feed); err != nil {
+			return nil, fmt.Errorf("failed to parse Atom feed: %w", err)
+		}
+		title, description = feed.Title, feed.Subtitle
+		for _, e := range feed.Entries {
+			item := feedItem{title: e.Title, date: firstNonEmpty(e.Published, e.Updated), summary: firstNonEmpty(e.Summary, e.Content)}
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					item.link = l.Href
+					break
+				}
+			}
+			items = append(items, item)
+		}
+	} else {
+		var feed rssFeed
+		if err := xml.Unmarshal(body, &feed); err != nil {
+			return nil, fmt.Errorf("failed to parse RSS feed: %w", err)
+		}
+		title, description = feed.Channel.Title, feed.Channel.Description
+		for _, it := range append(feed.Channel.Items, feed.Items...) {
+			link := it.Link
+			if link == "" && strings.HasPrefix(it.GUID, "http") {
+				link = it.GUID
+			}
+			items = append(items, feedItem{
+				title:   it.Title,
+				link:    link,
+				date:    firstNonEmpty(it.PubDate, it.Date),
+				summary: firstNonEmpty(it.Description, it.Content),
+			})
+		}
+	}
+
+	page := &browsePage{url: pageURL.String(), title: collapseSpace(title)}
+	var b strings.Builder
+	if description = summarizeMarkup(description, feedSummaryChars); description != "" {
+		b.WriteString(description + "\n\n")
+	}
+
+	maxItems := envInt("CLYDE_BROWSE_MAX_FEED_ITEMS", defaultBrowseFeedItems)
+	for i, item := range items {
+		if i == maxItems {
+			b.WriteString(fmt.Sprintf("[%d more items omitted (CLYDE_BROWSE_MAX_FEED_ITEMS)]\n", len(items)-maxItems))
+			break
+		}
+		heading := collapseSpace(item.title)
+		if heading == "" {
+			heading = "(untitled)"
+		}
+		if target, err := pageURL.Parse(strings.TrimSpace(item.link)); err == nil && item.link != "" {
+			page.links = append(page.links, target.String())
+			heading += fmt.Sprintf(" [%d]", len(page.links))
+		}
+		b.WriteString(fmt.Sprintf("%d. **%s**\n", i+1, heading))
+		if item.date != "" {
+			b.WriteString("   " + strings.TrimSpace(item.date) + "\n")
+		}
+		if summary := summarizeMarkup(item.summary, feedSummaryChars); summary != "" {
+			b.WriteString("   " + summary + "\n")
+		}
+		b.WriteString("\n")
+	}
+	if len(items) == 0 {
+		b.WriteString("(feed has no items)")
+	}
+	page.markdown = strings.TrimSpace(b.String())
+	return page, nil
+}
+
+// summarizeMarkup strips HTML from a feed field and shortens it
+func summarizeMarkup(s string, limit int) string {
+	if doc, err := goquery.NewDocumentFromReader(strings.NewReader(s)); err == nil {
+		s = doc.Text()
+	}
+	s = collapseSpace(s)
+	if len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = strings.TrimSpace(s[:cut]) + "…"
+	}
+	return s
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// convertPDF extracts the text of each page, row by row. Scanned PDFs have
+// no text layer and come back empty.
+func convertPDF(body []byte, truncated bool, pageURL *url.URL) (*browsePage, error) {
+	if truncated {
+		return nil, fmt.Errorf("PDF is larger than %d MB (CLYDE_BROWSE_MAX_PDF_MB)", envInt("CLYDE_BROWSE_MAX_PDF_MB", defaultBrowseMaxPDFMB))
+	}
+	reader, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	page := &browsePage{url: pageURL.String()}
+	page.title = collapseSpace(reader.Trailer().Key("Info").Key("Title").Text())
+
+	total := reader.NumPage()
+	maxPages := envInt("CLYDE_BROWSE_MAX_PDF_PAGES", defaultBrowseMaxPDFPages)
+	var b strings.Builder
+	hasText := false
+	for n := 1; n <= total && n <= maxPages; n++ {
+		text, err := pdfPageText(reader.Page(n))
+		if err != nil {
+			text = fmt.Sprintf("[could not extract text: %v]", err)
+		}
+		hasText = hasText || err == nil && text != ""
+		b.WriteString(fmt.Sprintf("## Page %d\n\n%s\n\n", n, text))
+	}
+	if total > maxPages {
+		b.WriteString(fmt.Sprintf("[Stopped after %d of %d pages (CLYDE_BROWSE_MAX_PDF_PAGES)]", maxPages, total))
+	}
+
+	if !hasText {
+		return nil, fmt.Errorf("PDF has %d pages but no extractable text. It is probably scanned; try include_file to view it instead", total)
+	}
+	page.markdown = strings.TrimSpace(b.String())
+	return page, nil
+}
+
+// pdfPageText joins the text fragments of each row, top to bottom. Words
+// are separated by a space; single glyphs positioned one at a time are
+// glued back together.
+func pdfPageText(p pdf.Page) (string, error) {
+	if p.V.IsNull() {
+		return "", nil
+	}
+	rows, err := p.GetTextByRow()
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, row := range rows {
+		var line strings.Builder
+		for _, word := range row.Content {
+			s := word.S
+			if line.Len() > 0 && !strings.HasSuffix(line.String(), " ") && !strings.HasPrefix(s, " ") && len(s) > 1 {
+				line.WriteByte(' ')
+			}
+			line.WriteString(s)
+		}
+		if text := strings.TrimSpace(line.String()); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,410 @@
+package tools
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/JohannesKaufmann/html-to-markdown/plugin"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// browsePage is a fetched page converted to markdown, with its outgoing
+// links numbered in order of appearance
+type browsePage struct {
+	url      string
+	kind     string // kindHTML, kindJSON, ...
+	title    string
+	markdown string
+	links    []string // links[i] is link number i+1
+}
+
+var (
+	browseMu        sync.Mutex
+	browsedPages    = make(map[string][]string) // page URL -> link index
+	lastBrowsedPage string
+)
+
+// rememberLinks stores a page's link index so a later call can follow a
+// link by number
+func rememberLinks(pageURL string, links []string) {
+	browseMu.Lock()
+	defer browseMu.Unlock()
+	browsedPages[pageURL] = links
+	lastBrowsedPage = pageURL
+}
+
+// resolveLinkIndex returns the URL of link n on pageURL, or on the most
+// recently browsed page when pageURL is empty
+func resolveLinkIndex(pageURL string, n int) (string, error) {
+	browseMu.Lock()
+	defer browseMu.Unlock()
+
+	if pageURL == "" {
+		pageURL = lastBrowsedPage
+	}
+	links, ok := browsedPages[pageURL]
+	if !ok {
+		if pageURL == "" {
+			return "", fmt.Errorf("no page has been browsed yet. Call browse with a url first, then follow its numbered links with link=N")
+		}
+		return "", fmt.Errorf("'%s' hasn't been browsed in this session, so its links aren't numbered yet. Browse it first", pageURL)
+	}
+	if n < 1 || n > len(links) {
+		return "", fmt.Errorf("link %d does not exist on %s (it has %d links)", n, pageURL, len(links))
+	}
+	return links[n-1], nil
+}
+
+// convertPage turns an HTML document into markdown. Unless fullPage is set,
+// only the main content is kept. Links become "text [n]" markers and are
+// collected in page.links.
+func convertPage(doc *goquery.Document, pageURL *url.URL, fullPage bool) *browsePage {
+	page := &browsePage{url: pageURL.String()}
+
+	var content *goquery.Selection
+	if fullPage {
+		doc.Find("script, style, noscript, template").Remove()
+		page.title = pageTitle(doc)
+		content = doc.Find("body")
+		if content.Length() == 0 {
+			content = doc.Selection
+		}
+	} else {
+		content, page.title = extractReadable(doc)
+	}
+
+	page.links = numberLinks(content, pageURL)
+	page.markdown = strings.TrimSpace(newPageConverter(pageURL).Convert(content))
+	return page
+}
+
+// linkAttr carries a link's number from numberLinks to the converter
+const linkAttr = "data-clyde-link"
+
+// numberLinks numbers each followable anchor in order of appearance.
+// Repeated URLs share a number.
+func numberLinks(content *goquery.Selection, base *url.URL) []string {
+	var links []string
+	index := make(map[string]int)
+
+	content.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		target, err := base.Parse(strings.TrimSpace(href))
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			return
+		}
+		target.Fragment = ""
+		if target.String() == base.String() {
+			return // in-page anchor
+		}
+
+		n, seen := index[target.String()]
+		if !seen {
+			links = append(links, target.String())
+			n = len(links)
+			index[target.String()] = n
+		}
+		a.SetAttr(linkAttr, strconv.Itoa(n))
+	})
+	return links
+}
+
+// newPageConverter returns an HTML-to-markdown converter that resolves
+// URLs against the page, renders links as "text [n]" markers and converts
+// tables with spans and pipes intact
+func newPageConverter(base *url.URL) *md.Converter {
+	conv := md.NewConverter(base.Host, true, &md.Options{
+		GetAbsoluteURL: func(_ *goquery.Selection, rawURL string, _ string) string {
+			if u, err := base.Parse(rawURL); err == nil {
+				return u.String()
+			}
+			return rawURL
+		},
+	})
+	conv.Use(plugin.Strikethrough(""), plugin.TaskListItems())
+	conv.AddRules(
+		md.Rule{
+			Filter: []string{"a"},
+			Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+				content = strings.TrimSpace(content)
+				if n, ok := selec.Attr(linkAttr); ok {
+					return md.String(strings.TrimSpace(content + " [" + n + "]"))
+				}
+				// Unfollowable links (in-page anchors, javascript:) are plain text
+				return md.String(content)
+			},
+		},
+		md.Rule{
+			Filter: []string{"table"},
+			Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+				return md.String("\n\n" + renderTable(conv, selec) + "\n\n")
+			},
+		},
+	)
+	return conv
+}
+
+// maxTableSpan bounds colspan/rowspan so a malformed page can't blow up
+// the grid
+const maxTableSpan = 50
+
+// renderTable converts a table into a markdown grid. colspan leaves the
+// spanned cells empty; rowspan repeats the value so every row stands alone.
+// Single-column tables are usually layout, so they become plain blocks.
+func renderTable(conv *md.Converter, table *goquery.Selection) string {
+	rows := table.Find("tr").FilterFunction(func(_ int, tr *goquery.Selection) bool {
+		return tr.Closest("table").IsSelection(table)
+	})
+
+	var grid [][]string
+	occupied := make(map[[2]int]string)
+	headerRows := 0
+	width := 0
+
+	rows.Each(func(r int, tr *goquery.Selection) {
+		var row []string
+		col := 0
+		allTH := true
+		tr.Children().Filter("td, th").Each(func(_ int, cell *goquery.Selection) {
+			for {
+				if text, ok := occupied[[2]int{r, col}]; ok {
+					row = append(row, text)
+					col++
+					continue
+				}
+				break
+			}
+			if !cell.Is("th") {
+				allTH = false
+			}
+			text := tableCellText(conv, cell)
+			colspan := spanAttr(cell, "colspan")
+			rowspan := spanAttr(cell, "rowspan")
+			for c := 0; c < colspan; c++ {
+				value := text
+				if c > 0 {
+					value = ""
+				}
+				row = append(row, value)
+				for dr := 1; dr < rowspan; dr++ {
+					occupied[[2]int{r + dr, col + c}] = value
+				}
+			}
+			col += colspan
+		})
+		for {
+			text, ok := occupied[[2]int{r, col}]
+			if !ok {
+				break
+			}
+			row = append(row, text)
+			col++
+		}
+
+		if r == headerRows && (tr.ParentFiltered("thead").Length() > 0 || allTH) && len(row) > 0 {
+			headerRows++
+		}
+		width = max(width, len(row))
+		grid = append(grid, row)
+	})
+
+	var b strings.Builder
+	if caption := strings.TrimSpace(table.ChildrenFiltered("caption").Text()); caption != "" {
+		b.WriteString("*" + strings.Join(strings.Fields(caption), " ") + "*\n\n")
+	}
+	if width == 0 {
+		return strings.TrimSpace(b.String())
+	}
+	if width == 1 {
+		for _, row := range grid {
+			if len(row) > 0 && row[0] != "" {
+				b.WriteString(strings.ReplaceAll(row[0], "<br>", "\n") + "\n\n")
+			}
+		}
+		return strings.TrimSpace(b.String())
+	}
+
+	writeRow := func(row []string) {
+		b.WriteString("|")
+		for c := 0; c < width; c++ {
+			cell := ""
+			if c < len(row) {
+				cell = row[c]
+			}
+			b.WriteString(" " + cell + " |")
+		}
+		b.WriteString("\n")
+	}
+
+	// Markdown needs exactly one header row: merge multi-row headers and
+	// add an empty one when the table has none
+	header := make([]string, width)
+	for _, row := range grid[:headerRows] {
+		for c, cell := range row {
+			if cell != "" && header[c] != cell {
+				header[c] = strings.TrimSpace(header[c] + " " + cell)
+			}
+		}
+	}
+	writeRow(header)
+	b.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+	for _, row := range grid[headerRows:] {
+		writeRow(row)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// tableCellText renders a cell's content on one line with pipes escaped
+func tableCellText(conv *md.Converter, cell *goquery.Selection) string {
+	text := strings.TrimSpace(conv.Convert(cell))
+	lines := strings.Split(text, "\n")
+	var kept []string
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	text = strings.Join(kept, "<br>")
+	// The converter escapes some pipes already; normalize before escaping all
+	text = strings.ReplaceAll(text, `\|`, "|")
+	return strings.ReplaceAll(text, "|", `\|`)
+}
+
+func spanAttr(cell *goquery.Selection, name string) int {
+	val, _ := cell.Attr(name)
+	n, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return min(n, maxTableSpan)
+}
+
+// pageChunk is one page of a long document
+type pageChunk struct {
+	text       string
+	start, end int // character offsets into the full markdown
+	number     int // 1-based; 0 when reading from an explicit offset
+	total      int
+}
+
+// paginate splits markdown into chunks of at most size bytes, breaking at
+// paragraph or line boundaries where possible, and returns the requested
+// one. offset (when >= 0) overrides page.
+func paginate(markdown string, size, page, offset int) (*pageChunk, error) {
+	bounds := chunkBounds(markdown, size)
+
+	if offset >= 0 {
+		if offset >= len(markdown) && len(markdown) > 0 {
+			return nil, fmt.Errorf("offset %d is past the end of the page (%d characters)", offset, len(markdown))
+		}
+		end := chunkEnd(markdown, offset, size)
+		return &pageChunk{text: markdown[offset:end], start: offset, end: end, total: len(bounds)}, nil
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if page > len(bounds) {
+		return nil, fmt.Errorf("page %d does not exist; the content has %d pages", page, len(bounds))
+	}
+	b := bounds[page-1]
+	return &pageChunk{text: markdown[b[0]:b[1]], start: b[0], end: b[1], number: page, total: len(bounds)}, nil
+}
+
+func chunkBounds(markdown string, size int) [][2]int {
+	var bounds [][2]int
+	for start := 0; start < len(markdown); {
+		end := chunkEnd(markdown, start, size)
+		bounds = append(bounds, [2]int{start, end})
+		start = end
+	}
+	if len(bounds) == 0 {
+		bounds = append(bounds, [2]int{0, 0})
+	}
+	return bounds
+}
+
+// chunkEnd finds where a chunk starting at start should end: the last
+// paragraph break within size, else the last line break, else size bytes
+// (backed up to a UTF-8 boundary)
+func chunkEnd(s string, start, size int) int {
+	if len(s)-start <= size {
+		return len(s)
+	}
+	window := s[start : start+size]
+	if i := strings.LastIndex(window, "\n\n"); i > size/2 {
+		return start + i + 2
+	}
+	if i := strings.LastIndex(window, "\n"); i > size/2 {
+		return start + i + 1
+	}
+	end := start + size
+	for end > start && end < len(s) && s[end]&0xC0 == 0x80 {
+		end--
+	}
+	return end
+}
+
+// linksInChunk lists the link numbers referenced by markers in text
+func linksInChunk(text string, links []string) []int {
+	var found []int
+	for n := 1; n <= len(links); n++ {
+		if strings.Contains(text, "["+strconv.Itoa(n)+"]") {
+			found = append(found, n)
+		}
+	}
+	return found
+}
+
+// kindLabels name non-HTML content in the page header
+var kindLabels = map[string]string{
+	kindJSON: "JSON",
+	kindText: "plain text",
+	kindFeed: "feed",
+	kindPDF:  "PDF",
+}
+
+// formatBrowsePage renders one chunk with a title header, a position footer
+// when the content spans several pages, and the links cited in the chunk
+func formatBrowsePage(page *browsePage, chunk *pageChunk) string {
+	var b strings.Builder
+	if page.title != "" {
+		b.WriteString("# " + page.title + "\n")
+	}
+	b.WriteString("URL: " + page.url)
+	if label, ok := kindLabels[page.kind]; ok {
+		b.WriteString(" (" + label + ")")
+	}
+	b.WriteString("\n\n")
+	b.WriteString(strings.TrimSpace(chunk.text))
+	b.WriteString("\n")
+
+	total := len(page.markdown)
+	if chunk.start > 0 || chunk.end < total {
+		position := fmt.Sprintf("characters %d-%d of %d", chunk.start, chunk.end, total)
+		if chunk.number > 0 {
+			position = fmt.Sprintf("Page %d of %d · %s", chunk.number, chunk.total, position)
+		}
+		next := "end of content"
+		if chunk.end < total {
+			if chunk.number > 0 {
+				next = fmt.Sprintf("use page=%d to continue", chunk.number+1)
+			} else {
+				next = fmt.Sprintf("use offset=%d to continue", chunk.end)
+			}
+		}
+		b.WriteString(fmt.Sprintf("\n[%s · %s]\n", position, next))
+	}
+
+	if cited := linksInChunk(chunk.text, page.links); len(cited) > 0 {
+		b.WriteString("\nLinks (follow with link=N):\n")
+		for _, n := range cited {
+			b.WriteString(fmt.Sprintf("[%d] %s\n", n, page.links[n-1]))
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,334 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checkpoints: before write_file, patch_file or multi_patch change a file,
+// its content is copied into the current turn's checkpoint under
+// ~/.clyde/checkpoints/<session>/<turn>/, once per file and turn. Rewinding
+// to a turn puts every file changed since then back the way it was before
+// that turn, deleting files the agent created.
+
+// checkpoint defaults, overridable in ~/.clyde/config
+const (
+	defaultCheckpointMaxFileMB = 10 // CLYDE_CHECKPOINT_MAX_FILE_MB
+	defaultCheckpointSessions  = 20 // CLYDE_CHECKPOINT_SESSIONS
+)
+
+// checkpointFile records a file as it was before a turn changed it
+type checkpointFile struct {
+	Path    string      `json:"path"`
+	Existed bool        `json:"existed"`
+	Mode    fs.FileMode `json:"mode,omitempty"`
+	Blob    string      `json:"blob,omitempty"`    // copy of the content, in the turn directory
+	Skipped string      `json:"skipped,omitempty"` // why the content was not saved
+}
+
+// checkpointManifest describes one turn and is saved as checkpoint.json
+type checkpointManifest struct {
+	Turn    int              `json:"turn"`
+	Time    time.Time        `json:"time"`
+	Prompt  string           `json:"prompt"`
+	History int              `json:"history"` // conversation messages before the turn
+	Files   []checkpointFile `json:"files"`
+}
+
+// Checkpoint summarizes a turn for the REPL's /checkpoints command
+type Checkpoint struct {
+	Turn    int
+	Time    time.Time
+	Prompt  string
+	History int      // conversation length to truncate to when rewinding, -1 for a rewind's own checkpoint
+	Files   []string // files the turn changed
+}
+
+// RewindResult reports what restoring a checkpoint did
+type RewindResult struct {
+	Turn     int      // the checkpoint restored
+	Saved    int      // checkpoint holding the versions replaced, to undo the rewind
+	History  int      // conversation length before the restored turn
+	Restored []string // files put back
+	Deleted  []string // files the agent had created
+	Failed   []string // files that could not be restored, with the reason
+}
+
+type checkpointStore struct {
+	mu      sync.Mutex
+	session string // session directory, created with the first turn
+	turns   []*checkpointManifest
+}
+
+var checkpoints checkpointStore
+
+func init() {
+	// A new agent after Shutdown starts a new session
+	registerCleanup(func() {
+		checkpoints.mu.Lock()
+		defer checkpoints.mu.Unlock()
+		checkpoints.session, checkpoints.turns = "", nil
+	})
+}
+
+// checkpointRoot returns CLYDE_CHECKPOINT_DIR, or ~/.clyde/checkpoints
+func checkpointRoot() (string, error) {
+	if dir := strings.TrimSpace(os.Getenv("CLYDE_CHECKPOINT_DIR")); dir != "" {
+		return expandHome(dir), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find home directory for ~/.clyde/checkpoints: %w", err)
+	}
+	return filepath.Join(home, ".clyde", "checkpoints"), nil
+}
+
+// BeginCheckpoint starts the checkpoint for a new user turn. history is
+// the number of conversation messages before the turn, so a rewind can
+// truncate the conversation to match. CLYDE_CHECKPOINTS=false disables
+// checkpoints.
+func BeginCheckpoint(prompt string, history int) {
+	if !envBool("CLYDE_CHECKPOINTS", true) {
+		return
+	}
+	checkpoints.mu.Lock()
+	defer checkpoints.mu.Unlock()
+	if _, err := checkpoints.begin(prompt, history); err != nil {
+		reportProgress("⚠️ Checkpoints are off for this turn: %v", err)
+	}
+}
+
+func (s *checkpointStore) begin(prompt string, history int) (*checkpointManifest, error) {
+	if s.session == "" {
+		root, err := checkpointRoot()
+		if err != nil {
+			return nil, err
+		}
+		session := filepath.Join(root, fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), os.Getpid()))
+		if err := os.MkdirAll(session, 0700); err != nil {
+			return nil, err
+		}
+		s.session = session
+		pruneCheckpointSessions(root, session)
+	}
+	m := &checkpointManifest{Turn: len(s.turns) + 1, Time: time.Now(), Prompt: prompt, History: history, Files: []checkpointFile{}}
+	if err := os.MkdirAll(s.turnDir(m.Turn), 0700); err != nil {
+		return nil, err
+	}
+	s.turns = append(s.turns, m)
+	return m, s.save(m)
+}
+
+func (s *checkpointStore) turnDir(turn int) string {
+	return filepath.Join(s.session, fmt.Sprintf("%03d", turn))
+}
+
+func (s *checkpointStore) save(m *checkpointManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.turnDir(m.Turn), "checkpoint.json"), data)
+}
+
+// pruneCheckpointSessions keeps the most recent CLYDE_CHECKPOINT_SESSIONS
+// session directories
+func pruneCheckpointSessions(root, current string) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	var sessions []string
+	for _, e := range entries {
+		if e.IsDir() && filepath.Join(root, e.Name()) != current {
+			sessions = append(sessions, e.Name())
+		}
+	}
+	sort.Strings(sessions) // names start with the time they began
+	keep := max(envInt("CLYDE_CHECKPOINT_SESSIONS", defaultCheckpointSessions)-1, 0)
+	for len(sessions) > keep {
+		os.RemoveAll(filepath.Join(root, sessions[0]))
+		sessions = sessions[1:]
+	}
+}
+
+// checkpointBeforeWrite saves the current content of files a tool is about
+// to change. Failures are reported but never block the edit.
+func checkpointBeforeWrite(paths ...string) {
+	checkpoints.mu.Lock()
+	defer checkpoints.mu.Unlock()
+	if len(checkpoints.turns) == 0 {
+		return
+	}
+	m := checkpoints.turns[len(checkpoints.turns)-1]
+	changed := false
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		}
+		if m.has(abs) {
+			continue
+		}
+		f, err := checkpoints.snapshot(m, abs)
+		if err != nil {
+			reportProgress("⚠️ Could not checkpoint %s: %v", displayName(abs), err)
+			continue
+		}
+		m.Files = append(m.Files, f)
+		changed = true
+	}
+	if changed {
+		if err := checkpoints.save(m); err != nil {
+			reportProgress("⚠️ Could not save checkpoint %d: %v", m.Turn, err)
+		}
+	}
+}
+
+func (m *checkpointManifest) has(path string) bool {
+	for _, f := range m.Files {
+		if f.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *checkpointStore) snapshot(m *checkpointManifest, path string) (checkpointFile, error) {
+	f := checkpointFile{Path: path}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return f, err
+	}
+	f.Existed, f.Mode = true, info.Mode().Perm()
+	if limit := int64(envInt("CLYDE_CHECKPOINT_MAX_FILE_MB", defaultCheckpointMaxFileMB)) << 20; limit > 0 && info.Size() > limit {
+		f.Skipped = fmt.Sprintf("%s is larger than CLYDE_CHECKPOINT_MAX_FILE_MB", formatSize(info.Size()))
+		return f, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	f.Blob = fmt.Sprintf("%d-%s", len(m.Files)+1, filepath.Base(path))
+	return f, os.WriteFile(filepath.Join(s.turnDir(m.Turn), f.Blob), data, 0600)
+}
+
+// ListCheckpoints returns this session's turns, oldest first
+func ListCheckpoints() []Checkpoint {
+	checkpoints.mu.Lock()
+	defer checkpoints.mu.Unlock()
+	var list []Checkpoint
+	for _, m := range checkpoints.turns {
+		c := Checkpoint{Turn: m.Turn, Time: m.Time, Prompt: m.Prompt, History: m.History}
+		for _, f := range m.Files {
+			c.Files = append(c.Files, f.Path)
+		}
+		list = append(list, c)
+	}
+	return list
+}
+
+// LastChangedTurn returns the most recent turn that changed files, or 0
+func LastChangedTurn() int {
+	checkpoints.mu.Lock()
+	defer checkpoints.mu.Unlock()
+	for i := len(checkpoints.turns) - 1; i >= 0; i-- {
+		if len(checkpoints.turns[i].Files) > 0 {
+			return checkpoints.turns[i].Turn
+		}
+	}
+	return 0
+}
+
+// RewindCheckpoint restores every file changed in turn and later turns to
+// its state before turn. The versions it replaces are saved first as a new
+// checkpoint, so the rewind can itself be rewound.
+func RewindCheckpoint(turn int) (*RewindResult, error) {
+	checkpoints.mu.Lock()
+	defer checkpoints.mu.Unlock()
+	if turn < 1 || turn > len(checkpoints.turns) {
+		if len(checkpoints.turns) == 0 {
+			return nil, fmt.Errorf("no checkpoints yet in this session")
+		}
+		return nil, fmt.Errorf("no checkpoint %d; this session has checkpoints 1 to %d", turn, len(checkpoints.turns))
+	}
+
+	// The earliest record of each file from turn on is its state before turn
+	var order []string
+	before := make(map[string]checkpointFile)
+	source := make(map[string]int)
+	for _, m := range checkpoints.turns[turn-1:] {
+		for _, f := range m.Files {
+			if _, seen := before[f.Path]; !seen {
+				before[f.Path], source[f.Path] = f, m.Turn
+				order = append(order, f.Path)
+			}
+		}
+	}
+	result := &RewindResult{Turn: turn, History: checkpoints.turns[turn-1].History}
+	if len(order) == 0 {
+		return result, nil
+	}
+
+	saved, err := checkpoints.begin(fmt.Sprintf("(rewind to checkpoint %d)", turn), -1)
+	if err != nil {
+		return nil, fmt.Errorf("could not save the current files before rewinding: %w", err)
+	}
+	result.Saved = saved.Turn
+	for _, path := range order {
+		f, err := checkpoints.snapshot(saved, path)
+		if err != nil {
+			return nil, fmt.Errorf("could not save the current %s before rewinding: %w", displayName(path), err)
+		}
+		saved.Files = append(saved.Files, f)
+	}
+	if err := checkpoints.save(saved); err != nil {
+		return nil, err
+	}
+
+	for _, path := range order {
+		f := before[path]
+		name := displayName(relativePath(path))
+		switch {
+		case f.Skipped != "":
+			result.Failed = append(result.Failed, fmt.Sprintf("%s (not saved: %s)", name, f.Skipped))
+		case !f.Existed:
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				result.Failed = append(result.Failed, fmt.Sprintf("%s (%v)", name, err))
+				continue
+			}
+			result.Deleted = append(result.Deleted, name)
+		default:
+			data, err := os.ReadFile(filepath.Join(checkpoints.turnDir(source[path]), f.Blob))
+			if err == nil {
+				err = os.MkdirAll(filepath.Dir(path), 0755)
+			}
+			if err == nil {
+				err = writeFileAtomic(path, data)
+			}
+			if err == nil {
+				err = os.Chmod(path, f.Mode)
+			}
+			if err != nil {
+				result.Failed = append(result.Failed, fmt.Sprintf("%s (%v)", name, err))
+				continue
+			}
+			result.Restored = append(result.Restored, name)
+		}
+	}
+	return result, nil
+}
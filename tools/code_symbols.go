@@ -0,0 +1,518 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/api"
+	"golang.org/x/tools/go/packages"
+)
+
+func init() {
+	Register(codeSymbolsTool, executeCodeSymbols, displayCodeSymbols)
+}
+
+var codeSymbolsTool = api.Tool{
+	Name:        "code_symbols",
+	Description: "Go code intelligence from the type checker, with file:line locations. Actions: 'definition' (declaration, signature and doc of a symbol), 'references' (every use), 'implementations' (types implementing an interface, or interfaces a type implements), 'methods' (method set of a type, including promoted and pointer-receiver methods), 'outline' (a package's exported API with doc comments) and 'callgraph' (callers and callees of a function, to a depth). Prefer this over grep for Go navigation: it matches the actual symbol, not the text. Symbols are written 'Name', 'Type.Method', 'pkg.Name' or 'pkg.Type.Field'; use file and line to pick the identifier at a specific place.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"definition", "references", "implementations", "methods", "outline", "callgraph"},
+				"description": "What to look up",
+			},
+			"symbol": map[string]interface{}{
+				"type":        "string",
+				"description": "The symbol, e.g. 'Register', 'Client.WithModel', 'api.Tool', 'io.Reader'. For outline, a package name, import path or directory",
+			},
+			"file": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: with line, resolve symbol as the identifier on that line of this file instead of by name",
+			},
+			"line": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional: line number for file",
+			},
+			"dir": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: module directory to load (default current directory)",
+			},
+			"pattern": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: package pattern to load (default './...')",
+			},
+			"direction": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"callers", "callees", "both"},
+				"description": "Optional, callgraph only: which side of the graph to show (default both)",
+			},
+			"depth": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional, callgraph only: levels to follow (default 1, max 4)",
+			},
+			"all": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Optional, outline only: include unexported declarations (default false)",
+			},
+		},
+		"required": []string{"action", "symbol"},
+	},
+}
+
+const (
+	defaultCodeSymbolsResults = 200
+	maxCodeSymbolsOutput      = 60 * 1024
+	codeSymbolsLoadTimeout    = 2 * time.Minute
+)
+
+// symbolIndex is a set of type-checked packages. Test variants are
+// loaded too, so declarations in _test.go files and uses from tests are
+// found; objects are compared by declaration position, since a package
+// and its test variant have separate copies of every object.
+type symbolIndex struct {
+	dir         string
+	pattern     string
+	fingerprint uint64
+	fset        *token.FileSet
+	pkgs        []*packages.Package // source packages, plain ones before test variants
+	loadErrors  []string
+
+	graphOnce sync.Once
+	calls     []callEdge
+
+	linesMu sync.Mutex
+	lines   map[string][]string
+}
+
+var symbolCache struct {
+	sync.Mutex
+	index *symbolIndex
+}
+
+func executeCodeSymbols(input map[string]interface{}, apiClient *api.Client, history []api.Message) (string, error) {
+	action, _ := input["action"].(string)
+	symbol, _ := input["symbol"].(string)
+	if action == "" || symbol == "" {
+		return "", fmt.Errorf("action and symbol are required. Example: code_symbols(action=\"references\", symbol=\"Client.Do\")")
+	}
+
+	dir, _ := input["dir"].(string)
+	if dir == "" {
+		dir = "."
+	}
+	if err := checkWorkspacePath(dir); err != nil {
+		return "", err
+	}
+	pattern, _ := input["pattern"].(string)
+	if pattern == "" {
+		pattern = "./..."
+	}
+
+	ix, err := loadSymbolIndex(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+
+	var result string
+	switch action {
+	case "outline":
+		all, _ := input["all"].(bool)
+		result, err = ix.outline(symbol, all)
+	case "definition", "references", "implementations", "methods", "callgraph":
+		var objs []types.Object
+		if file, _ := input["file"].(string); file != "" {
+			line, _ := input["line"].(float64)
+			objs, err = ix.resolveAt(file, int(line), symbol)
+		} else {
+			objs, err = ix.resolve(symbol)
+		}
+		if err != nil {
+			return "", err
+		}
+		if action == "definition" {
+			result = ix.definitions(objs)
+			break
+		}
+		if len(objs) > 1 {
+			return "", fmt.Errorf("'%s' is ambiguous:\n%s\nQualify it (e.g. pkg.Name or Type.Method) or pass file and line", symbol, ix.candidateList(objs))
+		}
+		switch action {
+		case "references":
+			result = ix.references(objs[0])
+		case "implementations":
+			result, err = ix.implementations(objs[0])
+		case "methods":
+			result, err = ix.methods(objs[0])
+		case "callgraph":
+			direction, _ := input["direction"].(string)
+			depth := 1
+			if v, ok := input["depth"].(float64); ok && v >= 1 {
+				depth = min(int(v), 4)
+			}
+			result, err = ix.callgraph(objs[0], direction, depth)
+		}
+	default:
+		return "", fmt.Errorf("unknown action '%s'. Use definition, references, implementations, methods, outline or callgraph", action)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if len(ix.loadErrors) > 0 {
+		result += fmt.Sprintf("\n\nNote: %d package errors; results may be incomplete. First: %s", len(ix.loadErrors), ix.loadErrors[0])
+	}
+	if len(result) > maxCodeSymbolsOutput {
+		result = result[:maxCodeSymbolsOutput] + "\n\n[Output truncated. Narrow the symbol or pattern]"
+	}
+	return result, nil
+}
+
+// loadSymbolIndex loads and type-checks the packages matching pattern,
+// reusing the last load while no Go file under dir has changed
+func loadSymbolIndex(dir, pattern string) (*symbolIndex, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := goSourceFingerprint(abs)
+
+	symbolCache.Lock()
+	defer symbolCache.Unlock()
+	if ix := symbolCache.index; ix != nil && ix.dir == abs && ix.pattern == pattern && ix.fingerprint == fingerprint {
+		return ix, nil
+	}
+
+	reportProgress("🔎 Loading Go packages in %s...", displayName(dir))
+	ctx, cancel := context.WithTimeout(context.Background(), codeSymbolsLoadTimeout)
+	defer cancel()
+	fset := token.NewFileSet()
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports |
+			packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
+		Context: ctx,
+		Dir:     abs,
+		Fset:    fset,
+		Tests:   true,
+	}
+	pkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Go packages in '%s': %w. code_symbols needs a Go module and the go command", dir, err)
+	}
+
+	ix := &symbolIndex{dir: abs, pattern: pattern, fingerprint: fingerprint, fset: fset, lines: make(map[string][]string)}
+	for _, p := range pkgs {
+		// The generated test main packages have nothing to navigate
+		if strings.HasSuffix(p.ID, ".test") || p.Types == nil {
+			continue
+		}
+		for _, e := range p.Errors {
+			ix.loadErrors = append(ix.loadErrors, e.Error())
+		}
+		ix.pkgs = append(ix.pkgs, p)
+	}
+	if len(ix.pkgs) == 0 {
+		if len(ix.loadErrors) > 0 {
+			return nil, fmt.Errorf("no Go packages could be loaded from '%s': %s", dir, ix.loadErrors[0])
+		}
+		return nil, fmt.Errorf("no Go packages match '%s' in '%s'", pattern, dir)
+	}
+	sort.SliceStable(ix.pkgs, func(i, j int) bool {
+		return !isTestVariant(ix.pkgs[i]) && isTestVariant(ix.pkgs[j])
+	})
+	symbolCache.index = ix
+	return ix, nil
+}
+
+// goSourceFingerprint hashes the names, sizes and modification times of
+// the Go files and go.mod under dir, so edits invalidate the cached load
+func goSourceFingerprint(dir string) uint64 {
+	h := fnv.New64a()
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != dir && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules" || d.Name() == "vendor" || d.Name() == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(p, ".go") || d.Name() == "go.mod" || d.Name() == "go.work" {
+			if info, err := d.Info(); err == nil {
+				fmt.Fprintf(h, "%s|%d|%d\n", p, info.Size(), info.ModTime().UnixNano())
+			}
+		}
+		return nil
+	})
+	return h.Sum64()
+}
+
+// isTestVariant reports whether p is a package recompiled with its tests,
+// or an external _test package
+func isTestVariant(p *packages.Package) bool {
+	return strings.Contains(p.ID, " [")
+}
+
+// key identifies an object across package variants by where it's declared
+func (ix *symbolIndex) key(obj types.Object) string {
+	pos := ix.fset.Position(obj.Pos())
+	if !pos.IsValid() {
+		if obj.Pkg() == nil {
+			return "builtin." + obj.Name()
+		}
+		return obj.Pkg().Path() + "." + obj.Name()
+	}
+	return fmt.Sprintf("%s:%d:%d:%s", pos.Filename, pos.Line, pos.Column, obj.Name())
+}
+
+// typesPackages returns the loaded packages and the packages they import,
+// one per import path
+func (ix *symbolIndex) typesPackages(withImports bool) []*types.Package {
+	seen := make(map[string]bool)
+	var out []*types.Package
+	add := func(p *types.Package) {
+		if !seen[p.Path()] {
+			seen[p.Path()] = true
+			out = append(out, p)
+		}
+	}
+	for _, p := range ix.pkgs {
+		add(p.Types)
+	}
+	if withImports {
+		for _, p := range ix.pkgs {
+			for _, imp := range p.Types.Imports() {
+				add(imp)
+			}
+		}
+	}
+	return out
+}
+
+// resolve finds the objects a symbol names. Forms: Name, Type.Member,
+// pkg.Name, pkg.Type.Member, and import paths in place of pkg.
+func (ix *symbolIndex) resolve(symbol string) ([]types.Object, error) {
+	var found []types.Object
+	seen := make(map[string]bool)
+	add := func(obj types.Object) {
+		if obj != nil && !seen[ix.key(obj)] {
+			seen[ix.key(obj)] = true
+			found = append(found, obj)
+		}
+	}
+
+	// An import path qualifier: github.com/x/y.Type.Method
+	if slash := strings.LastIndex(symbol, "/"); slash >= 0 {
+		segs := strings.Split(symbol[slash+1:], ".")
+		path := symbol[:slash+1] + segs[0]
+		for _, p := range ix.typesPackages(true) {
+			if p.Path() == path {
+				add(lookupMembers(p, segs[1:]))
+			}
+		}
+	} else {
+		segs := strings.Split(symbol, ".")
+		// Qualified by package name
+		if len(segs) > 1 {
+			for _, p := range ix.typesPackages(true) {
+				if p.Name() == segs[0] || p.Path() == segs[0] {
+					add(lookupMembers(p, segs[1:]))
+				}
+			}
+		}
+		// Unqualified, in the loaded packages
+		for _, p := range ix.typesPackages(false) {
+			add(lookupMembers(p, segs))
+		}
+		// A bare name that isn't declared at package level may be a method
+		// or field
+		if len(found) == 0 && len(segs) == 1 {
+			for _, p := range ix.typesPackages(false) {
+				scope := p.Scope()
+				for _, name := range scope.Names() {
+					if tn, ok := scope.Lookup(name).(*types.TypeName); ok && !tn.IsAlias() {
+						obj, _, _ := types.LookupFieldOrMethod(tn.Type(), true, p, segs[0])
+						if obj != nil && obj.Pkg() == p {
+							add(obj)
+						}
+					}
+				}
+			}
+		}
+		if len(found) == 0 && len(segs) == 1 {
+			add(types.Universe.Lookup(segs[0]))
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, fmt.Errorf("symbol '%s' not found in the loaded packages. Check the spelling, qualify it (pkg.Name, Type.Method), or use grep", symbol)
+	}
+	return found, nil
+}
+
+// lookupMembers resolves Name or Type.Member within a package
+func lookupMembers(p *types.Package, segs []string) types.Object {
+	if len(segs) == 0 || len(segs) > 2 {
+		return nil
+	}
+	obj := p.Scope().Lookup(segs[0])
+	if obj == nil || len(segs) == 1 {
+		return obj
+	}
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	member, _, _ := types.LookupFieldOrMethod(tn.Type(), true, p, segs[1])
+	return member
+}
+
+// resolveAt finds the identifier named name (or the last segment of a
+// qualified name) on a line of a file, and returns what it refers to
+func (ix *symbolIndex) resolveAt(file string, line int, name string) ([]types.Object, error) {
+	if line < 1 {
+		return nil, fmt.Errorf("line is required with file")
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	fileFound := false
+	for _, p := range ix.pkgs {
+		for _, f := range p.Syntax {
+			if ix.fset.File(f.Pos()).Name() != abs {
+				continue
+			}
+			fileFound = true
+			var obj types.Object
+			ast.Inspect(f, func(n ast.Node) bool {
+				id, ok := n.(*ast.Ident)
+				if obj != nil || !ok || id.Name != name || ix.fset.Position(id.Pos()).Line != line {
+					return obj == nil
+				}
+				if o := p.TypesInfo.Defs[id]; o != nil {
+					obj = o
+				} else if o := p.TypesInfo.Uses[id]; o != nil {
+					obj = o
+				}
+				return false
+			})
+			if obj != nil {
+				return []types.Object{obj}, nil
+			}
+		}
+	}
+	if !fileFound {
+		return nil, fmt.Errorf("'%s' is not part of the loaded packages (pattern '%s')", file, ix.pattern)
+	}
+	return nil, fmt.Errorf("no identifier '%s' on line %d of '%s'", name, line, file)
+}
+
+// position formats a position as a path relative to the working directory
+func (ix *symbolIndex) position(pos token.Pos) string {
+	p := ix.fset.Position(pos)
+	if !p.IsValid() {
+		return "(no source)"
+	}
+	return fmt.Sprintf("%s:%d", relativePath(p.Filename), p.Line)
+}
+
+// sourceLine returns a trimmed line of a file, for showing references
+func (ix *symbolIndex) sourceLine(pos token.Pos) string {
+	p := ix.fset.Position(pos)
+	ix.linesMu.Lock()
+	defer ix.linesMu.Unlock()
+	lines, ok := ix.lines[p.Filename]
+	if !ok {
+		data, _ := os.ReadFile(p.Filename)
+		lines = strings.Split(string(data), "\n")
+		ix.lines[p.Filename] = lines
+	}
+	if p.Line < 1 || p.Line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[p.Line-1])
+}
+
+// qualifiedName names an object as pkg.Name, pkg.Type.Method or
+// (*pkg.Type).Method
+func qualifiedName(obj types.Object) string {
+	if fn, ok := obj.(*types.Func); ok {
+		if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+			t := types.TypeString(recv.Type(), func(p *types.Package) string { return p.Name() })
+			if strings.HasPrefix(t, "*") {
+				return fmt.Sprintf("(%s).%s", t, fn.Name())
+			}
+			return t + "." + fn.Name()
+		}
+	}
+	if v, ok := obj.(*types.Var); ok && v.IsField() {
+		return "field " + v.Name()
+	}
+	if obj.Pkg() == nil {
+		return obj.Name()
+	}
+	return obj.Pkg().Name() + "." + obj.Name()
+}
+
+// objectKind describes an object for headers
+func objectKind(obj types.Object) string {
+	switch o := obj.(type) {
+	case *types.Func:
+		if o.Type().(*types.Signature).Recv() != nil {
+			return "method"
+		}
+		return "func"
+	case *types.TypeName:
+		if types.IsInterface(o.Type()) {
+			return "interface"
+		}
+		return "type"
+	case *types.Var:
+		if o.IsField() {
+			return "field"
+		}
+		return "var"
+	case *types.Const:
+		return "const"
+	case *types.PkgName:
+		return "package"
+	case *types.Builtin:
+		return "builtin"
+	}
+	return "object"
+}
+
+func (ix *symbolIndex) candidateList(objs []types.Object) string {
+	var b strings.Builder
+	for _, obj := range objs {
+		fmt.Fprintf(&b, "  %s %s  %s\n", objectKind(obj), qualifiedName(obj), ix.position(obj.Pos()))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func displayCodeSymbols(input map[string]interface{}) string {
+	action, _ := input["action"].(string)
+	symbol, _ := input["symbol"].(string)
+	if file, _ := input["file"].(string); file != "" {
+		line, _ := input["line"].(float64)
+		return fmt.Sprintf("→ Code symbols: %s %s (%s:%d)", action, symbol, file, int(line))
+	}
+	return fmt.Sprintf("→ Code symbols: %s %s", action, symbol)
+}
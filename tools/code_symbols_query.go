@@ -0,0 +1,588 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// definitions describes each object: kind, location, declaration and doc
+func (ix *symbolIndex) definitions(objs []types.Object) string {
+	var b strings.Builder
+	for i, obj := range objs {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "%s (%s)  %s\n", qualifiedName(obj), objectKind(obj), ix.position(obj.Pos()))
+		decl, docText := ix.declaration(obj)
+		if decl == "" {
+			decl = types.ObjectString(obj, types.RelativeTo(obj.Pkg()))
+		}
+		b.WriteString("\n" + indent(decl, "  ") + "\n")
+		if docText != "" {
+			b.WriteString("\n" + indent(strings.TrimSpace(docText), "  ") + "\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// declaration prints an object's declaration from source, with function
+// bodies left out and long type definitions cut, plus its doc comment
+func (ix *symbolIndex) declaration(obj types.Object) (string, string) {
+	file := ix.fileFor(obj.Pos())
+	if file == nil {
+		return "", ""
+	}
+	path, _ := astutil.PathEnclosingInterval(file, obj.Pos(), obj.Pos())
+	var genDoc *ast.CommentGroup
+	for _, n := range path {
+		if gd, ok := n.(*ast.GenDecl); ok && len(gd.Specs) == 1 {
+			genDoc = gd.Doc
+		}
+	}
+	for _, n := range path {
+		switch d := n.(type) {
+		case *ast.FuncDecl:
+			header := *d
+			header.Body = nil
+			header.Doc = nil
+			return ix.printNode(&header, 1), d.Doc.Text()
+		case *ast.TypeSpec:
+			return "type " + ix.printNode(d, 40), firstDoc(d.Doc, genDoc, d.Comment)
+		case *ast.ValueSpec:
+			kind := "var "
+			if _, ok := obj.(*types.Const); ok {
+				kind = "const "
+			}
+			return kind + ix.printNode(d, 10), firstDoc(d.Doc, genDoc, d.Comment)
+		case *ast.Field:
+			return ix.printNode(d, 10), firstDoc(d.Doc, d.Comment)
+		}
+	}
+	return "", ""
+}
+
+func firstDoc(groups ...*ast.CommentGroup) string {
+	for _, g := range groups {
+		if text := g.Text(); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// fileFor finds the syntax tree holding pos
+func (ix *symbolIndex) fileFor(pos token.Pos) *ast.File {
+	if !pos.IsValid() {
+		return nil
+	}
+	for _, p := range ix.pkgs {
+		for _, f := range p.Syntax {
+			if f.FileStart <= pos && pos <= f.FileEnd {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// printNode formats a node, keeping at most maxLines lines
+func (ix *symbolIndex) printNode(node ast.Node, maxLines int) string {
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, ix.fset, node); err != nil {
+		return ""
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) > maxLines {
+		lines = append(lines[:maxLines], fmt.Sprintf("\t// ... %d more lines", len(lines)-maxLines))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
+
+// references lists every use of obj, grouped by file
+func (ix *symbolIndex) references(obj types.Object) string {
+	target := ix.key(obj)
+	seen := make(map[string]bool)
+	var uses []token.Pos
+	for _, p := range ix.pkgs {
+		for id, o := range p.TypesInfo.Uses {
+			if ix.key(o) != target {
+				continue
+			}
+			at := ix.fset.Position(id.Pos()).String()
+			if !seen[at] {
+				seen[at] = true
+				uses = append(uses, id.Pos())
+			}
+		}
+	}
+	sort.Slice(uses, func(i, j int) bool {
+		a, b := ix.fset.Position(uses[i]), ix.fset.Position(uses[j])
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "References to %s (%s, declared at %s): %d\n", qualifiedName(obj), objectKind(obj), ix.position(obj.Pos()), len(uses))
+	if len(uses) == 0 {
+		b.WriteString("\nNo uses in the loaded packages.")
+		return b.String()
+	}
+	files := make(map[string]bool)
+	for i, pos := range uses {
+		if i == defaultCodeSymbolsResults {
+			fmt.Fprintf(&b, "\n... and %d more", len(uses)-i)
+			break
+		}
+		loc := ix.position(pos)
+		file := loc[:strings.LastIndex(loc, ":")]
+		if !files[file] {
+			files[file] = true
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s  %s\n", loc, ix.sourceLine(pos))
+	}
+	return strings.TrimRight(b.String(), "\n") + fmt.Sprintf("\n\n%d uses in %d files", len(uses), len(files))
+}
+
+// namedTypes returns the package-level named types of the loaded packages,
+// skipping test variants so each declaration appears once
+func (ix *symbolIndex) namedTypes(withImports bool) []*types.TypeName {
+	var out []*types.TypeName
+	for _, p := range ix.typesPackages(withImports) {
+		scope := p.Scope()
+		for _, name := range scope.Names() {
+			if tn, ok := scope.Lookup(name).(*types.TypeName); ok && !tn.IsAlias() {
+				out = append(out, tn)
+			}
+		}
+	}
+	return out
+}
+
+// implementations lists the types implementing an interface, or the
+// interfaces a type implements
+func (ix *symbolIndex) implementations(obj types.Object) (string, error) {
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return "", fmt.Errorf("%s is a %s; implementations needs a type or interface", qualifiedName(obj), objectKind(obj))
+	}
+	var b strings.Builder
+	if iface, ok := tn.Type().Underlying().(*types.Interface); ok {
+		if iface.Empty() {
+			return "", fmt.Errorf("%s is an empty interface, which every type implements", qualifiedName(obj))
+		}
+		var concrete, extending []string
+		for _, other := range ix.namedTypes(false) {
+			if other == tn {
+				continue
+			}
+			t := other.Type()
+			line := fmt.Sprintf("  %s  %s", qualifiedName(other), ix.position(other.Pos()))
+			switch {
+			case types.IsInterface(t):
+				if types.Implements(t, iface) {
+					extending = append(extending, line)
+				}
+			case types.Implements(t, iface):
+				concrete = append(concrete, line)
+			case types.Implements(types.NewPointer(t), iface):
+				concrete = append(concrete, line+"  (pointer receiver: *"+other.Name()+")")
+			}
+		}
+		fmt.Fprintf(&b, "Implementations of %s (%s): %d\n", qualifiedName(obj), ix.position(obj.Pos()), len(concrete))
+		b.WriteString(strings.Join(concrete, "\n"))
+		if len(concrete) == 0 {
+			b.WriteString("  none in the loaded packages")
+		}
+		if len(extending) > 0 {
+			fmt.Fprintf(&b, "\n\nInterfaces that include it:\n%s", strings.Join(extending, "\n"))
+		}
+		return b.String(), nil
+	}
+
+	// A concrete type: which interfaces does it satisfy
+	t := tn.Type()
+	var found []string
+	check := func(other *types.TypeName) {
+		iface, ok := other.Type().Underlying().(*types.Interface)
+		if !ok || iface.Empty() || other == tn {
+			return
+		}
+		line := fmt.Sprintf("  %s  %s", qualifiedName(other), ix.position(other.Pos()))
+		if types.Implements(t, iface) {
+			found = append(found, line)
+		} else if types.Implements(types.NewPointer(t), iface) {
+			found = append(found, line+"  (as *"+tn.Name()+")")
+		}
+	}
+	check(types.Universe.Lookup("error").(*types.TypeName))
+	for _, other := range ix.namedTypes(true) {
+		if other.Exported() || other.Pkg() == tn.Pkg() {
+			check(other)
+		}
+	}
+	fmt.Fprintf(&b, "Interfaces implemented by %s (%s): %d\n", qualifiedName(obj), ix.position(obj.Pos()), len(found))
+	b.WriteString(strings.Join(found, "\n"))
+	if len(found) == 0 {
+		b.WriteString("  none among the loaded packages and their imports")
+	}
+	return b.String(), nil
+}
+
+// methods lists the method set of a type, including promoted methods and
+// those that need a pointer receiver
+func (ix *symbolIndex) methods(obj types.Object) (string, error) {
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return "", fmt.Errorf("%s is a %s; methods needs a type", qualifiedName(obj), objectKind(obj))
+	}
+	t := tn.Type()
+	valueSet := types.NewMethodSet(t)
+	all := valueSet
+	if !types.IsInterface(t) {
+		all = types.NewMethodSet(types.NewPointer(t))
+	}
+	qualifier := types.RelativeTo(tn.Pkg())
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Method set of %s (%s  %s): %d methods\n", qualifiedName(obj), objectKind(obj), ix.position(obj.Pos()), all.Len())
+	for i := 0; i < all.Len(); i++ {
+		sel := all.At(i)
+		fn := sel.Obj().(*types.Func)
+		sig := fn.Type().(*types.Signature)
+		var notes []string
+		if !types.IsInterface(t) && valueSet.Lookup(fn.Pkg(), fn.Name()) == nil {
+			notes = append(notes, "pointer receiver")
+		}
+		if len(sel.Index()) > 1 {
+			if recv := sig.Recv(); recv != nil {
+				notes = append(notes, "promoted from "+types.TypeString(recv.Type(), qualifier))
+			}
+		}
+		line := fmt.Sprintf("\n  %s%s", fn.Name(), strings.TrimPrefix(types.TypeString(sig, qualifier), "func"))
+		if len(notes) > 0 {
+			line += "  (" + strings.Join(notes, ", ") + ")"
+		}
+		b.WriteString(line + "\n    " + ix.position(fn.Pos()))
+		if _, docText := ix.declaration(fn); docText != "" {
+			b.WriteString(" · " + strings.SplitN(strings.TrimSpace(docText), "\n", 2)[0])
+		}
+	}
+	if all.Len() == 0 {
+		b.WriteString("\n  no methods")
+	}
+	return b.String(), nil
+}
+
+// outline renders a package's API with doc comments, like go doc -all
+func (ix *symbolIndex) outline(name string, all bool) (string, error) {
+	pkg := ix.findPackage(name)
+	if pkg == nil {
+		var names []string
+		for _, p := range ix.pkgs {
+			if !isTestVariant(p) {
+				names = append(names, p.PkgPath)
+			}
+		}
+		return "", fmt.Errorf("package '%s' not found. Loaded: %s", name, summarizeList(names, 20))
+	}
+
+	// go/doc rewrites the trees it's given, so parse a fresh copy
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, path := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse '%s': %w", path, err)
+		}
+		files = append(files, f)
+	}
+	mode := doc.Mode(0)
+	if all {
+		mode = doc.AllDecls | doc.AllMethods
+	}
+	dp, err := doc.NewFromFiles(fset, files, pkg.PkgPath, mode)
+	if err != nil {
+		return "", fmt.Errorf("failed to read docs for '%s': %w", pkg.PkgPath, err)
+	}
+
+	rel := func(pos token.Pos) string {
+		p := fset.Position(pos)
+		dir, _ := filepath.Rel(ix.dir, p.Filename)
+		return fmt.Sprintf("%s:%d", filepath.ToSlash(dir), p.Line)
+	}
+	var b strings.Builder
+	write := func(decl ast.Node, docText string, pos token.Pos) {
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			header := *fd
+			header.Body, header.Doc = nil, nil
+			decl = &header
+		}
+		var buf bytes.Buffer
+		(&printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}).Fprint(&buf, fset, decl)
+		fmt.Fprintf(&b, "%s  // %s\n", buf.String(), rel(pos))
+		if text := strings.TrimSpace(docText); text != "" {
+			b.WriteString(indent(text, "    ") + "\n")
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "package %s // import %q\n\n", dp.Name, dp.ImportPath)
+	if text := strings.TrimSpace(dp.Doc); text != "" {
+		b.WriteString(text + "\n\n")
+	}
+	section := func(title string, n int) {
+		if n > 0 {
+			fmt.Fprintf(&b, "%s\n\n", strings.ToUpper(title))
+		}
+	}
+	section("Constants", len(dp.Consts))
+	for _, v := range dp.Consts {
+		write(v.Decl, v.Doc, v.Decl.Pos())
+	}
+	section("Variables", len(dp.Vars))
+	for _, v := range dp.Vars {
+		write(v.Decl, v.Doc, v.Decl.Pos())
+	}
+	section("Functions", len(dp.Funcs))
+	for _, f := range dp.Funcs {
+		write(f.Decl, f.Doc, f.Decl.Pos())
+	}
+	section("Types", len(dp.Types))
+	for _, t := range dp.Types {
+		write(t.Decl, t.Doc, t.Decl.Pos())
+		for _, v := range t.Consts {
+			write(v.Decl, v.Doc, v.Decl.Pos())
+		}
+		for _, v := range t.Vars {
+			write(v.Decl, v.Doc, v.Decl.Pos())
+		}
+		for _, f := range t.Funcs {
+			write(f.Decl, f.Doc, f.Decl.Pos())
+		}
+		for _, f := range t.Methods {
+			write(f.Decl, f.Doc, f.Decl.Pos())
+		}
+	}
+	if len(dp.Consts)+len(dp.Vars)+len(dp.Funcs)+len(dp.Types) == 0 {
+		b.WriteString("No exported declarations. Pass all=true to include unexported ones.\n")
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// findPackage matches a package by import path, path suffix, name or
+// directory
+func (ix *symbolIndex) findPackage(name string) *packages.Package {
+	var absDir string
+	if abs, err := filepath.Abs(filepath.Join(ix.dir, name)); err == nil {
+		absDir = abs
+	}
+	for _, match := range []func(p *packages.Package) bool{
+		func(p *packages.Package) bool { return p.PkgPath == name },
+		func(p *packages.Package) bool {
+			return len(p.GoFiles) > 0 && filepath.Dir(p.GoFiles[0]) == absDir
+		},
+		func(p *packages.Package) bool { return strings.HasSuffix(p.PkgPath, "/"+name) },
+		func(p *packages.Package) bool { return p.Name == name },
+	} {
+		for _, p := range ix.pkgs {
+			if !isTestVariant(p) && match(p) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// callEdge is one call site from a function to a function or method
+type callEdge struct {
+	caller  types.Object
+	callee  *types.Func
+	pos     token.Pos
+	dynamic bool // a call through an interface method
+}
+
+// callGraph collects every call site in the loaded packages, once
+func (ix *symbolIndex) callGraph() []callEdge {
+	ix.graphOnce.Do(func() {
+		seen := make(map[string]bool)
+		for _, p := range ix.pkgs {
+			for _, f := range p.Syntax {
+				for _, decl := range f.Decls {
+					fd, ok := decl.(*ast.FuncDecl)
+					if !ok || fd.Body == nil {
+						continue
+					}
+					caller := p.TypesInfo.Defs[fd.Name]
+					if caller == nil {
+						continue
+					}
+					ast.Inspect(fd.Body, func(n ast.Node) bool {
+						call, ok := n.(*ast.CallExpr)
+						if !ok {
+							return true
+						}
+						callee, ok := typeutil.Callee(p.TypesInfo, call).(*types.Func)
+						if !ok {
+							return true
+						}
+						at := ix.fset.Position(call.Lparen).String()
+						if seen[at] {
+							return true
+						}
+						seen[at] = true
+						sig := callee.Type().(*types.Signature)
+						dynamic := sig.Recv() != nil && types.IsInterface(sig.Recv().Type())
+						ix.calls = append(ix.calls, callEdge{caller: caller, callee: callee, pos: call.Lparen, dynamic: dynamic})
+						return true
+					})
+				}
+			}
+		}
+	})
+	return ix.calls
+}
+
+// callgraph shows the callers and callees of a function to a depth
+func (ix *symbolIndex) callgraph(obj types.Object, direction string, depth int) (string, error) {
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return "", fmt.Errorf("%s is a %s; callgraph needs a function or method", qualifiedName(obj), objectKind(obj))
+	}
+	if direction == "" {
+		direction = "both"
+	}
+	edges := ix.callGraph()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Call graph for %s (%s  %s)\n", qualifiedName(fn), objectKind(fn), ix.position(fn.Pos()))
+	if direction == "callers" || direction == "both" {
+		b.WriteString("\nCallers:\n")
+		n := ix.writeCallTree(&b, fn, depth, true, edges, map[string]bool{ix.key(fn): true}, "  ")
+		if n == 0 {
+			b.WriteString("  none in the loaded packages (it may only be used as a value; try references)\n")
+		}
+	}
+	if direction == "callees" || direction == "both" {
+		b.WriteString("\nCallees:\n")
+		n := ix.writeCallTree(&b, fn, depth, false, edges, map[string]bool{ix.key(fn): true}, "  ")
+		if n == 0 {
+			b.WriteString("  none\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// writeCallTree writes one level of callers or callees and recurses,
+// returning how many entries it wrote at this level
+func (ix *symbolIndex) writeCallTree(b *strings.Builder, fn types.Object, depth int, callers bool, edges []callEdge, visiting map[string]bool, prefix string) int {
+	target := ix.key(fn)
+	var recv types.Type
+	if sig := fn.Type().(*types.Signature); sig.Recv() != nil && !types.IsInterface(sig.Recv().Type()) {
+		recv = sig.Recv().Type()
+	}
+
+	type entry struct {
+		other types.Object
+		pos   token.Pos
+		note  string
+	}
+	var entries []entry
+	seen := make(map[string]bool)
+	for _, e := range edges {
+		var other types.Object
+		note := ""
+		if callers {
+			switch {
+			case ix.key(e.callee) == target:
+			case e.dynamic && recv != nil && e.callee.Name() == fn.Name() && implementsInterfaceOf(recv, e.callee):
+				// A call through an interface this method satisfies
+				note = "via " + qualifiedName(e.callee)
+			default:
+				continue
+			}
+			other = e.caller
+		} else {
+			if ix.key(e.caller) != target {
+				continue
+			}
+			other = e.callee
+			if e.dynamic {
+				note = "dynamic"
+			}
+			// List each callee once, at its first call site
+			if seen[ix.key(other)] {
+				continue
+			}
+			seen[ix.key(other)] = true
+		}
+		entries = append(entries, entry{other, e.pos, note})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := ix.fset.Position(entries[i].pos), ix.fset.Position(entries[j].pos)
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+
+	for i, e := range entries {
+		if i == defaultCodeSymbolsResults {
+			fmt.Fprintf(b, "%s... and %d more\n", prefix, len(entries)-i)
+			break
+		}
+		line := fmt.Sprintf("%s%s  %s", prefix, qualifiedName(e.other), ix.position(e.pos))
+		if e.note != "" {
+			line += "  (" + e.note + ")"
+		}
+		key := ix.key(e.other)
+		if visiting[key] {
+			b.WriteString(line + "  (recursive)\n")
+			continue
+		}
+		b.WriteString(line + "\n")
+		if depth > 1 {
+			visiting[key] = true
+			ix.writeCallTree(b, e.other, depth-1, callers, edges, visiting, prefix+"  ")
+			delete(visiting, key)
+		}
+	}
+	return len(entries)
+}
+
+// implementsInterfaceOf reports whether t (or *t) implements the interface
+// that declares method m
+func implementsInterfaceOf(t types.Type, m *types.Func) bool {
+	recv := m.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return false
+	}
+	iface, ok := recv.Type().Underlying().(*types.Interface)
+	if !ok {
+		return false
+	}
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	return types.Implements(t, iface) || types.Implements(types.NewPointer(t), iface)
+}
@@ -0,0 +1,626 @@
+package tools
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/this-is-alpha-iota/clyde/api"
+)
+
+func init() {
+	Register(crawlTool, executeCrawl, displayCrawl)
+}
+
+var crawlTool = api.Tool{
+	Name:        "crawl",
+	Description: "Crawl a documentation site into a local markdown corpus that search_docs can query. Starts at a URL and follows links within the same path prefix (or the whole domain) up to a depth and page limit, respecting robots.txt and fetching politely. Pages are converted like browse does and stored under ~/.clyde/docs/<name>. Use when adopting a library whose docs you'll need repeatedly; crawling again replaces the corpus.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "The page to start from, e.g. https://docs.example.com/guide/",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: corpus name (letters, digits, '.', '-', '_'). Defaults to the host name",
+			},
+			"scope": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"prefix", "domain"},
+				"description": "Optional: 'prefix' (default) follows links under the start URL's directory; 'domain' follows links anywhere on the host and its subdomains",
+			},
+			"max_depth": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional: how many links away from the start page to go (default 3, max 10)",
+				"default":     defaultCrawlDepth,
+			},
+			"max_pages": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional: stop after storing this many pages (default 100)",
+				"default":     defaultCrawlPages,
+			},
+			"exclude": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Optional: skip URLs whose path contains any of these strings, e.g. [\"/blog/\", \"/v1/\"]",
+			},
+		},
+		"required": []string{"url"},
+	},
+}
+
+const (
+	defaultCrawlDepth       = 3
+	maxCrawlDepth           = 10
+	defaultCrawlPages       = 100
+	defaultCrawlMaxPages    = 500
+	defaultCrawlConcurrency = 4
+	defaultCrawlDelayMS     = 250
+	maxCrawlDelay           = 10 * time.Second
+)
+
+// corpusNamePattern limits corpus names to safe directory names
+var corpusNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// skippedExtensions are links the crawler never fetches: assets and
+// archives that can't be converted to text
+var skippedExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".svg": true, ".ico": true,
+	".css": true, ".js": true, ".mjs": true, ".map": true, ".woff": true, ".woff2": true, ".ttf": true,
+	".zip": true, ".gz": true, ".tgz": true, ".tar": true, ".bz2": true, ".xz": true, ".dmg": true, ".exe": true,
+	".mp3": true, ".mp4": true, ".webm": true, ".mov": true, ".wasm": true,
+}
+
+// docsIndex is the manifest of a corpus, stored as index.json
+type docsIndex struct {
+	Name      string     `json:"name"`
+	StartURL  string     `json:"start_url"`
+	Scope     string     `json:"scope"`
+	CrawledAt time.Time  `json:"crawled_at"`
+	Pages     []docsPage `json:"pages"`
+}
+
+// docsPage is one stored page
+type docsPage struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	File  string `json:"file"` // relative to the corpus directory
+	Size  int    `json:"size"`
+}
+
+// docsDir returns where corpora are stored: CLYDE_DOCS_DIR, or ~/.clyde/docs
+func docsDir() (string, error) {
+	if dir := strings.TrimSpace(os.Getenv("CLYDE_DOCS_DIR")); dir != "" {
+		return expandHome(dir), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find home directory for ~/.clyde/docs: %w", err)
+	}
+	return filepath.Join(home, ".clyde", "docs"), nil
+}
+
+// crawler holds the state of one crawl
+type crawler struct {
+	start    *url.URL
+	scope    string
+	prefix   string // path prefix for scope "prefix"
+	exclude  []string
+	maxPages int
+	delay    time.Duration
+	dir      string // where pages are written
+
+	mu        sync.Mutex
+	seen      map[string]bool
+	reserved  int // pages stored or being fetched
+	pages     []docsPage
+	files     map[string]bool
+	robots    map[string]*robotsRules
+	nextFetch map[string]time.Time // per host, for the politeness delay
+	blocked   int
+	failures  []string
+}
+
+// crawlResult is what fetching one URL produced
+type crawlResult struct {
+	page  *docsPage
+	links []string
+}
+
+func executeCrawl(input map[string]interface{}, apiClient *api.Client, conversationHistory []api.Message) (string, error) {
+	startStr, _ := input["url"].(string)
+	start, err := url.Parse(strings.TrimSpace(startStr))
+	if err != nil || (start.Scheme != "http" && start.Scheme != "https") || start.Host == "" {
+		return "", fmt.Errorf("url must be an http:// or https:// URL. Example: crawl(\"https://docs.example.com/guide/\")\n\nProvided: %s", startStr)
+	}
+	start.Fragment = ""
+
+	name, _ := input["name"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = strings.TrimPrefix(start.Hostname(), "www.")
+	}
+	if !corpusNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid corpus name '%s'. Use letters, digits, '.', '-' and '_'", name)
+	}
+
+	scope, _ := input["scope"].(string)
+	if scope == "" {
+		scope = "prefix"
+	}
+	if scope != "prefix" && scope != "domain" {
+		return "", fmt.Errorf("invalid scope '%s'. Use 'prefix' or 'domain'", scope)
+	}
+
+	maxDepth := defaultCrawlDepth
+	if v, ok := input["max_depth"].(float64); ok && v >= 0 {
+		maxDepth = min(int(v), maxCrawlDepth)
+	}
+	pageCap := envInt("CLYDE_CRAWL_MAX_PAGES", defaultCrawlMaxPages)
+	maxPages := min(defaultCrawlPages, pageCap)
+	if v, ok := input["max_pages"].(float64); ok && v > 0 {
+		if int(v) > pageCap {
+			return "", fmt.Errorf("max_pages %d exceeds the limit of %d (CLYDE_CRAWL_MAX_PAGES)", int(v), pageCap)
+		}
+		maxPages = int(v)
+	}
+
+	var exclude []string
+	if list, ok := input["exclude"].([]interface{}); ok {
+		for _, item := range list {
+			if s, ok := item.(string); ok && s != "" {
+				exclude = append(exclude, s)
+			}
+		}
+	}
+
+	root, err := docsDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", fmt.Errorf("failed to create docs directory: %w", err)
+	}
+	// Crawl into a scratch directory so a failed crawl leaves the old
+	// corpus in place
+	tmpDir, err := os.MkdirTemp(root, "."+name+".crawl-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create docs directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	prefix := start.Path
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = path.Dir(prefix)
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+	}
+
+	c := &crawler{
+		start:     start,
+		scope:     scope,
+		prefix:    prefix,
+		exclude:   exclude,
+		maxPages:  maxPages,
+		delay:     time.Duration(envInt("CLYDE_CRAWL_DELAY_MS", defaultCrawlDelayMS)) * time.Millisecond,
+		dir:       tmpDir,
+		seen:      map[string]bool{start.String(): true},
+		files:     make(map[string]bool),
+		robots:    make(map[string]*robotsRules),
+		nextFetch: make(map[string]time.Time),
+	}
+
+	// Breadth-first, one depth level at a time, so max_depth is exact and
+	// the page limit keeps the pages closest to the start
+	level := []string{start.String()}
+	depthReached, unvisited := 0, 0
+	for depth := 0; len(level) > 0; depth++ {
+		depthReached = depth
+		results := c.fetchLevel(level)
+
+		var next []string
+		for _, r := range results {
+			for _, link := range r.links {
+				if !c.seen[link] {
+					c.seen[link] = true
+					next = append(next, link)
+				}
+			}
+		}
+		if c.reserved >= c.maxPages || depth == maxDepth {
+			unvisited = len(next)
+			break
+		}
+		level = next
+	}
+
+	if len(c.pages) == 0 {
+		msg := fmt.Sprintf("no pages could be crawled from %s", start)
+		if c.blocked > 0 {
+			msg += " (blocked by robots.txt)"
+		}
+		if len(c.failures) > 0 {
+			msg += ":\n\n" + strings.Join(c.failures, "\n")
+		}
+		return "", fmt.Errorf("%s", msg)
+	}
+
+	index := docsIndex{Name: name, StartURL: start.String(), Scope: scope, CrawledAt: time.Now().UTC(), Pages: c.pages}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to write corpus index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "index.json"), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write corpus index: %w", err)
+	}
+
+	corpusDir := filepath.Join(root, name)
+	if err := os.RemoveAll(corpusDir); err != nil {
+		return "", fmt.Errorf("failed to replace the old corpus: %w", err)
+	}
+	if err := os.Rename(tmpDir, corpusDir); err != nil {
+		return "", fmt.Errorf("failed to store corpus: %w", err)
+	}
+
+	total := 0
+	for _, p := range c.pages {
+		total += p.Size
+	}
+	var output strings.Builder
+	fmt.Fprintf(&output, "Crawled %d pages from %s into %s (depth %d, %d KB of markdown).\n", len(c.pages), start, corpusDir, depthReached, (total+1023)/1024)
+
+	var notes []string
+	if c.blocked > 0 {
+		notes = append(notes, fmt.Sprintf("  - %d blocked by robots.txt", c.blocked))
+	}
+	if unvisited > 0 {
+		reason := "max_depth"
+		if c.reserved >= c.maxPages {
+			reason = "max_pages"
+		}
+		notes = append(notes, fmt.Sprintf("  - %d more links in scope, not followed (raise %s to include them)", unvisited, reason))
+	}
+	if len(c.failures) > 0 {
+		notes = append(notes, fmt.Sprintf("  - %d failed:", len(c.failures)))
+		for i, f := range c.failures {
+			if i == 10 {
+				notes = append(notes, fmt.Sprintf("      ... and %d more", len(c.failures)-10))
+				break
+			}
+			notes = append(notes, "      "+f)
+		}
+	}
+	if len(notes) > 0 {
+		output.WriteString("\nNot stored:\n" + strings.Join(notes, "\n") + "\n")
+	}
+	fmt.Fprintf(&output, "\nSearch it with search_docs(name=\"%s\", query=\"...\").", name)
+	return output.String(), nil
+}
+
+// fetchLevel fetches the URLs of one depth level concurrently and returns
+// the results in the order of the URLs
+func (c *crawler) fetchLevel(urls []string) []crawlResult {
+	results := make([]crawlResult, len(urls))
+	sem := make(chan struct{}, max(envInt("CLYDE_CRAWL_CONCURRENCY", defaultCrawlConcurrency), 1))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		if !c.reserve() {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, u string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			page, links, err := c.fetch(u)
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if err != nil {
+				c.reserved--
+				c.failures = append(c.failures, fmt.Sprintf("%s (%s)", u, firstLine(err.Error())))
+				return
+			}
+			// Pages that aren't stored (noindex, no readable text) still
+			// lead to the rest of the section
+			results[i] = crawlResult{page: page, links: links}
+			if page == nil {
+				c.reserved--
+				return
+			}
+			c.pages = append(c.pages, *page)
+			reportProgress("  🕷️  [%d/%d] %s", len(c.pages), c.maxPages, u)
+		}(i, u)
+	}
+	wg.Wait()
+	return results
+}
+
+// reserve claims a slot under the page limit
+func (c *crawler) reserve() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reserved >= c.maxPages {
+		return false
+	}
+	c.reserved++
+	return true
+}
+
+// fetch downloads one page, stores it and returns the in-scope links on it.
+// A nil page with no error means the URL was skipped (robots.txt, redirect
+// out of scope, duplicate, nothing readable).
+func (c *crawler) fetch(rawURL string) (*docsPage, []string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules, err := c.robotsFor(u)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !rules.allowed(u) {
+		c.mu.Lock()
+		c.blocked++
+		c.mu.Unlock()
+		return nil, nil, nil
+	}
+	c.wait(u.Host, rules.crawlDelay)
+
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", crawlUserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,application/pdf;q=0.8,*/*;q=0.5")
+
+	resp, err := fetchURL("crawl", req, 30*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	final := resp.Request.URL
+	final.Fragment = ""
+	if final.String() != rawURL {
+		if !c.inScope(final) {
+			return nil, nil, nil
+		}
+		// The client followed the redirect, but the target's content
+		// must not be kept if robots.txt disallows it
+		finalRules, err := c.robotsFor(final)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !finalRules.allowed(final) {
+			c.mu.Lock()
+			c.blocked++
+			c.mu.Unlock()
+			return nil, nil, nil
+		}
+		c.mu.Lock()
+		dup := c.seen[final.String()]
+		c.seen[final.String()] = true
+		c.mu.Unlock()
+		if dup {
+			return nil, nil, nil
+		}
+	}
+
+	maxDownloadMB := envInt("CLYDE_BROWSE_MAX_DOWNLOAD_MB", defaultBrowseDownloadMB)
+	if contentKind(resp.Header.Get("Content-Type"), nil) == kindPDF {
+		maxDownloadMB = envInt("CLYDE_BROWSE_MAX_PDF_MB", defaultBrowseMaxPDFMB)
+	}
+	body, truncated, err := readLimited(resp.Body, int64(maxDownloadMB)*1024*1024)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read page: %w", err)
+	}
+
+	kind := contentKind(resp.Header.Get("Content-Type"), body)
+	var page *browsePage
+	var links []string
+	switch kind {
+	case kindHTML:
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed HTML: %w", err)
+		}
+		robotsMeta := strings.ToLower(doc.Find(`meta[name="robots" i]`).AttrOr("content", ""))
+		if !strings.Contains(robotsMeta, "nofollow") {
+			links = c.scopedLinks(doc, final)
+		}
+		if strings.Contains(robotsMeta, "noindex") {
+			return nil, links, nil
+		}
+		page = convertPage(doc, final, false)
+		page.kind = kindHTML
+		if truncated {
+			page.markdown += downloadStoppedNote()
+		}
+	case kindText, kindPDF, kindJSON, kindFeed:
+		page, err = convertContent(kind, body, truncated, final, browseOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, nil
+	}
+	if strings.TrimSpace(page.markdown) == "" {
+		return nil, links, nil
+	}
+
+	file := c.pageFile(final)
+	content := formatBrowsePage(page, &pageChunk{text: page.markdown, end: len(page.markdown), number: 1, total: 1}) + "\n"
+	target := filepath.Join(c.dir, filepath.FromSlash(file))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+		return nil, nil, err
+	}
+	return &docsPage{URL: final.String(), Title: page.title, File: file, Size: len(content)}, links, nil
+}
+
+// scopedLinks collects the links on the whole page, navigation included,
+// that are in scope and worth fetching
+func (c *crawler) scopedLinks(doc *goquery.Document, base *url.URL) []string {
+	var links []string
+	seen := make(map[string]bool)
+	doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		if strings.Contains(strings.ToLower(a.AttrOr("rel", "")), "nofollow") {
+			return
+		}
+		target, err := base.Parse(strings.TrimSpace(a.AttrOr("href", "")))
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			return
+		}
+		target.Fragment = ""
+		if skippedExtensions[strings.ToLower(path.Ext(target.Path))] || !c.inScope(target) {
+			return
+		}
+		if s := target.String(); !seen[s] {
+			seen[s] = true
+			links = append(links, s)
+		}
+	})
+	return links
+}
+
+// inScope reports whether u is within the crawl's scope and not excluded
+func (c *crawler) inScope(u *url.URL) bool {
+	if u.Scheme != c.start.Scheme && !(u.Scheme == "https" && c.start.Scheme == "http") {
+		return false
+	}
+	switch c.scope {
+	case "domain":
+		if !matchDomain(u.Hostname(), strings.TrimPrefix(c.start.Hostname(), "www.")) {
+			return false
+		}
+	default:
+		p := u.Path
+		if p == "" {
+			p = "/"
+		}
+		if u.Host != c.start.Host || !(strings.HasPrefix(p, c.prefix) || p+"/" == c.prefix) {
+			return false
+		}
+	}
+	for _, ex := range c.exclude {
+		if strings.Contains(u.Path, ex) {
+			return false
+		}
+	}
+	return true
+}
+
+// robotsFor returns the robots.txt rules for u's host, fetching them once
+func (c *crawler) robotsFor(u *url.URL) (*robotsRules, error) {
+	c.mu.Lock()
+	rules, ok := c.robots[u.Host]
+	c.mu.Unlock()
+	if ok {
+		return rules, nil
+	}
+	rules, err := fetchRobots(u)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.robots[u.Host]; ok {
+		return existing, nil
+	}
+	c.robots[u.Host] = rules
+	return rules, nil
+}
+
+// wait spaces requests to one host by the crawl delay, or by the site's
+// Crawl-delay when that is longer (capped at 10s)
+func (c *crawler) wait(host string, crawlDelay time.Duration) {
+	delay := max(c.delay, min(crawlDelay, maxCrawlDelay))
+	c.mu.Lock()
+	now := time.Now()
+	at := c.nextFetch[host]
+	if at.Before(now) {
+		at = now
+	}
+	c.nextFetch[host] = at.Add(delay)
+	c.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+// pageFile picks the corpus file for a URL, mirroring its path:
+// /guide/intro.html becomes guide/intro.md and /guide/ guide/index.md.
+// Pages on other hosts go under a directory named after the host, and
+// query strings get a short hash so variants don't collide.
+func (c *crawler) pageFile(u *url.URL) string {
+	p := strings.Trim(u.Path, "/")
+	if p == "" || strings.HasSuffix(u.Path, "/") {
+		p = path.Join(p, "index")
+	}
+	for _, ext := range []string{".html", ".htm", ".md", ".txt"} {
+		p = strings.TrimSuffix(p, ext)
+	}
+	var segments []string
+	if u.Host != c.start.Host {
+		segments = append(segments, sanitizeSegment(u.Host))
+	}
+	for _, s := range strings.Split(p, "/") {
+		if s = sanitizeSegment(s); s != "" {
+			segments = append(segments, s)
+		}
+	}
+	file := strings.Join(segments, "/")
+	if u.RawQuery != "" {
+		sum := sha256.Sum256([]byte(u.RawQuery))
+		file += "_" + hex.EncodeToString(sum[:4])
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	candidate := file + ".md"
+	for i := 2; c.files[candidate]; i++ {
+		candidate = fmt.Sprintf("%s_%d.md", file, i)
+	}
+	c.files[candidate] = true
+	return candidate
+}
+
+// sanitizeSegment makes one path segment safe as a file name
+func sanitizeSegment(s string) string {
+	if unescaped, err := url.PathUnescape(s); err == nil {
+		s = unescaped
+	}
+	s = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+	return strings.TrimLeft(s, ".")
+}
+
+func displayCrawl(input map[string]interface{}) string {
+	urlStr, _ := input["url"].(string)
+	if name, _ := input["name"].(string); name != "" {
+		return fmt.Sprintf("→ Crawling: %s (into docs/%s)", urlStr, name)
+	}
+	return fmt.Sprintf("→ Crawling: %s", urlStr)
+}
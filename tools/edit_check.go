@@ -0,0 +1,447 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Post-edit checks run configured commands after patch_file, write_file and
+// multi_patch change a file, so a broken build or lint failure shows up in
+// the edit's own result instead of several turns later. Only problems the
+// edit introduced are reported: each check's findings are compared with
+// its findings before the edit, ignoring line numbers, which shift.
+
+// editCheck is one command run after edits to files with a given extension
+type editCheck struct {
+	name    string // shown in results, e.g. "go vet"
+	command string // bash command with {file} and {dir} placeholders, or "lsp"
+}
+
+// perFile reports whether the check runs once per edited file rather than
+// once per directory
+func (c editCheck) perFile() bool {
+	return c.command == "lsp" || strings.Contains(c.command, "{file}")
+}
+
+var defaultEditChecks = map[string][]string{
+	"go": {"gofmt -l {file}", "go vet ."},
+}
+
+var defaultEditFormatters = map[string]string{
+	"go": "gofmt -w {file}",
+}
+
+const defaultEditCheckTimeoutSeconds = 30
+
+// maxEditFindings caps the new problems listed in one result
+const maxEditFindings = 20
+
+// editCommands parses a setting of "ext1,ext2=command;..." entries over
+// defaults. Listing an extension replaces its defaults; repeating it adds
+// more commands, and "off" disables it.
+func editCommands(setting string, defaults map[string][]string) map[string][]string {
+	commands := make(map[string][]string)
+	for ext, list := range defaults {
+		commands[ext] = list
+	}
+	replaced := make(map[string]bool)
+	for _, entry := range strings.Split(os.Getenv(setting), ";") {
+		exts, command, ok := strings.Cut(entry, "=")
+		command = strings.TrimSpace(command)
+		if !ok || command == "" {
+			continue
+		}
+		for _, ext := range strings.Split(exts, ",") {
+			ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+			if ext == "" {
+				continue
+			}
+			if !replaced[ext] {
+				commands[ext] = nil
+				replaced[ext] = true
+			}
+			if command != "off" {
+				commands[ext] = append(commands[ext], command)
+			}
+		}
+	}
+	return commands
+}
+
+// editChecksFor returns the checks configured for a file's extension
+func editChecksFor(path string) []editCheck {
+	if !envBool("CLYDE_EDIT_CHECK", true) {
+		return nil
+	}
+	var checks []editCheck
+	for _, command := range editCommands("CLYDE_EDIT_CHECKS", defaultEditChecks)[fileExt(path)] {
+		checks = append(checks, editCheck{name: commandName(command), command: command})
+	}
+	return checks
+}
+
+// editFormatterFor returns the formatter for a file when auto-formatting
+// is enabled
+func editFormatterFor(path string) string {
+	if !envBool("CLYDE_EDIT_FORMAT", false) {
+		return ""
+	}
+	defaults := make(map[string][]string)
+	for ext, command := range defaultEditFormatters {
+		defaults[ext] = []string{command}
+	}
+	commands := editCommands("CLYDE_EDIT_FORMATTERS", defaults)[fileExt(path)]
+	if len(commands) == 0 {
+		return ""
+	}
+	return commands[0]
+}
+
+func fileExt(path string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// commandName shortens a command to its program and first argument,
+// leaving out placeholders and paths
+func commandName(command string) string {
+	if command == "lsp" {
+		return "lsp"
+	}
+	var words []string
+	for _, w := range strings.Fields(command) {
+		if strings.Contains(w, "{") || strings.HasPrefix(w, ".") || strings.Contains(w, "/") {
+			continue
+		}
+		if words = append(words, w); len(words) == 2 {
+			break
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// editCheckRun is one check applied to a file or directory
+type editCheckRun struct {
+	check  editCheck
+	target string // the edited file for per-file checks, else its directory
+	files  []string
+}
+
+func (r *editCheckRun) key() string { return r.check.command + "\x00" + r.target }
+
+// stamp identifies the state a run's findings belong to: the target
+// file's size and modification time, or those of every entry in the
+// target directory
+func (r *editCheckRun) stamp() string {
+	var b strings.Builder
+	if r.check.perFile() {
+		if info, err := os.Stat(r.target); err == nil {
+			fmt.Fprintf(&b, "%d %d", info.Size(), info.ModTime().UnixNano())
+		}
+		return b.String()
+	}
+	entries, _ := os.ReadDir(r.target)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil {
+			fmt.Fprintf(&b, "%s %d %d\n", e.Name(), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
+
+type editCheckResult struct {
+	stamp    string
+	findings []string
+	note     string // why the check could not run, if it couldn't
+}
+
+var (
+	editCheckMu    sync.Mutex
+	editCheckCache = make(map[string]editCheckResult)
+)
+
+// pendingEditCheck holds the state of the checks for files about to be
+// edited
+type pendingEditCheck struct {
+	files     []string
+	runs      []*editCheckRun
+	baselines map[string][]string
+}
+
+// beforeEdit records each check's findings for the files as they are now.
+// Findings from the last check are reused while the files are unchanged
+// since; otherwise the check runs on the current contents.
+func beforeEdit(paths ...string) *pendingEditCheck {
+	p := &pendingEditCheck{baselines: make(map[string][]string)}
+	byKey := make(map[string]*editCheckRun)
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		p.files = append(p.files, abs)
+		for _, check := range editChecksFor(abs) {
+			run := &editCheckRun{check: check, target: abs}
+			if !check.perFile() {
+				run.target = filepath.Dir(abs)
+			}
+			if existing := byKey[run.key()]; existing != nil {
+				existing.files = append(existing.files, abs)
+				continue
+			}
+			run.files = []string{abs}
+			byKey[run.key()] = run
+			p.runs = append(p.runs, run)
+		}
+	}
+
+	for _, run := range p.runs {
+		stamp := run.stamp()
+		editCheckMu.Lock()
+		cached, ok := editCheckCache[run.key()]
+		editCheckMu.Unlock()
+		switch {
+		case ok && cached.stamp == stamp:
+			p.baselines[run.key()] = cached.findings
+		case stamp == "":
+			// A file or directory that doesn't exist yet has no problems
+		default:
+			p.baselines[run.key()] = run.execute().findings
+		}
+	}
+	return p
+}
+
+// report formats the edited files if enabled, runs the checks again and
+// describes what changed, ready to append to an edit tool's result. It
+// returns "" when no checks apply.
+func (p *pendingEditCheck) report() string {
+	var sections []string
+	var formatted []string
+	for _, file := range p.files {
+		if formatter := editFormatterFor(file); formatter != "" && formatFile(file, formatter) {
+			formatted = append(formatted, displayName(relativePath(file)))
+		}
+	}
+	if len(formatted) > 0 {
+		sections = append(sections, fmt.Sprintf("✓ Formatted %s (re-read before patching again)", strings.Join(formatted, ", ")))
+	}
+	if len(p.runs) == 0 {
+		return strings.Join(sections, "\n")
+	}
+
+	var added []string
+	var names, notes []string
+	remaining, fixed := 0, 0
+	for _, run := range p.runs {
+		result := run.execute()
+		if result.note != "" {
+			notes = append(notes, result.note)
+			continue
+		}
+		names = append(names, run.check.name)
+		editCheckMu.Lock()
+		editCheckCache[run.key()] = result
+		editCheckMu.Unlock()
+
+		before := make(map[string]int)
+		for _, f := range p.baselines[run.key()] {
+			before[findingKey(f)]++
+		}
+		for _, f := range result.findings {
+			if k := findingKey(f); before[k] > 0 {
+				before[k]--
+				remaining++
+			} else {
+				added = append(added, fmt.Sprintf("  %s  (%s)", f, run.check.name))
+			}
+		}
+		for _, n := range before {
+			fixed += n
+		}
+	}
+
+	var extra []string
+	if remaining > 0 {
+		extra = append(extra, fmt.Sprintf("%d %s from before the edit still reported", remaining, plural(remaining, "problem")))
+	}
+	if fixed > 0 {
+		extra = append(extra, fmt.Sprintf("fixed %d", fixed))
+	}
+	switch {
+	case len(added) > 0:
+		lines := []string{fmt.Sprintf("⚠️ Post-edit checks found %d new %s:", len(added), plural(len(added), "problem"))}
+		if len(added) > maxEditFindings {
+			added = append(added[:maxEditFindings], fmt.Sprintf("  ... and %d more", len(added)-maxEditFindings))
+		}
+		lines = append(lines, added...)
+		if len(extra) > 0 {
+			lines = append(lines, "("+strings.Join(extra, "; ")+")")
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	case len(names) > 0:
+		line := fmt.Sprintf("✓ Post-edit checks passed (%s)", strings.Join(names, ", "))
+		if len(extra) > 0 {
+			line = fmt.Sprintf("✓ No new problems from %s (%s)", strings.Join(names, ", "), strings.Join(extra, "; "))
+		}
+		sections = append(sections, line)
+	}
+	for _, note := range notes {
+		sections = append(sections, "ℹ️ "+note)
+	}
+	return strings.Join(sections, "\n")
+}
+
+// withEditReport appends a post-edit report to an edit tool's result
+func withEditReport(result string, check *pendingEditCheck) string {
+	if report := check.report(); report != "" {
+		return result + "\n\n" + report
+	}
+	return result
+}
+
+// findingPosition matches the line and column of a finding
+var findingPosition = regexp.MustCompile(`:\d+(:\d+)?:`)
+
+// findingKey identifies a finding across edits that move it to another
+// line
+func findingKey(finding string) string {
+	return findingPosition.ReplaceAllString(finding, ":")
+}
+
+// findingLocation matches output lines starting with path:line, as
+// compilers and linters print them, optionally after a tool prefix
+var findingLocation = regexp.MustCompile(`^(?:[a-z]+: )?([^\s:][^:]*\.[A-Za-z0-9]+):(\d+)(:\d+)?: ?(.*)$`)
+
+// execute runs the check and collects its findings
+func (r *editCheckRun) execute() editCheckResult {
+	result := editCheckResult{stamp: r.stamp()}
+	if r.check.command == "lsp" {
+		result.findings, result.note = lspFindings(r.target)
+		return result
+	}
+
+	dir := r.target
+	if r.check.perFile() {
+		dir = filepath.Dir(r.target)
+	}
+	output, timedOut, err := runEditCommand(r.check.command, r.target, dir)
+	switch {
+	case timedOut:
+		result.note = fmt.Sprintf("%s timed out after %ds (CLYDE_EDIT_CHECK_TIMEOUT_SECONDS)", r.check.name, envInt("CLYDE_EDIT_CHECK_TIMEOUT_SECONDS", defaultEditCheckTimeoutSeconds))
+		return result
+	case err != nil:
+		result.note = fmt.Sprintf("%s could not run: %v", r.check.name, err)
+		return result
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// List-style checks such as gofmt -l print the files that fail
+		if path := absIn(dir, line); slices.Contains(r.files, path) {
+			result.findings = append(result.findings, displayName(relativePath(path))+": needs formatting")
+			continue
+		}
+		m := findingLocation.FindStringSubmatch(line)
+		if m == nil {
+			// Headers and messages about the command itself
+			continue
+		}
+		result.findings = append(result.findings, fmt.Sprintf("%s:%s%s: %s", displayName(relativePath(absIn(dir, m[1]))), m[2], m[3], m[4]))
+	}
+	return result
+}
+
+// runEditCommand runs a check or formatter command with bash in dir,
+// returning its combined output. A missing program is an error; other
+// failures are normal for a check reporting problems.
+func runEditCommand(command, file, dir string) (string, bool, error) {
+	command = strings.NewReplacer("{file}", shellQuote(file), "{dir}", shellQuote(dir)).Replace(command)
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Dir = dir
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = 2 * time.Second
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return "", false, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	timeout := time.Duration(envInt("CLYDE_EDIT_CHECK_TIMEOUT_SECONDS", defaultEditCheckTimeoutSeconds)) * time.Second
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		killProcessGroup(cmd)
+		<-done
+		return output.String(), true, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && commandExitCode(exitErr) == 127 {
+		return "", false, fmt.Errorf("%s", strings.TrimSpace(output.String()))
+	}
+	return output.String(), false, nil
+}
+
+// formatFile runs a formatter on file and reports whether it changed the
+// contents
+func formatFile(file, formatter string) bool {
+	before, err := os.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	if _, timedOut, err := runEditCommand(formatter, file, filepath.Dir(file)); timedOut || err != nil {
+		return false
+	}
+	after, err := os.ReadFile(file)
+	return err == nil && !bytes.Equal(before, after)
+}
+
+// lspFindings gets the errors and warnings the file's language server
+// reports for it
+func lspFindings(file string) ([]string, string) {
+	if _, err := os.Stat(file); err != nil {
+		return nil, ""
+	}
+	client, err := lspClientFor(file)
+	if err != nil {
+		return nil, "lsp check skipped: " + strings.SplitN(err.Error(), "\n", 2)[0]
+	}
+	text, uri, err := client.syncDocument(file)
+	if err != nil {
+		return nil, "lsp check skipped: " + err.Error()
+	}
+	diags, _, err := client.fileDiagnostics(uri, defaultLSPWaitSeconds*time.Second)
+	if err != nil {
+		return nil, "lsp check skipped: " + err.Error()
+	}
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Range.Start.Line < diags[j].Range.Start.Line })
+	var findings []string
+	for _, d := range diags {
+		if d.Severity <= 2 {
+			findings = append(findings, diagnosticLine(client, relativePath(file), text, d))
+		}
+	}
+	return findings, ""
+}
+
+// absIn resolves a path printed by a command run in dir
+func absIn(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,309 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// All outbound HTTP from tools goes through fetchURL, which enforces the
+// egress policy: domain allow/deny lists from config, and no connections to
+// loopback, private or link-local addresses. The address check runs on the
+// resolved IP at connect time, so it also covers every redirect hop and DNS
+// answers that change between lookups.
+
+const maxFetchRedirects = 10
+
+// egressPolicy describes which hosts tools may fetch from
+type egressPolicy struct {
+	allowDomains []string // if set, only these domains (and subdomains)
+	denyDomains  []string
+	allowPrivate bool
+}
+
+// egressError is returned when the policy blocks a request
+type egressError struct {
+	url    string
+	reason string
+}
+
+func (e *egressError) Error() string {
+	return fmt.Sprintf("request to %s blocked by egress policy: %s", e.url, e.reason)
+}
+
+// blockedNetworks are special-purpose ranges not covered by the net.IP
+// helpers used in checkIP
+var blockedNetworks = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // "this network"
+		"100.64.0.0/10", // carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"198.18.0.0/15", // benchmarking
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+func currentEgressPolicy() *egressPolicy {
+	return &egressPolicy{
+		allowDomains: envList("CLYDE_FETCH_ALLOW_DOMAINS"),
+		denyDomains:  envList("CLYDE_FETCH_DENY_DOMAINS"),
+		allowPrivate: envBool("CLYDE_FETCH_ALLOW_PRIVATE", false),
+	}
+}
+
+// checkURL validates the scheme and host of a URL against the domain lists
+func (p *egressPolicy) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &egressError{u.String(), fmt.Sprintf("scheme '%s' is not allowed (only http and https)", u.Scheme)}
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	for _, domain := range p.denyDomains {
+		if matchDomain(host, domain) {
+			return &egressError{u.String(), fmt.Sprintf("host '%s' matches deny rule '%s' (CLYDE_FETCH_DENY_DOMAINS)", host, domain)}
+		}
+	}
+	if len(p.allowDomains) == 0 {
+		return nil
+	}
+	for _, domain := range p.allowDomains {
+		if matchDomain(host, domain) {
+			return nil
+		}
+	}
+	return &egressError{u.String(), fmt.Sprintf("host '%s' is not in CLYDE_FETCH_ALLOW_DOMAINS", host)}
+}
+
+// checkIP rejects addresses that reach the local machine or internal networks
+func (p *egressPolicy) checkIP(ip net.IP) string {
+	if p.allowPrivate {
+		return ""
+	}
+	switch {
+	case ip.IsLoopback():
+		return fmt.Sprintf("%s is a loopback address", ip)
+	case ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast():
+		return fmt.Sprintf("%s is a link-local address (cloud metadata endpoints live here)", ip)
+	case ip.IsPrivate():
+		return fmt.Sprintf("%s is a private network address", ip)
+	case ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast():
+		return fmt.Sprintf("%s is not a public unicast address", ip)
+	}
+	for _, n := range blockedNetworks {
+		if n.Contains(ip) {
+			return fmt.Sprintf("%s is in reserved range %s", ip, n)
+		}
+	}
+	return ""
+}
+
+// matchDomain reports whether host is domain or a subdomain of it. A leading
+// "*." in the rule is accepted and means the same thing.
+func matchDomain(host, domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "*."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// newFetchClient builds an http.Client that enforces the policy on every
+// connection and redirect. Proxies from the environment are ignored, since
+// connecting through one would hide the real destination from the check.
+func newFetchClient(policy *egressPolicy, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if reason := policy.checkIP(net.ParseIP(host)); reason != "" {
+				return &egressError{address, reason + ". Set CLYDE_FETCH_ALLOW_PRIVATE=true to allow internal addresses"}
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     30 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+			}
+			return policy.checkURL(req.URL)
+		},
+	}
+}
+
+// fetchURL performs req under the egress policy and records it in the fetch
+// log. tool names the caller in the log. The response body is logged with
+// the number of bytes actually read once it is closed.
+func fetchURL(tool string, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	policy := currentEgressPolicy()
+	start := time.Now()
+
+	if err := policy.checkURL(req.URL); err != nil {
+		logFetch(fetchLogEntry{Tool: tool, Method: req.Method, URL: req.URL.String(), Blocked: err.Error()}, start)
+		return nil, err
+	}
+
+	// Remember every address connected to, one per redirect hop, so the
+	// response cache can recheck them against a later policy
+	var remoteIPs []string
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				remoteIPs = append(remoteIPs, host)
+			}
+		},
+	}))
+
+	resp, err := newFetchClient(policy, timeout).Do(req)
+	if err != nil {
+		entry := fetchLogEntry{Tool: tool, Method: req.Method, URL: req.URL.String(), Error: err.Error()}
+		var blocked *egressError
+		if errors.As(err, &blocked) {
+			entry.Error, entry.Blocked = "", blocked.Error()
+			err = blocked
+		}
+		logFetch(entry, start)
+		return nil, err
+	}
+
+	entry := fetchLogEntry{
+		Tool:     tool,
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		FinalURL: resp.Request.URL.String(),
+		Status:   resp.StatusCode,
+	}
+	if len(remoteIPs) > 0 {
+		entry.RemoteIP = remoteIPs[len(remoteIPs)-1]
+	}
+	resp.Body = &loggedBody{ReadCloser: resp.Body, start: start, entry: entry, remoteIPs: remoteIPs}
+	return resp, nil
+}
+
+// fetchRemoteIPs returns the addresses a response from fetchURL came from,
+// the first request's first and the final hop's last
+func fetchRemoteIPs(resp *http.Response) []string {
+	if body, ok := resp.Body.(*loggedBody); ok {
+		return body.remoteIPs
+	}
+	return nil
+}
+
+// isEgressBlocked reports whether err came from the egress policy
+func isEgressBlocked(err error) bool {
+	var blocked *egressError
+	return errors.As(err, &blocked)
+}
+
+// readLimited reads at most max bytes from r. exceeded reports whether the
+// body was larger than max.
+func readLimited(r io.Reader, max int64) (data []byte, exceeded bool, err error) {
+	data, err = io.ReadAll(io.LimitReader(r, max+1))
+	if int64(len(data)) > max {
+		return data[:max], true, err
+	}
+	return data, false, err
+}
+
+// fetchLogEntry is one line in the fetch log
+type fetchLogEntry struct {
+	Time       string `json:"time"`
+	Tool       string `json:"tool"`
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	FinalURL   string `json:"final_url,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	RemoteIP   string `json:"remote_ip,omitempty"`
+	Bytes      int64  `json:"bytes,omitempty"`
+	Cached     bool   `json:"cached,omitempty"` // served from the response cache without a request
+	DurationMS int64  `json:"duration_ms"`
+	Blocked    string `json:"blocked,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type loggedBody struct {
+	io.ReadCloser
+	start     time.Time
+	entry     fetchLogEntry
+	remoteIPs []string
+	once      sync.Once
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.entry.Bytes += int64(n)
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	b.once.Do(func() { logFetch(b.entry, b.start) })
+	return b.ReadCloser.Close()
+}
+
+var fetchLogMu sync.Mutex
+
+// fetchLogPath returns the log file: CLYDE_FETCH_LOG, or
+// ~/.clyde/logs/fetch.log. "off" disables logging.
+func fetchLogPath() string {
+	path := strings.TrimSpace(os.Getenv("CLYDE_FETCH_LOG"))
+	if strings.EqualFold(path, "off") {
+		return ""
+	}
+	if path != "" {
+		return expandHome(path)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".clyde", "logs", "fetch.log")
+}
+
+// logFetch appends entry as a JSON line. Logging failures never fail the
+// fetch itself.
+func logFetch(entry fetchLogEntry, start time.Time) {
+	path := fetchLogPath()
+	if path == "" {
+		return
+	}
+	entry.Time = start.UTC().Format(time.RFC3339)
+	entry.DurationMS = time.Since(start).Milliseconds()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	fetchLogMu.Lock()
+	defer fetchLogMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(line, '\n'))
+}
@@ -0,0 +1,843 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/api"
+)
+
+func init() {
+	Register(gitTool, executeGit, displayGit)
+}
+
+var gitTool = api.Tool{
+	Name:        "git",
+	Description: "Work with the git repository through typed actions instead of raw git commands: status (JSON), diff (unstaged, staged or against a ref), log, blame, show, branch (list, create, delete), switch, stage, unstage, commit (with optional Co-authored-by trailers) and discard. Operations that can lose work (discarding changes, force-deleting an unmerged branch, switching with discard_changes, amending a pushed commit) need the user's approval. reset, push, rebase, clean and other history rewrites are not available.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"status", "diff", "log", "blame", "show", "branch", "switch", "stage", "unstage", "commit", "discard"},
+				"description": "What to do",
+			},
+			"paths": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Files or directories to limit status, diff, log and show to, or to stage, unstage or discard",
+			},
+			"ref": map[string]interface{}{
+				"type":        "string",
+				"description": "diff: compare with this commit or range (e.g. main, HEAD~3, main...HEAD); log: start point or range; show: commit or commit:path (default HEAD); blame: revision; branch/switch: start point of a new branch",
+			},
+			"staged": map[string]interface{}{
+				"type":        "boolean",
+				"description": "diff: show staged changes instead of unstaged ones",
+			},
+			"stat": map[string]interface{}{
+				"type":        "boolean",
+				"description": "diff and log: only list changed files with line counts",
+			},
+			"max_count": map[string]interface{}{
+				"type":        "integer",
+				"description": "log: number of commits (default 20)",
+			},
+			"grep": map[string]interface{}{
+				"type":        "string",
+				"description": "log: only commits whose message matches this regular expression",
+			},
+			"file": map[string]interface{}{
+				"type":        "string",
+				"description": "blame: the file",
+			},
+			"start_line": map[string]interface{}{
+				"type":        "integer",
+				"description": "blame: first line",
+			},
+			"end_line": map[string]interface{}{
+				"type":        "integer",
+				"description": "blame: last line",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "branch: branch to create or delete (omit to list branches); switch: branch to switch to",
+			},
+			"create": map[string]interface{}{
+				"type":        "boolean",
+				"description": "switch: create the branch first",
+			},
+			"delete": map[string]interface{}{
+				"type":        "boolean",
+				"description": "branch: delete the named branch (an unmerged branch needs approval)",
+			},
+			"discard_changes": map[string]interface{}{
+				"type":        "boolean",
+				"description": "switch: throw away uncommitted changes that conflict with the target (needs approval)",
+			},
+			"all": map[string]interface{}{
+				"type":        "boolean",
+				"description": "stage: stage every change including untracked files; commit: also commit changes to tracked files that are not staged; branch: list remote branches too",
+			},
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "commit: the commit message (subject line, blank line, body)",
+			},
+			"co_authors": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "commit: people to credit with Co-authored-by trailers, as \"Name <email>\" (default CLYDE_GIT_CO_AUTHORS)",
+			},
+			"amend": map[string]interface{}{
+				"type":        "boolean",
+				"description": "commit: replace the last commit (needs approval if it was already pushed)",
+			},
+			"dir": map[string]interface{}{
+				"type":        "string",
+				"description": "Directory inside the repository (default: current directory)",
+			},
+		},
+		"required": []string{"action"},
+	},
+}
+
+const (
+	gitTimeout            = 2 * time.Minute
+	defaultGitLogCount    = 20
+	maxGitLogCount        = 500
+	defaultGitMaxOutputKB = 50 // CLYDE_GIT_MAX_OUTPUT_KB
+)
+
+// gitRefusedActions explains the git commands the tool deliberately lacks
+var gitRefusedActions = map[string]string{
+	"reset":         "it can throw away commits and uncommitted changes. Use unstage to unstage files, or discard for changes the user agreed to lose",
+	"push":          "publishing commits is left to the user",
+	"rebase":        "it rewrites history",
+	"clean":         "it deletes untracked files",
+	"checkout":      "use switch to change branches and discard to drop changes",
+	"stash":         "stashes are easy to lose track of; commit work on a branch instead",
+	"merge":         "merges are left to the user",
+	"cherry-pick":   "it is left to the user",
+	"filter-branch": "it rewrites history",
+}
+
+var coAuthorPattern = regexp.MustCompile(`^[^<>\n]+ <[^<>\s]+@[^<>\s]+>$`)
+
+func executeGit(input map[string]interface{}, apiClient *api.Client, history []api.Message) (string, error) {
+	dir := stringInput(input, "dir")
+	if dir == "" {
+		dir = "."
+	}
+	if err := checkWorkspacePath(dir); err != nil {
+		return "", err
+	}
+	action := stringInput(input, "action")
+	if reason, ok := gitRefusedActions[action]; ok {
+		return "", fmt.Errorf("git %s is not available: %s. If it is really needed, ask the user to run it themselves", action, reason)
+	}
+	if _, err := runGit(dir, "rev-parse", "--git-dir"); err != nil {
+		return "", fmt.Errorf("%s is not inside a git repository", displayName(dir))
+	}
+	for _, key := range []string{"ref", "name"} {
+		if v := stringInput(input, key); strings.HasPrefix(v, "-") {
+			return "", fmt.Errorf("%s '%s' must not start with '-'", key, v)
+		}
+	}
+	paths := stringList(input["paths"])
+
+	switch action {
+	case "status":
+		return gitStatusJSON(dir, paths)
+	case "diff":
+		return gitDiff(dir, input, paths)
+	case "log":
+		return gitLog(dir, input, paths)
+	case "blame":
+		return gitBlame(dir, input)
+	case "show":
+		return gitShow(dir, input, paths)
+	case "branch":
+		return gitBranch(dir, input)
+	case "switch":
+		return gitSwitch(dir, input)
+	case "stage", "unstage", "discard":
+		return gitChangePaths(dir, action, input, paths)
+	case "commit":
+		return gitCommit(dir, input)
+	case "":
+		return "", fmt.Errorf("action is required. Example: git(action=\"status\")")
+	default:
+		return "", fmt.Errorf("unknown action '%s'. Use status, diff, log, blame, show, branch, switch, stage, unstage, commit or discard", action)
+	}
+}
+
+// runGit runs git in dir without pager, colors, prompts or an editor and
+// returns its standard output. Errors carry git's own message.
+func runGit(dir string, args ...string) (string, error) {
+	return runGitInput(dir, "", args...)
+}
+
+func runGitInput(dir, stdin string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--no-pager", "-c", "color.ui=false", "-c", "core.quotepath=false"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_EDITOR=true", "GIT_PAGER=cat", "LC_ALL=C")
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("git %s timed out after %s", args[0], gitTimeout)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			// Some failures, such as "nothing to commit", go to stdout
+			msg = strings.TrimSpace(stdout.String())
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return stdout.String(), fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
+
+// limitGitOutput cuts long output at a line boundary with a hint
+func limitGitOutput(out, hint string) string {
+	limit := envInt("CLYDE_GIT_MAX_OUTPUT_KB", defaultGitMaxOutputKB) * 1024
+	if limit <= 0 || len(out) <= limit {
+		return out
+	}
+	cut := out[:limit]
+	if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+		cut = cut[:i+1]
+	}
+	return fmt.Sprintf("%s\n... truncated at %d KB of %d KB; %s", cut, limit/1024, len(out)/1024, hint)
+}
+
+// gitFileStatus is one changed file in the status JSON
+type gitFileStatus struct {
+	Path   string `json:"path"`
+	From   string `json:"from,omitempty"`
+	Status string `json:"status"`
+}
+
+type gitStatus struct {
+	Branch     string          `json:"branch,omitempty"`
+	Detached   bool            `json:"detached,omitempty"`
+	Commit     string          `json:"commit,omitempty"`
+	Upstream   string          `json:"upstream,omitempty"`
+	Ahead      int             `json:"ahead"`
+	Behind     int             `json:"behind"`
+	InProgress string          `json:"in_progress,omitempty"`
+	Clean      bool            `json:"clean"`
+	Staged     []gitFileStatus `json:"staged"`
+	Unstaged   []gitFileStatus `json:"unstaged"`
+	Untracked  []string        `json:"untracked"`
+	Conflicted []gitFileStatus `json:"conflicted"`
+}
+
+func gitStatusJSON(dir string, paths []string) (string, error) {
+	status, err := readGitStatus(dir, paths)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func readGitStatus(dir string, paths []string) (*gitStatus, error) {
+	out, err := runGit(dir, append([]string{"status", "--porcelain=v2", "--branch", "-z", "--"}, paths...)...)
+	if err != nil {
+		return nil, err
+	}
+	status := parseGitStatus(out)
+	if gitDir, err := runGit(dir, "rev-parse", "--absolute-git-dir"); err == nil {
+		status.InProgress = gitOperationInProgress(strings.TrimSpace(gitDir))
+	}
+	return status, nil
+}
+
+// parseGitStatus reads git status --porcelain=v2 --branch -z output
+func parseGitStatus(out string) *gitStatus {
+	s := &gitStatus{Staged: []gitFileStatus{}, Unstaged: []gitFileStatus{}, Untracked: []string{}, Conflicted: []gitFileStatus{}}
+	records := strings.Split(out, "\x00")
+	for i := 0; i < len(records); i++ {
+		r := records[i]
+		switch {
+		case strings.HasPrefix(r, "# branch.oid "):
+			if oid := strings.TrimPrefix(r, "# branch.oid "); oid != "(initial)" {
+				s.Commit = oid[:min(len(oid), 7)]
+			}
+		case strings.HasPrefix(r, "# branch.head "):
+			if head := strings.TrimPrefix(r, "# branch.head "); head == "(detached)" {
+				s.Detached = true
+			} else {
+				s.Branch = head
+			}
+		case strings.HasPrefix(r, "# branch.upstream "):
+			s.Upstream = strings.TrimPrefix(r, "# branch.upstream ")
+		case strings.HasPrefix(r, "# branch.ab "):
+			fmt.Sscanf(strings.TrimPrefix(r, "# branch.ab "), "+%d -%d", &s.Ahead, &s.Behind)
+		case strings.HasPrefix(r, "1 "):
+			if f := strings.SplitN(r, " ", 9); len(f) == 9 {
+				s.add(f[1], f[8], "")
+			}
+		case strings.HasPrefix(r, "2 "):
+			// Renames and copies are followed by the original path
+			if f := strings.SplitN(r, " ", 10); len(f) == 10 && i+1 < len(records) {
+				i++
+				s.add(f[1], f[9], records[i])
+			}
+		case strings.HasPrefix(r, "u "):
+			if f := strings.SplitN(r, " ", 11); len(f) == 11 {
+				s.Conflicted = append(s.Conflicted, gitFileStatus{Path: f[10], Status: gitConflictName(f[1])})
+			}
+		case strings.HasPrefix(r, "? "):
+			s.Untracked = append(s.Untracked, strings.TrimPrefix(r, "? "))
+		}
+	}
+	s.Clean = len(s.Staged)+len(s.Unstaged)+len(s.Untracked)+len(s.Conflicted) == 0
+	return s
+}
+
+func (s *gitStatus) add(xy, path, from string) {
+	if xy[0] != '.' {
+		s.Staged = append(s.Staged, gitFileStatus{Path: path, From: from, Status: gitChangeName(xy[0])})
+	}
+	if xy[1] != '.' {
+		s.Unstaged = append(s.Unstaged, gitFileStatus{Path: path, Status: gitChangeName(xy[1])})
+	}
+}
+
+func gitChangeName(c byte) string {
+	switch c {
+	case 'M':
+		return "modified"
+	case 'T':
+		return "type changed"
+	case 'A':
+		return "added"
+	case 'D':
+		return "deleted"
+	case 'R':
+		return "renamed"
+	case 'C':
+		return "copied"
+	}
+	return string(c)
+}
+
+func gitConflictName(xy string) string {
+	switch xy {
+	case "DD":
+		return "both deleted"
+	case "AU":
+		return "added by us"
+	case "UD":
+		return "deleted by them"
+	case "UA":
+		return "added by them"
+	case "DU":
+		return "deleted by us"
+	case "AA":
+		return "both added"
+	}
+	return "both modified"
+}
+
+// gitOperationInProgress names an unfinished merge, rebase and the like
+func gitOperationInProgress(gitDir string) string {
+	for _, op := range []struct{ file, name string }{
+		{"rebase-merge", "rebase"},
+		{"rebase-apply", "rebase"},
+		{"MERGE_HEAD", "merge"},
+		{"CHERRY_PICK_HEAD", "cherry-pick"},
+		{"REVERT_HEAD", "revert"},
+		{"BISECT_LOG", "bisect"},
+	} {
+		if _, err := os.Stat(filepath.Join(gitDir, op.file)); err == nil {
+			return op.name
+		}
+	}
+	return ""
+}
+
+func gitDiff(dir string, input map[string]interface{}, paths []string) (string, error) {
+	staged, _ := input["staged"].(bool)
+	stat, _ := input["stat"].(bool)
+	ref := stringInput(input, "ref")
+
+	args := []string{"diff", "--patch-with-stat"}
+	if stat {
+		args = []string{"diff", "--stat"}
+	}
+	label := "unstaged changes"
+	if staged {
+		args = append(args, "--cached")
+		label = "staged changes"
+	}
+	if ref != "" {
+		args = append(args, ref)
+		switch {
+		case strings.Contains(ref, ".."):
+			label = ref
+		case staged:
+			label = "staged changes against " + ref
+		default:
+			label = "working tree against " + ref
+		}
+	}
+	args = append(args, "--")
+	out, err := runGit(dir, append(args, paths...)...)
+	if err != nil {
+		return "", err
+	}
+	if len(paths) > 0 {
+		label += " in " + strings.Join(paths, ", ")
+	}
+	if strings.TrimSpace(out) == "" {
+		hint := ""
+		if !staged && ref == "" {
+			hint = " (staged changes are shown with staged=true)"
+		}
+		return fmt.Sprintf("No differences: %s%s", label, hint), nil
+	}
+	return limitGitOutput(fmt.Sprintf("Diff of %s:\n\n%s", label, out), "narrow it with paths or use stat=true"), nil
+}
+
+func gitLog(dir string, input map[string]interface{}, paths []string) (string, error) {
+	count := defaultGitLogCount
+	if v, ok := input["max_count"].(float64); ok && v > 0 {
+		count = min(int(v), maxGitLogCount)
+	}
+	args := []string{"log", fmt.Sprintf("--max-count=%d", count), "--date=short", "--format=%h %ad %an  %s%d"}
+	if stat, _ := input["stat"].(bool); stat {
+		args = append(args, "--stat")
+	}
+	if grep := stringInput(input, "grep"); grep != "" {
+		args = append(args, "--extended-regexp", "--regexp-ignore-case", "--grep="+grep)
+	}
+	if len(paths) == 1 {
+		// Follow a single file through renames
+		if info, err := os.Stat(filepath.Join(dir, paths[0])); err == nil && !info.IsDir() {
+			args = append(args, "--follow")
+		}
+	}
+	if ref := stringInput(input, "ref"); ref != "" {
+		args = append(args, ref)
+	}
+	args = append(args, "--")
+	out, err := runGit(dir, append(args, paths...)...)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not have any commits") {
+			return "No commits yet", nil
+		}
+		return "", err
+	}
+	if strings.TrimSpace(out) == "" {
+		return "No matching commits", nil
+	}
+	return limitGitOutput(out, "lower max_count or add paths"), nil
+}
+
+func gitBlame(dir string, input map[string]interface{}) (string, error) {
+	file := stringInput(input, "file")
+	if file == "" {
+		return "", fmt.Errorf("file is required for blame. Example: git(action=\"blame\", file=\"main.go\", start_line=10, end_line=30)")
+	}
+	args := []string{"blame", "--date=short"}
+	start, _ := input["start_line"].(float64)
+	end, _ := input["end_line"].(float64)
+	switch {
+	case start > 0 && end > 0:
+		if end < start {
+			return "", fmt.Errorf("end_line %d is before start_line %d", int(end), int(start))
+		}
+		args = append(args, fmt.Sprintf("-L%d,%d", int(start), int(end)))
+	case start > 0:
+		args = append(args, fmt.Sprintf("-L%d,", int(start)))
+	case end > 0:
+		args = append(args, fmt.Sprintf("-L1,%d", int(end)))
+	}
+	if ref := stringInput(input, "ref"); ref != "" {
+		args = append(args, ref)
+	}
+	out, err := runGit(dir, append(args, "--", file)...)
+	if err != nil {
+		return "", err
+	}
+	return limitGitOutput(out, "pass start_line and end_line"), nil
+}
+
+func gitShow(dir string, input map[string]interface{}, paths []string) (string, error) {
+	ref := stringInput(input, "ref")
+	if ref == "" {
+		ref = "HEAD"
+	}
+	args := []string{"show", "--date=iso", "--format=fuller", "--patch-with-stat", ref, "--"}
+	out, err := runGit(dir, append(args, paths...)...)
+	if err != nil {
+		return "", err
+	}
+	return limitGitOutput(out, "pass paths to see part of the commit"), nil
+}
+
+const gitBranchFormat = "%(HEAD) %(refname:short)%(if)%(upstream)%(then) [%(upstream:short)%(if)%(upstream:track)%(then): %(upstream:track,nobracket)%(end)]%(end)  %(objectname:short) %(committerdate:short) %(contents:subject)"
+
+func gitBranch(dir string, input map[string]interface{}) (string, error) {
+	name := stringInput(input, "name")
+	if name == "" {
+		args := []string{"branch", "--list", "--sort=-committerdate", "--format=" + gitBranchFormat}
+		if all, _ := input["all"].(bool); all {
+			args = append(args, "--all")
+		}
+		out, err := runGit(dir, args...)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(out) == "" {
+			return "No branches yet (the repository has no commits)", nil
+		}
+		return "Branches, most recently committed first (* is current):\n" + out, nil
+	}
+
+	if del, _ := input["delete"].(bool); del {
+		commit, _ := runGit(dir, "rev-parse", "--short", "--verify", "--end-of-options", "refs/heads/"+name)
+		_, err := runGit(dir, "branch", "--delete", name)
+		if err == nil {
+			return fmt.Sprintf("✓ Deleted branch %s (was %s)", name, strings.TrimSpace(commit)), nil
+		}
+		if !strings.Contains(err.Error(), "not fully merged") {
+			return "", err
+		}
+		unmerged, _ := runGit(dir, "log", "--oneline", "--max-count=5", "refs/heads/"+name, "--not", "HEAD")
+		if !requestApproval("Delete branch %s? It has commits not merged into the current branch, which would be lost:\n%s", name, strings.TrimRight(unmerged, "\n")) {
+			return "", fmt.Errorf("refused: branch %s is not fully merged, and deleting it would lose these commits:\n%sAsk the user before deleting it", name, unmerged)
+		}
+		if _, err := runGit(dir, "branch", "--delete", "--force", name); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("✓ Deleted unmerged branch %s (was %s; restore it with git branch %s %s)", name, strings.TrimSpace(commit), name, strings.TrimSpace(commit)), nil
+	}
+
+	if _, err := runGit(dir, "check-ref-format", "--branch", name); err != nil {
+		return "", fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	args := []string{"branch", name}
+	if ref := stringInput(input, "ref"); ref != "" {
+		args = append(args, ref)
+	}
+	if _, err := runGit(dir, args...); err != nil {
+		return "", err
+	}
+	commit, _ := runGit(dir, "log", "-1", "--format=%h %s", "refs/heads/"+name)
+	return fmt.Sprintf("✓ Created branch %s at %s (still on the current branch; use action=\"switch\" to move to it)", name, strings.TrimSpace(commit)), nil
+}
+
+func gitSwitch(dir string, input map[string]interface{}) (string, error) {
+	name := stringInput(input, "name")
+	if name == "" {
+		return "", fmt.Errorf("name is required for switch. Example: git(action=\"switch\", name=\"fix-parser\", create=true)")
+	}
+	args := []string{"switch"}
+	if create, _ := input["create"].(bool); create {
+		args = append(args, "--create", name)
+		if ref := stringInput(input, "ref"); ref != "" {
+			args = append(args, ref)
+		}
+	} else {
+		args = append(args, name)
+	}
+	if discard, _ := input["discard_changes"].(bool); discard {
+		stat, _ := runGit(dir, "diff", "HEAD", "--shortstat")
+		if !requestApproval("Switch to %s and throw away uncommitted changes (%s)?", name, strings.TrimSpace(stat)) {
+			return "", fmt.Errorf("refused: switching with discard_changes would lose uncommitted changes. Commit them first, or ask the user")
+		}
+		args = append(args, "--discard-changes")
+	}
+	if _, err := runGit(dir, args...); err != nil {
+		return "", err
+	}
+	commit, _ := runGit(dir, "log", "-1", "--format=%h %s")
+	result := fmt.Sprintf("✓ Switched to %s (%s)", name, strings.TrimSpace(commit))
+	if status, err := readGitStatus(dir, nil); err == nil && !status.Clean {
+		result += fmt.Sprintf("\nUncommitted changes carried over: %d staged, %d unstaged, %d untracked", len(status.Staged), len(status.Unstaged), len(status.Untracked))
+	}
+	return result, nil
+}
+
+// gitChangePaths stages, unstages or discards changes to paths
+func gitChangePaths(dir, action string, input map[string]interface{}, paths []string) (string, error) {
+	all, _ := input["all"].(bool)
+	if len(paths) == 0 && !(all && action == "stage") {
+		return "", fmt.Errorf("paths is required for %s. Example: git(action=\"%s\", paths=[\"main.go\"])", action, action)
+	}
+	var args []string
+	switch action {
+	case "stage":
+		args = append([]string{"add", "--"}, paths...)
+		if all {
+			args = []string{"add", "--all"}
+		}
+	case "unstage":
+		args = append([]string{"restore", "--staged", "--"}, paths...)
+	case "discard":
+		stat, _ := runGit(dir, append([]string{"diff", "--shortstat", "--"}, paths...)...)
+		if strings.TrimSpace(stat) == "" {
+			return "Nothing to discard: no unstaged changes in " + strings.Join(paths, ", "), nil
+		}
+		if !requestApproval("Discard uncommitted changes to %s (%s)? This cannot be undone.", strings.Join(paths, ", "), strings.TrimSpace(stat)) {
+			return "", fmt.Errorf("refused: discarding changes to %s cannot be undone. Ask the user first", strings.Join(paths, ", "))
+		}
+		args = append([]string{"restore", "--worktree", "--"}, paths...)
+	}
+	if _, err := runGit(dir, args...); err != nil {
+		return "", err
+	}
+
+	status, err := readGitStatus(dir, nil)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	switch action {
+	case "stage":
+		fmt.Fprintf(&b, "✓ Staged. %d %s ready to commit:\n", len(status.Staged), plural(len(status.Staged), "file"))
+	case "unstage":
+		fmt.Fprintf(&b, "✓ Unstaged (the changes stay in the working tree). %d %s still staged:\n", len(status.Staged), plural(len(status.Staged), "file"))
+	case "discard":
+		fmt.Fprintf(&b, "✓ Discarded changes to %s. %d %s still staged:\n", strings.Join(paths, ", "), len(status.Staged), plural(len(status.Staged), "file"))
+	}
+	for _, f := range status.Staged {
+		if f.From != "" {
+			fmt.Fprintf(&b, "  %s: %s → %s\n", f.Status, f.From, f.Path)
+		} else {
+			fmt.Fprintf(&b, "  %s: %s\n", f.Status, f.Path)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+func gitCommit(dir string, input map[string]interface{}) (string, error) {
+	message := strings.TrimSpace(stringInput(input, "message"))
+	if message == "" {
+		return "", fmt.Errorf("message is required for commit. Example: git(action=\"commit\", message=\"Fix header parsing\")")
+	}
+	coAuthors := envList("CLYDE_GIT_CO_AUTHORS")
+	switch v := input["co_authors"].(type) {
+	case string:
+		// An empty string turns the configured co-authors off
+		coAuthors = nil
+		if v = strings.TrimSpace(v); v != "" {
+			coAuthors = []string{v}
+		}
+	case []interface{}:
+		coAuthors = nil
+		for _, item := range v {
+			if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+				coAuthors = append(coAuthors, strings.TrimSpace(s))
+			}
+		}
+	}
+	for _, a := range coAuthors {
+		if !coAuthorPattern.MatchString(a) {
+			return "", fmt.Errorf("co-author '%s' must look like \"Name <email@example.com>\"", a)
+		}
+	}
+	all, _ := input["all"].(bool)
+	amend, _ := input["amend"].(bool)
+
+	if !all && !amend {
+		if _, err := runGit(dir, "diff", "--cached", "--quiet"); err == nil {
+			return "", fmt.Errorf("nothing is staged. Stage files with git(action=\"stage\", paths=[...]) or pass all=true to commit every change to tracked files")
+		}
+	}
+	if amend {
+		if remotes, _ := runGit(dir, "branch", "--remotes", "--contains", "HEAD"); strings.TrimSpace(remotes) != "" {
+			if !requestApproval("Amend the last commit? It has already been pushed (%s), so amending rewrites published history.", strings.Join(strings.Fields(remotes), ", ")) {
+				return "", fmt.Errorf("refused: the last commit is already pushed, and amending it would rewrite published history. Make a new commit instead")
+			}
+		}
+	}
+
+	args := []string{"commit", "--file=-", "--cleanup=strip"}
+	if all {
+		args = append(args, "--all")
+	}
+	if amend {
+		args = append(args, "--amend")
+	}
+	for _, a := range coAuthors {
+		args = append(args, "--trailer", "Co-authored-by: "+a)
+	}
+	if _, err := runGitInput(dir, message+"\n", args...); err != nil {
+		return "", err
+	}
+
+	summary, _ := runGit(dir, "log", "-1", "--format=%h %s")
+	stat, _ := runGit(dir, "show", "--stat", "--format=", "HEAD")
+	branch, _ := runGit(dir, "branch", "--show-current")
+	where := strings.TrimSpace(branch)
+	if where == "" {
+		where = "detached HEAD"
+	}
+	verb := "Committed"
+	if amend {
+		verb = "Amended"
+	}
+	result := fmt.Sprintf("✓ %s %s on %s", verb, strings.TrimSpace(summary), where)
+	for _, a := range coAuthors {
+		result += "\nCo-authored-by: " + a
+	}
+	if stat = strings.TrimRight(stat, "\n"); stat != "" {
+		result += "\n\n" + stat
+	}
+	return result, nil
+}
+
+// guardShellCommand refuses a shell command that runs git destructively
+// unless the user approves it. run_bash and the process tool both pass
+// commands through here, including text typed into a running process,
+// which may be a shell.
+func guardShellCommand(tool, command string) error {
+	reason := destructiveGitCommand(command)
+	if reason == "" || requestApproval("Allow %s to run this? %s:\n  %s", tool, reason, command) {
+		return nil
+	}
+	return fmt.Errorf("refused: %s. Use the git tool for status, diff, staging and commits; if this command is really needed, ask the user to run it", reason)
+}
+
+// shellSeparators splits a shell command into the simple commands it runs
+var shellSeparators = regexp.MustCompile(`[;&|\n()]+`)
+
+// destructiveGitCommand reports why a shell command runs git in a way that
+// can lose work, or "" if it doesn't. The check reads the command text,
+// so it catches the usual spellings rather than every possible one.
+func destructiveGitCommand(command string) string {
+	for _, segment := range shellSeparators.Split(command, -1) {
+		fields := strings.Fields(segment)
+		for i, f := range fields {
+			if f == "git" || strings.HasSuffix(f, "/git") {
+				if reason := destructiveGitArgs(fields[i+1:]); reason != "" {
+					return reason
+				}
+				break
+			}
+		}
+	}
+	return ""
+}
+
+func destructiveGitArgs(args []string) string {
+	// Skip global options such as -C dir and -c key=value
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if (args[0] == "-C" || args[0] == "-c") && len(args) > 1 {
+			args = args[2:]
+		} else {
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	sub, rest := args[0], args[1:]
+	has := func(flags ...string) bool {
+		for _, a := range rest {
+			for _, f := range flags {
+				if a == f || strings.HasPrefix(a, f+"=") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	shortFlag := func(c byte) bool {
+		for _, a := range rest {
+			if len(a) > 1 && a[0] == '-' && a[1] != '-' && strings.IndexByte(a[1:], c) >= 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch sub {
+	case "reset":
+		if has("--hard", "--merge", "--keep") {
+			return "git reset --hard throws away uncommitted changes"
+		}
+	case "push":
+		if has("--force", "--force-with-lease", "--mirror", "--delete", "--prune") || shortFlag('f') || shortFlag('d') {
+			return "a forced or deleting git push can destroy published history"
+		}
+		for _, a := range rest {
+			if strings.HasPrefix(a, "+") || strings.HasPrefix(a, ":") {
+				return "a forced or deleting git push can destroy published history"
+			}
+		}
+	case "clean":
+		if has("--force") || shortFlag('f') {
+			return "git clean deletes untracked files"
+		}
+	case "checkout":
+		if has("--", ".", "--force") || shortFlag('f') {
+			return "git checkout with paths or --force throws away uncommitted changes"
+		}
+	case "restore":
+		if !has("--staged") && !shortFlag('S') || has("--worktree") || shortFlag('W') {
+			return "git restore throws away uncommitted changes"
+		}
+	case "branch":
+		if has("-D") || (has("--delete") || shortFlag('d')) && (has("--force") || shortFlag('f')) {
+			return "force-deleting a branch can lose its commits"
+		}
+	case "stash":
+		if len(rest) > 0 && (rest[0] == "drop" || rest[0] == "clear") {
+			return "dropping stashes loses the changes in them"
+		}
+	case "filter-branch", "filter-repo":
+		return "it rewrites history"
+	}
+	return ""
+}
+
+func displayGit(input map[string]interface{}) string {
+	action := stringInput(input, "action")
+	switch action {
+	case "commit":
+		subject, _, _ := strings.Cut(stringInput(input, "message"), "\n")
+		return fmt.Sprintf("→ Git commit: %s", subject)
+	case "diff":
+		what := "unstaged"
+		if staged, _ := input["staged"].(bool); staged {
+			what = "staged"
+		}
+		if ref := stringInput(input, "ref"); ref != "" {
+			what = ref
+		}
+		return fmt.Sprintf("→ Git diff: %s", what)
+	case "blame":
+		return fmt.Sprintf("→ Git blame: %s", stringInput(input, "file"))
+	case "branch", "switch":
+		if name := stringInput(input, "name"); name != "" {
+			return fmt.Sprintf("→ Git %s: %s", action, name)
+		}
+	case "stage", "unstage", "discard":
+		if paths := stringList(input["paths"]); len(paths) > 0 {
+			return fmt.Sprintf("→ Git %s: %s", action, strings.Join(paths, ", "))
+		}
+	}
+	return fmt.Sprintf("→ Git %s", action)
+}
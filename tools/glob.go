@@ -45,6 +45,9 @@ func executeGlob(input map[string]interface{}, apiClient *api.Client, conversati
 	if path == "" {
 		path = "."
 	}
+	if err := checkWorkspacePath(path); err != nil {
+		return "", err
+	}
 
 	// Check if search path exists
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -99,12 +102,27 @@ func executeGlob(input map[string]interface{}, apiClient *api.Client, conversati
 		return strings.Join(suggestions, "\n"), nil
 	}
 
-	// Count files and format output
-	files := strings.Split(strings.TrimSpace(string(output)), "\n")
+	// Drop files the workspace policy denies (.env and the like)
+	policy := currentWorkspacePolicy()
+	var files []string
+	hidden := 0
+	for _, file := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if policy.isDenied(file) {
+			hidden++
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return fmt.Sprintf("No files found matching pattern '%s' in %s\n(%d %s blocked by CLYDE_FILE_DENY omitted)", pattern, path, hidden, plural(hidden, "file")), nil
+	}
 	fileCount := len(files)
 
 	// Build result with summary
-	result := fmt.Sprintf("Found %d files matching '%s':\n\n%s", fileCount, pattern, string(output))
+	result := fmt.Sprintf("Found %d files matching '%s':\n\n%s\n", fileCount, pattern, strings.Join(files, "\n"))
+	if hidden > 0 {
+		result += fmt.Sprintf("\n(%d %s blocked by CLYDE_FILE_DENY omitted)\n", hidden, plural(hidden, "file"))
+	}
 
 	return result, nil
 }
@@ -49,6 +49,10 @@ func executeGrep(input map[string]interface{}, apiClient *api.Client, conversati
 	if path == "" {
 		path = "."
 	}
+	policy := currentWorkspacePolicy()
+	if err := policy.check(path); err != nil {
+		return "", err
+	}
 
 	// Check if search path exists
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -118,8 +122,28 @@ func executeGrep(input map[string]interface{}, apiClient *api.Client, conversati
 		return fmt.Sprintf("No matches found for pattern '%s' in %s", pattern, path), nil
 	}
 
+	// Drop matches in files the workspace policy denies (.env and the like)
+	var lines []string
+	hidden := 0
+	denied := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if colonIdx := strings.Index(line, ":"); colonIdx > 0 {
+			filename := line[:colonIdx]
+			if _, seen := denied[filename]; !seen {
+				denied[filename] = policy.isDenied(filename)
+			}
+			if denied[filename] {
+				hidden++
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return fmt.Sprintf("No matches found for pattern '%s' in %s", pattern, path), nil
+	}
+
 	// Count matches and files
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
 	matchCount := len(lines)
 
 	// Count unique files
@@ -133,7 +157,10 @@ func executeGrep(input map[string]interface{}, apiClient *api.Client, conversati
 	fileCount := len(fileSet)
 
 	// Build result with summary
-	result := fmt.Sprintf("Found %d matches in %d files:\n\n%s", matchCount, fileCount, string(output))
+	result := fmt.Sprintf("Found %d matches in %d files:\n\n%s\n", matchCount, fileCount, strings.Join(lines, "\n"))
+	if hidden > 0 {
+		result += fmt.Sprintf("\n(%d matches in files blocked by CLYDE_FILE_DENY were omitted)\n", hidden)
+	}
 
 	return result, nil
 }
@@ -0,0 +1,412 @@
+package tools
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An on-disk cache of successful GET responses, shared by browse,
+// web_search and include_file. Entries are keyed by URL and honor
+// Cache-Control, Expires, ETag and Last-Modified: fresh entries are served
+// without a request, stale ones are revalidated with a conditional request
+// and reused on 304. Least recently used entries are evicted once the cache
+// exceeds its size cap.
+
+const (
+	defaultCacheTTLMinutes = 60
+	defaultCacheMaxMB      = 200
+)
+
+// cachedHeaders are the response headers kept with an entry
+var cachedHeaders = []string{"Content-Type", "Cache-Control", "Expires", "ETag", "Last-Modified", "Date"}
+
+// cacheOptions adjust how one request uses the cache
+type cacheOptions struct {
+	refresh bool // skip the lookup and fetch unconditionally; the result is still stored
+	// apiResponse caches for the TTL regardless of the response's own
+	// headers. Search APIs mark results uncacheable, but repeating a query
+	// within the TTL shouldn't cost quota.
+	apiResponse bool
+}
+
+// cacheEntry is the metadata stored next to a cached body
+type cacheEntry struct {
+	URL       string      `json:"url"`
+	FinalURL  string      `json:"final_url"`
+	Header    http.Header `json:"header"`
+	RemoteIPs []string    `json:"remote_ips"` // rechecked against the egress policy before every hit
+	StoredAt  time.Time   `json:"stored_at"`
+	Expires   time.Time   `json:"expires"`
+	Size      int64       `json:"size"`
+}
+
+var cacheMu sync.Mutex
+
+// cacheDir returns the cache directory: CLYDE_CACHE_DIR, or
+// ~/.clyde/cache/http. CLYDE_CACHE=false disables caching.
+func cacheDir() string {
+	if !envBool("CLYDE_CACHE", true) {
+		return ""
+	}
+	if dir := strings.TrimSpace(os.Getenv("CLYDE_CACHE_DIR")); dir != "" {
+		return expandHome(dir)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".clyde", "cache", "http")
+}
+
+func cacheKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedFetch is fetchURL with the response cache in front of it. Only GET
+// requests with a 200 response are stored, and only once the caller has
+// read the body to the end, so bodies cut off by a size limit never land
+// in the cache.
+func cachedFetch(tool string, req *http.Request, timeout time.Duration, opts cacheOptions) (*http.Response, error) {
+	dir := cacheDir()
+	if dir == "" || req.Method != http.MethodGet {
+		return fetchURL(tool, req, timeout)
+	}
+	// A cached copy must not outlive a policy change that blocks its URL
+	policy := currentEgressPolicy()
+	if err := policy.checkURL(req.URL); err != nil {
+		return fetchURL(tool, req, timeout)
+	}
+	key := cacheKey(req)
+
+	var entry *cacheEntry
+	if !opts.refresh {
+		entry = loadCacheEntry(dir, key)
+	}
+	if entry != nil && !entry.allowedBy(policy) {
+		entry = nil // fetching again applies the policy, and logs the refusal
+	}
+	if entry != nil && time.Now().Before(entry.Expires) {
+		start := time.Now()
+		if resp, err := entry.response(dir, key, req); err == nil {
+			reportProgress("  💾 Cache hit: %s (fetched %s ago)", req.URL, formatAge(time.Since(entry.StoredAt)))
+			resp.Body = &loggedBody{ReadCloser: resp.Body, start: start, entry: fetchLogEntry{
+				Tool:     tool,
+				Method:   req.Method,
+				URL:      req.URL.String(),
+				FinalURL: resp.Request.URL.String(),
+				Status:   resp.StatusCode,
+				RemoteIP: entry.RemoteIPs[len(entry.RemoteIPs)-1],
+				Cached:   true,
+			}}
+			return resp, nil
+		}
+		entry = nil
+	}
+
+	// Stale: ask the server whether our copy is still good
+	if entry != nil && !opts.apiResponse {
+		if etag := entry.Header.Get("ETag"); etag != "" && req.Header.Get("If-None-Match") == "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.Header.Get("Last-Modified"); modified != "" && req.Header.Get("If-Modified-Since") == "" {
+			req.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	resp, err := fetchURL(tool, req, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		for _, name := range []string{"Cache-Control", "Expires", "ETag", "Last-Modified", "Date"} {
+			if v := resp.Header.Get(name); v != "" {
+				entry.Header.Set(name, v)
+			}
+		}
+		if ips := fetchRemoteIPs(resp); len(ips) > 0 {
+			entry.RemoteIPs = ips
+		}
+		entry.StoredAt = time.Now()
+		entry.Expires = freshUntil(entry.Header, entry.StoredAt, opts)
+		saveCacheMeta(dir, key, entry)
+		cached, err := entry.response(dir, key, req)
+		if err == nil {
+			reportProgress("  💾 Cache revalidated: %s (not modified)", req.URL)
+			return cached, nil
+		}
+		// The body vanished between load and use; fetch it again
+		req.Header.Del("If-None-Match")
+		req.Header.Del("If-Modified-Since")
+		return fetchURL(tool, req, timeout)
+	}
+
+	remoteIPs := fetchRemoteIPs(resp)
+	if resp.StatusCode != http.StatusOK || (!opts.apiResponse && noStore(resp.Header)) || len(remoteIPs) == 0 {
+		return resp, nil
+	}
+
+	entry = &cacheEntry{
+		URL:       req.URL.String(),
+		FinalURL:  resp.Request.URL.String(),
+		Header:    http.Header{},
+		RemoteIPs: remoteIPs,
+		StoredAt:  time.Now(),
+	}
+	for _, name := range cachedHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			entry.Header.Set(name, v)
+		}
+	}
+	entry.Expires = freshUntil(entry.Header, entry.StoredAt, opts)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return resp, nil
+	}
+	tmp, err := os.CreateTemp(dir, key+".tmp-*")
+	if err != nil {
+		return resp, nil
+	}
+	resp.Body = &cachingBody{ReadCloser: resp.Body, tmp: tmp, dir: dir, key: key, entry: entry}
+	return resp, nil
+}
+
+// cachingBody copies a response body to a temp file as it is read and
+// commits it to the cache on Close if the whole body was read
+type cachingBody struct {
+	io.ReadCloser
+	tmp      *os.File
+	dir, key string
+	entry    *cacheEntry
+	complete bool
+	failed   bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.failed {
+		if _, werr := b.tmp.Write(p[:n]); werr != nil {
+			b.failed = true
+		}
+		b.entry.Size += int64(n)
+	}
+	if err == io.EOF {
+		b.complete = true
+	}
+	return n, err
+}
+
+func (b *cachingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.tmp.Close()
+	maxBytes := int64(envInt("CLYDE_CACHE_MAX_MB", defaultCacheMaxMB)) * 1024 * 1024
+	// A single entry may use at most a quarter of the cache
+	if !b.complete || b.failed || b.entry.Size > maxBytes/4 {
+		os.Remove(b.tmp.Name())
+		return err
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if os.Rename(b.tmp.Name(), filepath.Join(b.dir, b.key+".body")) != nil {
+		os.Remove(b.tmp.Name())
+		return err
+	}
+	saveCacheMeta(b.dir, b.key, b.entry)
+	evictCache(b.dir, maxBytes)
+	return err
+}
+
+func loadCacheEntry(dir, key string) *cacheEntry {
+	data, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if json.Unmarshal(data, &entry) != nil {
+		return nil
+	}
+	return &entry
+}
+
+func saveCacheMeta(dir, key string, entry *cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	tmp := filepath.Join(dir, key+".json.tmp-"+randomSuffix())
+	if os.WriteFile(tmp, data, 0600) == nil {
+		os.Rename(tmp, filepath.Join(dir, key+".json"))
+	}
+}
+
+// allowedBy reports whether the policy still allows every host and address
+// the entry was fetched from. Entries without addresses predate recording
+// them and are never served.
+func (e *cacheEntry) allowedBy(policy *egressPolicy) bool {
+	if len(e.RemoteIPs) == 0 {
+		return false
+	}
+	if final, err := url.Parse(e.FinalURL); err != nil || policy.checkURL(final) != nil {
+		return false
+	}
+	for _, ip := range e.RemoteIPs {
+		if policy.checkIP(net.ParseIP(ip)) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// response builds an http.Response from the cached body. Serving an entry
+// bumps its modification time, which is what LRU eviction orders by.
+func (e *cacheEntry) response(dir, key string, req *http.Request) (*http.Response, error) {
+	bodyPath := filepath.Join(dir, key+".body")
+	f, err := os.Open(bodyPath)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	os.Chtimes(bodyPath, now, now)
+
+	final := *req
+	if u, err := req.URL.Parse(e.FinalURL); err == nil && e.FinalURL != "" {
+		final.URL = u
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          f,
+		ContentLength: e.Size,
+		Request:       &final,
+	}, nil
+}
+
+// freshUntil works out when a response goes stale: max-age, then Expires,
+// then the configured TTL. no-cache responses are stale immediately, so
+// every use revalidates.
+func freshUntil(header http.Header, stored time.Time, opts cacheOptions) time.Time {
+	ttl := time.Duration(envInt("CLYDE_CACHE_TTL_MINUTES", defaultCacheTTLMinutes)) * time.Minute
+	if opts.apiResponse {
+		return stored.Add(ttl)
+	}
+
+	directives := cacheControl(header)
+	if _, ok := directives["no-cache"]; ok {
+		return stored
+	}
+	if maxAge, ok := directives["max-age"]; ok {
+		if secs, err := strconv.Atoi(maxAge); err == nil {
+			return stored.Add(time.Duration(secs) * time.Second)
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return stored // invalid Expires means already expired
+		}
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			return stored.Add(t.Sub(date)) // don't trust our clock against theirs
+		}
+		return t
+	}
+	return stored.Add(ttl)
+}
+
+func noStore(header http.Header) bool {
+	_, ok := cacheControl(header)["no-store"]
+	return ok
+}
+
+// cacheControl parses the Cache-Control header into directive -> value
+func cacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+// evictCache deletes the least recently used entries until the bodies fit
+// in maxBytes. Leftover temp files from interrupted downloads go too.
+func evictCache(dir string, maxBytes int64) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type cached struct {
+		key  string
+		size int64
+		used time.Time
+	}
+	var bodies []cached
+	var total int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		name := e.Name()
+		if strings.Contains(name, ".tmp-") && time.Since(info.ModTime()) > time.Hour {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if key, ok := strings.CutSuffix(name, ".body"); ok {
+			bodies = append(bodies, cached{key, info.Size(), info.ModTime()})
+			total += info.Size()
+		}
+	}
+	if total <= maxBytes {
+		return
+	}
+	sort.Slice(bodies, func(i, j int) bool { return bodies[i].used.Before(bodies[j].used) })
+	for _, b := range bodies {
+		if total <= maxBytes {
+			break
+		}
+		os.Remove(filepath.Join(dir, b.key+".body"))
+		os.Remove(filepath.Join(dir, b.key+".json"))
+		total -= b.size
+	}
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+func randomSuffix() string {
+	var b [6]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
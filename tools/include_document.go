@@ -0,0 +1,297 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// documentMarker packs a document block for the agent, like IMAGE_LOADED
+// does for images. Format:
+// DOCUMENT_LOADED:<source_type>:<media_type>:<title>:<summary>:<data>, with
+// title, summary and data base64-encoded so they can't contain colons.
+// source_type is "base64" for PDFs and "text" for plain text.
+func documentMarker(sourceType, mediaType, title, summary string, data []byte) string {
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("DOCUMENT_LOADED:%s:%s:%s:%s:%s", sourceType, mediaType, enc([]byte(title)), enc([]byte(summary)), enc(data))
+}
+
+// includePDFDocument sends a whole PDF as a document block, so the model
+// sees its layout and figures. With a page range only the text of those
+// pages is sent, since pages can't be cut out of the PDF itself.
+func includePDFDocument(name string, data []byte, pages string) (string, error) {
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read PDF '%s': %w", name, err)
+	}
+	total := reader.NumPage()
+	sizeKB := float64(len(data)) / 1024
+
+	if pages == "" {
+		if total > maxPDFDocumentPages {
+			return "", fmt.Errorf("PDF has %d pages; at most %d can be sent at once. Pass pages (e.g. pages=\"1-20\") to include part of it", total, maxPDFDocumentPages)
+		}
+		summary := fmt.Sprintf("PDF document loaded: %s (%d pages, %.1f KB)", name, total, sizeKB)
+		return documentMarker("base64", "application/pdf", name, summary, data), nil
+	}
+
+	selected, err := parsePageRange(pages, total)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	hasText := false
+	for _, n := range selected {
+		text, err := pdfPageText(reader.Page(n))
+		if err != nil {
+			text = fmt.Sprintf("[could not extract text: %v]", err)
+		}
+		hasText = hasText || err == nil && text != ""
+		b.WriteString(fmt.Sprintf("## Page %d\n\n%s\n\n", n, text))
+	}
+	if !hasText {
+		return "", fmt.Errorf("pages %s of '%s' have no extractable text. The PDF is probably scanned; include it without pages to send the pages as images", pages, name)
+	}
+	title := fmt.Sprintf("%s (pages %s of %d)", name, pages, total)
+	summary := fmt.Sprintf("PDF pages loaded as text: %s (%d of %d pages)", name, len(selected), total)
+	return documentMarker("text", "text/plain", title, summary, []byte(strings.TrimSpace(b.String()))), nil
+}
+
+// parsePageRange turns "1-3,8" into sorted, de-duplicated page numbers
+// within 1..total
+func parsePageRange(spec string, total int) ([]int, error) {
+	seen := make(map[int]bool)
+	var pages []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		first, err1 := strconv.Atoi(strings.TrimSpace(from))
+		last := first
+		var err2 error
+		if isRange {
+			last, err2 = strconv.Atoi(strings.TrimSpace(to))
+		}
+		if err1 != nil || err2 != nil || first < 1 || last < first {
+			return nil, fmt.Errorf("invalid pages '%s'. Use page numbers and ranges like '3', '2-5' or '1-3,8'", spec)
+		}
+		if last > total {
+			return nil, fmt.Errorf("pages '%s' go past the end of the PDF, which has %d pages", spec, total)
+		}
+		for n := first; n <= last; n++ {
+			if !seen[n] {
+				seen[n] = true
+				pages = append(pages, n)
+			}
+		}
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("invalid pages '%s'. Use page numbers and ranges like '3', '2-5' or '1-3,8'", spec)
+	}
+	sort.Ints(pages)
+	return pages, nil
+}
+
+// frameTextFile renders a text file with a header line and a code fence
+// tagged with its language. size is the full file size, or -1 if unknown.
+func frameTextFile(name string, data []byte, truncated bool, size int64) string {
+	text := strings.ToValidUTF8(string(data), "�")
+	lang := languageFor(name)
+
+	var b strings.Builder
+	meta := []string{}
+	if label := languageLabels[lang]; label != "" {
+		meta = append(meta, label)
+	}
+	meta = append(meta, fmt.Sprintf("%d lines", strings.Count(text, "\n")+boolInt(text != "" && !strings.HasSuffix(text, "\n"))))
+	meta = append(meta, formatSize(int64(len(data))))
+	fmt.Fprintf(&b, "File: %s (%s)\n\n", name, strings.Join(meta, " · "))
+
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	b.WriteString(fence + lang + "\n")
+	b.WriteString(strings.TrimRight(text, "\n"))
+	b.WriteString("\n" + fence + "\n")
+	if truncated {
+		if size > 0 {
+			fmt.Fprintf(&b, "\n[Showing the first %s of %s (CLYDE_INCLUDE_MAX_TEXT_KB)]\n", formatSize(int64(len(data))), formatSize(size))
+		} else {
+			fmt.Fprintf(&b, "\n[Showing the first %s (CLYDE_INCLUDE_MAX_TEXT_KB)]\n", formatSize(int64(len(data))))
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// includeDirectory bundles the text files under dir that match glob, in
+// path order, within the byte budget. A file too large for what is left is
+// listed as omitted and later files that still fit are included. Hidden
+// directories, dependency folders, denied paths and binary files are
+// skipped.
+func includeDirectory(dir, glob string, budget int) (string, error) {
+	if glob == "" {
+		glob = "*"
+	}
+	re := globToRegexp(glob)
+	matchName := !strings.Contains(glob, "/")
+	policy := currentWorkspacePolicy()
+
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != dir && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules" || d.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, p)
+		rel = filepath.ToSlash(rel)
+		target := rel
+		if matchName {
+			target = d.Name()
+		}
+		if re.MatchString(target) && !policy.isDenied(p) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list directory '%s': %w", dir, err)
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no files in '%s' match '%s'. Use list_files or glob to see what's there", dir, glob)
+	}
+
+	var body strings.Builder
+	var included, omitted, binary []string
+	used := 0
+	for _, rel := range files {
+		full := filepath.Join(dir, filepath.FromSlash(rel))
+		info, err := os.Stat(full)
+		if err != nil {
+			continue
+		}
+		remaining := budget - used
+		data, err := readHead(full, min(info.Size(), int64(max(remaining, 512))))
+		if err != nil {
+			continue
+		}
+		if kind, _ := sniffInclude(data, int64(len(data)) == info.Size()); kind != includeText {
+			binary = append(binary, rel)
+			continue
+		}
+		if info.Size() > int64(remaining) {
+			omitted = append(omitted, rel)
+			continue
+		}
+		used += len(data)
+		included = append(included, rel)
+		body.WriteString(frameTextFile(displayName(filepath.Join(dir, filepath.FromSlash(rel))), data, false, int64(len(data))))
+		body.WriteString("\n\n")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Directory: %s (%s) · %d of %d files · %s of %s budget\n\n", displayName(dir), glob, len(included), len(files), formatSize(int64(used)), formatSize(int64(budget)))
+	b.WriteString(body.String())
+	if len(omitted) > 0 {
+		fmt.Fprintf(&b, "Omitted over budget (%d): %s\nRaise max_kb or narrow the glob to include them.\n", len(omitted), summarizeList(omitted, 20))
+	}
+	if len(binary) > 0 {
+		fmt.Fprintf(&b, "Skipped binary files (%d): %s\n", len(binary), summarizeList(binary, 10))
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// readHead reads up to n bytes of a file
+func readHead(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, _, err := readLimited(f, n)
+	return data, err
+}
+
+func summarizeList(items []string, limit int) string {
+	if len(items) <= limit {
+		return strings.Join(items, ", ")
+	}
+	return strings.Join(items[:limit], ", ") + fmt.Sprintf(", ... and %d more", len(items)-limit)
+}
+
+func formatSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	if n < 1024*1024 {
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// languageFor picks the code fence tag for a file from its name
+func languageFor(name string) string {
+	base := strings.ToLower(filepath.Base(name))
+	switch base {
+	case "makefile", "gnumakefile":
+		return "makefile"
+	case "dockerfile", "containerfile":
+		return "dockerfile"
+	case "go.mod", "go.sum", "go.work":
+		return "gomod"
+	case "cmakelists.txt":
+		return "cmake"
+	}
+	if strings.HasPrefix(base, "dockerfile.") {
+		return "dockerfile"
+	}
+	return languageByExt[strings.TrimPrefix(filepath.Ext(base), ".")]
+}
+
+var languageByExt = map[string]string{
+	"go": "go", "py": "python", "rb": "ruby", "rs": "rust", "java": "java", "kt": "kotlin", "swift": "swift",
+	"c": "c", "h": "c", "cc": "cpp", "cpp": "cpp", "hpp": "cpp", "cs": "csharp", "m": "objectivec",
+	"js": "javascript", "mjs": "javascript", "cjs": "javascript", "jsx": "jsx", "ts": "typescript", "tsx": "tsx",
+	"php": "php", "pl": "perl", "lua": "lua", "r": "r", "scala": "scala", "ex": "elixir", "exs": "elixir",
+	"erl": "erlang", "hs": "haskell", "ml": "ocaml", "clj": "clojure", "dart": "dart", "zig": "zig",
+	"sh": "bash", "bash": "bash", "zsh": "zsh", "fish": "fish", "ps1": "powershell",
+	"sql": "sql", "graphql": "graphql", "proto": "protobuf",
+	"html": "html", "htm": "html", "css": "css", "scss": "scss", "vue": "vue", "svelte": "svelte",
+	"json": "json", "yaml": "yaml", "yml": "yaml", "toml": "toml", "xml": "xml", "ini": "ini",
+	"md": "markdown", "tf": "hcl", "hcl": "hcl", "diff": "diff", "patch": "diff", "csv": "csv",
+}
+
+// languageLabels name languages in the file header
+var languageLabels = map[string]string{
+	"go": "Go", "python": "Python", "ruby": "Ruby", "rust": "Rust", "java": "Java", "kotlin": "Kotlin",
+	"swift": "Swift", "c": "C", "cpp": "C++", "csharp": "C#", "javascript": "JavaScript", "jsx": "JSX",
+	"typescript": "TypeScript", "tsx": "TSX", "php": "PHP", "bash": "Shell", "sql": "SQL",
+	"html": "HTML", "css": "CSS", "json": "JSON", "yaml": "YAML", "toml": "TOML", "xml": "XML",
+	"markdown": "Markdown", "makefile": "Makefile", "dockerfile": "Dockerfile", "gomod": "Go modules",
+	"protobuf": "Protocol Buffers", "diff": "Diff", "csv": "CSV", "hcl": "HCL",
+}
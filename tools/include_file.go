@@ -1,13 +1,19 @@
 package tools
 
 import (
-	"encoding/base64"
+	"bytes"
 	"fmt"
+	"image"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/this-is-alpha-iota/clyde/api"
 )
@@ -18,102 +24,282 @@ func init() {
 
 var includeFileTool = api.Tool{
 	Name:        "include_file",
-	Description: "Include a file's contents in the conversation. For images (jpg, png, gif, webp), this sends the image to Claude for vision analysis. Can load from local filesystem or remote URLs. Use this tool when the user asks you to look at, analyze, or work with a specific file.",
+	Description: "Include a file's contents in the conversation. Images (jpg, png, gif, webp) are sent for vision analysis, downscaled to a maximum edge and optionally cropped, with their dimensions and estimated token cost reported; PDFs are sent as documents, optionally limited to a page range; text and source files are included with a header and a language-tagged code fence; a directory includes the text files matching a glob, up to a size budget. The type is detected from the content, not the extension. Can load from local filesystem or remote URLs. Use this tool when the user asks you to look at, analyze, or work with a specific file.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
 			"path": map[string]interface{}{
 				"type":        "string",
-				"description": "File path (local or URL). Examples: './screenshot.png', '/tmp/diagram.jpg', 'https://example.com/image.png'",
+				"description": "File or directory path (local or URL). Examples: './screenshot.png', 'docs/spec.pdf', 'internal/auth', 'https://example.com/image.png'",
+			},
+			"pages": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional, PDFs only: pages to include, e.g. '3', '2-5' or '1-3,8'. The text of those pages is sent instead of the whole PDF",
+			},
+			"max_edge": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional, images only: longest edge in pixels after downscaling (default 1568). Lower it to save tokens; the aspect ratio is kept",
+			},
+			"crop": map[string]interface{}{
+				"type":        "object",
+				"description": "Optional, images only: region to keep, in pixels of the original image, applied before downscaling. Use it to zoom in on part of a large screenshot",
+				"properties": map[string]interface{}{
+					"x":      map[string]interface{}{"type": "integer"},
+					"y":      map[string]interface{}{"type": "integer"},
+					"width":  map[string]interface{}{"type": "integer"},
+					"height": map[string]interface{}{"type": "integer"},
+				},
+				"required": []string{"x", "y", "width", "height"},
+			},
+			"glob": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional, directories only: which files to include (default all). A pattern without '/' matches file names at any depth ('*.go'); with '/' it matches paths relative to the directory ('cmd/**/*.go')",
+			},
+			"max_kb": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional, directories only: total size budget in KB (default 200)",
+			},
+			"refresh": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Optional: for URLs, bypass the local cache and download again (default false)",
 			},
 		},
 		"required": []string{"path"},
 	},
 }
 
+const (
+	// defaultMaxImageMB caps image reads and downloads. It's above the API's
+	// 5MB limit because large images are downscaled before sending.
+	// Configurable with CLYDE_INCLUDE_MAX_IMAGE_MB (local files) and
+	// CLYDE_FETCH_MAX_IMAGE_MB (URLs).
+	defaultMaxImageMB = 20
+	// defaultMaxPDFMB matches the API's limit for PDF documents
+	defaultMaxPDFMB = 32
+	// maxPDFDocumentPages is the most pages the API accepts in one PDF
+	maxPDFDocumentPages = 100
+
+	defaultIncludeTextKB   = 256
+	defaultIncludeBundleKB = 200
+)
+
+// Kinds of content include_file handles, decided by sniffing
+const (
+	includeImage  = "image"
+	includePDF    = "pdf"
+	includeText   = "text"
+	includeBinary = "binary"
+)
+
 func executeIncludeFile(input map[string]interface{}, apiClient *api.Client, history []api.Message) (string, error) {
 	path, ok := input["path"].(string)
 	if !ok || path == "" {
 		return "", fmt.Errorf("path is required. Example: include_file(\"./screenshot.png\")")
 	}
+	pages, _ := input["pages"].(string)
+	imgOpts, err := parseImageOptions(input)
+	if err != nil {
+		return "", err
+	}
 
 	// Determine if URL or local path
 	isURL := strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+	if isURL {
+		refresh, _ := input["refresh"].(bool)
+		return includeURL(path, pages, imgOpts, refresh)
+	}
 
-	// Check file type
-	ext := strings.ToLower(filepath.Ext(path))
-	isImage := ext == ".jpg" || ext == ".jpeg" || ext == ".png" ||
-		ext == ".gif" || ext == ".webp"
+	if err := checkWorkspacePath(path); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fileError(path, err)
+	}
+	if info.IsDir() {
+		glob, _ := input["glob"].(string)
+		budgetKB := envInt("CLYDE_INCLUDE_MAX_BUNDLE_KB", defaultIncludeBundleKB)
+		if v, ok := input["max_kb"].(float64); ok && v > 0 {
+			budgetKB = int(v)
+		}
+		return includeDirectory(path, glob, budgetKB*1024)
+	}
 
-	if isImage {
-		return loadImage(path, isURL)
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fileError(path, err)
 	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	kind, mediaType := sniffInclude(head[:n], n < len(head))
 
-	// For non-images, return error for now (future: support text files)
-	return "", fmt.Errorf("only image files are currently supported (.jpg, .png, .gif, .webp). Got: %s", ext)
+	// Read no more than the kind can use
+	var limit int64
+	switch kind {
+	case includeImage:
+		limit = int64(envInt("CLYDE_INCLUDE_MAX_IMAGE_MB", defaultMaxImageMB)) * 1024 * 1024
+	case includePDF:
+		limit = int64(envInt("CLYDE_INCLUDE_MAX_PDF_MB", defaultMaxPDFMB)) * 1024 * 1024
+	case includeText:
+		limit = int64(envInt("CLYDE_INCLUDE_MAX_TEXT_KB", defaultIncludeTextKB)) * 1024
+	default:
+		return "", unsupportedError(path, mediaType)
+	}
+	if kind != includeText && info.Size() > limit {
+		return "", tooLargeError(kind, info.Size(), limit)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	data, truncated, err := readLimited(f, limit)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	return includeContent(path, kind, mediaType, data, truncated, info.Size(), pages, imgOpts)
 }
 
-func loadImage(path string, isURL bool) (string, error) {
-	var data []byte
-	var err error
-	var mediaType string
-
-	if isURL {
-		// Fetch from URL
-		resp, err := http.Get(path)
-		if err != nil {
-			return "", fmt.Errorf("failed to fetch image from URL: %w", err)
+// parseImageOptions reads max_edge and crop
+func parseImageOptions(input map[string]interface{}) (imageOptions, error) {
+	var opts imageOptions
+	if v, ok := input["max_edge"].(float64); ok {
+		if v < 16 {
+			return opts, fmt.Errorf("max_edge must be at least 16 pixels")
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			return "", fmt.Errorf("URL returned status %d. Check if the URL is correct and accessible", resp.StatusCode)
+		opts.maxEdge = int(v)
+	}
+	if raw, ok := input["crop"]; ok && raw != nil {
+		crop, ok := raw.(map[string]interface{})
+		if !ok {
+			return opts, fmt.Errorf("crop must be an object like {\"x\": 0, \"y\": 0, \"width\": 800, \"height\": 600}")
 		}
-
-		mediaType = resp.Header.Get("Content-Type")
-		if !isValidImageType(mediaType) {
-			return "", fmt.Errorf("unsupported image type from URL: %s. Supported types: image/jpeg, image/png, image/webp, image/gif", mediaType)
+		var vals [4]int
+		for i, key := range []string{"x", "y", "width", "height"} {
+			v, ok := crop[key].(float64)
+			if !ok || v < 0 {
+				return opts, fmt.Errorf("crop needs non-negative x, y, width and height in pixels; '%s' is missing or invalid", key)
+			}
+			vals[i] = int(v)
 		}
+		if vals[2] == 0 || vals[3] == 0 {
+			return opts, fmt.Errorf("crop width and height must be greater than zero")
+		}
+		rect := image.Rect(vals[0], vals[1], vals[0]+vals[2], vals[1]+vals[3])
+		opts.crop = &rect
+	}
+	return opts, nil
+}
 
-		data, err = io.ReadAll(resp.Body)
-		if err != nil {
-			return "", fmt.Errorf("failed to read image data from URL: %w", err)
+// includeURL downloads a file and includes it by its sniffed type. The
+// Content-Type header only picks the download cap, so images stay within
+// the image limit.
+func includeURL(rawURL, pages string, imgOpts imageOptions, refresh bool) (string, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	resp, err := cachedFetch("include_file", req, 30*time.Second, cacheOptions{refresh: refresh})
+	if err != nil {
+		if isEgressBlocked(err) {
+			return "", err
 		}
+		return "", fmt.Errorf("failed to fetch file from URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("URL returned status %d. Check if the URL is correct and accessible", resp.StatusCode)
+	}
+
+	headerType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	var maxBytes int64
+	var setting string
+	if strings.HasPrefix(headerType, "image/") {
+		// Don't download more than we could shrink to send
+		maxBytes = int64(envInt("CLYDE_FETCH_MAX_IMAGE_MB", defaultMaxImageMB)) * 1024 * 1024
+		setting = "CLYDE_FETCH_MAX_IMAGE_MB"
 	} else {
-		// Read local file
-		data, err = os.ReadFile(path)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return "", fmt.Errorf("file '%s' not found. Use list_files or glob to find available files", path)
-			}
-			if os.IsPermission(err) {
-				return "", fmt.Errorf("permission denied reading '%s'. Check file permissions", path)
-			}
-			return "", fmt.Errorf("failed to read file '%s': %w", path, err)
-		}
+		maxBytes = int64(envInt("CLYDE_INCLUDE_MAX_PDF_MB", defaultMaxPDFMB)) * 1024 * 1024
+		setting = "CLYDE_INCLUDE_MAX_PDF_MB"
+	}
+	if resp.ContentLength > maxBytes {
+		return "", fmt.Errorf("file too large (%.1f MB). Maximum download is %d MB (%s)",
+			float64(resp.ContentLength)/(1024*1024), maxBytes/(1024*1024), setting)
+	}
+	data, exceeded, err := readLimited(resp.Body, maxBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to read data from URL: %w", err)
+	}
+
+	kind, mediaType := sniffInclude(data, !exceeded)
+	if exceeded && kind != includeText {
+		return "", fmt.Errorf("download exceeded %d MB and was stopped (%s)", maxBytes/(1024*1024), setting)
+	}
 
-		// Detect media type from extension
-		ext := strings.ToLower(filepath.Ext(path))
-		mediaType = detectMediaType(ext)
-		if mediaType == "" {
-			return "", fmt.Errorf("unsupported image format: %s. Supported formats: .jpg, .jpeg, .png, .gif, .webp", ext)
+	name := rawURL
+	if u, err := url.Parse(rawURL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		name = path.Base(u.Path)
+	}
+	switch kind {
+	case includeText:
+		// Text downloads use the text cap rather than the PDF one
+		textMax := envInt("CLYDE_INCLUDE_MAX_TEXT_KB", defaultIncludeTextKB) * 1024
+		size := int64(len(data))
+		if exceeded {
+			size = -1
 		}
+		if len(data) > textMax {
+			data, exceeded = data[:textMax], true
+		}
+		return frameTextFile(name, data, exceeded, size), nil
+	case includeImage, includePDF:
+		return includeContent(name, kind, mediaType, data, false, int64(len(data)), pages, imgOpts)
 	}
+	return "", unsupportedError(rawURL, mediaType)
+}
 
-	// Check size (5MB limit per Claude API)
-	sizeBytes := len(data)
-	sizeMB := float64(sizeBytes) / (1024 * 1024)
-	if sizeBytes > 5*1024*1024 {
-		return "", fmt.Errorf("image too large (%.1f MB). Maximum is 5MB. Try resizing the image or using a different file", sizeMB)
+// includeContent dispatches loaded data to the handler for its kind
+func includeContent(name, kind, mediaType string, data []byte, truncated bool, size int64, pages string, imgOpts imageOptions) (string, error) {
+	if pages != "" && kind != includePDF {
+		return "", fmt.Errorf("pages only applies to PDFs; '%s' is %s", name, mediaType)
+	}
+	if (imgOpts.crop != nil || imgOpts.maxEdge > 0) && kind != includeImage {
+		return "", fmt.Errorf("crop and max_edge only apply to images; '%s' is %s", name, mediaType)
+	}
+	switch kind {
+	case includeImage:
+		return loadImage(data, mediaType, imgOpts)
+	case includePDF:
+		return includePDFDocument(name, data, pages)
+	case includeText:
+		return frameTextFile(name, data, truncated, size), nil
 	}
+	return "", unsupportedError(name, mediaType)
+}
 
-	// Encode to base64
-	encoded := base64.StdEncoding.EncodeToString(data)
+// sniffInclude classifies content by its bytes. complete says data is the
+// whole file, so a multi-byte character cut off at the end of a sample
+// isn't mistaken for binary.
+func sniffInclude(data []byte, complete bool) (kind, mediaType string) {
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		return includePDF, "application/pdf"
+	}
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if isValidImageType(detected) {
+		return includeImage, detected
+	}
 
-	// Return special marker that agent will recognize
-	// Format: IMAGE_LOADED:<media_type>:<size_kb>:<base64_data>
-	sizeKB := float64(sizeBytes) / 1024
-	return fmt.Sprintf("IMAGE_LOADED:%s:%.1f:%s", mediaType, sizeKB, encoded), nil
+	sample := data[:min(len(data), 8192)]
+	if !complete || len(data) > len(sample) {
+		// Allow a character split by the end of the sample
+		for i := 0; i < utf8.UTFMax && len(sample) > 0 && !utf8.Valid(sample); i++ {
+			sample = sample[:len(sample)-1]
+		}
+	}
+	if utf8.Valid(sample) && !bytes.ContainsRune(sample, 0) {
+		return includeText, "text/plain"
+	}
+	return includeBinary, detected
 }
 
 func isValidImageType(mediaType string) bool {
@@ -126,22 +312,44 @@ func isValidImageType(mediaType string) bool {
 	return false
 }
 
-func detectMediaType(ext string) string {
-	switch ext {
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".png":
-		return "image/png"
-	case ".webp":
-		return "image/webp"
-	case ".gif":
-		return "image/gif"
+func fileError(path string, err error) error {
+	if os.IsNotExist(err) {
+		return fmt.Errorf("file '%s' not found. Use list_files or glob to find available files", path)
+	}
+	if os.IsPermission(err) {
+		return fmt.Errorf("permission denied reading '%s'. Check file permissions", path)
+	}
+	return fmt.Errorf("failed to read file '%s': %w", path, err)
+}
+
+func unsupportedError(path, mediaType string) error {
+	return fmt.Errorf("'%s' is a binary file (%s) that can't be included. Supported: images (jpg, png, gif, webp), PDFs, text and source files, and directories", path, mediaType)
+}
+
+func tooLargeError(kind string, size, limit int64) error {
+	switch kind {
+	case includeImage:
+		return fmt.Errorf("image too large (%.1f MB). Maximum is %d MB (CLYDE_INCLUDE_MAX_IMAGE_MB)", float64(size)/(1024*1024), limit/(1024*1024))
 	default:
-		return ""
+		return fmt.Errorf("PDF too large (%.1f MB). Maximum is %d MB (CLYDE_INCLUDE_MAX_PDF_MB)", float64(size)/(1024*1024), limit/(1024*1024))
 	}
 }
 
 func displayIncludeFile(input map[string]interface{}) string {
 	path, _ := input["path"].(string)
+	if pages, _ := input["pages"].(string); pages != "" {
+		return fmt.Sprintf("→ Including file: %s (pages %s)", path, pages)
+	}
+	if glob, _ := input["glob"].(string); glob != "" {
+		return fmt.Sprintf("→ Including file: %s (%s)", path, glob)
+	}
+	if _, ok := input["crop"].(map[string]interface{}); ok {
+		return fmt.Sprintf("→ Including file: %s (cropped)", path)
+	}
 	return fmt.Sprintf("→ Including file: %s", path)
 }
+
+// displayName shortens a local path for headers
+func displayName(path string) string {
+	return filepath.ToSlash(filepath.Clean(path))
+}
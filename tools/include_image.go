@@ -0,0 +1,223 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register the WebP decoder
+)
+
+// Images are decoded, optionally cropped, scaled down to a maximum edge and
+// re-encoded when that makes them smaller. The API scales anything with a
+// long edge over 1568 pixels down anyway, so sending more only costs
+// upload size and tokens.
+
+const (
+	defaultImageMaxEdge    = 1568
+	defaultImageJPEGQ      = 85
+	defaultReencodeKB      = 300
+	maxImageUploadBytes    = 5 * 1024 * 1024
+	maxImagePixels         = 100_000_000
+	imageTokenPixelDivisor = 750
+)
+
+// imageOptions are the per-call image settings
+type imageOptions struct {
+	maxEdge int
+	crop    *image.Rectangle // in original pixel coordinates
+}
+
+// processedImage is what will be sent, with notes on how it got there
+type processedImage struct {
+	data                  []byte
+	mediaType             string
+	origWidth, origHeight int
+	width, height         int
+	origSize              int
+	cropped, scaled       bool
+	reencodedFrom         string // original media type, when the format changed
+}
+
+// processImage applies crop, downscaling and re-encoding. An image that
+// needs none of them is passed through byte for byte.
+func processImage(data []byte, mediaType string, opts imageOptions) (*processedImage, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image (%s): %w", mediaType, err)
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, fmt.Errorf("image is %d×%d pixels, more than %d megapixels. Crop or resize it before including it", cfg.Width, cfg.Height, maxImagePixels/1_000_000)
+	}
+	result := &processedImage{
+		data: data, mediaType: mediaType,
+		origWidth: cfg.Width, origHeight: cfg.Height,
+		width: cfg.Width, height: cfg.Height,
+		origSize: len(data),
+	}
+
+	maxEdge := opts.maxEdge
+	if maxEdge <= 0 {
+		maxEdge = envInt("CLYDE_IMAGE_MAX_EDGE", defaultImageMaxEdge)
+	}
+	reencodeBytes := envInt("CLYDE_IMAGE_REENCODE_KB", defaultReencodeKB) * 1024
+	needsScale := maxEdge > 0 && max(cfg.Width, cfg.Height) > maxEdge
+	needsReencode := format == "png" && len(data) > reencodeBytes
+	if opts.crop == nil && !needsScale && !needsReencode && len(data) <= maxImageUploadBytes {
+		return result, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image (%s): %w", mediaType, err)
+	}
+
+	if opts.crop != nil {
+		region := opts.crop.Intersect(img.Bounds())
+		if region.Empty() {
+			return nil, fmt.Errorf("crop region %d,%d %d×%d is outside the %d×%d image",
+				opts.crop.Min.X, opts.crop.Min.Y, opts.crop.Dx(), opts.crop.Dy(), cfg.Width, cfg.Height)
+		}
+		if sub, ok := img.(interface {
+			SubImage(image.Rectangle) image.Image
+		}); ok {
+			img = sub.SubImage(region)
+		} else {
+			dst := image.NewRGBA(image.Rect(0, 0, region.Dx(), region.Dy()))
+			draw.Copy(dst, image.Point{}, img, region, draw.Src, nil)
+			img = dst
+		}
+		result.cropped = true
+	}
+
+	bounds := img.Bounds()
+	if maxEdge > 0 && max(bounds.Dx(), bounds.Dy()) > maxEdge {
+		w, h := scaledSize(bounds.Dx(), bounds.Dy(), maxEdge)
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+		img = dst
+		result.scaled = true
+	}
+	result.width, result.height = img.Bounds().Dx(), img.Bounds().Dy()
+
+	// Keep the original format where we can encode it; WebP has no Go
+	// encoder and GIF palettes would band, so those become PNG
+	outType := mediaType
+	if format != "jpeg" && format != "png" {
+		outType = "image/png"
+	}
+	encoded, err := encodeImage(img, outType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Photos and screenshots saved as PNG are often far smaller as JPEG.
+	// Only opaque images qualify, since JPEG has no alpha channel.
+	if outType == "image/png" && len(encoded) > reencodeBytes && isOpaque(img) {
+		if alt, err := encodeImage(img, "image/jpeg"); err == nil && len(alt) < len(encoded) {
+			encoded, outType = alt, "image/jpeg"
+		}
+	}
+
+	// An untouched image that didn't get smaller is sent as it was
+	if !result.cropped && !result.scaled && len(encoded) >= len(data) {
+		if len(data) > maxImageUploadBytes {
+			return nil, imageTooLarge(len(data))
+		}
+		return result, nil
+	}
+	if len(encoded) > maxImageUploadBytes {
+		return nil, imageTooLarge(len(encoded))
+	}
+	if outType != mediaType {
+		result.reencodedFrom = mediaType
+	}
+	result.data, result.mediaType = encoded, outType
+	return result, nil
+}
+
+// scaledSize fits w×h within maxEdge on the long side, keeping the aspect
+// ratio
+func scaledSize(w, h, maxEdge int) (int, int) {
+	if w >= h {
+		return maxEdge, max(1, (h*maxEdge+w/2)/w)
+	}
+	return max(1, (w*maxEdge+h/2)/h), maxEdge
+}
+
+func encodeImage(img image.Image, mediaType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch mediaType {
+	case "image/jpeg":
+		quality := envInt("CLYDE_IMAGE_JPEG_QUALITY", defaultImageJPEGQ)
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: min(max(quality, 1), 100)})
+	default:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// isOpaque reports whether an image has no transparent pixels
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// imageTokens estimates the input tokens an image costs: width × height /
+// 750, per the vision documentation
+func imageTokens(w, h int) int {
+	return (w*h + imageTokenPixelDivisor - 1) / imageTokenPixelDivisor
+}
+
+func imageTooLarge(size int) error {
+	return fmt.Errorf("image too large (%.1f MB) even after processing. Maximum is 5MB. Lower max_edge or crop a region", float64(size)/(1024*1024))
+}
+
+// loadImage processes an image and base64-encodes it into the marker the
+// agent turns into an image block. Format:
+// IMAGE_LOADED:<media_type>:<details>:<base64_data>, where details is a
+// human-readable summary without colons.
+func loadImage(data []byte, mediaType string, opts imageOptions) (string, error) {
+	img, err := processImage(data, mediaType, opts)
+	if err != nil {
+		return "", err
+	}
+
+	details := []string{fmt.Sprintf("%.1f KB", float64(len(img.data))/1024)}
+	if img.width != img.origWidth || img.height != img.origHeight {
+		details = append(details, fmt.Sprintf("%d×%d → %d×%d", img.origWidth, img.origHeight, img.width, img.height))
+	} else {
+		details = append(details, fmt.Sprintf("%d×%d", img.width, img.height))
+	}
+	var notes []string
+	if img.cropped {
+		notes = append(notes, "cropped")
+	}
+	if img.scaled {
+		notes = append(notes, "downscaled")
+	}
+	if img.reencodedFrom != "" {
+		notes = append(notes, "re-encoded from "+strings.TrimPrefix(img.reencodedFrom, "image/"))
+	}
+	if len(img.data) != img.origSize {
+		notes = append(notes, fmt.Sprintf("was %.1f KB", float64(img.origSize)/1024))
+	}
+	if len(notes) > 0 {
+		details = append(details, strings.Join(notes, ", "))
+	}
+	details = append(details, fmt.Sprintf("~%d tokens", imageTokens(img.width, img.height)))
+
+	encoded := base64.StdEncoding.EncodeToString(img.data)
+	return fmt.Sprintf("IMAGE_LOADED:%s:%s:%s", img.mediaType, strings.Join(details, " · "), encoded), nil
+}
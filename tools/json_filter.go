@@ -0,0 +1,459 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A small subset of jq for narrowing JSON responses before they reach the
+// context window. Supported:
+//
+//	.                identity
+//	.foo .foo.bar    object fields (."odd key" and .["odd key"] too)
+//	.[0] .[-1]       array elements
+//	.[2:5]           array slices
+//	.[] .foo[]       iterate arrays and object values
+//	a | b            pipes
+//	keys, length     builtins
+//	select(cond)     keep inputs where cond is true; cond is a path, or
+//	                 a path compared to a literal with == != < <= > >=
+//
+// Appending ? to a step suppresses its type errors, as in jq.
+
+type jsonFilter []jsonStage
+
+type jsonStage interface {
+	apply(v interface{}) ([]interface{}, error)
+}
+
+// parseJSONFilter compiles expr. Errors name the offending part.
+func parseJSONFilter(expr string) (jsonFilter, error) {
+	var filter jsonFilter
+	for _, part := range splitTopLevel(expr, '|') {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty step in filter '%s'", expr)
+		}
+		stage, err := parseJSONStage(part)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, stage)
+	}
+	return filter, nil
+}
+
+// run applies the filter to v and returns every output
+func (f jsonFilter) run(v interface{}) ([]interface{}, error) {
+	values := []interface{}{v}
+	for _, stage := range f {
+		var next []interface{}
+		for _, in := range values {
+			out, err := stage.apply(in)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, out...)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+func parseJSONStage(s string) (jsonStage, error) {
+	switch {
+	case s == "keys":
+		return keysStage{}, nil
+	case s == "length":
+		return lengthStage{}, nil
+	case strings.HasPrefix(s, "select(") && strings.HasSuffix(s, ")"):
+		return parseSelect(s[len("select(") : len(s)-1])
+	case strings.HasPrefix(s, "."):
+		return parsePath(s)
+	}
+	return nil, fmt.Errorf("unsupported filter step '%s'. Supported: .field, .[n], .[a:b], .[], |, keys, length, select(...)", s)
+}
+
+// pathStep is one segment of a path expression
+type pathStep struct {
+	field    *string // .foo or .["foo"]
+	index    *int    // .[n]
+	slice    *[2]*int
+	iterate  bool // .[]
+	optional bool // trailing ?
+}
+
+type pathStage []pathStep
+
+func parsePath(s string) (pathStage, error) {
+	var path pathStage
+	i := 0
+	for i < len(s) {
+		var step pathStep
+		switch {
+		case s[i] == '.' && i+1 < len(s) && s[i+1] == '"':
+			end := strings.IndexByte(s[i+2:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted field in '%s'", s)
+			}
+			name := s[i+2 : i+2+end]
+			step.field = &name
+			i += end + 3
+		case s[i] == '.' && i+1 < len(s) && isFieldChar(s[i+1]):
+			j := i + 1
+			for j < len(s) && isFieldChar(s[j]) {
+				j++
+			}
+			name := s[i+1 : j]
+			step.field = &name
+			i = j
+		case s[i] == '.' && (i+1 == len(s) || s[i+1] == '['):
+			i++ // bare dot: identity, or the lead-in to a bracket
+			continue
+		case s[i] == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("missing ] in '%s'", s)
+			}
+			if err := parseBracket(strings.TrimSpace(s[i+1:i+end]), &step); err != nil {
+				return nil, fmt.Errorf("%v in '%s'", err, s)
+			}
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("unexpected '%c' at position %d in '%s'", s[i], i, s)
+		}
+		if i < len(s) && s[i] == '?' {
+			step.optional = true
+			i++
+		}
+		path = append(path, step)
+	}
+	return path, nil
+}
+
+func parseBracket(inner string, step *pathStep) error {
+	switch {
+	case inner == "":
+		step.iterate = true
+	case strings.HasPrefix(inner, `"`):
+		name, err := strconv.Unquote(inner)
+		if err != nil {
+			return fmt.Errorf("bad quoted key %s", inner)
+		}
+		step.field = &name
+	case strings.Contains(inner, ":"):
+		parts := strings.SplitN(inner, ":", 2)
+		var bounds [2]*int
+		for k, p := range parts {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return fmt.Errorf("bad slice bound '%s'", p)
+			}
+			bounds[k] = &n
+		}
+		step.slice = &bounds
+	default:
+		n, err := strconv.Atoi(inner)
+		if err != nil {
+			return fmt.Errorf("bad index '%s'", inner)
+		}
+		step.index = &n
+	}
+	return nil
+}
+
+func isFieldChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p pathStage) apply(v interface{}) ([]interface{}, error) {
+	values := []interface{}{v}
+	for _, step := range p {
+		var next []interface{}
+		for _, in := range values {
+			out, err := step.apply(in)
+			if err != nil {
+				if step.optional {
+					continue
+				}
+				return nil, err
+			}
+			next = append(next, out...)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+func (s pathStep) apply(v interface{}) ([]interface{}, error) {
+	switch {
+	case s.field != nil:
+		switch obj := v.(type) {
+		case nil:
+			return []interface{}{nil}, nil
+		case map[string]interface{}:
+			return []interface{}{obj[*s.field]}, nil
+		}
+		return nil, fmt.Errorf("cannot index %s with \"%s\"", jsonTypeName(v), *s.field)
+
+	case s.index != nil:
+		switch arr := v.(type) {
+		case nil:
+			return []interface{}{nil}, nil
+		case []interface{}:
+			i := *s.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i >= len(arr) {
+				return []interface{}{nil}, nil
+			}
+			return []interface{}{arr[i]}, nil
+		}
+		return nil, fmt.Errorf("cannot index %s with number", jsonTypeName(v))
+
+	case s.slice != nil:
+		switch arr := v.(type) {
+		case nil:
+			return []interface{}{nil}, nil
+		case []interface{}:
+			start, end := sliceBounds(*s.slice, len(arr))
+			return []interface{}{arr[start:end]}, nil
+		}
+		return nil, fmt.Errorf("cannot slice %s", jsonTypeName(v))
+
+	case s.iterate:
+		switch c := v.(type) {
+		case []interface{}:
+			return c, nil
+		case map[string]interface{}:
+			var out []interface{}
+			for _, k := range sortedKeys(c) {
+				out = append(out, c[k])
+			}
+			return out, nil
+		}
+		return nil, fmt.Errorf("cannot iterate over %s", jsonTypeName(v))
+	}
+	return []interface{}{v}, nil
+}
+
+func sliceBounds(bounds [2]*int, n int) (int, int) {
+	clamp := func(b *int, def int) int {
+		if b == nil {
+			return def
+		}
+		i := *b
+		if i < 0 {
+			i += n
+		}
+		return min(max(i, 0), n)
+	}
+	start, end := clamp(bounds[0], 0), clamp(bounds[1], n)
+	if end < start {
+		end = start
+	}
+	return start, end
+}
+
+type keysStage struct{}
+
+func (keysStage) apply(v interface{}) ([]interface{}, error) {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		var keys []interface{}
+		for _, k := range sortedKeys(c) {
+			keys = append(keys, k)
+		}
+		return []interface{}{keys}, nil
+	case []interface{}:
+		keys := make([]interface{}, len(c))
+		for i := range c {
+			keys[i] = json.Number(strconv.Itoa(i))
+		}
+		return []interface{}{keys}, nil
+	}
+	return nil, fmt.Errorf("%s has no keys", jsonTypeName(v))
+}
+
+type lengthStage struct{}
+
+func (lengthStage) apply(v interface{}) ([]interface{}, error) {
+	var n int
+	switch c := v.(type) {
+	case nil:
+		n = 0
+	case map[string]interface{}:
+		n = len(c)
+	case []interface{}:
+		n = len(c)
+	case string:
+		n = len([]rune(c))
+	default:
+		return nil, fmt.Errorf("%s has no length", jsonTypeName(v))
+	}
+	return []interface{}{json.Number(strconv.Itoa(n))}, nil
+}
+
+// selectStage keeps its input when the condition holds
+type selectStage struct {
+	lhs jsonFilter
+	op  string      // empty means "lhs is truthy"
+	rhs interface{} // literal
+}
+
+var selectOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func parseSelect(cond string) (jsonStage, error) {
+	for _, op := range selectOps {
+		if i := strings.Index(cond, op); i >= 0 {
+			lhs, err := parseJSONFilter(cond[:i])
+			if err != nil {
+				return nil, err
+			}
+			literal := strings.TrimSpace(cond[i+len(op):])
+			dec := json.NewDecoder(strings.NewReader(literal))
+			dec.UseNumber()
+			var rhs interface{}
+			if err := dec.Decode(&rhs); err != nil {
+				return nil, fmt.Errorf("select: right side of %s must be a JSON literal (\"text\", 42, true, null), got '%s'", op, literal)
+			}
+			return selectStage{lhs: lhs, op: op, rhs: rhs}, nil
+		}
+	}
+	lhs, err := parseJSONFilter(cond)
+	if err != nil {
+		return nil, err
+	}
+	return selectStage{lhs: lhs}, nil
+}
+
+func (s selectStage) apply(v interface{}) ([]interface{}, error) {
+	results, err := s.lhs.run(v)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if s.holds(r) {
+			return []interface{}{v}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s selectStage) holds(v interface{}) bool {
+	if s.op == "" {
+		return v != nil && v != false
+	}
+	cmp, comparable := compareJSON(v, s.rhs)
+	switch s.op {
+	case "==":
+		return comparable && cmp == 0
+	case "!=":
+		return !comparable || cmp != 0
+	case "<":
+		return comparable && cmp < 0
+	case "<=":
+		return comparable && cmp <= 0
+	case ">":
+		return comparable && cmp > 0
+	case ">=":
+		return comparable && cmp >= 0
+	}
+	return false
+}
+
+// compareJSON orders two scalars of the same type. Values of different
+// types, and non-scalars, are only comparable for equality.
+func compareJSON(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return 0, false
+		}
+		fx, _ := x.Float64()
+		fy, _ := y.Float64()
+		switch {
+		case fx < fy:
+			return -1, true
+		case fx > fy:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	}
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	if bytes.Equal(ja, jb) {
+		return 0, true
+	}
+	return 0, false
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitTopLevel splits s on sep, ignoring separators inside quotes,
+// brackets and parentheses
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	inString := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
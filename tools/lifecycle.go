@@ -0,0 +1,28 @@
+package tools
+
+import "sync"
+
+var (
+	cleanupMu sync.Mutex
+	cleanups  []func()
+)
+
+// registerCleanup adds a function to run when Shutdown is called. Tools that
+// hold long-lived resources (shell sessions, child processes) use this.
+func registerCleanup(fn func()) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	cleanups = append(cleanups, fn)
+}
+
+// Shutdown releases long-lived resources held by tools. Call it when the
+// agent session ends.
+func Shutdown() {
+	cleanupMu.Lock()
+	fns := cleanups
+	cleanupMu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
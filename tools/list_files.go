@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strings"
 )
 
@@ -35,7 +37,10 @@ func executeListFiles(input map[string]interface{}, apiClient *api.Client, conve
 	if path == "" {
 		path = "."
 	}
-	
+	if err := checkWorkspacePath(path); err != nil {
+		return "", err
+	}
+
 	cmd := exec.Command("ls", "-la", path)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -49,9 +54,40 @@ func executeListFiles(input map[string]interface{}, apiClient *api.Client, conve
 		}
 		return "", fmt.Errorf("failed to list files in '%s': %s\nOutput: %s", path, err, string(output))
 	}
-	return string(output), nil
+
+	// Drop entries the workspace policy denies (.env and the like)
+	denied := make(map[string]bool)
+	if entries, err := os.ReadDir(path); err == nil {
+		policy := currentWorkspacePolicy()
+		for _, e := range entries {
+			if policy.isDenied(filepath.Join(path, e.Name())) {
+				denied[e.Name()] = true
+			}
+		}
+	}
+	if len(denied) == 0 {
+		return string(output), nil
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		if m := lsEntryName.FindStringSubmatch(line); m != nil {
+			if name, _, _ := strings.Cut(m[1], " -> "); denied[name] {
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+	entries := "entries"
+	if len(denied) == 1 {
+		entries = "entry"
+	}
+	return fmt.Sprintf("%s\n\n(%d %s blocked by CLYDE_FILE_DENY omitted)\n", strings.Join(lines, "\n"), len(denied), entries), nil
 }
 
+// lsEntryName captures the name in a line of ls -la output, after the mode,
+// links, owner, group, size and date columns
+var lsEntryName = regexp.MustCompile(`^\S+\s+\d+\s+\S+\s+\S+\s+\S+\s+\S+\s+\S+\s+\S+\s+(.+)$`)
+
 func displayListFiles(input map[string]interface{}) string {
 	path := ""
 	if pathVal, ok := input["path"]; ok && pathVal != nil {
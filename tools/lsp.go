@@ -0,0 +1,984 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/this-is-alpha-iota/clyde/api"
+)
+
+func init() {
+	Register(lspTool, executeLSP, displayLSP)
+	registerCleanup(stopAllLSPClients)
+}
+
+var lspTool = api.Tool{
+	Name:        "lsp",
+	Description: "Ask the language server for a file's language (gopls, pyright, typescript-language-server, rust-analyzer, clangd or any configured one). Actions: 'diagnostics' (compiler and linter errors for a file), 'definition', 'references', 'hover' (type and docs), 'document_symbols' (outline of a file), 'workspace_symbols' (find symbols by name across the project) and 'rename' (preview every edit a rename would make, without writing). Positions are 1-based line and column; instead of column you can give the symbol name on that line. 'servers' lists configured and running servers, 'stop' shuts them down. Servers start on first use per workspace and keep running between calls.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"diagnostics", "definition", "references", "hover", "document_symbols", "workspace_symbols", "rename", "servers", "stop"},
+				"description": "What to ask",
+			},
+			"file": map[string]interface{}{
+				"type":        "string",
+				"description": "The file to ask about. Its extension picks the language server and its project root the workspace",
+			},
+			"line": map[string]interface{}{
+				"type":        "integer",
+				"description": "1-based line, for definition, references, hover and rename",
+			},
+			"column": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional 1-based column in characters. Defaults to where symbol appears on the line",
+			},
+			"symbol": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: the identifier on that line to ask about, instead of column",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "For workspace_symbols: the name or part of it to search for",
+			},
+			"new_name": map[string]interface{}{
+				"type":        "string",
+				"description": "For rename: the new name",
+			},
+			"wait_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": "For diagnostics: how long to wait for the server to analyze the file (default 5, max 30)",
+			},
+		},
+		"required": []string{"action"},
+	},
+}
+
+// lspServerConfig describes a language server and the files it handles
+type lspServerConfig struct {
+	name        string // shown in messages; the command's base name
+	extensions  []string
+	command     []string
+	rootMarkers []string // files marking a project root, nearest wins
+	installHint string
+	initOptions interface{}
+}
+
+// defaultLSPServers are used when their command is installed.
+// CLYDE_LSP_SERVERS overrides them per extension.
+var defaultLSPServers = []lspServerConfig{
+	{extensions: []string{"go"}, command: []string{"gopls"}, rootMarkers: []string{"go.work", "go.mod"},
+		installHint: "go install golang.org/x/tools/gopls@latest"},
+	{extensions: []string{"py", "pyi"}, command: []string{"pyright-langserver", "--stdio"},
+		rootMarkers: []string{"pyproject.toml", "pyrightconfig.json", "setup.py", "setup.cfg", "requirements.txt"},
+		installHint: "npm install -g pyright"},
+	{extensions: []string{"ts", "tsx", "js", "jsx", "mjs", "cjs"}, command: []string{"typescript-language-server", "--stdio"},
+		rootMarkers: []string{"tsconfig.json", "jsconfig.json", "package.json"},
+		installHint: "npm install -g typescript typescript-language-server"},
+	{extensions: []string{"rs"}, command: []string{"rust-analyzer"}, rootMarkers: []string{"Cargo.toml"},
+		installHint: "rustup component add rust-analyzer"},
+	{extensions: []string{"c", "h", "cc", "cpp", "cxx", "hpp"}, command: []string{"clangd"},
+		rootMarkers: []string{"compile_commands.json", "compile_flags.txt", ".clangd"},
+		installHint: "install clangd from your package manager"},
+}
+
+// lspLanguageIDs are the LSP language identifiers that differ from the
+// code fence names in languageByExt
+var lspLanguageIDs = map[string]string{
+	"tsx": "typescriptreact", "jsx": "javascriptreact", "mjs": "javascript", "cjs": "javascript",
+	"h": "c", "cc": "cpp", "cxx": "cpp", "hpp": "cpp", "pyi": "python",
+}
+
+const (
+	defaultLSPIdleMinutes = 30
+	defaultLSPMaxServers  = 4
+	defaultLSPWaitSeconds = 5
+	maxLSPWaitSeconds     = 30
+	maxLSPResults         = 200
+)
+
+var (
+	lspMu      sync.Mutex
+	lspClients = make(map[string]*lspClient) // by server name and workspace root
+)
+
+// lspServers returns the server configuration: the defaults, with
+// CLYDE_LSP_SERVERS entries replacing them per extension. The setting is
+// a semicolon-separated list of "ext1,ext2=command args"; a command of
+// "off" disables the extensions.
+func lspServers() map[string]*lspServerConfig {
+	byExt := make(map[string]*lspServerConfig)
+	for i := range defaultLSPServers {
+		s := defaultLSPServers[i]
+		s.name = filepath.Base(s.command[0])
+		for _, ext := range s.extensions {
+			byExt[ext] = &s
+		}
+	}
+	for _, entry := range strings.Split(os.Getenv("CLYDE_LSP_SERVERS"), ";") {
+		exts, command, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(command)
+		var s *lspServerConfig
+		if len(fields) > 0 && fields[0] != "off" {
+			fields[0] = expandHome(fields[0])
+			s = &lspServerConfig{name: filepath.Base(fields[0]), command: fields, rootMarkers: []string{".git"}}
+			// Keep the root markers of a default server with the same command
+			for _, d := range defaultLSPServers {
+				if filepath.Base(d.command[0]) == s.name {
+					s.rootMarkers, s.installHint = d.rootMarkers, d.installHint
+				}
+			}
+		}
+		for _, ext := range strings.Split(exts, ",") {
+			ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+			if ext == "" {
+				continue
+			}
+			if s == nil {
+				delete(byExt, ext)
+				continue
+			}
+			s.extensions = append(s.extensions, ext)
+			byExt[ext] = s
+		}
+	}
+	return byExt
+}
+
+// lspServerFor picks the server for a file by its extension
+func lspServerFor(path string) (*lspServerConfig, error) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	server := lspServers()[ext]
+	if server == nil {
+		return nil, fmt.Errorf("no language server is configured for .%s files. Add one to CLYDE_LSP_SERVERS in ~/.clyde/config, e.g. CLYDE_LSP_SERVERS=\"%s=my-language-server --stdio\"", ext, ext)
+	}
+	if _, err := exec.LookPath(server.command[0]); err != nil {
+		hint := " Install it or"
+		if server.installHint != "" {
+			hint = " Install it (" + server.installHint + ") or"
+		}
+		return nil, fmt.Errorf("language server '%s' for .%s files is not installed (not found in PATH).%s point CLYDE_LSP_SERVERS at it", server.name, ext, hint)
+	}
+	return server, nil
+}
+
+func lspLanguageID(path string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if id := lspLanguageIDs[ext]; id != "" {
+		return id
+	}
+	if lang := languageByExt[ext]; lang != "" {
+		return lang
+	}
+	return ext
+}
+
+// findLSPRoot walks up from a file to the nearest directory holding one of
+// the server's root markers, falling back to the workspace root that
+// contains the file
+func findLSPRoot(path string, markers []string) string {
+	abs, _ := filepath.Abs(path)
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		for _, marker := range markers {
+			if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+				return dir
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	for _, root := range workspaceRoots() {
+		if isWithin(abs, root) {
+			return root
+		}
+	}
+	return filepath.Dir(abs)
+}
+
+func lspRootFor(path string, server *lspServerConfig) string {
+	return findLSPRoot(path, append(append([]string{}, server.rootMarkers...), ".git"))
+}
+
+// lspClientFor returns the running server for a file's workspace, starting
+// it if needed. Servers idle longer than CLYDE_LSP_IDLE_MINUTES are shut
+// down, and the least recently used one makes way when
+// CLYDE_LSP_MAX_SERVERS are running.
+func lspClientFor(path string) (*lspClient, error) {
+	server, err := lspServerFor(path)
+	if err != nil {
+		return nil, err
+	}
+	root := lspRootFor(path, server)
+	key := server.name + "\x00" + root
+
+	lspMu.Lock()
+	var stale []*lspClient
+	idle := time.Duration(envInt("CLYDE_LSP_IDLE_MINUTES", defaultLSPIdleMinutes)) * time.Minute
+	for k, c := range lspClients {
+		c.mu.Lock()
+		unused := time.Since(c.lastUsed)
+		c.mu.Unlock()
+		if !c.alive() || k != key && idle > 0 && unused > idle {
+			stale = append(stale, c)
+			delete(lspClients, k)
+		}
+	}
+	client := lspClients[key]
+	if client == nil && len(lspClients) >= envInt("CLYDE_LSP_MAX_SERVERS", defaultLSPMaxServers) {
+		var oldestKey string
+		var oldest time.Time
+		for k, c := range lspClients {
+			c.mu.Lock()
+			if oldestKey == "" || c.lastUsed.Before(oldest) {
+				oldestKey, oldest = k, c.lastUsed
+			}
+			c.mu.Unlock()
+		}
+		stale = append(stale, lspClients[oldestKey])
+		delete(lspClients, oldestKey)
+	}
+	lspMu.Unlock()
+	for _, c := range stale {
+		c.shutdown()
+	}
+	if client != nil {
+		return client, nil
+	}
+
+	reportProgress("🧠 Starting %s for %s...", server.name, root)
+	client, err = startLSPClient(server, root)
+	if err != nil {
+		return nil, err
+	}
+	lspMu.Lock()
+	if existing := lspClients[key]; existing != nil && existing.alive() {
+		// Another call started one first
+		lspMu.Unlock()
+		client.shutdown()
+		return existing, nil
+	}
+	lspClients[key] = client
+	lspMu.Unlock()
+	return client, nil
+}
+
+// stopAllLSPClients shuts down every language server
+func stopAllLSPClients() {
+	lspMu.Lock()
+	clients := make([]*lspClient, 0, len(lspClients))
+	for k, c := range lspClients {
+		clients = append(clients, c)
+		delete(lspClients, k)
+	}
+	lspMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *lspClient) {
+			defer wg.Done()
+			c.shutdown()
+		}(c)
+	}
+	wg.Wait()
+}
+
+func executeLSP(input map[string]interface{}, apiClient *api.Client, history []api.Message) (string, error) {
+	action, _ := input["action"].(string)
+	file, _ := input["file"].(string)
+	switch action {
+	case "servers":
+		return lspStatus(), nil
+	case "stop":
+		return lspStop(file)
+	case "workspace_symbols":
+		return lspWorkspaceSymbols(input, file)
+	case "diagnostics", "definition", "references", "hover", "document_symbols", "rename":
+	case "":
+		return "", fmt.Errorf("action is required. Example: lsp(action=\"diagnostics\", file=\"main.go\")")
+	default:
+		return "", fmt.Errorf("unknown action '%s'. Use diagnostics, definition, references, hover, document_symbols, workspace_symbols, rename, servers or stop", action)
+	}
+
+	if file == "" {
+		return "", fmt.Errorf("file is required for %s", action)
+	}
+	if err := checkWorkspacePath(file); err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(file); err != nil {
+		return "", fileError(file, err)
+	} else if info.IsDir() {
+		return "", fmt.Errorf("'%s' is a directory; lsp works on one file", file)
+	}
+	client, err := lspClientFor(file)
+	if err != nil {
+		return "", err
+	}
+	text, uri, err := client.syncDocument(file)
+	if err != nil {
+		return "", err
+	}
+	doc := textDocumentParams(uri)
+
+	switch action {
+	case "diagnostics":
+		wait := defaultLSPWaitSeconds
+		if v, ok := input["wait_seconds"].(float64); ok && v >= 0 {
+			wait = min(int(v), maxLSPWaitSeconds)
+		}
+		diags, complete, err := client.fileDiagnostics(uri, time.Duration(wait)*time.Second)
+		if err != nil {
+			return "", err
+		}
+		return formatDiagnostics(client, file, text, diags, complete), nil
+	case "document_symbols":
+		var raw json.RawMessage
+		if err := client.call("textDocument/documentSymbol", doc, &raw); err != nil {
+			return "", err
+		}
+		return formatDocumentSymbols(client, file, text, raw), nil
+	}
+
+	pos, err := lspPositionFor(client, input, text)
+	if err != nil {
+		return "", err
+	}
+	doc["position"] = pos
+
+	switch action {
+	case "definition":
+		var raw json.RawMessage
+		if err := client.call("textDocument/definition", doc, &raw); err != nil {
+			return "", err
+		}
+		locations := parseLocations(raw)
+		if len(locations) == 0 {
+			return "No definition found at that position. Check line and column (or symbol).", nil
+		}
+		return "Definition:\n" + formatLocations(client, locations), nil
+	case "references":
+		doc["context"] = map[string]interface{}{"includeDeclaration": true}
+		var raw json.RawMessage
+		if err := client.call("textDocument/references", doc, &raw); err != nil {
+			return "", err
+		}
+		locations := parseLocations(raw)
+		if len(locations) == 0 {
+			return "No references found at that position.", nil
+		}
+		return fmt.Sprintf("References (%d, including the declaration):\n%s", len(locations), formatLocations(client, locations)), nil
+	case "hover":
+		var result struct {
+			Contents json.RawMessage `json:"contents"`
+		}
+		if err := client.call("textDocument/hover", doc, &result); err != nil {
+			return "", err
+		}
+		if hover := hoverText(result.Contents); hover != "" {
+			return hover, nil
+		}
+		return "No hover information at that position.", nil
+	case "rename":
+		newName, _ := input["new_name"].(string)
+		if newName == "" {
+			return "", fmt.Errorf("new_name is required for rename")
+		}
+		return lspRenamePreview(client, doc, text, pos, newName)
+	}
+	return "", nil
+}
+
+func textDocumentParams(uri string) map[string]interface{} {
+	return map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}}
+}
+
+// lspPositionFor turns line plus column or symbol into a server position.
+// Without either, the first non-blank character of the line is used.
+func lspPositionFor(client *lspClient, input map[string]interface{}, text string) (lspPosition, error) {
+	lineF, _ := input["line"].(float64)
+	line := int(lineF)
+	lines := strings.Count(text, "\n") + 1
+	if line < 1 || line > lines {
+		return lspPosition{}, fmt.Errorf("line is required and must be between 1 and %d", lines)
+	}
+	lineText := lineAt(text, line-1)
+	column := 0
+	if v, ok := input["column"].(float64); ok && v >= 1 {
+		column = int(v)
+	} else if symbol, _ := input["symbol"].(string); symbol != "" {
+		if i := strings.LastIndex(symbol, "."); i >= 0 && i < len(symbol)-1 {
+			symbol = symbol[i+1:]
+		}
+		column = findWord(lineText, symbol)
+		if column == 0 {
+			return lspPosition{}, fmt.Errorf("'%s' does not appear on line %d: %s", symbol, line, strings.TrimSpace(lineText))
+		}
+	} else {
+		column = 1 + utf8.RuneCountInString(lineText) - utf8.RuneCountInString(strings.TrimLeftFunc(lineText, unicode.IsSpace))
+	}
+	return client.toLSPPosition(text, line, column), nil
+}
+
+// findWord returns the 1-based character column of the first whole-word
+// occurrence of word in line, or 0
+func findWord(line, word string) int {
+	isIdent := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	for start := 0; start <= len(line)-len(word); {
+		i := strings.Index(line[start:], word)
+		if i < 0 {
+			return 0
+		}
+		i += start
+		before, _ := utf8.DecodeLastRuneInString(line[:i])
+		after, _ := utf8.DecodeRuneInString(line[i+len(word):])
+		if (i == 0 || !isIdent(before)) && (i+len(word) == len(line) || !isIdent(after)) {
+			return utf8.RuneCountInString(line[:i]) + 1
+		}
+		start = i + 1
+	}
+	return 0
+}
+
+// fileDiagnostics gets a synced document's diagnostics, pulling them when
+// the server supports it and otherwise waiting for the server to publish
+// them. complete is false when the wait ran out first.
+func (c *lspClient) fileDiagnostics(uri string, wait time.Duration) ([]lspDiagnostic, bool, error) {
+	if c.hasCapability("diagnosticProvider") {
+		var report struct {
+			Kind  string          `json:"kind"`
+			Items []lspDiagnostic `json:"items"`
+		}
+		if err := c.call("textDocument/diagnostic", textDocumentParams(uri), &report); err == nil && report.Kind != "unchanged" {
+			return report.Items, true, nil
+		}
+	}
+	diags, fresh := c.waitDiagnostics(uri, c.documentVersion(uri), c.started, wait)
+	return diags, fresh, nil
+}
+
+var lspSeverities = map[int]string{1: "error", 2: "warning", 3: "info", 4: "hint"}
+
+// formatDiagnostics lists diagnostics as file:line:col: severity: message
+func formatDiagnostics(client *lspClient, file, text string, diags []lspDiagnostic, complete bool) string {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i].Range.Start, diags[j].Range.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+	})
+	counts := make(map[string]int)
+	var b strings.Builder
+	for _, d := range diags {
+		severity := lspSeverities[d.Severity]
+		if severity == "" {
+			severity = "error"
+		}
+		counts[severity]++
+		b.WriteString(diagnosticLine(client, file, text, d) + "\n")
+	}
+
+	note := ""
+	if !complete {
+		note = fmt.Sprintf("\n(%s had not finished analyzing the file; raise wait_seconds for complete results)", client.server.name)
+	}
+	if len(diags) == 0 {
+		return fmt.Sprintf("No diagnostics for %s (%s).%s", displayName(file), client.server.name, note)
+	}
+	var summary []string
+	for _, sev := range []string{"error", "warning", "info", "hint"} {
+		if n := counts[sev]; n > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", n, plural(n, sev)))
+		}
+	}
+	return fmt.Sprintf("%s in %s (%s):\n%s%s", strings.Join(summary, ", "), displayName(file), client.server.name, b.String(), note)
+}
+
+// diagnosticLine renders one diagnostic as file:line:col: severity:
+// message [source code]
+func diagnosticLine(client *lspClient, file, text string, d lspDiagnostic) string {
+	severity := lspSeverities[d.Severity]
+	if severity == "" {
+		severity = "error"
+	}
+	line, col := client.fromLSPPosition(text, d.Range.Start)
+	entry := fmt.Sprintf("%s:%d:%d: %s: %s", displayName(file), line, col, severity, strings.TrimSpace(d.Message))
+	var tags []string
+	if d.Source != "" {
+		tags = append(tags, d.Source)
+	}
+	var code interface{}
+	if json.Unmarshal(d.Code, &code) == nil && code != nil {
+		tags = append(tags, fmt.Sprint(code))
+	}
+	if len(tags) > 0 {
+		entry += " [" + strings.Join(tags, " ") + "]"
+	}
+	return entry
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+// parseLocations accepts a Location, a list of Locations or a list of
+// LocationLinks
+func parseLocations(raw json.RawMessage) []lspLocation {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var items []json.RawMessage
+	if raw[0] == '[' {
+		json.Unmarshal(raw, &items)
+	} else {
+		items = []json.RawMessage{raw}
+	}
+	var out []lspLocation
+	for _, item := range items {
+		var loc struct {
+			URI                  string    `json:"uri"`
+			Range                lspRange  `json:"range"`
+			TargetURI            string    `json:"targetUri"`
+			TargetSelectionRange *lspRange `json:"targetSelectionRange"`
+		}
+		if json.Unmarshal(item, &loc) != nil {
+			continue
+		}
+		if loc.TargetURI != "" && loc.TargetSelectionRange != nil {
+			out = append(out, lspLocation{URI: loc.TargetURI, Range: *loc.TargetSelectionRange})
+		} else if loc.URI != "" {
+			out = append(out, lspLocation{URI: loc.URI, Range: loc.Range})
+		}
+	}
+	return out
+}
+
+// lspFileText reads a file a server pointed at, for converting positions
+// and showing lines
+type lspFileText map[string]string
+
+func (t lspFileText) get(uri string) string {
+	if text, ok := t[uri]; ok {
+		return text
+	}
+	data, _ := os.ReadFile(uriToPath(uri))
+	t[uri] = string(data)
+	return t[uri]
+}
+
+// formatLocations lists locations with their source lines, grouped by file
+func formatLocations(client *lspClient, locations []lspLocation) string {
+	sort.SliceStable(locations, func(i, j int) bool {
+		a, b := locations[i], locations[j]
+		if a.URI != b.URI {
+			return a.URI < b.URI
+		}
+		return a.Range.Start.Line < b.Range.Start.Line || a.Range.Start.Line == b.Range.Start.Line && a.Range.Start.Character < b.Range.Start.Character
+	})
+	texts := make(lspFileText)
+	var b strings.Builder
+	lastURI := ""
+	for i, loc := range locations {
+		if i == maxLSPResults {
+			fmt.Fprintf(&b, "... and %d more\n", len(locations)-i)
+			break
+		}
+		if lastURI != "" && loc.URI != lastURI {
+			b.WriteString("\n")
+		}
+		lastURI = loc.URI
+		text := texts.get(loc.URI)
+		line, col := client.fromLSPPosition(text, loc.Range.Start)
+		fmt.Fprintf(&b, "%s:%d:%d  %s\n", relativePath(uriToPath(loc.URI)), line, col, strings.TrimSpace(lineAt(text, loc.Range.Start.Line)))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// relativePath shortens a path relative to the working directory when it
+// is inside it
+func relativePath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return path
+}
+
+// hoverText flattens MarkupContent, a MarkedString or a list of them
+func hoverText(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return strings.TrimSpace(s)
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		var parts []string
+		for _, item := range list {
+			if text := hoverText(item); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	var obj struct {
+		Kind     string `json:"kind"`
+		Language string `json:"language"`
+		Value    string `json:"value"`
+	}
+	if json.Unmarshal(raw, &obj) != nil {
+		return ""
+	}
+	if obj.Language != "" {
+		return "```" + obj.Language + "\n" + strings.TrimSpace(obj.Value) + "\n```"
+	}
+	return strings.TrimSpace(obj.Value)
+}
+
+var lspSymbolKinds = []string{"", "file", "module", "namespace", "package", "class", "method", "property", "field",
+	"constructor", "enum", "interface", "function", "variable", "constant", "string", "number", "boolean", "array",
+	"object", "key", "null", "enum member", "struct", "event", "operator", "type parameter"}
+
+func symbolKind(kind int) string {
+	if kind > 0 && kind < len(lspSymbolKinds) {
+		return lspSymbolKinds[kind]
+	}
+	return "symbol"
+}
+
+// lspSymbol covers DocumentSymbol, SymbolInformation and WorkspaceSymbol
+type lspSymbol struct {
+	Name           string       `json:"name"`
+	Detail         string       `json:"detail"`
+	Kind           int          `json:"kind"`
+	ContainerName  string       `json:"containerName"`
+	SelectionRange *lspRange    `json:"selectionRange"`
+	Location       *lspLocation `json:"location"`
+	Children       []lspSymbol  `json:"children"`
+}
+
+// formatDocumentSymbols renders a file's symbols as an indented outline
+func formatDocumentSymbols(client *lspClient, file, text string, raw json.RawMessage) string {
+	var symbols []lspSymbol
+	json.Unmarshal(raw, &symbols)
+	if len(symbols) == 0 {
+		return fmt.Sprintf("No symbols in %s.", displayName(file))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Symbols in %s:\n", displayName(file))
+	count := 0
+	var walk func(list []lspSymbol, depth int)
+	walk = func(list []lspSymbol, depth int) {
+		for _, s := range list {
+			count++
+			start := lspPosition{}
+			if s.SelectionRange != nil {
+				start = s.SelectionRange.Start
+			} else if s.Location != nil {
+				start = s.Location.Range.Start
+			}
+			line, _ := client.fromLSPPosition(text, start)
+			fmt.Fprintf(&b, "%s%s %s", strings.Repeat("  ", depth+1), symbolKind(s.Kind), s.Name)
+			if s.Detail != "" {
+				b.WriteString("  " + s.Detail)
+			}
+			if s.ContainerName != "" && s.SelectionRange == nil {
+				b.WriteString("  (in " + s.ContainerName + ")")
+			}
+			fmt.Fprintf(&b, "  :%d\n", line)
+			walk(s.Children, depth+1)
+		}
+	}
+	walk(symbols, 0)
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// lspWorkspaceSymbols searches symbols by name. With a file, its server
+// answers; without one, every running server does.
+func lspWorkspaceSymbols(input map[string]interface{}, file string) (string, error) {
+	query, _ := input["query"].(string)
+	if query == "" {
+		query, _ = input["symbol"].(string)
+	}
+	if query == "" {
+		return "", fmt.Errorf("query is required for workspace_symbols")
+	}
+	var clients []*lspClient
+	if file != "" {
+		if err := checkWorkspacePath(file); err != nil {
+			return "", err
+		}
+		client, err := lspClientFor(file)
+		if err != nil {
+			return "", err
+		}
+		// Some servers only index a workspace once a file is open
+		if _, _, err := client.syncDocument(file); err != nil {
+			return "", err
+		}
+		clients = append(clients, client)
+	} else {
+		lspMu.Lock()
+		for _, c := range lspClients {
+			clients = append(clients, c)
+		}
+		lspMu.Unlock()
+		if len(clients) == 0 {
+			return "", fmt.Errorf("no language server is running yet. Pass file (any file of the project) to pick one")
+		}
+	}
+
+	var b strings.Builder
+	total := 0
+	for _, client := range clients {
+		var symbols []lspSymbol
+		if err := client.call("workspace/symbol", map[string]interface{}{"query": query}, &symbols); err != nil {
+			return "", err
+		}
+		texts := make(lspFileText)
+		for _, s := range symbols {
+			if total == maxLSPResults {
+				fmt.Fprintf(&b, "... and more; refine the query\n")
+				break
+			}
+			total++
+			loc := ""
+			if s.Location != nil {
+				text := texts.get(s.Location.URI)
+				line, _ := client.fromLSPPosition(text, s.Location.Range.Start)
+				loc = fmt.Sprintf("%s:%d", relativePath(uriToPath(s.Location.URI)), line)
+			}
+			fmt.Fprintf(&b, "%s %s", symbolKind(s.Kind), s.Name)
+			if s.ContainerName != "" {
+				b.WriteString(" (in " + s.ContainerName + ")")
+			}
+			b.WriteString("  " + loc + "\n")
+		}
+	}
+	if total == 0 {
+		return fmt.Sprintf("No symbols match '%s'.", query), nil
+	}
+	return fmt.Sprintf("Symbols matching '%s' (%d):\n%s", query, total, strings.TrimRight(b.String(), "\n")), nil
+}
+
+// lspRenamePreview asks the server for the edits a rename needs and shows
+// each changed line before and after. Nothing is written.
+func lspRenamePreview(client *lspClient, doc map[string]interface{}, text string, pos lspPosition, newName string) (string, error) {
+	oldName := ""
+	if client.hasCapability("renameProvider") {
+		var prepared json.RawMessage
+		if err := client.call("textDocument/prepareRename", doc, &prepared); err == nil {
+			if string(prepared) == "null" {
+				return "", fmt.Errorf("the symbol at that position can't be renamed")
+			}
+			var r struct {
+				Range       *lspRange    `json:"range"`
+				Start       *lspPosition `json:"start"`
+				End         *lspPosition `json:"end"`
+				Placeholder string       `json:"placeholder"`
+			}
+			json.Unmarshal(prepared, &r)
+			oldName = r.Placeholder
+			if oldName == "" && r.Start != nil && r.End != nil {
+				oldName = text[client.offsetOf(text, *r.Start):client.offsetOf(text, *r.End)]
+			}
+		}
+	}
+
+	doc["newName"] = newName
+	var edit struct {
+		Changes         map[string][]lspTextEdit `json:"changes"`
+		DocumentChanges []struct {
+			Kind         string `json:"kind"`
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			Edits  []lspTextEdit `json:"edits"`
+			OldURI string        `json:"oldUri"`
+			NewURI string        `json:"newUri"`
+			URI    string        `json:"uri"`
+		} `json:"documentChanges"`
+	}
+	if err := client.call("textDocument/rename", doc, &edit); err != nil {
+		return "", err
+	}
+
+	byURI := make(map[string][]lspTextEdit)
+	for uri, edits := range edit.Changes {
+		byURI[uri] = append(byURI[uri], edits...)
+	}
+	var fileOps []string
+	for _, change := range edit.DocumentChanges {
+		switch change.Kind {
+		case "":
+			byURI[change.TextDocument.URI] = append(byURI[change.TextDocument.URI], change.Edits...)
+		case "rename":
+			fileOps = append(fileOps, fmt.Sprintf("rename file %s → %s", relativePath(uriToPath(change.OldURI)), relativePath(uriToPath(change.NewURI))))
+		default:
+			fileOps = append(fileOps, fmt.Sprintf("%s file %s", change.Kind, relativePath(uriToPath(change.URI))))
+		}
+	}
+	if len(byURI) == 0 && len(fileOps) == 0 {
+		return "", fmt.Errorf("the server returned no edits for this rename")
+	}
+
+	uris := make([]string, 0, len(byURI))
+	edits := 0
+	for uri, list := range byURI {
+		uris = append(uris, uri)
+		edits += len(list)
+	}
+	sort.Strings(uris)
+	texts := make(lspFileText)
+	var b strings.Builder
+	title := "Rename"
+	if oldName != "" {
+		title = fmt.Sprintf("Rename %s", oldName)
+	}
+	fmt.Fprintf(&b, "%s → %s: %d edits in %d files (preview only; nothing was written)\n", title, newName, edits, len(uris))
+	for _, uri := range uris {
+		fileText := texts.get(uri)
+		list := byURI[uri]
+		fmt.Fprintf(&b, "\n%s (%d edits)\n", relativePath(uriToPath(uri)), len(list))
+		// Group single-line edits by line so each changed line shows once
+		byLine := make(map[int][]lspTextEdit)
+		var lines []int
+		for _, e := range list {
+			if e.Range.Start.Line != e.Range.End.Line {
+				fmt.Fprintf(&b, "  lines %d-%d: multi-line edit\n", e.Range.Start.Line+1, e.Range.End.Line+1)
+				continue
+			}
+			if _, ok := byLine[e.Range.Start.Line]; !ok {
+				lines = append(lines, e.Range.Start.Line)
+			}
+			byLine[e.Range.Start.Line] = append(byLine[e.Range.Start.Line], e)
+		}
+		sort.Ints(lines)
+		for _, line := range lines {
+			old := lineAt(fileText, line)
+			lineStart := client.offsetOf(fileText, lspPosition{Line: line})
+			updated := old
+			lineEdits := byLine[line]
+			sort.Slice(lineEdits, func(i, j int) bool { return lineEdits[i].Range.Start.Character > lineEdits[j].Range.Start.Character })
+			for _, e := range lineEdits {
+				from := client.offsetOf(fileText, e.Range.Start) - lineStart
+				to := client.offsetOf(fileText, e.Range.End) - lineStart
+				if from < 0 || to > len(updated) || from > to {
+					continue
+				}
+				updated = updated[:from] + e.NewText + updated[to:]
+			}
+			fmt.Fprintf(&b, "  %d - %s\n  %d + %s\n", line+1, strings.TrimSpace(old), line+1, strings.TrimSpace(updated))
+		}
+	}
+	if len(fileOps) > 0 {
+		fmt.Fprintf(&b, "\nFile operations:\n  %s\n", strings.Join(fileOps, "\n  "))
+	}
+	b.WriteString("\nApply these edits with multi_patch to perform the rename.")
+	return b.String(), nil
+}
+
+// lspStatus lists configured servers and the running ones
+func lspStatus() string {
+	var b strings.Builder
+	b.WriteString("Configured language servers:\n")
+	byCommand := make(map[string][]string)
+	commands := make(map[string]*lspServerConfig)
+	for ext, s := range lspServers() {
+		key := strings.Join(s.command, " ")
+		byCommand[key] = append(byCommand[key], ext)
+		commands[key] = s
+	}
+	keys := make([]string, 0, len(byCommand))
+	for k := range byCommand {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		exts := byCommand[k]
+		sort.Strings(exts)
+		state := "installed"
+		if _, err := exec.LookPath(commands[k].command[0]); err != nil {
+			state = "not installed"
+		}
+		fmt.Fprintf(&b, "  .%s: %s (%s)\n", strings.Join(exts, ", ."), k, state)
+	}
+
+	lspMu.Lock()
+	defer lspMu.Unlock()
+	if len(lspClients) == 0 {
+		b.WriteString("\nNo servers running. They start on first use.")
+		return b.String()
+	}
+	b.WriteString("\nRunning:\n")
+	var lines []string
+	for _, c := range lspClients {
+		c.mu.Lock()
+		lines = append(lines, fmt.Sprintf("  %s for %s (pid %d, up %s, %d open files, idle %s)", c.server.name, c.root,
+			c.cmd.Process.Pid, time.Since(c.started).Round(time.Second), len(c.docs), time.Since(c.lastUsed).Round(time.Second)))
+		c.mu.Unlock()
+	}
+	sort.Strings(lines)
+	b.WriteString(strings.Join(lines, "\n"))
+	return b.String()
+}
+
+// lspStop shuts down the server for a file's workspace, or all of them
+func lspStop(file string) (string, error) {
+	if file == "" {
+		lspMu.Lock()
+		n := len(lspClients)
+		lspMu.Unlock()
+		stopAllLSPClients()
+		return fmt.Sprintf("Stopped %d language %s.", n, plural(n, "server")), nil
+	}
+	server, err := lspServerFor(file)
+	if err != nil {
+		return "", err
+	}
+	root := lspRootFor(file, server)
+	key := server.name + "\x00" + root
+	lspMu.Lock()
+	client := lspClients[key]
+	delete(lspClients, key)
+	lspMu.Unlock()
+	if client == nil {
+		return fmt.Sprintf("No %s is running for %s.", server.name, root), nil
+	}
+	client.shutdown()
+	return fmt.Sprintf("Stopped %s for %s. It will restart on next use.", server.name, root), nil
+}
+
+func displayLSP(input map[string]interface{}) string {
+	action, _ := input["action"].(string)
+	file, _ := input["file"].(string)
+	if line, ok := input["line"].(float64); ok && file != "" {
+		return fmt.Sprintf("→ LSP %s: %s:%d", action, file, int(line))
+	}
+	if query, _ := input["query"].(string); query != "" {
+		return fmt.Sprintf("→ LSP %s: %s", action, query)
+	}
+	if file != "" {
+		return fmt.Sprintf("→ LSP %s: %s", action, file)
+	}
+	return fmt.Sprintf("→ LSP %s", action)
+}
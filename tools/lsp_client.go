@@ -0,0 +1,601 @@
+package tools
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// lspClient speaks JSON-RPC 2.0 over a language server's stdin and stdout,
+// framed with Content-Length headers as the Language Server Protocol
+// specifies. One client serves one server process for one workspace root.
+type lspClient struct {
+	server  *lspServerConfig
+	root    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stderr  *ringBuffer
+	started time.Time
+	done    chan struct{} // closed when the server process exits
+
+	writeMu sync.Mutex
+
+	mu          sync.Mutex
+	nextID      int
+	pending     map[int]chan lspResponse
+	docs        map[string]*lspDocument // by URI
+	diagnostics map[string]lspPublishedDiagnostics
+	diagWaiters []chan struct{}
+	lastUsed    time.Time
+
+	capabilities map[string]json.RawMessage
+	utf8         bool // positions count bytes rather than UTF-16 units
+}
+
+// lspDocument is a file the server has been told about
+type lspDocument struct {
+	version int
+	text    string
+}
+
+type lspPublishedDiagnostics struct {
+	version     int
+	diagnostics []lspDiagnostic
+	received    time.Time
+}
+
+type lspResponse struct {
+	Result json.RawMessage
+	Error  *lspError
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// lspMessage is any incoming message: a response, a notification or a
+// request from the server
+type lspMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *lspError       `json:"error,omitempty"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange        `json:"range"`
+	Severity int             `json:"severity"`
+	Code     json.RawMessage `json:"code,omitempty"`
+	Source   string          `json:"source,omitempty"`
+	Message  string          `json:"message"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+const lspRequestTimeout = 30 * time.Second
+
+// startLSPClient launches a server, runs the initialize handshake and
+// returns a ready client
+func startLSPClient(server *lspServerConfig, root string) (*lspClient, error) {
+	cmd := exec.Command(server.command[0], server.command[1:]...)
+	cmd.Dir = root
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := newRingBuffer(64 * 1024)
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start language server '%s': %w", server.name, err)
+	}
+
+	c := &lspClient{
+		server:      server,
+		root:        root,
+		cmd:         cmd,
+		stdin:       stdin,
+		stderr:      stderr,
+		started:     time.Now(),
+		done:        make(chan struct{}),
+		pending:     make(map[int]chan lspResponse),
+		docs:        make(map[string]*lspDocument),
+		diagnostics: make(map[string]lspPublishedDiagnostics),
+		lastUsed:    time.Now(),
+	}
+	go func() {
+		c.readLoop(bufio.NewReader(stdout))
+		cmd.Wait()
+		c.mu.Lock()
+		for id, ch := range c.pending {
+			close(ch)
+			delete(c.pending, id)
+		}
+		c.mu.Unlock()
+		close(c.done)
+	}()
+
+	if err := c.initialize(); err != nil {
+		c.kill()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *lspClient) initialize() error {
+	rootURI := pathToURI(c.root)
+	params := map[string]interface{}{
+		"processId": os.Getpid(),
+		"clientInfo": map[string]interface{}{
+			"name": "clyde",
+		},
+		"rootUri":  rootURI,
+		"rootPath": c.root,
+		"workspaceFolders": []map[string]interface{}{
+			{"uri": rootURI, "name": filepath.Base(c.root)},
+		},
+		"initializationOptions": c.server.initOptions,
+		"capabilities": map[string]interface{}{
+			"general": map[string]interface{}{
+				"positionEncodings": []string{"utf-8", "utf-16"},
+			},
+			"workspace": map[string]interface{}{
+				"configuration":    true,
+				"workspaceFolders": true,
+				"symbol":           map[string]interface{}{},
+			},
+			"textDocument": map[string]interface{}{
+				"synchronization": map[string]interface{}{"didSave": false},
+				"hover": map[string]interface{}{
+					"contentFormat": []string{"markdown", "plaintext"},
+				},
+				"definition": map[string]interface{}{"linkSupport": true},
+				"references": map[string]interface{}{},
+				"documentSymbol": map[string]interface{}{
+					"hierarchicalDocumentSymbolSupport": true,
+				},
+				"rename":             map[string]interface{}{"prepareSupport": true},
+				"publishDiagnostics": map[string]interface{}{"versionSupport": true},
+				"diagnostic":         map[string]interface{}{},
+			},
+		},
+	}
+	var result struct {
+		Capabilities map[string]json.RawMessage `json:"capabilities"`
+	}
+	if err := c.call("initialize", params, &result); err != nil {
+		return fmt.Errorf("language server '%s' failed to initialize: %w%s", c.server.name, err, c.stderrTail())
+	}
+	c.capabilities = result.Capabilities
+	var encoding string
+	json.Unmarshal(result.Capabilities["positionEncoding"], &encoding)
+	c.utf8 = encoding == "utf-8"
+	return c.notify("initialized", map[string]interface{}{})
+}
+
+// readLoop dispatches incoming messages until the server closes stdout
+func (c *lspClient) readLoop(r *bufio.Reader) {
+	for {
+		body, err := readLSPFrame(r)
+		if err != nil {
+			return
+		}
+		var msg lspMessage
+		if json.Unmarshal(body, &msg) != nil {
+			continue
+		}
+		switch {
+		case msg.Method != "" && len(msg.ID) > 0:
+			go c.handleServerRequest(msg)
+		case msg.Method != "":
+			c.handleNotification(msg)
+		case len(msg.ID) > 0:
+			id, err := strconv.Atoi(string(msg.ID))
+			if err != nil {
+				continue
+			}
+			c.mu.Lock()
+			ch := c.pending[id]
+			delete(c.pending, id)
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- lspResponse{Result: msg.Result, Error: msg.Error}
+			}
+		}
+	}
+}
+
+// readLSPFrame reads one Content-Length framed message
+func readLSPFrame(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("bad Content-Length: %w", err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+func (c *lspClient) write(msg map[string]interface{}) error {
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.stdin, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.stdin.Write(body)
+	return err
+}
+
+// call sends a request and decodes its result into out
+func (c *lspClient) call(method string, params interface{}, out interface{}) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	ch := make(chan lspResponse, 1)
+	c.pending[id] = ch
+	c.lastUsed = time.Now()
+	c.mu.Unlock()
+
+	if err := c.write(map[string]interface{}{"id": id, "method": method, "params": params}); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return fmt.Errorf("language server '%s' is not accepting requests: %w", c.server.name, err)
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return fmt.Errorf("language server '%s' exited%s", c.server.name, c.stderrTail())
+		}
+		if resp.Error != nil {
+			return fmt.Errorf("%s failed: %s (code %d)", method, resp.Error.Message, resp.Error.Code)
+		}
+		if out != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, out)
+		}
+		return nil
+	case <-time.After(lspRequestTimeout):
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		c.notify("$/cancelRequest", map[string]interface{}{"id": id})
+		return fmt.Errorf("%s timed out after %s; the server may still be indexing. Try again shortly", method, lspRequestTimeout)
+	}
+}
+
+func (c *lspClient) notify(method string, params interface{}) error {
+	return c.write(map[string]interface{}{"method": method, "params": params})
+}
+
+// handleServerRequest answers requests the server sends the client. Only
+// the ones servers commonly block on are supported.
+func (c *lspClient) handleServerRequest(msg lspMessage) {
+	reply := map[string]interface{}{"id": msg.ID}
+	switch msg.Method {
+	case "workspace/configuration":
+		// No settings: one null per requested item
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		reply["result"] = make([]interface{}, len(params.Items))
+	case "workspace/workspaceFolders":
+		reply["result"] = []map[string]interface{}{{"uri": pathToURI(c.root), "name": filepath.Base(c.root)}}
+	case "client/registerCapability", "client/unregisterCapability", "window/workDoneProgress/create", "window/showMessageRequest":
+		reply["result"] = nil
+	default:
+		reply["error"] = lspError{Code: -32601, Message: "method not supported by clyde: " + msg.Method}
+	}
+	c.write(reply)
+}
+
+func (c *lspClient) handleNotification(msg lspMessage) {
+	if msg.Method != "textDocument/publishDiagnostics" {
+		return
+	}
+	var params struct {
+		URI         string          `json:"uri"`
+		Version     *int            `json:"version"`
+		Diagnostics []lspDiagnostic `json:"diagnostics"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	version := -1
+	if params.Version != nil {
+		version = *params.Version
+	}
+	c.diagnostics[normalizeURI(params.URI)] = lspPublishedDiagnostics{version: version, diagnostics: params.Diagnostics, received: time.Now()}
+	for _, w := range c.diagWaiters {
+		close(w)
+	}
+	c.diagWaiters = nil
+}
+
+// syncDocument opens a file on the server, or sends its new text if it
+// changed on disk since the server last saw it. It returns the text and
+// the URI.
+func (c *lspClient) syncDocument(path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fileError(path, err)
+	}
+	text := string(data)
+	uri := pathToURI(path)
+
+	c.mu.Lock()
+	doc := c.docs[uri]
+	switch {
+	case doc == nil:
+		doc = &lspDocument{version: 1, text: text}
+		c.docs[uri] = doc
+		c.mu.Unlock()
+		return text, uri, c.notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"uri": uri, "languageId": lspLanguageID(path), "version": doc.version, "text": text,
+			},
+		})
+	case doc.text != text:
+		doc.version++
+		doc.text = text
+		version := doc.version
+		c.mu.Unlock()
+		return text, uri, c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+			"contentChanges": []map[string]interface{}{{"text": text}},
+		})
+	}
+	c.mu.Unlock()
+	return text, uri, nil
+}
+
+// documentVersion is the version last sent for a URI
+func (c *lspClient) documentVersion(uri string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if doc := c.docs[uri]; doc != nil {
+		return doc.version
+	}
+	return 0
+}
+
+// waitDiagnostics returns the diagnostics for a document once the server
+// has published them for its current version, or whatever it has when
+// the wait runs out. Servers that don't report versions are given a
+// short settling time instead.
+func (c *lspClient) waitDiagnostics(uri string, version int, since time.Time, wait time.Duration) ([]lspDiagnostic, bool) {
+	deadline := time.Now().Add(wait)
+	for {
+		c.mu.Lock()
+		got, ok := c.diagnostics[uri]
+		fresh := ok && (got.version == version || got.version < 0 && got.received.After(since))
+		if fresh || time.Now().After(deadline) {
+			c.mu.Unlock()
+			return got.diagnostics, fresh
+		}
+		w := make(chan struct{})
+		c.diagWaiters = append(c.diagWaiters, w)
+		c.mu.Unlock()
+		select {
+		case <-w:
+		case <-c.done:
+			return got.diagnostics, false
+		case <-time.After(time.Until(deadline)):
+		}
+	}
+}
+
+// hasCapability reports whether the server advertised a provider
+func (c *lspClient) hasCapability(name string) bool {
+	raw, ok := c.capabilities[name]
+	return ok && string(raw) != "false" && string(raw) != "null"
+}
+
+func (c *lspClient) alive() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// shutdown asks the server to exit, then kills it if it doesn't
+func (c *lspClient) shutdown() {
+	if c.alive() {
+		done := make(chan struct{})
+		go func() {
+			c.call("shutdown", nil, nil)
+			c.notify("exit", nil)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+		}
+		c.stdin.Close()
+		select {
+		case <-c.done:
+			return
+		case <-time.After(2 * time.Second):
+		}
+	}
+	c.kill()
+}
+
+func (c *lspClient) kill() {
+	c.stdin.Close()
+	killProcessGroup(c.cmd)
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func (c *lspClient) stderrTail() string {
+	data, _, _ := c.stderr.ReadAt(0, 64*1024)
+	text := strings.TrimSpace(string(data))
+	if text == "" {
+		return ""
+	}
+	if len(text) > 1000 {
+		text = "..." + text[len(text)-1000:]
+	}
+	return "\nServer stderr:\n" + text
+}
+
+// Positions: LSP counts characters in UTF-16 code units unless the server
+// agreed to UTF-8. The tool works in 1-based lines and columns counted in
+// characters, as editors show them.
+
+// toLSPPosition converts a 1-based line and character column
+func (c *lspClient) toLSPPosition(text string, line, column int) lspPosition {
+	lineText := lineAt(text, line-1)
+	prefix := lineText
+	if n := column - 1; n >= 0 && n < utf8.RuneCountInString(lineText) {
+		prefix = string([]rune(lineText)[:n])
+	}
+	if c.utf8 {
+		return lspPosition{Line: line - 1, Character: len(prefix)}
+	}
+	return lspPosition{Line: line - 1, Character: len(utf16.Encode([]rune(prefix)))}
+}
+
+// fromLSPPosition converts a server position to a 1-based line and
+// character column
+func (c *lspClient) fromLSPPosition(text string, pos lspPosition) (int, int) {
+	lineText := lineAt(text, pos.Line)
+	if c.utf8 {
+		n := min(pos.Character, len(lineText))
+		return pos.Line + 1, utf8.RuneCountInString(lineText[:n]) + 1
+	}
+	units := 0
+	for i, r := range []rune(lineText) {
+		if units >= pos.Character {
+			return pos.Line + 1, i + 1
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return pos.Line + 1, utf8.RuneCountInString(lineText) + 1
+}
+
+// offsetOf converts a server position to a byte offset in text
+func (c *lspClient) offsetOf(text string, pos lspPosition) int {
+	offset := 0
+	for i := 0; i < pos.Line; i++ {
+		next := strings.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			return len(text)
+		}
+		offset += next + 1
+	}
+	lineText := lineAt(text, pos.Line)
+	if c.utf8 {
+		return offset + min(pos.Character, len(lineText))
+	}
+	units := 0
+	for i, r := range lineText {
+		if units >= pos.Character {
+			return offset + i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return offset + len(lineText)
+}
+
+func lineAt(text string, index int) string {
+	for i := 0; i < index; i++ {
+		next := strings.IndexByte(text, '\n')
+		if next < 0 {
+			return ""
+		}
+		text = text[next+1:]
+	}
+	if end := strings.IndexByte(text, '\n'); end >= 0 {
+		text = text[:end]
+	}
+	return strings.TrimSuffix(text, "\r")
+}
+
+func pathToURI(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// normalizeURI re-encodes a server URI so it matches pathToURI's form
+func normalizeURI(uri string) string {
+	if path := uriToPath(uri); path != uri {
+		return pathToURI(path)
+	}
+	return uri
+}
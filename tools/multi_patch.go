@@ -3,7 +3,8 @@ package tools
 import (
 	"github.com/this-is-alpha-iota/clyde/api"
 	"fmt"
-	"os/exec"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -13,13 +14,13 @@ func init() {
 
 var multiPatchTool = api.Tool{
 	Name:        "multi_patch",
-	Description: "Apply coordinated changes to multiple files atomically. If any patch fails, all previous changes are rolled back using git. Best for refactoring function names, updating imports, or applying consistent changes across files.",
+	Description: "Apply coordinated changes to multiple files atomically. All patches are validated against the current file contents before anything is written; if any patch or write fails, every file is restored to its original content. Several patches to the same file are applied in order. Works with uncommitted changes and outside git repositories. Best for refactoring function names, updating imports, or applying consistent changes across files.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
 			"patches": map[string]interface{}{
 				"type":        "array",
-				"description": "Array of patches to apply to different files",
+				"description": "Array of patches to apply. Patches targeting the same file are applied in sequence.",
 				"items": map[string]interface{}{
 					"type": "object",
 					"properties": map[string]interface{}{
@@ -77,6 +78,9 @@ func executeMultiPatch(input map[string]interface{}, apiClient *api.Client, conv
 		if !newOk {
 			return "", fmt.Errorf("patch %d is missing 'new_text' parameter", i+1)
 		}
+		if err := checkWorkspacePath(path); err != nil {
+			return "", fmt.Errorf("patch %d: %w\n\nNo files were modified", i+1, err)
+		}
 
 		parsedPatches = append(parsedPatches, patchInfo{
 			Path:    path,
@@ -85,137 +89,151 @@ func executeMultiPatch(input map[string]interface{}, apiClient *api.Client, conv
 		})
 	}
 
-	// Check if git is available and we're in a git repo
-	gitAvailable := false
-	if cmd := exec.Command("git", "rev-parse", "--git-dir"); cmd.Run() == nil {
-		gitAvailable = true
+	// Snapshot every target file once, in the order it is first referenced
+	snapshots := make(map[string]*fileSnapshot)
+	var order []string
+	for i, patch := range parsedPatches {
+		key := snapshotKey(patch.Path)
+		if _, seen := snapshots[key]; seen {
+			continue
+		}
+		snap, err := takeSnapshot(patch.Path)
+		if err != nil {
+			return "", fmt.Errorf("❌ Patch %d/%d FAILED: %s\nError: %v\n\nNo files were modified", i+1, len(parsedPatches), patch.Path, err)
+		}
+		snapshots[key] = snap
+		order = append(order, key)
 	}
 
-	// Check for uncommitted changes and suggest commit if git available
-	if gitAvailable {
-		cmd := exec.Command("git", "status", "--porcelain")
-		output, err := cmd.Output()
-		if err == nil && len(output) > 0 {
-			// There are uncommitted changes - suggest committing first
-			suggestions := []string{
-				"⚠️  You have uncommitted changes.",
-				"",
-				"It's recommended to commit your changes before applying multiple patches.",
-				"This allows you to easily undo if something goes wrong.",
-				"",
-				"To commit first:",
-				"  1. Review changes: run_bash(\"git status\")",
-				"  2. Commit changes: run_bash(\"git add -A && git commit -m 'Before multi-patch'\")",
-				"  3. Then run multi_patch again",
-				"",
-				"Or, if you're sure, I can proceed anyway.",
-				"",
-				fmt.Sprintf("Ready to apply %d patches to:", len(parsedPatches)),
-			}
-			for i, patch := range parsedPatches {
-				suggestions = append(suggestions, fmt.Sprintf("  %d. %s", i+1, patch.Path))
-			}
-
-			// For now, we'll proceed but with a warning in the output
-			// In a future version, we could add confirmation logic
-			return strings.Join(suggestions, "\n"), nil
-		}
+	// Validate all patches against the in-memory content before touching disk.
+	// Patches to the same file are applied in sequence, so later patches see
+	// the result of earlier ones.
+	pending := make(map[string]string, len(snapshots))
+	for key, snap := range snapshots {
+		pending[key] = string(snap.content)
 	}
 
-	// Apply patches
 	var results []string
-	var appliedPatches []patchInfo
-
 	for i, patch := range parsedPatches {
-		// Create input for executePatchFile
-		patchInput := map[string]interface{}{
-			"path":     patch.Path,
-			"old_text": patch.OldText,
-			"new_text": patch.NewText,
-		}
-		
-		result, err := executePatchFile(patchInput, apiClient, conversationHistory)
+		key := snapshotKey(patch.Path)
+		updated, err := applyTextPatch(pending[key], patch.OldText, patch.NewText)
 		if err != nil {
-			// Patch failed - attempt rollback if git available
 			failureMsg := []string{
 				fmt.Sprintf("❌ Patch %d/%d FAILED: %s", i+1, len(parsedPatches), patch.Path),
 				fmt.Sprintf("Error: %v", err),
 				"",
+				"No files were modified: all patches are validated before any file is written.",
 			}
+			return "", fmt.Errorf("%s", strings.Join(failureMsg, "\n"))
+		}
+		pending[key] = updated
 
-			if gitAvailable && len(appliedPatches) > 0 {
+		changeSize := len(patch.NewText) - len(patch.OldText)
+		results = append(results, fmt.Sprintf("✓ Patch %d/%d: %s: replaced %d bytes with %d bytes (change: %+d bytes)",
+			i+1, len(parsedPatches), patch.Path, len(patch.OldText), len(patch.NewText), changeSize))
+	}
+
+	var paths []string
+	for _, key := range order {
+		paths = append(paths, snapshots[key].path)
+	}
+	checkpointBeforeWrite(paths...)
+	autoCommitNoteWrite(paths...)
+	check := beforeEdit(paths...)
+
+	// Write each file atomically, restoring from the snapshots on failure
+	var written []*fileSnapshot
+	for _, key := range order {
+		snap := snapshots[key]
+		if err := writeFileAtomic(snap.path, []byte(pending[key])); err != nil {
+			failureMsg := []string{
+				fmt.Sprintf("❌ Failed to write %s", snap.path),
+				fmt.Sprintf("Error: %v", err),
+				"",
+			}
+
+			if len(written) > 0 {
 				failureMsg = append(failureMsg,
-					fmt.Sprintf("Rolling back %d successful patches...", len(appliedPatches)),
+					fmt.Sprintf("Rolling back %d files already written...", len(written)),
 				)
 
-				// Attempt to restore each file that was changed
 				var rollbackErrors []string
-				for _, applied := range appliedPatches {
-					if restoreErr := exec.Command("git", "checkout", "--", applied.Path).Run(); restoreErr != nil {
-						rollbackErrors = append(rollbackErrors, fmt.Sprintf("  - Failed to restore %s: %v", applied.Path, restoreErr))
+				for _, done := range written {
+					if restoreErr := done.restore(); restoreErr != nil {
+						rollbackErrors = append(rollbackErrors, fmt.Sprintf("  - Failed to restore %s: %v", done.path, restoreErr))
 					}
 				}
 
 				if len(rollbackErrors) > 0 {
-					failureMsg = append(failureMsg,
-						"⚠️  Some rollback operations failed:",
-					)
+					failureMsg = append(failureMsg, "⚠️  Some rollback operations failed:")
 					failureMsg = append(failureMsg, rollbackErrors...)
-					failureMsg = append(failureMsg,
-						"",
-						"You may need to manually restore these files with:",
-						"  git checkout -- <file>",
-					)
 				} else {
-					failureMsg = append(failureMsg,
-						"✓ Successfully rolled back all changes",
-					)
-				}
-			} else if len(appliedPatches) > 0 {
-				failureMsg = append(failureMsg,
-					fmt.Sprintf("⚠️  %d patches were applied before this failure:", len(appliedPatches)),
-				)
-				for _, applied := range appliedPatches {
-					failureMsg = append(failureMsg, fmt.Sprintf("  - %s", applied.Path))
-				}
-				if gitAvailable {
-					failureMsg = append(failureMsg,
-						"",
-						"To undo these changes, run:",
-						"  git checkout -- <files>",
-					)
-				} else {
-					failureMsg = append(failureMsg,
-						"",
-						"You may need to manually undo these changes",
-					)
+					failureMsg = append(failureMsg, "✓ Successfully rolled back all changes")
 				}
+			} else {
+				failureMsg = append(failureMsg, "No files were modified.")
 			}
 
 			return "", fmt.Errorf("%s", strings.Join(failureMsg, "\n"))
 		}
-
-		appliedPatches = append(appliedPatches, patch)
-		results = append(results, fmt.Sprintf("✓ Patch %d/%d: %s", i+1, len(parsedPatches), result))
+		written = append(written, snap)
 	}
 
 	// All patches succeeded
 	summary := []string{
-		fmt.Sprintf("✅ Successfully applied all %d patches:", len(parsedPatches)),
+		fmt.Sprintf("✅ Successfully applied all %d patches to %d files:", len(parsedPatches), len(order)),
 		"",
 	}
 	summary = append(summary, results...)
 
-	if gitAvailable {
-		summary = append(summary,
-			"",
-			"Next steps:",
-			"  - Review changes: run_bash(\"git diff\")",
-			"  - Commit changes: run_bash(\"git add -A && git commit -m 'Applied multi-patch'\")",
-		)
+	return withEditReport(strings.Join(summary, "\n"), check), nil
+}
+
+// fileSnapshot holds the original content of a file so multi_patch can
+// restore it without relying on version control.
+type fileSnapshot struct {
+	path    string
+	content []byte
+}
+
+// snapshotKey identifies the file a path refers to, so a.go, ./a.go, its
+// absolute path and symlinks to it share one snapshot.
+func snapshotKey(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
+func takeSnapshot(path string) (*fileSnapshot, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file '%s' does not exist. Use write_file to create a new file", path)
+		}
+		return nil, fmt.Errorf("cannot access '%s': %w", path, err)
 	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("'%s' is a directory, not a file", path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsPermission(err) {
+			return nil, fmt.Errorf("permission denied reading '%s'. Check file permissions", path)
+		}
+		return nil, fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	return &fileSnapshot{path: path, content: content}, nil
+}
 
-	return strings.Join(summary, "\n"), nil
+// restore writes the snapshot content back to disk
+func (s *fileSnapshot) restore() error {
+	return writeFileAtomic(s.path, s.content)
 }
 
 func displayMultiPatch(input map[string]interface{}) string {
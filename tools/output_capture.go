@@ -0,0 +1,158 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxSpillBytes caps how much output is saved to a spill file, so a runaway
+// command cannot fill the disk.
+const maxSpillBytes = 50 * 1024 * 1024
+
+// outputCapture is an io.Writer that keeps the head and tail of a stream in
+// memory and spills the full stream to a temp file once it grows past limit.
+// The model sees a truncated view and can read_file the spill file if it
+// needs the rest.
+type outputCapture struct {
+	mu         sync.Mutex
+	name       string // stream name used in the spill file name (stdout/stderr)
+	limit      int
+	head       []byte
+	tail       []byte // last limit/2 bytes once the stream overflows
+	total      int64
+	overflowed bool
+	spill      *os.File
+	spillN     int64
+}
+
+func newOutputCapture(name string, limit int) *outputCapture {
+	return &outputCapture{name: name, limit: limit}
+}
+
+func (c *outputCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.total += int64(len(p))
+
+	// Fast path: everything still fits in memory
+	if !c.overflowed && len(c.head)+len(p) <= c.limit {
+		c.head = append(c.head, p...)
+		return len(p), nil
+	}
+
+	// First overflow: move what we have to a spill file and split the
+	// buffer into head and tail halves
+	half := c.limit / 2
+	if !c.overflowed {
+		c.overflowed = true
+		if dir, err := getScratchDir(); err == nil {
+			if f, err := os.CreateTemp(dir, c.name+"-*.log"); err == nil {
+				c.spill = f
+				c.writeSpill(c.head)
+			}
+		}
+		if len(c.head) > half {
+			c.tail = append(c.tail, c.head[half:]...)
+			c.head = c.head[:half]
+		}
+	}
+
+	if c.spill != nil {
+		c.writeSpill(p)
+	}
+	if room := half - len(c.head); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		c.head = append(c.head, p[:room]...)
+	}
+	c.tail = append(c.tail, p...)
+	if over := len(c.tail) - half; over > 0 {
+		c.tail = append(c.tail[:0], c.tail[over:]...)
+	}
+	return len(p), nil
+}
+
+func (c *outputCapture) writeSpill(p []byte) {
+	if c.spillN >= maxSpillBytes {
+		return
+	}
+	if room := maxSpillBytes - c.spillN; int64(len(p)) > room {
+		p = p[:room]
+	}
+	n, _ := c.spill.Write(p)
+	c.spillN += int64(n)
+}
+
+// Truncated reports whether the stream exceeded the in-memory limit
+func (c *outputCapture) Truncated() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total > int64(c.limit)
+}
+
+// Close flushes and closes the spill file, if any
+func (c *outputCapture) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.spill != nil {
+		c.spill.Close()
+	}
+}
+
+// SpillPath returns the path of the file holding the full output, or ""
+func (c *outputCapture) SpillPath() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.spill == nil {
+		return ""
+	}
+	return c.spill.Name()
+}
+
+// String returns the captured output. Truncated streams show the head and
+// tail separated by a marker that says how much was omitted and where the
+// full output lives.
+func (c *outputCapture) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.total <= int64(c.limit) {
+		return string(c.head)
+	}
+
+	head := trimToLastNewline(string(c.head))
+	tail := trimToFirstNewline(string(c.tail))
+	omitted := c.total - int64(len(head)) - int64(len(tail))
+
+	marker := fmt.Sprintf("\n[... %d bytes of %s omitted", omitted, c.name)
+	if c.spill != nil {
+		marker += fmt.Sprintf("; full %s saved to %s (use read_file to view it)", c.name, c.spill.Name())
+		if c.spillN < c.total {
+			marker += fmt.Sprintf(", first %d MB only", maxSpillBytes/(1024*1024))
+		}
+	}
+	marker += " ...]\n"
+
+	return head + marker + tail
+}
+
+// trimToLastNewline drops a partial trailing line so truncation happens on
+// line boundaries where possible
+func trimToLastNewline(s string) string {
+	if i := strings.LastIndexByte(s, '\n'); i >= len(s)/2 {
+		return s[:i+1]
+	}
+	return s
+}
+
+// trimToFirstNewline drops a partial leading line
+func trimToFirstNewline(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 && i < len(s)/2 {
+		return s[i+1:]
+	}
+	return s
+}
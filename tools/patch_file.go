@@ -48,6 +48,9 @@ func executePatchFile(input map[string]interface{}, apiClient *api.Client, conve
 	if !newTextOk {
 		return "", fmt.Errorf("new_text is required (can be empty string to delete)")
 	}
+	if err := checkWorkspacePath(path); err != nil {
+		return "", err
+	}
 
 	// Check if file exists
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -63,10 +66,34 @@ func executePatchFile(input map[string]interface{}, apiClient *api.Client, conve
 		return "", fmt.Errorf("failed to read file '%s': %w", path, err)
 	}
 
-	fileContent := string(content)
+	newContent, err := applyTextPatch(string(content), oldText, newText)
+	if err != nil {
+		return "", err
+	}
+
+	checkpointBeforeWrite(path)
+	autoCommitNoteWrite(path)
+	check := beforeEdit(path)
+
+	// Write the modified content back
+	if err := writeFileAtomic(path, []byte(newContent)); err != nil {
+		if os.IsPermission(err) {
+			return "", fmt.Errorf("permission denied writing to '%s'. Check file permissions", path)
+		}
+		return "", fmt.Errorf("failed to write file '%s': %w", path, err)
+	}
 
+	changeSize := len(newText) - len(oldText)
+	result := fmt.Sprintf("Successfully patched %s: replaced %d bytes with %d bytes (change: %+d bytes)",
+		path, len(oldText), len(newText), changeSize)
+	return withEditReport(result, check), nil
+}
+
+// applyTextPatch replaces the single occurrence of oldText in content with
+// newText. It returns a descriptive error if oldText is missing or not unique.
+func applyTextPatch(content, oldText, newText string) (string, error) {
 	// Check if old_text exists in the file
-	if !strings.Contains(fileContent, oldText) {
+	if !strings.Contains(content, oldText) {
 		// Provide helpful suggestions
 		suggestions := []string{
 			"The old_text was not found in the file. Common issues:",
@@ -83,7 +110,7 @@ func executePatchFile(input map[string]interface{}, apiClient *api.Client, conve
 	}
 
 	// Count occurrences to ensure it's unique
-	occurrences := strings.Count(fileContent, oldText)
+	occurrences := strings.Count(content, oldText)
 	if occurrences > 1 {
 		suggestions := []string{
 			fmt.Sprintf("The old_text appears %d times in the file. It must be unique to ensure the right text is replaced.", occurrences),
@@ -99,19 +126,7 @@ func executePatchFile(input map[string]interface{}, apiClient *api.Client, conve
 	}
 
 	// Replace the text
-	newContent := strings.Replace(fileContent, oldText, newText, 1)
-
-	// Write the modified content back
-	if err := os.WriteFile(path, []byte(newContent), 0644); err != nil {
-		if os.IsPermission(err) {
-			return "", fmt.Errorf("permission denied writing to '%s'. Check file permissions", path)
-		}
-		return "", fmt.Errorf("failed to write file '%s': %w", path, err)
-	}
-
-	changeSize := len(newText) - len(oldText)
-	return fmt.Sprintf("Successfully patched %s: replaced %d bytes with %d bytes (change: %+d bytes)",
-		path, len(oldText), len(newText), changeSize), nil
+	return strings.Replace(content, oldText, newText, 1), nil
 }
 
 func displayPatchFile(input map[string]interface{}) string {
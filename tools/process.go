@@ -0,0 +1,494 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/api"
+)
+
+func init() {
+	Register(processTool, executeProcess, displayProcess)
+	registerCleanup(stopAllProcesses)
+}
+
+var processTool = api.Tool{
+	Name:        "process",
+	Description: "Manage background processes such as dev servers, file watchers and long builds. Use 'start' to launch a command without waiting for it (returns an id), then 'read_output' to read its logs incrementally, 'send_stdin' to type into it, 'status' to check whether it is still running, and 'stop' to terminate it. All processes are stopped when Clyde exits.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"start", "status", "read_output", "send_stdin", "stop"},
+				"description": "What to do",
+			},
+			"command": map[string]interface{}{
+				"type":        "string",
+				"description": "For start: the bash command to run in the background",
+			},
+			"cwd": map[string]interface{}{
+				"type":        "string",
+				"description": "For start: directory to run in (default: current directory)",
+			},
+			"env": map[string]interface{}{
+				"type":        "object",
+				"description": "For start: extra environment variables",
+				"additionalProperties": map[string]interface{}{
+					"type": "string",
+				},
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "Process id returned by start (e.g. 'p1'). For status, omit to list all processes.",
+			},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "For read_output: byte offset to read from. Pass the next_offset from the previous read to get only new output (default 0)",
+			},
+			"max_bytes": map[string]interface{}{
+				"type":        "integer",
+				"description": "For read_output: maximum bytes to return (default 16384)",
+			},
+			"wait_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": "For read_output: wait up to this many seconds (max 30) for new output or exit before returning",
+			},
+			"input": map[string]interface{}{
+				"type":        "string",
+				"description": "For send_stdin: text to write. Include a trailing \\n to submit a line.",
+			},
+			"close_stdin": map[string]interface{}{
+				"type":        "boolean",
+				"description": "For send_stdin: close stdin after writing (signals EOF)",
+			},
+		},
+		"required": []string{"action"},
+	},
+}
+
+// Process manager limits, overridable in ~/.clyde/config
+const (
+	defaultProcessBufferKB = 256 // CLYDE_PROCESS_BUFFER_KB, output kept per process
+	defaultMaxProcesses    = 10  // CLYDE_PROCESS_MAX, concurrently running
+	defaultReadBytes       = 16 * 1024
+	maxReadWaitSeconds     = 30
+)
+
+// managedProcess is a background command started by the process tool
+type managedProcess struct {
+	id      string
+	command string
+	cwd     string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	output  *ringBuffer // stdout and stderr interleaved, as a terminal would show them
+	started time.Time
+	done    chan struct{} // closed when the process has exited
+
+	mu       sync.Mutex
+	exitCode int
+	ended    time.Time
+	stopped  bool // stopped via the tool rather than exiting on its own
+}
+
+// ProcessInfo describes a background process for display in a UI
+type ProcessInfo struct {
+	ID       string
+	Command  string
+	PID      int
+	Running  bool
+	ExitCode int
+	Started  time.Time
+	Uptime   time.Duration
+}
+
+var (
+	processMu     sync.Mutex
+	processes     = make(map[string]*managedProcess)
+	nextProcessID = 1
+)
+
+func executeProcess(input map[string]interface{}, apiClient *api.Client, conversationHistory []api.Message) (string, error) {
+	action, _ := input["action"].(string)
+	switch action {
+	case "start":
+		return startProcess(input)
+	case "status":
+		return processStatus(input)
+	case "read_output":
+		return readProcessOutput(input)
+	case "send_stdin":
+		return sendProcessStdin(input)
+	case "stop":
+		return stopProcess(input)
+	case "":
+		return "", fmt.Errorf("action is required. Use one of: start, status, read_output, send_stdin, stop")
+	default:
+		return "", fmt.Errorf("unknown action '%s'. Use one of: start, status, read_output, send_stdin, stop", action)
+	}
+}
+
+func startProcess(input map[string]interface{}) (string, error) {
+	command, _ := input["command"].(string)
+	if command == "" {
+		return "", fmt.Errorf("command is required for start. Example: process(action=\"start\", command=\"go run ./cmd/server\")")
+	}
+
+	// Reuse run_bash's validation of cwd and env
+	req, err := parseBashRequest(input)
+	if err != nil {
+		return "", err
+	}
+	if err := guardShellCommand("process", req.command); err != nil {
+		return "", err
+	}
+	autoCommitNoteShell()
+
+	processMu.Lock()
+	running := 0
+	for _, p := range processes {
+		if p.isRunning() {
+			running++
+		}
+	}
+	processMu.Unlock()
+	if max := envInt("CLYDE_PROCESS_MAX", defaultMaxProcesses); running >= max {
+		return "", fmt.Errorf("%d background processes are already running (limit %d). Stop one with process(action=\"stop\", id=...) first", running, max)
+	}
+
+	cmd := exec.Command("bash", "-c", req.command)
+	cmd.Dir = req.cwd
+	if len(req.env) > 0 {
+		cmd.Env = append(os.Environ(), req.env...)
+	}
+	output := newRingBuffer(envInt("CLYDE_PROCESS_BUFFER_KB", defaultProcessBufferKB) * 1024)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	setProcessGroup(cmd)
+	if err := sandboxCommand(cmd); err != nil {
+		return "", err
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start '%s': %w", command, err)
+	}
+
+	cwd := req.cwd
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+
+	processMu.Lock()
+	id := fmt.Sprintf("p%d", nextProcessID)
+	nextProcessID++
+	p := &managedProcess{
+		id:      id,
+		command: command,
+		cwd:     cwd,
+		cmd:     cmd,
+		stdin:   stdin,
+		output:  output,
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	processes[id] = p
+	processMu.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+		p.mu.Lock()
+		p.exitCode = 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			p.exitCode = commandExitCode(exitErr)
+		} else if err != nil {
+			p.exitCode = -1
+		}
+		p.ended = time.Now()
+		p.mu.Unlock()
+		close(p.done)
+	}()
+
+	// Give fast-failing commands a moment so errors show up right away
+	select {
+	case <-p.done:
+		data, next, _ := output.ReadAt(0, defaultReadBytes)
+		return fmt.Sprintf("Process %s exited immediately with code %d (pid %d)\n\nOutput:\n%s\n[next_offset: %d]",
+			id, p.getExitCode(), cmd.Process.Pid, string(data), next), nil
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	return fmt.Sprintf("Started process %s (pid %d): %s\nWorking directory: %s\n\nUse process(action=\"read_output\", id=\"%s\") to see its output.",
+		id, cmd.Process.Pid, command, cwd, id), nil
+}
+
+func lookupProcess(input map[string]interface{}) (*managedProcess, error) {
+	id, _ := input["id"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("id is required. Use process(action=\"status\") to list processes")
+	}
+	processMu.Lock()
+	defer processMu.Unlock()
+	p, ok := processes[id]
+	if !ok {
+		return nil, fmt.Errorf("no process with id '%s'. Use process(action=\"status\") to list processes", id)
+	}
+	return p, nil
+}
+
+func processStatus(input map[string]interface{}) (string, error) {
+	if id, _ := input["id"].(string); id != "" {
+		p, err := lookupProcess(input)
+		if err != nil {
+			return "", err
+		}
+		return p.describe(), nil
+	}
+
+	list := ListProcesses()
+	if len(list) == 0 {
+		return "No background processes. Start one with process(action=\"start\", command=...)", nil
+	}
+	var lines []string
+	for _, info := range list {
+		processMu.Lock()
+		p := processes[info.ID]
+		processMu.Unlock()
+		lines = append(lines, p.describe())
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func readProcessOutput(input map[string]interface{}) (string, error) {
+	p, err := lookupProcess(input)
+	if err != nil {
+		return "", err
+	}
+
+	offset := int64(0)
+	if val, ok := input["offset"].(float64); ok && val > 0 {
+		offset = int64(val)
+	}
+	maxBytes := defaultReadBytes
+	if val, ok := input["max_bytes"].(float64); ok && val > 0 {
+		maxBytes = int(val)
+	}
+	wait := 0
+	if val, ok := input["wait_seconds"].(float64); ok && val > 0 {
+		wait = int(val)
+		if wait > maxReadWaitSeconds {
+			wait = maxReadWaitSeconds
+		}
+	}
+
+	// Optionally wait for something new to read
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	for p.output.Total() <= offset && p.isRunning() && time.Now().Before(deadline) {
+		select {
+		case <-p.done:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	data, next, dropped := p.output.ReadAt(offset, maxBytes)
+
+	var out strings.Builder
+	out.WriteString(p.describe())
+	out.WriteString("\n")
+	if dropped > 0 {
+		out.WriteString(fmt.Sprintf("[%d older bytes were discarded from the output buffer]\n", dropped))
+	}
+	if len(data) == 0 {
+		out.WriteString("(no new output)\n")
+	} else {
+		out.WriteString("\n")
+		out.Write(data)
+		if data[len(data)-1] != '\n' {
+			out.WriteString("\n")
+		}
+	}
+	if remaining := p.output.Total() - next; remaining > 0 {
+		out.WriteString(fmt.Sprintf("[%d more bytes available]\n", remaining))
+	}
+	out.WriteString(fmt.Sprintf("[next_offset: %d]", next))
+	return out.String(), nil
+}
+
+func sendProcessStdin(input map[string]interface{}) (string, error) {
+	p, err := lookupProcess(input)
+	if err != nil {
+		return "", err
+	}
+	if !p.isRunning() {
+		return "", fmt.Errorf("process %s has already exited (code %d)", p.id, p.getExitCode())
+	}
+
+	text, _ := input["input"].(string)
+	closeStdin, _ := input["close_stdin"].(bool)
+	if text == "" && !closeStdin {
+		return "", fmt.Errorf("input is required for send_stdin (or set close_stdin=true)")
+	}
+
+	if err := guardShellCommand("process", text); err != nil {
+		return "", err
+	}
+	autoCommitNoteShell()
+	if text != "" {
+		if _, err := io.WriteString(p.stdin, text); err != nil {
+			return "", fmt.Errorf("failed to write to process %s: %w", p.id, err)
+		}
+	}
+	if closeStdin {
+		p.stdin.Close()
+		return fmt.Sprintf("Sent %d bytes to %s and closed stdin", len(text), p.id), nil
+	}
+	return fmt.Sprintf("Sent %d bytes to %s", len(text), p.id), nil
+}
+
+func stopProcess(input map[string]interface{}) (string, error) {
+	p, err := lookupProcess(input)
+	if err != nil {
+		return "", err
+	}
+	if !p.isRunning() {
+		return fmt.Sprintf("Process %s had already exited with code %d", p.id, p.getExitCode()), nil
+	}
+
+	p.stop()
+	return fmt.Sprintf("Stopped process %s (%s)", p.id, p.command), nil
+}
+
+// stop terminates the process and all of its children
+func (p *managedProcess) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+
+	p.stdin.Close()
+	killProcessGroup(p.cmd)
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func (p *managedProcess) isRunning() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *managedProcess) getExitCode() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.exitCode
+}
+
+// describe renders a one-line status summary
+func (p *managedProcess) describe() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := fmt.Sprintf("running for %s", time.Since(p.started).Round(time.Second))
+	if !p.ended.IsZero() {
+		switch {
+		case p.stopped:
+			state = "stopped"
+		default:
+			state = fmt.Sprintf("exited with code %d", p.exitCode)
+		}
+	}
+	return fmt.Sprintf("%s (pid %d, %s): %s [%d bytes of output]",
+		p.id, p.cmd.Process.Pid, state, p.command, p.output.Total())
+}
+
+// ListProcesses returns all background processes started in this session,
+// oldest first
+func ListProcesses() []ProcessInfo {
+	processMu.Lock()
+	defer processMu.Unlock()
+
+	var list []ProcessInfo
+	for _, p := range processes {
+		p.mu.Lock()
+		info := ProcessInfo{
+			ID:       p.id,
+			Command:  p.command,
+			PID:      p.cmd.Process.Pid,
+			Running:  p.ended.IsZero(),
+			ExitCode: p.exitCode,
+			Started:  p.started,
+		}
+		if info.Running {
+			info.Uptime = time.Since(p.started)
+		} else {
+			info.Uptime = p.ended.Sub(p.started)
+		}
+		p.mu.Unlock()
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+// stopAllProcesses kills every running background process
+func stopAllProcesses() {
+	processMu.Lock()
+	var running []*managedProcess
+	for _, p := range processes {
+		if p.isRunning() {
+			running = append(running, p)
+		}
+	}
+	processMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range running {
+		wg.Add(1)
+		go func(p *managedProcess) {
+			defer wg.Done()
+			p.stop()
+		}(p)
+	}
+	wg.Wait()
+}
+
+func displayProcess(input map[string]interface{}) string {
+	action, _ := input["action"].(string)
+	id, _ := input["id"].(string)
+
+	switch action {
+	case "start":
+		command, _ := input["command"].(string)
+		if len(command) > 60 {
+			command = command[:57] + "..."
+		}
+		return fmt.Sprintf("→ Starting background process: %s", command)
+	case "status":
+		if id == "" {
+			return "→ Listing background processes"
+		}
+		return fmt.Sprintf("→ Checking process %s", id)
+	case "read_output":
+		return fmt.Sprintf("→ Reading output of process %s", id)
+	case "send_stdin":
+		return fmt.Sprintf("→ Sending input to process %s", id)
+	case "stop":
+		return fmt.Sprintf("→ Stopping process %s", id)
+	default:
+		return "→ Managing background processes"
+	}
+}
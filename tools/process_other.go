@@ -0,0 +1,20 @@
+//go:build !unix
+
+package tools
+
+import "os/exec"
+
+// setProcessGroup is a no-op on platforms without POSIX process groups
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// commandExitCode returns the command's exit status
+func commandExitCode(exitErr *exec.ExitError) int {
+	return exitErr.ExitCode()
+}
+
+// killProcessGroup kills the command itself; children may survive
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,47 @@
+//go:build unix
+
+package tools
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup starts cmd in a new process group so the command and
+// everything it spawns can be signalled together
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// commandExitCode returns the exit status the way a shell reports it:
+// 128+N for a process killed by signal N
+func commandExitCode(exitErr *exec.ExitError) int {
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
+
+// killProcessGroup sends SIGTERM to the command's process group, then
+// SIGKILL if anything is still alive after a short grace period
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	pgid := -cmd.Process.Pid
+	syscall.Kill(pgid, syscall.SIGTERM)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		// Signal 0 only checks whether the group still exists
+		if err := syscall.Kill(pgid, 0); err != nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	syscall.Kill(pgid, syscall.SIGKILL)
+}
@@ -0,0 +1,558 @@
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/this-is-alpha-iota/clyde/api"
+)
+
+func init() {
+	Register(profileTool, executeProfile, displayProfile)
+}
+
+var profileTool = api.Tool{
+	Name:        "profile",
+	Description: "Analyze a pprof profile file (CPU, heap, allocs, mutex, block, goroutine; gzipped protobuf as written by runtime/pprof or /debug/pprof). Actions: 'top' lists the functions with the highest flat or cumulative value, 'paths' shows the call paths leading to a function and what it calls, 'list' shows a function's source with the value of each line, mapping the profile's file paths onto local source files.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"file": map[string]interface{}{
+				"type":        "string",
+				"description": "Path to the profile file",
+			},
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"top", "paths", "list"},
+				"description": "What to show (default top)",
+			},
+			"function": map[string]interface{}{
+				"type":        "string",
+				"description": "For paths and list: regular expression matching function names, e.g. \"parseHeader\" or \"\\\\(\\\\*Server\\\\)\\\\.handle\"",
+			},
+			"sample_type": map[string]interface{}{
+				"type":        "string",
+				"description": "Which value to analyze when the profile has several, e.g. cpu, samples, inuse_space, alloc_space, alloc_objects, contentions, delay (default: the profile's default)",
+			},
+			"sort": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"flat", "cum"},
+				"description": "For top: order by flat (the function itself) or cum (including callees). Default flat",
+			},
+			"n": map[string]interface{}{
+				"type":        "integer",
+				"description": "Number of functions or paths to show (default 20)",
+			},
+			"source_dir": map[string]interface{}{
+				"type":        "string",
+				"description": "For list: local checkout to find source files in when the profile's paths are from another machine (default: current directory)",
+			},
+		},
+		"required": []string{"file"},
+	},
+}
+
+const (
+	defaultProfileTop    = 20
+	maxProfileTop        = 200
+	maxProfileListings   = 5
+	profileListContext   = 3
+	maxProfileListedLine = 400
+)
+
+// profileFrame is one function call on a sample's stack
+type profileFrame struct {
+	function, file string
+	line, start    int64
+}
+
+// profileView analyzes one sample value of a profile
+type profileView struct {
+	p     *profile.Profile
+	index int
+	name  string // the sample type, e.g. cpu or inuse_space
+	unit  string
+	total int64
+}
+
+func executeProfile(input map[string]interface{}, apiClient *api.Client, history []api.Message) (string, error) {
+	path, _ := input["file"].(string)
+	if path == "" {
+		return "", fmt.Errorf("file is required. Example: profile(file=\"cpu.pprof\", action=\"top\")")
+	}
+	if err := checkWorkspacePath(path); err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fileError(path, err)
+	}
+	defer f.Close()
+	p, err := profile.Parse(bufio.NewReader(f))
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not a pprof profile: %v", path, err)
+	}
+
+	view, err := newProfileView(p, stringInput(input, "sample_type"))
+	if err != nil {
+		return "", err
+	}
+	n := defaultProfileTop
+	if v, ok := input["n"].(float64); ok && v > 0 {
+		n = min(int(v), maxProfileTop)
+	}
+
+	header := view.header(path)
+	switch action := stringInput(input, "action"); action {
+	case "", "top":
+		return header + "\n\n" + view.top(n, stringInput(input, "sort") == "cum"), nil
+	case "paths", "list":
+		pattern := stringInput(input, "function")
+		if pattern == "" {
+			return "", fmt.Errorf("function is required for %s, e.g. profile(file=\"%s\", action=\"%s\", function=\"parseHeader\")", action, path, action)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid function pattern: %v", err)
+		}
+		functions := view.matchFunctions(re)
+		if len(functions) == 0 {
+			return "", fmt.Errorf("no function in the profile matches '%s'. Use action=\"top\" to see the function names", pattern)
+		}
+		if action == "paths" {
+			return header + "\n\n" + view.paths(re, functions, n), nil
+		}
+		sourceDir := stringInput(input, "source_dir")
+		if sourceDir == "" {
+			sourceDir = "."
+		}
+		if err := checkWorkspacePath(sourceDir); err != nil {
+			return "", err
+		}
+		return header + "\n\n" + view.list(functions, sourceDir), nil
+	default:
+		return "", fmt.Errorf("unknown action '%s'. Use top, paths or list", action)
+	}
+}
+
+func stringInput(input map[string]interface{}, key string) string {
+	s, _ := input[key].(string)
+	return strings.TrimSpace(s)
+}
+
+// newProfileView selects a sample type by name, defaulting to the
+// profile's default type or else the last one, as pprof does
+func newProfileView(p *profile.Profile, sampleType string) (*profileView, error) {
+	if len(p.SampleType) == 0 {
+		return nil, fmt.Errorf("the profile has no sample types")
+	}
+	index := len(p.SampleType) - 1
+	if sampleType == "" {
+		sampleType = p.DefaultSampleType
+	}
+	if sampleType != "" {
+		index = -1
+		var names []string
+		for i, st := range p.SampleType {
+			names = append(names, st.Type)
+			if st.Type == sampleType {
+				index = i
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("the profile has no '%s' samples. Available sample types: %s", sampleType, strings.Join(names, ", "))
+		}
+	}
+	v := &profileView{p: p, index: index, name: p.SampleType[index].Type, unit: p.SampleType[index].Unit}
+	for _, s := range p.Sample {
+		v.total += s.Value[index]
+	}
+	return v, nil
+}
+
+// frames returns a sample's stack, innermost call first, with inlined
+// calls expanded
+func frames(s *profile.Sample) []profileFrame {
+	var out []profileFrame
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			f := profileFrame{function: "?", line: line.Line}
+			if line.Function != nil {
+				f.function, f.file, f.start = line.Function.Name, line.Function.Filename, line.Function.StartLine
+			}
+			out = append(out, f)
+		}
+		if len(loc.Line) == 0 {
+			out = append(out, profileFrame{function: fmt.Sprintf("0x%x", loc.Address)})
+		}
+	}
+	return out
+}
+
+func (v *profileView) header(path string) string {
+	var parts []string
+	parts = append(parts, "Type: "+v.name)
+	if v.p.DurationNanos > 0 {
+		parts = append(parts, "Duration: "+formatProfileDuration(v.p.DurationNanos))
+	}
+	total := "Total: " + v.format(v.total)
+	if v.unit == "nanoseconds" && v.p.DurationNanos > 0 {
+		total += fmt.Sprintf(" (%.1f%% of the duration)", float64(v.total)/float64(v.p.DurationNanos)*100)
+	}
+	parts = append(parts, total, fmt.Sprintf("%d samples", len(v.p.Sample)))
+	if v.p.TimeNanos > 0 {
+		parts = append(parts, "taken "+time.Unix(0, v.p.TimeNanos).Format("2006-01-02 15:04"))
+	}
+	var others []string
+	for i, st := range v.p.SampleType {
+		if i != v.index {
+			others = append(others, st.Type)
+		}
+	}
+	out := fmt.Sprintf("Profile %s\n%s", displayName(path), strings.Join(parts, " · "))
+	if len(others) > 0 {
+		out += fmt.Sprintf("\nOther sample types: %s (pass sample_type to switch)", strings.Join(others, ", "))
+	}
+	return out
+}
+
+func (v *profileView) value(s *profile.Sample) int64 { return s.Value[v.index] }
+
+// top lists functions by flat or cumulative value, like pprof -top
+func (v *profileView) top(n int, byCum bool) string {
+	flat := make(map[string]int64)
+	cum := make(map[string]int64)
+	for _, s := range v.p.Sample {
+		value := v.value(s)
+		stack := frames(s)
+		if len(stack) == 0 {
+			continue
+		}
+		flat[stack[0].function] += value
+		seen := make(map[string]bool)
+		for _, f := range stack {
+			if !seen[f.function] {
+				seen[f.function] = true
+				cum[f.function] += value
+			}
+		}
+	}
+	names := make([]string, 0, len(cum))
+	for name := range cum {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := flat[names[i]], flat[names[j]]
+		if byCum {
+			a, b = cum[names[i]], cum[names[j]]
+		}
+		if a != b {
+			return a > b
+		}
+		return names[i] < names[j]
+	})
+
+	order := "flat"
+	if byCum {
+		order = "cum"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Top %d of %d functions by %s:\n", min(n, len(names)), len(names), order)
+	fmt.Fprintf(&b, "%10s %7s %7s %10s %7s\n", "flat", "flat%", "sum%", "cum", "cum%")
+	var sum int64
+	for i, name := range names {
+		if i == n {
+			break
+		}
+		sum += flat[name]
+		fmt.Fprintf(&b, "%10s %7s %7s %10s %7s  %s\n", v.format(flat[name]), v.percent(flat[name]), v.percent(sum), v.format(cum[name]), v.percent(cum[name]), name)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// matchFunctions returns the names of the functions matching re, most
+// expensive first
+func (v *profileView) matchFunctions(re *regexp.Regexp) []string {
+	cum := make(map[string]int64)
+	for _, s := range v.p.Sample {
+		seen := make(map[string]bool)
+		for _, f := range frames(s) {
+			if !seen[f.function] && re.MatchString(f.function) {
+				seen[f.function] = true
+				cum[f.function] += v.value(s)
+			}
+		}
+	}
+	names := make([]string, 0, len(cum))
+	for name := range cum {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if cum[names[i]] != cum[names[j]] {
+			return cum[names[i]] > cum[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// paths shows, for each matching function, the distinct call paths from
+// the root of the stack to it and the functions it calls directly
+func (v *profileView) paths(re *regexp.Regexp, functions []string, n int) string {
+	var b strings.Builder
+	for i, target := range functions {
+		if i == maxProfileListings {
+			fmt.Fprintf(&b, "\n%d more functions match: %s\n", len(functions)-i, strings.Join(functions[i:], ", "))
+			break
+		}
+		pathValues := make(map[string]int64)
+		callees := make(map[string]int64)
+		var total, self int64
+		for _, s := range v.p.Sample {
+			stack := frames(s)
+			// The outermost call of the target, so recursion shows once
+			at := -1
+			for j := len(stack) - 1; j >= 0; j-- {
+				if stack[j].function == target {
+					at = j
+					break
+				}
+			}
+			if at < 0 {
+				continue
+			}
+			value := v.value(s)
+			total += value
+			var path []string
+			for j := len(stack) - 1; j >= at; j-- {
+				path = append(path, stack[j].function)
+			}
+			pathValues[strings.Join(path, " → ")] += value
+			if at == 0 {
+				self += value
+			} else {
+				callees[stack[at-1].function] += value
+			}
+		}
+
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s: %s cumulative (%s), %s in the function itself\n", target, v.format(total), v.percent(total), v.format(self))
+		b.WriteString("\nCall paths (outermost caller first):\n")
+		for j, path := range sortedByValue(pathValues) {
+			if j == n {
+				fmt.Fprintf(&b, "  ... %d more paths\n", len(pathValues)-n)
+				break
+			}
+			fmt.Fprintf(&b, "%10s %7s  %s\n", v.format(pathValues[path]), v.percentOf(pathValues[path], total), path)
+		}
+		if len(callees) > 0 {
+			b.WriteString("\nCalls:\n")
+			for j, callee := range sortedByValue(callees) {
+				if j == n {
+					fmt.Fprintf(&b, "  ... %d more callees\n", len(callees)-n)
+					break
+				}
+				fmt.Fprintf(&b, "%10s %7s  %s\n", v.format(callees[callee]), v.percentOf(callees[callee], total), callee)
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// list shows each matching function's source with the flat and
+// cumulative value of every line
+func (v *profileView) list(functions []string, sourceDir string) string {
+	var b strings.Builder
+	for i, target := range functions {
+		if i == maxProfileListings {
+			fmt.Fprintf(&b, "\n%d more functions match: %s\n", len(functions)-i, strings.Join(functions[i:], ", "))
+			break
+		}
+		flat := make(map[int64]int64)
+		cum := make(map[int64]int64)
+		var file string
+		var start int64
+		for _, s := range v.p.Sample {
+			value := v.value(s)
+			seen := make(map[int64]bool)
+			for j, f := range frames(s) {
+				if f.function != target {
+					continue
+				}
+				file, start = f.file, f.start
+				if j == 0 {
+					flat[f.line] += value
+				}
+				if !seen[f.line] {
+					seen[f.line] = true
+					cum[f.line] += value
+				}
+			}
+		}
+
+		var total int64
+		var lines []int64
+		for line := range cum {
+			lines = append(lines, line)
+		}
+		sort.Slice(lines, func(i, j int) bool { return lines[i] < lines[j] })
+		for _, s := range v.p.Sample {
+			for _, f := range frames(s) {
+				if f.function == target {
+					total += v.value(s)
+					break
+				}
+			}
+		}
+
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "ROUTINE %s: %s cumulative (%s)\n", target, v.format(total), v.percent(total))
+		source, local := readProfileSource(file, sourceDir)
+		if source == nil {
+			if file != "" {
+				fmt.Fprintf(&b, "Source %s not found locally (%s); set source_dir to your checkout. Lines with samples:\n", file, local)
+			}
+			fmt.Fprintf(&b, "%10s %10s  %s\n", "flat", "cum", "line")
+			for _, line := range lines {
+				fmt.Fprintf(&b, "%10s %10s  %d\n", v.formatOrDot(flat[line]), v.formatOrDot(cum[line]), line)
+			}
+			continue
+		}
+
+		fmt.Fprintf(&b, "%s\n", displayName(relativePath(local)))
+		from, to := start, int64(0)
+		if len(lines) > 0 {
+			if from <= 0 || from > lines[0] {
+				from = lines[0] - profileListContext
+			}
+			to = lines[len(lines)-1] + profileListContext
+		}
+		from = max(from, 1)
+		to = min(to, int64(len(source)), from+maxProfileListedLine)
+		fmt.Fprintf(&b, "%10s %10s  %5s\n", "flat", "cum", "line")
+		for line := from; line <= to; line++ {
+			fmt.Fprintf(&b, "%10s %10s  %5d  %s\n", v.formatOrDot(flat[line]), v.formatOrDot(cum[line]), line, strings.TrimRight(source[line-1], " \t"))
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// readProfileSource finds a profile's source file locally: at its recorded
+// path, or else at the longest suffix of that path that exists under
+// sourceDir, so /build/src/github.com/org/app/server/handler.go matches
+// server/handler.go in a checkout of the app. It returns the file's lines
+// and the path used, or nil and a reason.
+func readProfileSource(file, sourceDir string) ([]string, string) {
+	if file == "" {
+		return nil, "no file recorded"
+	}
+	candidates := []string{file}
+	parts := strings.Split(filepath.ToSlash(file), "/")
+	for i := 1; i < len(parts); i++ {
+		if rest := filepath.Join(parts[i:]...); rest != "" {
+			candidates = append(candidates, filepath.Join(sourceDir, rest))
+		}
+	}
+	reason := "no matching file under " + displayName(sourceDir)
+	for _, c := range candidates {
+		if info, err := os.Stat(c); err != nil || info.IsDir() {
+			continue
+		}
+		if err := checkWorkspacePath(c); err != nil {
+			reason = "outside the workspace"
+			continue
+		}
+		data, err := os.ReadFile(c)
+		if err != nil {
+			continue
+		}
+		return strings.Split(string(data), "\n"), c
+	}
+	return nil, reason
+}
+
+func sortedByValue(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func (v *profileView) percent(value int64) string { return v.percentOf(value, v.total) }
+
+func (v *profileView) percentOf(value, total int64) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.2f%%", float64(value)/float64(total)*100)
+}
+
+func (v *profileView) formatOrDot(value int64) string {
+	if value == 0 {
+		return "."
+	}
+	return v.format(value)
+}
+
+// format renders a value in the sample type's unit
+func (v *profileView) format(value int64) string {
+	switch v.unit {
+	case "nanoseconds":
+		return formatProfileDuration(value)
+	case "bytes":
+		f := float64(value)
+		switch {
+		case f >= 1<<30 || f <= -(1<<30):
+			return fmt.Sprintf("%.2fGB", f/(1<<30))
+		case f >= 1<<20 || f <= -(1<<20):
+			return fmt.Sprintf("%.2fMB", f/(1<<20))
+		case f >= 1<<10 || f <= -(1<<10):
+			return fmt.Sprintf("%.2fkB", f/(1<<10))
+		}
+		return fmt.Sprintf("%dB", value)
+	}
+	return fmt.Sprintf("%d", value)
+}
+
+func formatProfileDuration(ns int64) string {
+	d := time.Duration(ns)
+	switch {
+	case d >= time.Second || d <= -time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond || d <= -time.Millisecond:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	case d >= time.Microsecond || d <= -time.Microsecond:
+		return fmt.Sprintf("%.2fµs", float64(d)/float64(time.Microsecond))
+	}
+	return fmt.Sprintf("%dns", ns)
+}
+
+func displayProfile(input map[string]interface{}) string {
+	file, _ := input["file"].(string)
+	action := stringInput(input, "action")
+	if action == "" {
+		action = "top"
+	}
+	if function := stringInput(input, "function"); function != "" && action != "top" {
+		return fmt.Sprintf("→ Profile %s: %s %s", action, function, file)
+	}
+	return fmt.Sprintf("→ Profile %s: %s", action, file)
+}
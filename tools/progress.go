@@ -0,0 +1,29 @@
+package tools
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	progressMu       sync.Mutex
+	progressReporter func(string)
+)
+
+// SetProgressReporter sets where tools send status messages while they run,
+// such as cache hits. The agent points it at its progress callback.
+func SetProgressReporter(fn func(string)) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progressReporter = fn
+}
+
+// reportProgress sends a status message to the UI, if anyone is listening
+func reportProgress(format string, args ...interface{}) {
+	progressMu.Lock()
+	fn := progressReporter
+	progressMu.Unlock()
+	if fn != nil {
+		fn(fmt.Sprintf(format, args...))
+	}
+}
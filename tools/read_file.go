@@ -30,6 +30,9 @@ func executeReadFile(input map[string]interface{}, apiClient *api.Client, conver
 	if !ok || path == "" {
 		return "", fmt.Errorf("file path is required. Example: read_file(\"main.go\")")
 	}
+	if err := checkWorkspacePath(path); err != nil {
+		return "", err
+	}
 
 	// Check if file exists first
 	info, err := os.Stat(path)
@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// A small readability-style extractor: strip page chrome (navigation,
+// footers, cookie banners, ads), then pick the element that holds most of
+// the paragraph text. Pages that mark up their content with <main> or
+// <article> are trusted as-is.
+
+// boilerplateSelector matches elements that are never main content
+const boilerplateSelector = "script, style, noscript, template, svg, canvas, iframe, object, embed, " +
+	"form, button, input, select, textarea, dialog, nav, aside, footer, " +
+	"[role=navigation], [role=banner], [role=contentinfo], [role=complementary], [role=dialog], " +
+	"[aria-hidden=true], [hidden]"
+
+var (
+	// unlikelyCandidate matches class/id values of page chrome
+	unlikelyCandidate = regexp.MustCompile(`(?i)cookie|consent|gdpr|banner|newsletter|subscribe|signup|popup|modal|overlay|` +
+		`share|social|advert|\bads?\b|sponsor|promo|breadcrumb|sidebar|related|recommend|comment|disqus|` +
+		`footer|masthead|navbar|\bnav\b|menu|skip-link|toolbar|pagination`)
+	// maybeCandidate rescues elements whose names also suggest content
+	maybeCandidate = regexp.MustCompile(`(?i)article|body|content|main|post|entry|story|text|column|doc`)
+)
+
+// minReadableChars is how much text a candidate needs before it is trusted
+// over the whole (cleaned) body
+const minReadableChars = 200
+
+// extractReadable removes boilerplate from doc and returns the selection
+// holding the main content, along with the page title
+func extractReadable(doc *goquery.Document) (*goquery.Selection, string) {
+	title := pageTitle(doc)
+
+	doc.Find(boilerplateSelector).Remove()
+	doc.Find("header").Each(func(_ int, s *goquery.Selection) {
+		// Article headers carry the title; site headers are chrome
+		if s.Closest("article, main, [role=main]").Length() == 0 {
+			s.Remove()
+		}
+	})
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		if s.Is("html, body, main, article, table, tbody, thead, tr, td, th, pre, code") {
+			return
+		}
+		class, _ := s.Attr("class")
+		id, _ := s.Attr("id")
+		names := class + " " + id
+		if unlikelyCandidate.MatchString(names) && !maybeCandidate.MatchString(names) {
+			s.Remove()
+		}
+	})
+
+	body := doc.Find("body")
+	if body.Length() == 0 {
+		body = doc.Selection
+	}
+
+	// Explicit content markup wins when it has real text
+	var best *goquery.Selection
+	bestLen := 0
+	doc.Find("main, article, [role=main]").Each(func(_ int, s *goquery.Selection) {
+		if n := textLength(s); n > bestLen {
+			best, bestLen = s, n
+		}
+	})
+	if best != nil && bestLen >= minReadableChars {
+		return best, title
+	}
+
+	if candidate := bestScoredCandidate(doc); candidate != nil && textLength(candidate) >= minReadableChars {
+		return candidate, title
+	}
+	return body, title
+}
+
+// bestScoredCandidate scores the parents of paragraph-like elements by the
+// amount of prose they contain, discounted by link density
+func bestScoredCandidate(doc *goquery.Document) *goquery.Selection {
+	scores := make(map[*html.Node]float64)
+	add := func(s *goquery.Selection, score float64) {
+		if s.Length() > 0 && !s.Is("html") {
+			scores[s.Get(0)] += score
+		}
+	}
+
+	doc.Find("p, pre, blockquote, li, td, dd").Each(func(_ int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + float64(min(len(text)/100, 3))
+		parent := s.Parent()
+		add(parent, score)
+		add(parent.Parent(), score/2)
+	})
+
+	// Walk in document order so ties go to the earliest element, the same
+	// one on every run
+	var best *goquery.Selection
+	bestScore := 0.0
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		score, ok := scores[s.Get(0)]
+		if !ok {
+			return
+		}
+		score *= 1 - linkDensity(s)
+		if score > bestScore {
+			best, bestScore = s, score
+		}
+	})
+	return best
+}
+
+// linkDensity is the share of an element's text that sits inside links
+func linkDensity(s *goquery.Selection) float64 {
+	total := textLength(s)
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		links += textLength(a)
+	})
+	return float64(links) / float64(total)
+}
+
+func textLength(s *goquery.Selection) int {
+	return len(strings.Join(strings.Fields(s.Text()), " "))
+}
+
+// pageTitle prefers the document title, then og:title, then the first h1
+func pageTitle(doc *goquery.Document) string {
+	if title := strings.TrimSpace(doc.Find("title").First().Text()); title != "" {
+		return strings.Join(strings.Fields(title), " ")
+	}
+	if title, ok := doc.Find(`meta[property="og:title"]`).Attr("content"); ok && strings.TrimSpace(title) != "" {
+		return strings.TrimSpace(title)
+	}
+	return strings.Join(strings.Fields(doc.Find("h1").First().Text()), " ")
+}
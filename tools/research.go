@@ -0,0 +1,284 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/this-is-alpha-iota/clyde/api"
+)
+
+func init() {
+	Register(researchTool, executeResearch, displayResearch)
+}
+
+var researchTool = api.Tool{
+	Name:        "research",
+	Description: "Answer a question from the web in one step: search, read the top results, pull out the passages that matter and return a short synthesized answer citing numbered source URLs. Pages are read outside the conversation, so only the answer comes back. Use instead of web_search followed by several browse calls when you need facts rather than a specific page.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"question": map[string]interface{}{
+				"type":        "string",
+				"description": "The question to answer, as specific as possible",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: search query to use instead of the question",
+			},
+			"num_sources": map[string]interface{}{
+				"type":        "integer",
+				"description": "Number of pages to read (1-8, default 4)",
+				"default":     defaultResearchSources,
+			},
+			"site": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: only use pages from this domain, e.g. 'go.dev'",
+			},
+			"freshness": map[string]interface{}{
+				"type":        "string",
+				"enum":        searchFreshness,
+				"description": "Optional: only use pages published within this window",
+			},
+			"refresh": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Optional: bypass cached search results and pages (default false)",
+			},
+		},
+		"required": []string{"question"},
+	},
+}
+
+const (
+	defaultResearchSources     = 4
+	maxResearchSources         = 8
+	defaultResearchConcurrency = 4
+	defaultResearchPageKB      = 40
+)
+
+const researchExtractPrompt = "You extract evidence from web pages. Quote or closely paraphrase only the passages of the page that help answer the question, keeping numbers, versions, names and code exactly as written. Be brief. If the page contains nothing relevant, reply with exactly NONE."
+
+const researchSynthesisPrompt = "You answer questions from numbered source extracts. Write a concise, direct answer using only the extracts. Cite sources inline as [n] after the statements they support. If the sources disagree, say so. If they don't answer the question, say what is missing. Do not list the sources at the end."
+
+// researchSource is one search result as it moves through the pipeline
+type researchSource struct {
+	result  SearchResult
+	page    *browsePage
+	extract string
+	err     error
+}
+
+func executeResearch(input map[string]interface{}, apiClient *api.Client, conversationHistory []api.Message) (string, error) {
+	question, _ := input["question"].(string)
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return "", fmt.Errorf("question is required. Example: research(\"What is the default GOMAXPROCS in Go 1.25?\")")
+	}
+	if apiClient == nil {
+		return "", fmt.Errorf("research needs an API client to read pages. Use web_search and browse instead")
+	}
+
+	numSources := defaultResearchSources
+	if numVal, ok := input["num_sources"].(float64); ok && numVal > 0 {
+		numSources = min(int(numVal), maxResearchSources)
+	}
+
+	q := SearchQuery{Query: question, Count: min(numSources*2, 10)}
+	if query, _ := input["query"].(string); strings.TrimSpace(query) != "" {
+		q.Query = strings.TrimSpace(query)
+	}
+	q.Site, _ = input["site"].(string)
+	q.Site = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(q.Site, "https://"), "http://"), "/")
+	q.Freshness, _ = input["freshness"].(string)
+	if q.Freshness != "" && !slices.Contains(searchFreshness, q.Freshness) {
+		return "", fmt.Errorf("invalid freshness '%s'. Use one of: %s", q.Freshness, strings.Join(searchFreshness, ", "))
+	}
+	q.Refresh, _ = input["refresh"].(bool)
+
+	results, provider, err := runSearch(q)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return fmt.Sprintf("No search results for '%s'. Try a more general query.", q.Query), nil
+	}
+	reportProgress("  🔎 %d results via %s, reading up to %d", len(results), provider, numSources)
+
+	sources := fetchResearchSources(results, numSources, q.Refresh)
+	var read []*researchSource
+	for _, s := range sources {
+		if s.page != nil {
+			read = append(read, s)
+		}
+	}
+	if len(read) == 0 {
+		return "", fmt.Errorf("could not read any of the search results for '%s':\n\n%s", q.Query, formatSkippedSources(sources))
+	}
+
+	extractResearchPassages(apiClient, question, read)
+
+	// Only pages with relevant passages become numbered sources
+	var cited []*researchSource
+	for _, s := range read {
+		if s.err == nil && s.extract != "" {
+			cited = append(cited, s)
+		}
+	}
+	if len(cited) == 0 {
+		return fmt.Sprintf("None of the %d pages read had information relevant to the question.\n\n%s", len(read), formatSkippedSources(sources)), nil
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Question: %s\n\n", question)
+	for i, s := range cited {
+		fmt.Fprintf(&prompt, "[%d] %s (%s)\n%s\n\n", i+1, s.page.title, s.page.url, s.extract)
+	}
+	reportProgress("  ✍️  Synthesizing answer from %d sources", len(cited))
+	answer, err := secondaryCall(apiClient, researchSynthesisPrompt, prompt.String(), secondaryMaxTokens())
+	if err != nil {
+		return "", fmt.Errorf("failed to synthesize an answer: %w", err)
+	}
+
+	var output strings.Builder
+	output.WriteString(strings.TrimSpace(answer))
+	output.WriteString("\n\nSources:\n")
+	for i, s := range cited {
+		fmt.Fprintf(&output, "[%d] %s - %s\n", i+1, firstNonEmpty(s.page.title, s.result.Title), s.page.url)
+	}
+	if skipped := formatSkippedSources(sources); skipped != "" {
+		output.WriteString("\n")
+		output.WriteString(skipped)
+	}
+	return strings.TrimRight(output.String(), "\n"), nil
+}
+
+// fetchResearchSources reads search results concurrently until want pages
+// have loaded. When a fetch fails the next result takes its place, so a
+// dead link doesn't cost a source. Sources come back in search-rank order;
+// results never tried have neither a page nor an error.
+func fetchResearchSources(results []SearchResult, want int, refresh bool) []*researchSource {
+	sources := make([]*researchSource, len(results))
+	for i, r := range results {
+		sources[i] = &researchSource{result: r}
+	}
+
+	var (
+		mu     sync.Mutex
+		next   int
+		loaded int
+		wg     sync.WaitGroup
+	)
+	// take hands out the next result to fetch, or -1 once enough pages
+	// have loaded or are in flight
+	inFlight := 0
+	take := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= len(sources) || loaded+inFlight >= want {
+			return -1
+		}
+		next++
+		inFlight++
+		return next - 1
+	}
+
+	workers := max(envInt("CLYDE_RESEARCH_CONCURRENCY", defaultResearchConcurrency), 1)
+	for w := 0; w < min(workers, want); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := take(); i >= 0; i = take() {
+				s := sources[i]
+				page, err := loadPage(s.result.URL, refresh, browseOptions{})
+				mu.Lock()
+				inFlight--
+				if err == nil {
+					s.page = page
+					loaded++
+				} else {
+					s.err = err
+				}
+				mu.Unlock()
+				if err == nil {
+					reportProgress("  📄 Read %s", s.result.URL)
+				} else {
+					reportProgress("  ⚠️  Skipped %s: %s", s.result.URL, firstLine(err.Error()))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return sources
+}
+
+// extractResearchPassages asks the secondary model, one call per page in
+// parallel, for the passages relevant to the question. Pages with nothing
+// relevant are left with an empty extract.
+func extractResearchPassages(apiClient *api.Client, question string, sources []*researchSource) {
+	maxChars := max(envInt("CLYDE_RESEARCH_PAGE_KB", defaultResearchPageKB), 1) * 1024
+	sem := make(chan struct{}, max(envInt("CLYDE_RESEARCH_CONCURRENCY", defaultResearchConcurrency), 1))
+	var wg sync.WaitGroup
+	for _, s := range sources {
+		wg.Add(1)
+		go func(s *researchSource) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			content := s.page.markdown
+			if len(content) > maxChars {
+				content = strings.ToValidUTF8(content[:maxChars], "") + "\n\n[Page truncated]"
+			}
+			prompt := fmt.Sprintf("Question: %s\n\nPage: %s\nURL: %s\n\n%s", question, s.page.title, s.page.url, content)
+			extract, err := secondaryCall(apiClient, researchExtractPrompt, prompt, secondaryMaxTokens())
+			if err != nil {
+				s.err = fmt.Errorf("extraction failed: %w", err)
+				return
+			}
+			extract = strings.TrimSpace(extract)
+			if strings.EqualFold(strings.Trim(extract, ". "), "NONE") {
+				extract = ""
+			}
+			s.extract = extract
+		}(s)
+	}
+	wg.Wait()
+}
+
+// formatSkippedSources lists the results that were tried but didn't make
+// it into the answer, with the reason
+func formatSkippedSources(sources []*researchSource) string {
+	var lines []string
+	for _, s := range sources {
+		switch {
+		case s.err != nil:
+			lines = append(lines, fmt.Sprintf("  - %s (%s)", s.result.URL, firstLine(s.err.Error())))
+		case s.page != nil && s.extract == "":
+			lines = append(lines, fmt.Sprintf("  - %s (nothing relevant)", s.result.URL))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "Skipped:\n" + strings.Join(lines, "\n")
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+func displayResearch(input map[string]interface{}) string {
+	question, _ := input["question"].(string)
+
+	// Truncate long questions for display
+	displayQuestion := question
+	if len(displayQuestion) > 60 {
+		displayQuestion = displayQuestion[:57] + "..."
+	}
+	if site, _ := input["site"].(string); site != "" {
+		return fmt.Sprintf("→ Researching: \"%s\" (site:%s)", displayQuestion, site)
+	}
+	return fmt.Sprintf("→ Researching: \"%s\"", displayQuestion)
+}
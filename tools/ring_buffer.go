@@ -0,0 +1,78 @@
+package tools
+
+import "sync"
+
+// ringBuffer keeps the most recent size bytes of a stream and addresses them
+// by absolute offset, so readers can poll incrementally and learn how much
+// output was dropped in between.
+type ringBuffer struct {
+	mu    sync.Mutex
+	buf   []byte
+	size  int
+	total int64 // bytes ever written
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{size: size}
+}
+
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.total += int64(len(p))
+	if len(p) >= r.size {
+		r.buf = append(r.buf[:0], p[len(p)-r.size:]...)
+		return len(p), nil
+	}
+
+	// Let the slice grow to twice the window before compacting, so eviction
+	// is amortized instead of a copy on every write
+	r.buf = append(r.buf, p...)
+	if len(r.buf) > 2*r.size {
+		r.buf = append(r.buf[:0], r.buf[len(r.buf)-r.size:]...)
+	}
+	return len(p), nil
+}
+
+// retained returns the bytes currently inside the window. Caller must hold r.mu.
+func (r *ringBuffer) retained() []byte {
+	if len(r.buf) > r.size {
+		return r.buf[len(r.buf)-r.size:]
+	}
+	return r.buf
+}
+
+// Total returns the number of bytes ever written
+func (r *ringBuffer) Total() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
+
+// ReadAt returns up to max bytes starting at the absolute offset. If the
+// offset has already been evicted, reading starts at the oldest retained
+// byte and dropped reports how many bytes were skipped. next is the offset
+// to pass on the following call.
+func (r *ringBuffer) ReadAt(offset int64, max int) (data []byte, next int64, dropped int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	window := r.retained()
+	start := r.total - int64(len(window))
+	if offset < start {
+		dropped = start - offset
+		offset = start
+	}
+	if offset > r.total {
+		offset = r.total
+	}
+
+	from := int(offset - start)
+	to := len(window)
+	if max > 0 && to-from > max {
+		to = from + max
+	}
+	data = append([]byte(nil), window[from:to]...)
+	return data, offset + int64(len(data)), dropped
+}
@@ -0,0 +1,181 @@
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// crawlUserAgent identifies the crawler to servers and robots.txt
+const crawlUserAgent = "clyde-crawler/1.0 (+https://github.com/this-is-alpha-iota/clyde)"
+
+// robotsRules is the part of a robots.txt that applies to the crawler
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	disallowed bool // robots.txt couldn't be fetched; treat the site as off limits
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// fetchRobots downloads and parses robots.txt for the URL's host, following
+// RFC 9309: a 4xx means no restrictions, while a 5xx or network error means
+// the whole site is off limits until robots.txt can be read.
+func fetchRobots(u *url.URL) (*robotsRules, error) {
+	robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	req, err := http.NewRequest("GET", robotsURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", crawlUserAgent)
+
+	resp, err := fetchURL("crawl", req, 15*time.Second)
+	if err != nil {
+		if isEgressBlocked(err) {
+			return nil, err
+		}
+		return &robotsRules{disallowed: true}, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return &robotsRules{disallowed: true}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &robotsRules{}, nil
+	}
+	body, _, err := readLimited(resp.Body, 512*1024)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read robots.txt: %w", err)
+	}
+	return parseRobots(string(body), "clyde"), nil
+}
+
+// parseRobots returns the rules of the group naming agent, or of the "*"
+// group when no group names it. Consecutive User-agent lines share a group.
+func parseRobots(content, agent string) *robotsRules {
+	type group struct {
+		agents []string
+		rules  robotsRules
+	}
+	var groups []*group
+	var current *group
+	inAgents := false
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			if value != "" {
+				current.agents = append(current.agents, strings.ToLower(value))
+			}
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules.rules = append(current.rules.rules, robotsRule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+				current.rules.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	var fallback *robotsRules
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a == "*" {
+				if fallback == nil {
+					fallback = &g.rules
+				}
+			} else if strings.Contains(agent, a) || strings.Contains(a, agent) {
+				return &g.rules
+			}
+		}
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return &robotsRules{}
+}
+
+// allowed reports whether the crawler may fetch u. The longest matching
+// pattern wins, and Allow wins a tie.
+func (r *robotsRules) allowed(u *url.URL) bool {
+	if r.disallowed {
+		return false
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	best, allow := -1, true
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > best || (len(rule.pattern) == best && rule.allow) {
+			best, allow = len(rule.pattern), rule.allow
+		}
+	}
+	return allow
+}
+
+// robotsMatch matches a robots.txt path pattern, where * matches any run of
+// characters and a trailing $ anchors the end
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(path[pos:], part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+	return !anchored || pos == len(path)
+}
@@ -3,8 +3,11 @@ package tools
 import (
 	"github.com/this-is-alpha-iota/clyde/api"
 	"fmt"
+	"os"
 	"os/exec"
+	"sort"
 	"strings"
+	"time"
 )
 
 func init() {
@@ -13,7 +16,7 @@ func init() {
 
 var runBashTool = api.Tool{
 	Name:        "run_bash",
-	Description: "Execute arbitrary bash commands and return the output. Use this for running shell commands, scripts, or any command-line operations.",
+	Description: "Execute arbitrary bash commands and return the output. Use this for running shell commands, scripts, or any command-line operations. Commands are killed (with all their child processes) when they exceed the timeout. Long output is truncated to its head and tail; the full output is saved to a temp file you can read with read_file. With persistent=true, commands run in a long-lived shell so cd, export, source and virtualenv activation carry over between calls.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
@@ -21,80 +24,318 @@ var runBashTool = api.Tool{
 				"type":        "string",
 				"description": "The bash command to execute. Can be any valid bash command or script.",
 			},
+			"timeout_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": "Kill the command after this many seconds (default 120, max 600)",
+			},
+			"cwd": map[string]interface{}{
+				"type":        "string",
+				"description": "Directory to run the command in. Defaults to the current directory.",
+			},
+			"env": map[string]interface{}{
+				"type":        "object",
+				"description": "Extra environment variables for this command, e.g. {\"GOFLAGS\": \"-count=1\"}",
+				"additionalProperties": map[string]interface{}{
+					"type": "string",
+				},
+			},
+			"persistent": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Run in the persistent shell session so directory changes and exported variables carry over (default from CLYDE_BASH_PERSISTENT, normally false). In persistent mode cwd and env also persist.",
+			},
+			"reset": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Restart the persistent shell session with a clean state before running command. Pass an empty command to only reset.",
+			},
 		},
 		"required": []string{"command"},
 	},
 }
 
+// run_bash defaults, overridable in ~/.clyde/config
+const (
+	defaultBashTimeoutSeconds = 120 // CLYDE_BASH_TIMEOUT_SECONDS
+	maxBashTimeoutSeconds     = 600 // CLYDE_BASH_MAX_TIMEOUT_SECONDS
+	defaultBashOutputKB       = 30  // CLYDE_BASH_MAX_OUTPUT_KB, per stream
+)
+
+// bashRequest describes a single run_bash invocation
+type bashRequest struct {
+	command string
+	cwd     string
+	env     []string // KEY=VALUE pairs added to the inherited environment
+	timeout time.Duration
+}
+
+// bashResult holds the outcome of a command
+type bashResult struct {
+	stdout   *outputCapture
+	stderr   *outputCapture
+	exitCode int
+	timedOut bool
+	notes    []string // extra information appended to the output
+}
+
 func executeRunBash(input map[string]interface{}, apiClient *api.Client, conversationHistory []api.Message) (string, error) {
+	if reset, _ := input["reset"].(bool); reset {
+		ResetShellSession()
+		if command, _ := input["command"].(string); command == "" {
+			return "Shell session reset. The next persistent command starts a fresh shell.", nil
+		}
+	}
+
+	req, err := parseBashRequest(input)
+	if err != nil {
+		return "", err
+	}
+	if err := guardShellCommand("run_bash", req.command); err != nil {
+		return "", err
+	}
+	autoCommitNoteShell()
+
+	var result *bashResult
+	if usePersistentShell(input) {
+		result, err = getSharedShell().run(req)
+	} else {
+		result, err = runBashCommand(req)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to execute command '%s': %w", req.command, err)
+	}
+	if result.exitCode != 0 {
+		result.notes = append(result.notes, sandboxViolations(result.combinedOutput(), result.exitCode)...)
+	}
+
+	return formatBashResult(req, result)
+}
+
+// usePersistentShell reports whether a call should run in the shared shell
+// session: the persistent parameter wins, then CLYDE_BASH_PERSISTENT
+func usePersistentShell(input map[string]interface{}) bool {
+	if val, ok := input["persistent"].(bool); ok {
+		return val
+	}
+	return envBool("CLYDE_BASH_PERSISTENT", false)
+}
+
+func parseBashRequest(input map[string]interface{}) (*bashRequest, error) {
 	command, ok := input["command"].(string)
 	if !ok || command == "" {
-		return "", fmt.Errorf("command is required. Example: run_bash(\"ls -la\")")
+		return nil, fmt.Errorf("command is required. Example: run_bash(\"ls -la\")")
+	}
+
+	maxTimeout := envInt("CLYDE_BASH_MAX_TIMEOUT_SECONDS", maxBashTimeoutSeconds)
+	timeout := envInt("CLYDE_BASH_TIMEOUT_SECONDS", defaultBashTimeoutSeconds)
+	if val, ok := input["timeout_seconds"].(float64); ok && val > 0 {
+		timeout = int(val)
+	}
+	if timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+
+	cwd := ""
+	if val, ok := input["cwd"].(string); ok && val != "" {
+		info, err := os.Stat(val)
+		if err != nil {
+			return nil, fmt.Errorf("working directory '%s' does not exist. Use list_files to find the right path", val)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("'%s' is not a directory. cwd must be a directory", val)
+		}
+		cwd = val
+	}
+
+	var env []string
+	if val, ok := input["env"].(map[string]interface{}); ok {
+		for k, v := range val {
+			if k == "" || strings.Contains(k, "=") {
+				return nil, fmt.Errorf("invalid environment variable name '%s'", k)
+			}
+			env = append(env, fmt.Sprintf("%s=%v", k, v))
+		}
+		sort.Strings(env)
+	}
+
+	return &bashRequest{
+		command: command,
+		cwd:     cwd,
+		env:     env,
+		timeout: time.Duration(timeout) * time.Second,
+	}, nil
+}
+
+// runBashCommand runs the command in its own process group and kills the
+// whole group if it outlives the timeout
+func runBashCommand(req *bashRequest) (*bashResult, error) {
+	limit := envInt("CLYDE_BASH_MAX_OUTPUT_KB", defaultBashOutputKB) * 1024
+	result := &bashResult{
+		stdout: newOutputCapture("stdout", limit),
+		stderr: newOutputCapture("stderr", limit),
 	}
+	defer result.stdout.Close()
+	defer result.stderr.Close()
 
-	cmd := exec.Command("bash", "-c", command)
-	output, err := cmd.CombinedOutput()
+	cmd := exec.Command("bash", "-c", req.command)
+	cmd.Dir = req.cwd
+	if len(req.env) > 0 {
+		cmd.Env = append(os.Environ(), req.env...)
+	}
+	cmd.Stdout = result.stdout
+	cmd.Stderr = result.stderr
+	// Don't wait forever on pipes held open by daemonized grandchildren
+	cmd.WaitDelay = 2 * time.Second
+	setProcessGroup(cmd)
+	if err := sandboxCommand(cmd); err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(req.timeout):
+		result.timedOut = true
+		killProcessGroup(cmd)
+		err = <-done
+	}
 
 	if err != nil {
 		exitErr, ok := err.(*exec.ExitError)
+		if !ok && !result.timedOut {
+			return nil, err
+		}
 		if ok {
-			exitCode := exitErr.ExitCode()
-			suggestions := []string{
-				fmt.Sprintf("Command failed with exit code %d: %s", exitCode, command),
-				"",
-				"Output:",
-				string(output),
-			}
+			result.exitCode = commandExitCode(exitErr)
+		}
+	}
+	return result, nil
+}
+
+// combinedOutput renders stdout followed by stderr, labelling stderr when
+// both streams have content
+func (r *bashResult) combinedOutput() string {
+	stdout := r.stdout.String()
+	stderr := r.stderr.String()
+	if stderr == "" {
+		return stdout
+	}
+	if stdout == "" {
+		return stderr
+	}
+	if !strings.HasSuffix(stdout, "\n") {
+		stdout += "\n"
+	}
+	return stdout + "[stderr]\n" + stderr
+}
 
-			// Add context-specific suggestions
-			if exitCode == 127 {
+func formatBashResult(req *bashRequest, result *bashResult) (string, error) {
+	command := req.command
+	output := result.combinedOutput()
+	if len(result.notes) > 0 {
+		if output != "" && !strings.HasSuffix(output, "\n") {
+			output += "\n"
+		}
+		output += "[" + strings.Join(result.notes, "]\n[") + "]\n"
+	}
+
+	if result.timedOut {
+		suggestions := []string{
+			fmt.Sprintf("Command timed out after %s and was killed (including child processes): %s", req.timeout, command),
+			"",
+			"Output before timeout:",
+			output,
+			"",
+			"Suggestions:",
+			"  - Increase timeout_seconds if the command just needs more time",
+			"  - Long-running servers and watchers should be started with the process tool, not run_bash",
+			"  - Check whether the command is waiting for input (pipe input or use non-interactive flags)",
+		}
+		return "", fmt.Errorf("%s", strings.Join(suggestions, "\n"))
+	}
+
+	if result.exitCode != 0 {
+		exitCode := result.exitCode
+		suggestions := []string{
+			fmt.Sprintf("Command failed with exit code %d: %s", exitCode, command),
+			"",
+			"Output:",
+			output,
+		}
+
+		// Add context-specific suggestions
+		if exitCode == 127 {
+			suggestions = append(suggestions,
+				"",
+				"Exit code 127 typically means 'command not found'.",
+				"Suggestions:",
+				"  - Check if the command is installed",
+				"  - Verify the command name is spelled correctly",
+				"  - Try which <command> to see if it's in PATH",
+			)
+		} else if exitCode == 126 {
+			suggestions = append(suggestions,
+				"",
+				"Exit code 126 typically means 'permission denied'.",
+				"Suggestions:",
+				"  - Check file/script permissions",
+				"  - Try: chmod +x <script>",
+			)
+		} else if exitCode == 1 {
+			// Common exit code, try to provide context based on command
+			if strings.Contains(command, "test") {
 				suggestions = append(suggestions,
 					"",
-					"Exit code 127 typically means 'command not found'.",
-					"Suggestions:",
-					"  - Check if the command is installed",
-					"  - Verify the command name is spelled correctly",
-					"  - Try which <command> to see if it's in PATH",
+					"This may indicate test failures. Check the output above for details.",
 				)
-			} else if exitCode == 126 {
+			} else if strings.Contains(command, "git") {
 				suggestions = append(suggestions,
 					"",
-					"Exit code 126 typically means 'permission denied'.",
-					"Suggestions:",
-					"  - Check file/script permissions",
-					"  - Try: chmod +x <script>",
+					"Git command failed. Check the output above for details.",
+					"Common issues: uncommitted changes, merge conflicts, or invalid references.",
 				)
-			} else if exitCode == 1 {
-				// Common exit code, try to provide context based on command
-				if strings.Contains(command, "test") {
-					suggestions = append(suggestions,
-						"",
-						"This may indicate test failures. Check the output above for details.",
-					)
-				} else if strings.Contains(command, "git") {
-					suggestions = append(suggestions,
-						"",
-						"Git command failed. Check the output above for details.",
-						"Common issues: uncommitted changes, merge conflicts, or invalid references.",
-					)
-				}
 			}
-
-			return "", fmt.Errorf("%s", strings.Join(suggestions, "\n"))
 		}
-		return "", fmt.Errorf("failed to execute command '%s': %w", command, err)
+
+		return "", fmt.Errorf("%s", strings.Join(suggestions, "\n"))
 	}
 
-	return string(output), nil
+	return output, nil
 }
 
 func displayRunBash(input map[string]interface{}) string {
 	command, _ := input["command"].(string)
-	
+	if reset, _ := input["reset"].(bool); reset && command == "" {
+		return "→ Resetting shell session"
+	}
+
 	// Truncate long commands for display
 	displayCmd := command
 	if len(displayCmd) > 60 {
 		displayCmd = displayCmd[:57] + "..."
 	}
+
+	var details []string
+	if cwd, ok := input["cwd"].(string); ok && cwd != "" {
+		details = append(details, "in "+cwd)
+	} else if usePersistentShell(input) {
+		if cwd := sharedShellCwd(); cwd != "" {
+			details = append(details, "in "+cwd)
+		}
+	}
+	if timeout, ok := input["timeout_seconds"].(float64); ok && timeout > 0 {
+		details = append(details, fmt.Sprintf("timeout %ds", int(timeout)))
+	}
+	if sandboxEnabled() {
+		details = append(details, "sandboxed")
+	}
+	if len(details) > 0 {
+		return fmt.Sprintf("→ Running bash: %s (%s)", displayCmd, strings.Join(details, ", "))
+	}
 	return fmt.Sprintf("→ Running bash: %s", displayCmd)
 }
@@ -0,0 +1,660 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/api"
+)
+
+func init() {
+	Register(runTestsTool, executeRunTests, displayRunTests)
+}
+
+var runTestsTool = api.Tool{
+	Name:        "run_tests",
+	Description: "Run Go tests with go test -json and get a structured summary instead of raw output: pass/fail/skip counts per package, each failing test with its file:line and output, panics with the panicking line, timeouts with the stuck tests, build errors and coverage. Progress is streamed while the tests run. Use this instead of run_bash(\"go test ...\").",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"packages": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Package patterns to test (default [\"./...\"])",
+			},
+			"run": map[string]interface{}{
+				"type":        "string",
+				"description": "Only run tests matching this regular expression (go test -run), e.g. \"TestParse\" or \"TestParse/empty_input\"",
+			},
+			"skip": map[string]interface{}{
+				"type":        "string",
+				"description": "Skip tests matching this regular expression (go test -skip)",
+			},
+			"dir": map[string]interface{}{
+				"type":        "string",
+				"description": "Directory to run in, inside the module (default: current directory)",
+			},
+			"coverage": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Report statement coverage per package (default false)",
+			},
+			"race": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Enable the race detector (default false)",
+			},
+			"short": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Pass -short to skip long-running tests (default false)",
+			},
+			"tags": map[string]interface{}{
+				"type":        "string",
+				"description": "Comma-separated build tags",
+			},
+			"count": map[string]interface{}{
+				"type":        "integer",
+				"description": "Run each test this many times; 1 bypasses the test cache",
+			},
+			"timeout_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": "Fail a test binary that runs longer than this (go test -timeout, default 600)",
+			},
+		},
+	},
+}
+
+const defaultTestTimeoutSeconds = 600
+
+// Limits on what a summary includes
+const (
+	maxTestFailuresShown = 20
+	maxTestOutputLines   = 40
+)
+
+// testEvent is one line of go test -json output
+type testEvent struct {
+	Action      string
+	Package     string
+	ImportPath  string
+	Test        string
+	Elapsed     float64
+	Output      string
+	FailedBuild string
+}
+
+// testCase collects one test's events
+type testCase struct {
+	pkg, name string
+	result    string // pass, fail or skip; "" while running
+	elapsed   float64
+	output    []string
+	panic     string // the panic message, if it panicked
+	location  string // file:line of the failure or panic
+}
+
+// testPackage collects one package's events
+type testPackage struct {
+	name                    string
+	result                  string // pass, fail or skip
+	elapsed                 float64
+	passed, failed, skipped int
+	coverage                string
+	noTests, buildFailed    bool
+	timedOut                string // the -timeout duration, if it was hit
+	stuck                   []string
+	output                  []string
+}
+
+var (
+	testCoverage   = regexp.MustCompile(`coverage: ([\d.]+)% of statements`)
+	testLocation   = regexp.MustCompile(`^\s*([\w.\-/]+\.go):(\d+): `)
+	testFrame      = regexp.MustCompile(`^\s+(/.+\.go):(\d+)`)
+	testTimeout    = regexp.MustCompile(`^panic: test timed out after (\S+)`)
+	testStuck      = regexp.MustCompile(`^\s+(Test\S*|Example\S*|Fuzz\S*) \(`)
+	testPanicState = regexp.MustCompile(` \[recovered[^\]]*\]$`)
+	testStatusRun  = regexp.MustCompile(`^(=== (RUN|PAUSE|CONT|NAME)|--- (PASS|FAIL|SKIP): |PASS$|FAIL$|ok\s|FAIL\s)`)
+)
+
+// testRun accumulates go test -json events into per-package results
+type testRun struct {
+	packages map[string]*testPackage
+	order    []string
+	tests    map[string]*testCase
+	failed   []*testCase // in the order they failed
+	build    []string    // compiler output
+}
+
+func newTestRun() *testRun {
+	return &testRun{packages: make(map[string]*testPackage), tests: make(map[string]*testCase)}
+}
+
+func (r *testRun) pkg(name string) *testPackage {
+	p := r.packages[name]
+	if p == nil {
+		p = &testPackage{name: name}
+		r.packages[name] = p
+		r.order = append(r.order, name)
+	}
+	return p
+}
+
+// handle applies one event, reporting progress for finished tests and
+// packages
+func (r *testRun) handle(e testEvent) {
+	switch e.Action {
+	case "build-output":
+		r.build = append(r.build, strings.TrimRight(e.Output, "\n"))
+		return
+	case "build-fail":
+		// Failures building a test variant name it "pkg [pkg.test]"
+		name, _, _ := strings.Cut(e.ImportPath, " ")
+		r.pkg(name).buildFailed = true
+		return
+	}
+	if e.Package == "" {
+		return
+	}
+	p := r.pkg(e.Package)
+
+	if e.Test == "" {
+		switch e.Action {
+		case "output":
+			line := strings.TrimRight(e.Output, "\n")
+			p.output = append(p.output, line)
+			if m := testCoverage.FindStringSubmatch(line); m != nil {
+				p.coverage = m[1] + "%"
+			}
+			if strings.Contains(line, "[no test files]") {
+				p.noTests = true
+			}
+		case "pass", "fail", "skip":
+			p.result, p.elapsed = e.Action, e.Elapsed
+			if e.FailedBuild != "" {
+				p.buildFailed = true
+			}
+			r.finishPackage(p)
+		}
+		return
+	}
+
+	key := e.Package + "\x00" + e.Test
+	t := r.tests[key]
+	if t == nil {
+		t = &testCase{pkg: e.Package, name: e.Test}
+		r.tests[key] = t
+	}
+	switch e.Action {
+	case "output":
+		t.output = append(t.output, strings.TrimRight(e.Output, "\n"))
+	case "pass", "fail", "skip":
+		t.result, t.elapsed = e.Action, e.Elapsed
+		switch e.Action {
+		case "pass":
+			p.passed++
+		case "skip":
+			p.skipped++
+		case "fail":
+			p.failed++
+			r.failed = append(r.failed, t)
+			reportProgress("  ✗ %s (%s)", t.name, shortPackage(t.pkg))
+		}
+	}
+}
+
+func (r *testRun) finishPackage(p *testPackage) {
+	r.scanPackageOutput(p)
+	switch {
+	case p.buildFailed:
+		reportProgress("  ✗ %s: build failed", p.name)
+	case p.timedOut != "":
+		reportProgress("  ✗ %s: timed out after %s", p.name, p.timedOut)
+	case p.result == "fail":
+		reportProgress("  ✗ %s: %d passed, %d failed (%.1fs)", p.name, p.passed, p.failed, p.elapsed)
+	case p.noTests:
+	default:
+		reportProgress("  ✓ %s: %d passed (%.1fs)", p.name, p.passed, p.elapsed)
+	}
+}
+
+// scanPackageOutput finds timeouts in a finished package's output and
+// marks the tests that were still running as failed
+func (r *testRun) scanPackageOutput(p *testPackage) {
+	lines := slices.Clone(p.output)
+	for _, t := range r.tests {
+		if t.pkg == p.name {
+			lines = append(lines, t.output...)
+		}
+	}
+	running := false
+	for _, line := range lines {
+		if m := testTimeout.FindStringSubmatch(line); m != nil {
+			p.timedOut = m[1]
+			continue
+		}
+		if strings.TrimSpace(line) == "running tests:" {
+			running = true
+			continue
+		}
+		if m := testStuck.FindStringSubmatch(line); running && m != nil {
+			p.stuck = append(p.stuck, m[1])
+			continue
+		}
+		running = false
+	}
+	for _, name := range p.stuck {
+		t := r.tests[p.name+"\x00"+name]
+		if t == nil || t.result == "fail" {
+			continue
+		}
+		t.result = "fail"
+		p.failed++
+		r.failed = append(r.failed, t)
+	}
+}
+
+// analyze finds each failing test's panic and location, resolving file
+// names against the package directories
+func (t *testCase) analyze(dirs map[string]string) {
+	var kept []string
+	inStack, frameFound := false, false
+	for _, line := range t.output {
+		switch {
+		case testTimeout.MatchString(line):
+			// The dump shows where the stuck test is waiting
+			inStack = true
+			continue
+		case strings.HasPrefix(line, "panic: "):
+			t.panic = testPanicState.ReplaceAllString(strings.TrimPrefix(line, "panic: "), "")
+			inStack = true
+			continue
+		case inStack:
+			// The goroutine dump is reduced to the first frame outside
+			// the standard library
+			if m := testFrame.FindStringSubmatch(line); m != nil && !frameFound && !isGoRootFrame(m[1]) {
+				t.location = fmt.Sprintf("%s:%s", displayName(relativePath(m[1])), m[2])
+				frameFound = true
+			}
+			continue
+		case testStatusRun.MatchString(strings.TrimSpace(line)) && !strings.HasPrefix(line, " "):
+			continue
+		case strings.HasPrefix(strings.TrimSpace(line), "--- "):
+			continue
+		}
+		// The last location is usually the assertion that failed, after
+		// any t.Log lines
+		if m := testLocation.FindStringSubmatch(line); m != nil && !frameFound {
+			file := m[1]
+			if dir := dirs[t.pkg]; dir != "" && !filepath.IsAbs(file) {
+				file = relativePath(filepath.Join(dir, file))
+			}
+			t.location = fmt.Sprintf("%s:%s", displayName(file), m[2])
+		}
+		kept = append(kept, line)
+	}
+	t.output = kept
+}
+
+// isGoRootFrame reports whether a stack frame is in the standard library
+func isGoRootFrame(file string) bool {
+	return build.Default.GOROOT != "" && strings.HasPrefix(file, filepath.Join(build.Default.GOROOT, "src")+"/")
+}
+
+// leafFailures returns the failing tests that have no failing subtests,
+// since a parent fails whenever a subtest does
+func (r *testRun) leafFailures() []*testCase {
+	var leaves []*testCase
+	for _, t := range r.failed {
+		leaf := true
+		for _, other := range r.failed {
+			if other.pkg == t.pkg && strings.HasPrefix(other.name, t.name+"/") {
+				leaf = false
+				break
+			}
+		}
+		if leaf {
+			leaves = append(leaves, t)
+		}
+	}
+	return leaves
+}
+
+func executeRunTests(input map[string]interface{}, apiClient *api.Client, history []api.Message) (string, error) {
+	dir, _ := input["dir"].(string)
+	if dir == "" {
+		dir = "."
+	}
+	if err := checkWorkspacePath(dir); err != nil {
+		return "", err
+	}
+
+	timeout := envInt("CLYDE_TEST_TIMEOUT_SECONDS", defaultTestTimeoutSeconds)
+	if v, ok := input["timeout_seconds"].(float64); ok && v > 0 {
+		timeout = int(v)
+	}
+	args := []string{"test", "-json", "-timeout", fmt.Sprintf("%ds", timeout)}
+	if run, _ := input["run"].(string); run != "" {
+		args = append(args, "-run", run)
+	}
+	if skip, _ := input["skip"].(string); skip != "" {
+		args = append(args, "-skip", skip)
+	}
+	if v, _ := input["coverage"].(bool); v {
+		args = append(args, "-cover")
+	}
+	if v, _ := input["race"].(bool); v {
+		args = append(args, "-race")
+	}
+	if v, _ := input["short"].(bool); v {
+		args = append(args, "-short")
+	}
+	if tags, _ := input["tags"].(string); tags != "" {
+		args = append(args, "-tags", tags)
+	}
+	if v, ok := input["count"].(float64); ok && v > 0 {
+		args = append(args, "-count", strconv.Itoa(int(v)))
+	}
+	packages := stringList(input["packages"])
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+	for _, p := range packages {
+		if strings.HasPrefix(p, "-") {
+			return "", fmt.Errorf("'%s' is not a package pattern. Use the run, skip, coverage, race, short, tags and count parameters for flags", p)
+		}
+	}
+	args = append(args, packages...)
+
+	reportProgress("🧪 go %s", strings.Join(args, " "))
+	start := time.Now()
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = 2 * time.Second
+	setProcessGroup(cmd)
+	if err := sandboxCommand(cmd); err != nil {
+		return "", err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to run go test: %w. Is Go installed?", err)
+	}
+
+	// go test -timeout only covers running the test binaries, so give
+	// building them room before killing the whole run
+	timer := time.AfterFunc(time.Duration(timeout)*time.Second+2*time.Minute, func() {
+		killProcessGroup(cmd)
+	})
+	run := newTestRun()
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e testEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			run.build = append(run.build, scanner.Text())
+			continue
+		}
+		run.handle(e)
+	}
+	waitErr := cmd.Wait()
+	killed := !timer.Stop() // the timer already fired
+
+	if len(run.order) == 0 {
+		out := strings.TrimSpace(stderr.String() + "\n" + strings.Join(run.build, "\n"))
+		if killed {
+			return "", fmt.Errorf("go test was killed after %ds without finishing a package", timeout+120)
+		}
+		if waitErr != nil || out != "" {
+			return "", fmt.Errorf("go test failed before running any tests:\n%s", out)
+		}
+		return "No packages matched " + strings.Join(packages, " "), nil
+	}
+	// Compiler output goes to stderr in older Go versions
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		if line != "" && !strings.HasPrefix(line, "go: downloading") {
+			run.build = append(run.build, line)
+		}
+	}
+
+	result := formatTestRun(run, dir, time.Since(start))
+	if killed {
+		result += fmt.Sprintf("\n\n⚠️ The run was killed after %ds; packages not listed did not finish", timeout+120)
+	}
+	return result, nil
+}
+
+// formatTestRun renders the summary: totals, a line per package, then the
+// failures in detail
+func formatTestRun(run *testRun, dir string, elapsed time.Duration) string {
+	var total, passed, failed, skipped, failedPkgs, okPkgs int
+	var noTests []string
+	for _, name := range run.order {
+		p := run.packages[name]
+		passed += p.passed
+		failed += p.failed
+		skipped += p.skipped
+		switch {
+		case p.result == "fail" || p.buildFailed:
+			failedPkgs++
+		case p.noTests:
+			noTests = append(noTests, name)
+		default:
+			okPkgs++
+		}
+	}
+	total = passed + failed + skipped
+
+	var b strings.Builder
+	status := "PASS"
+	if failedPkgs > 0 {
+		status = "FAIL"
+	}
+	fmt.Fprintf(&b, "%s: ", status)
+	if failedPkgs > 0 {
+		fmt.Fprintf(&b, "%d %s failed, ", failedPkgs, plural(failedPkgs, "package"))
+	}
+	fmt.Fprintf(&b, "%d passed (%d %s: %d passed, %d failed, %d skipped) in %.1fs\n", okPkgs, total, plural(total, "test"), passed, failed, skipped, elapsed.Seconds())
+
+	width := 0
+	for _, name := range run.order {
+		width = max(width, len(name))
+	}
+	b.WriteString("\nPackages:\n")
+	for _, name := range run.order {
+		p := run.packages[name]
+		if p.noTests && p.result != "fail" {
+			continue
+		}
+		var status, counts string
+		switch {
+		case p.buildFailed:
+			status, counts = "✗", "build failed"
+		case p.timedOut != "":
+			status, counts = "✗", fmt.Sprintf("timed out after %s", p.timedOut)
+		case p.result == "fail":
+			status = "✗"
+			counts = fmt.Sprintf("%d passed, %d failed", p.passed, p.failed)
+			if p.failed == 0 {
+				counts += ", package failed"
+			}
+		default:
+			status = "✓"
+			counts = fmt.Sprintf("%d passed", p.passed)
+		}
+		if p.skipped > 0 {
+			counts += fmt.Sprintf(", %d skipped", p.skipped)
+		}
+		line := fmt.Sprintf("  %s %-*s  %-24s", status, width, name, counts)
+		if !p.buildFailed {
+			line += fmt.Sprintf("  %5.1fs", p.elapsed)
+		}
+		if p.coverage != "" {
+			line += "  coverage " + p.coverage
+		}
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	if len(noTests) > 0 {
+		fmt.Fprintf(&b, "  (%d %s without test files)\n", len(noTests), plural(len(noTests), "package"))
+	}
+
+	failures := run.leafFailures()
+	if len(failures) > 0 {
+		dirs := testPackageDirs(dir, failures)
+		fmt.Fprintf(&b, "\nFailures (%d):\n", len(failures))
+		for i, t := range failures {
+			if i == maxTestFailuresShown {
+				var rest []string
+				for _, t := range failures[i:] {
+					rest = append(rest, t.name)
+				}
+				fmt.Fprintf(&b, "\n... and %d more: %s\n", len(rest), strings.Join(rest, ", "))
+				break
+			}
+			t.analyze(dirs)
+			writeTestFailure(&b, t, run.packages[t.pkg])
+		}
+	}
+
+	// Packages that failed outside any test, e.g. in TestMain or init
+	for _, name := range run.order {
+		p := run.packages[name]
+		if p.result != "fail" || p.failed > 0 || p.buildFailed {
+			continue
+		}
+		fmt.Fprintf(&b, "\n--- %s failed outside any test:\n", name)
+		for _, line := range tailLines(filterTestStatus(p.output), maxTestOutputLines) {
+			b.WriteString("    " + line + "\n")
+		}
+	}
+
+	if len(run.build) > 0 {
+		b.WriteString("\nBuild errors:\n")
+		for _, line := range tailLines(run.build, 2*maxTestOutputLines) {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func writeTestFailure(b *strings.Builder, t *testCase, p *testPackage) {
+	stuck := p.timedOut != "" && slices.Contains(p.stuck, t.name)
+	if stuck {
+		fmt.Fprintf(b, "\n--- %s (%s)", t.name, shortPackage(t.pkg))
+	} else {
+		fmt.Fprintf(b, "\n--- %s (%s, %.2fs)", t.name, shortPackage(t.pkg), t.elapsed)
+	}
+	if t.location != "" {
+		b.WriteString("  " + t.location)
+	}
+	b.WriteString("\n")
+	if t.panic != "" {
+		fmt.Fprintf(b, "    💥 panic: %s\n", t.panic)
+	}
+	if stuck {
+		fmt.Fprintf(b, "    ⏱️ still running when the %s timeout hit\n", p.timedOut)
+	}
+	output := t.output
+	if len(output) > maxTestOutputLines {
+		fmt.Fprintf(b, "    (%d earlier lines omitted)\n", len(output)-maxTestOutputLines)
+		output = tailLines(output, maxTestOutputLines)
+	}
+	for _, line := range output {
+		b.WriteString("    " + strings.TrimPrefix(line, "    ") + "\n")
+	}
+}
+
+// testPackageDirs looks up the directories of the packages with failing
+// tests, to turn the file names in test output into paths
+func testPackageDirs(dir string, failures []*testCase) map[string]string {
+	seen := make(map[string]bool)
+	args := []string{"list", "-f", "{{.ImportPath}}\t{{.Dir}}"}
+	for _, t := range failures {
+		if !seen[t.pkg] {
+			seen[t.pkg] = true
+			args = append(args, t.pkg)
+		}
+	}
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	out, _ := cmd.Output()
+	dirs := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if path, d, ok := strings.Cut(line, "\t"); ok {
+			dirs[path] = d
+		}
+	}
+	return dirs
+}
+
+// filterTestStatus drops go test's own status lines from output
+func filterTestStatus(lines []string) []string {
+	var kept []string
+	for _, line := range lines {
+		if !testStatusRun.MatchString(line) && !strings.HasPrefix(line, "exit status ") {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+func tailLines(lines []string, n int) []string {
+	if len(lines) > n {
+		return lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// shortPackage returns the last element of an import path
+func shortPackage(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// stringList accepts a JSON array of strings or a single string
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func displayRunTests(input map[string]interface{}) string {
+	packages := stringList(input["packages"])
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+	desc := strings.Join(packages, " ")
+	if run, _ := input["run"].(string); run != "" {
+		desc += " -run " + run
+	}
+	var flags []string
+	for _, f := range []string{"coverage", "race", "short"} {
+		if v, _ := input[f].(bool); v {
+			flags = append(flags, f)
+		}
+	}
+	if len(flags) > 0 {
+		desc += " (" + strings.Join(flags, ", ") + ")"
+	}
+	return "→ Running tests: " + desc
+}
@@ -0,0 +1,218 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Sandbox backends, selected with CLYDE_SANDBOX in ~/.clyde/config
+const (
+	sandboxOff        = "off"
+	sandboxAuto       = "auto"       // bubblewrap when installed, otherwise namespaces
+	sandboxBwrap      = "bwrap"      // bubblewrap (bwrap) binary
+	sandboxNamespaces = "namespaces" // user/mount/network namespaces set up by clyde
+)
+
+// sandboxPolicy describes how commands are confined
+type sandboxPolicy struct {
+	backend    string
+	writable   []string // absolute, symlink-resolved paths mounted read-write
+	network    bool
+	memoryMB   int
+	cpuSeconds int
+	tmpDir     string // private TMPDIR for sandboxed commands, also writable
+}
+
+var (
+	sandboxTmpMu  sync.Mutex
+	sandboxTmpDir string
+)
+
+func init() {
+	registerCleanup(removeSandboxTmpDir)
+}
+
+// sandboxMode returns the configured backend, normalizing boolean-style values
+func sandboxMode() string {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("CLYDE_SANDBOX")))
+	switch mode {
+	case "", "off", "false", "0", "none":
+		return sandboxOff
+	case "on", "true", "1":
+		return sandboxAuto
+	}
+	return mode
+}
+
+func sandboxEnabled() bool {
+	return sandboxMode() != sandboxOff
+}
+
+// currentSandboxPolicy builds the policy from config. It returns nil when
+// sandboxing is off.
+func currentSandboxPolicy() (*sandboxPolicy, error) {
+	mode := sandboxMode()
+	switch mode {
+	case sandboxOff:
+		return nil, nil
+	case sandboxAuto:
+		mode = sandboxNamespaces
+		if _, err := exec.LookPath("bwrap"); err == nil {
+			mode = sandboxBwrap
+		}
+	case sandboxBwrap:
+		if _, err := exec.LookPath("bwrap"); err != nil {
+			return nil, fmt.Errorf("sandbox: CLYDE_SANDBOX=bwrap but bubblewrap is not installed. Install it or use CLYDE_SANDBOX=namespaces")
+		}
+	case sandboxNamespaces:
+	default:
+		return nil, fmt.Errorf("sandbox: unknown CLYDE_SANDBOX value '%s'. Use off, auto, bwrap or namespaces", os.Getenv("CLYDE_SANDBOX"))
+	}
+
+	// The sandbox's writable workspace defaults to the file tools' roots
+	workspace := workspaceRoots()
+	if dir := strings.TrimSpace(os.Getenv("CLYDE_SANDBOX_WORKSPACE")); dir != "" {
+		workspace = []string{dir}
+	}
+	tmpDir, err := getSandboxTmpDir()
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: could not create temp directory: %w", err)
+	}
+
+	policy := &sandboxPolicy{
+		backend:    mode,
+		network:    envBool("CLYDE_SANDBOX_NETWORK", false),
+		memoryMB:   envInt("CLYDE_SANDBOX_MEMORY_MB", 0),
+		cpuSeconds: envInt("CLYDE_SANDBOX_CPU_SECONDS", 0),
+		tmpDir:     tmpDir,
+	}
+	for _, dir := range append(append(workspace, tmpDir), envList("CLYDE_SANDBOX_WRITABLE")...) {
+		resolved, err := resolveSandboxPath(dir)
+		if err != nil {
+			return nil, err
+		}
+		policy.writable = append(policy.writable, resolved)
+	}
+	return policy, nil
+}
+
+// resolveSandboxPath expands ~ and resolves symlinks so bind mounts target
+// the real directory
+func resolveSandboxPath(dir string) (string, error) {
+	abs, err := filepath.Abs(expandHome(dir))
+	if err != nil {
+		return "", fmt.Errorf("sandbox: invalid writable path '%s': %w", dir, err)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("sandbox: writable path '%s' does not exist", dir)
+	}
+	return resolved, nil
+}
+
+// sandboxCommand rewrites cmd to run inside the configured sandbox. It is a
+// no-op when sandboxing is off. Call it after cmd.Dir, cmd.Env and
+// setProcessGroup are set.
+func sandboxCommand(cmd *exec.Cmd) error {
+	policy, err := currentSandboxPolicy()
+	if err != nil || policy == nil {
+		return err
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, "TMPDIR="+policy.tmpDir)
+	return applySandbox(cmd, policy)
+}
+
+// isWithin reports whether path is dir or inside it
+func isWithin(path, dir string) bool {
+	if path == dir || dir == "/" {
+		return true
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// sandboxViolations explains failures that look like the sandbox blocked
+// something, so the model knows to change approach instead of retrying
+func sandboxViolations(output string, exitCode int) []string {
+	policy, err := currentSandboxPolicy()
+	if err != nil || policy == nil {
+		return nil
+	}
+
+	var notes []string
+	if strings.Contains(output, "clyde-sandbox:") {
+		notes = append(notes, "sandbox: setup failed before the command ran. Check the CLYDE_SANDBOX settings or set CLYDE_SANDBOX=off")
+	}
+	if strings.Contains(output, "Read-only file system") {
+		notes = append(notes, fmt.Sprintf("sandbox: writes are only allowed in %s (add directories with CLYDE_SANDBOX_WRITABLE)",
+			strings.Join(policy.writable, ", ")))
+	}
+	if !policy.network {
+		for _, pattern := range []string{"Network is unreachable", "Could not resolve host", "Temporary failure in name resolution", "Name or service not known", "no such host"} {
+			if strings.Contains(output, pattern) {
+				notes = append(notes, "sandbox: network access is disabled (set CLYDE_SANDBOX_NETWORK=true to allow it)")
+				break
+			}
+		}
+	}
+	if policy.cpuSeconds > 0 && (exitCode == 128+24 || strings.Contains(output, "CPU time limit exceeded")) {
+		notes = append(notes, fmt.Sprintf("sandbox: CPU time limit of %ds exceeded (CLYDE_SANDBOX_CPU_SECONDS)", policy.cpuSeconds))
+	}
+	if policy.memoryMB > 0 {
+		for _, pattern := range []string{"Cannot allocate memory", "out of memory", "MemoryError", "std::bad_alloc"} {
+			if strings.Contains(output, pattern) {
+				notes = append(notes, fmt.Sprintf("sandbox: memory limit of %d MB reached (CLYDE_SANDBOX_MEMORY_MB)", policy.memoryMB))
+				break
+			}
+		}
+	}
+	return notes
+}
+
+// limitsScript returns shell lines applying the policy's rlimits. Limits are
+// inherited by everything the command starts.
+func (p *sandboxPolicy) limitsScript() string {
+	var lines []string
+	if p.memoryMB > 0 {
+		lines = append(lines, fmt.Sprintf("ulimit -v %d || fail 'could not set memory limit'", p.memoryMB*1024))
+	}
+	if p.cpuSeconds > 0 {
+		// The soft limit sends SIGXCPU; the hard limit one second later is SIGKILL
+		lines = append(lines, fmt.Sprintf("ulimit -S -t %d && ulimit -H -t %d || fail 'could not set CPU limit'", p.cpuSeconds, p.cpuSeconds+1))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func getSandboxTmpDir() (string, error) {
+	sandboxTmpMu.Lock()
+	defer sandboxTmpMu.Unlock()
+
+	if sandboxTmpDir != "" {
+		if _, err := os.Stat(sandboxTmpDir); err == nil {
+			return sandboxTmpDir, nil
+		}
+	}
+	dir, err := os.MkdirTemp("", "clyde-sandbox-")
+	if err != nil {
+		return "", err
+	}
+	sandboxTmpDir = dir
+	return dir, nil
+}
+
+func removeSandboxTmpDir() {
+	sandboxTmpMu.Lock()
+	defer sandboxTmpMu.Unlock()
+
+	if sandboxTmpDir != "" {
+		os.RemoveAll(sandboxTmpDir)
+		sandboxTmpDir = ""
+	}
+}
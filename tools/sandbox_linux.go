@@ -0,0 +1,225 @@
+//go:build linux
+
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var (
+	namespaceProbeOnce sync.Once
+	namespaceProbeErr  error
+)
+
+func applySandbox(cmd *exec.Cmd, policy *sandboxPolicy) error {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		return fmt.Errorf("sandbox: bash not found in PATH")
+	}
+	if policy.backend == sandboxBwrap {
+		return wrapBwrap(cmd, policy, bash)
+	}
+	return wrapNamespaces(cmd, policy, bash)
+}
+
+// wrapBwrap runs cmd under bubblewrap: the whole filesystem read-only, the
+// writable paths bound read-write, fresh /dev, /proc and PID namespace
+func wrapBwrap(cmd *exec.Cmd, policy *sandboxPolicy, bash string) error {
+	bwrap, err := exec.LookPath("bwrap")
+	if err != nil {
+		return fmt.Errorf("sandbox: bubblewrap is not installed")
+	}
+
+	args := []string{"bwrap", "--die-with-parent", "--unshare-pid",
+		"--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc"}
+	for _, dir := range policy.writable {
+		args = append(args, "--bind", dir, dir)
+	}
+	if !policy.network {
+		args = append(args, "--unshare-net")
+	}
+	script := "fail() { echo \"clyde-sandbox: $1\" >&2; exit 125; }\n" + policy.limitsScript() + "\nexec \"$@\""
+	args = append(args, "--", bash, "-c", script, "clyde-sandbox", cmd.Path)
+	args = append(args, cmd.Args[1:]...)
+
+	cmd.Path = bwrap
+	cmd.Args = args
+	return nil
+}
+
+// wrapNamespaces runs cmd in new user, mount and PID namespaces (plus a
+// network namespace when the network is disabled). A setup script binds the
+// writable paths, remounts every other mount read-only and then runs the
+// command as its child, so the command can't see or signal host processes
+// and the script, as the namespace's init, ends everything it left behind.
+// The command sees itself as uid 0, which grants nothing outside the
+// namespace.
+func wrapNamespaces(cmd *exec.Cmd, policy *sandboxPolicy, bash string) error {
+	if _, err := exec.LookPath("mount"); err != nil {
+		return fmt.Errorf("sandbox: the mount command is required for CLYDE_SANDBOX=namespaces")
+	}
+	if err := probeNamespaces(); err != nil {
+		return err
+	}
+
+	mounts, err := readMountPoints()
+	if err != nil {
+		return fmt.Errorf("sandbox: cannot read mount table: %w", err)
+	}
+
+	var script strings.Builder
+	script.WriteString("fail() { echo \"clyde-sandbox: $1\" >&2; exit 125; }\n")
+	script.WriteString("mount --make-rprivate / || fail 'could not make mounts private'\n")
+	// A /proc for the new PID namespace. Hosts that mask parts of /proc
+	// refuse this; host processes are then listed but still can't be signaled.
+	script.WriteString("mount -t proc proc /proc 2>/dev/null\n")
+	for _, dir := range policy.writable {
+		q := shellQuote(dir)
+		fmt.Fprintf(&script, "mount --bind %s %s || fail %s\n", q, q, shellQuote("could not mount "+dir+" read-write"))
+	}
+	for _, mp := range mounts {
+		if skipReadOnlyRemount(mp.path, policy.writable) {
+			continue
+		}
+		// The kernel refuses a remount inside a user namespace that would
+		// clear the mount's locked flags, so they are repeated
+		options := strings.Join(append([]string{"remount", "bind", "ro"}, mp.lockedFlags...), ",")
+		q := shellQuote(mp.path)
+		fmt.Fprintf(&script, "mount -o %s %s 2>/dev/null || fail %s\n", options, q, shellQuote("could not make "+mp.path+" read-only"))
+	}
+	if !policy.network {
+		// The new network namespace only has a loopback device, and it starts down
+		script.WriteString("ip link set lo up 2>/dev/null\n")
+	}
+	if limits := policy.limitsScript(); limits != "" {
+		script.WriteString(limits + "\n")
+	}
+	// Not exec: the init of a PID namespace ignores SIGTERM, and the
+	// command should get it when it is stopped
+	script.WriteString("\"$@\"\nexit $?")
+
+	args := []string{"bash", "-c", script.String(), "clyde-sandbox", cmd.Path}
+	cmd.Path = bash
+	cmd.Args = append(args, cmd.Args[1:]...)
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	setNamespaceAttrs(cmd.SysProcAttr, policy.network)
+	return nil
+}
+
+func setNamespaceAttrs(attr *syscall.SysProcAttr, network bool) {
+	attr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+	if !network {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+}
+
+// probeNamespaces checks once whether this kernel lets us create the
+// namespaces, so a misconfigured host fails with a clear message rather than
+// a bare EPERM from fork/exec
+func probeNamespaces() error {
+	namespaceProbeOnce.Do(func() {
+		cmd := exec.Command("true")
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+		setNamespaceAttrs(cmd.SysProcAttr, false)
+		if err := cmd.Run(); err != nil {
+			namespaceProbeErr = fmt.Errorf("sandbox: cannot create user namespaces (%v). Unprivileged user namespaces may be disabled on this host; install bubblewrap or set CLYDE_SANDBOX=off", err)
+		}
+	})
+	return namespaceProbeErr
+}
+
+// skipReadOnlyRemount leaves /dev and /proc alone (device nodes stay usable
+// either way and /proc is per-process) as well as mounts inside writable paths
+func skipReadOnlyRemount(mountPoint string, writable []string) bool {
+	if isWithin(mountPoint, "/dev") || isWithin(mountPoint, "/proc") {
+		return true
+	}
+	for _, dir := range writable {
+		if isWithin(mountPoint, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// mountPoint is a mount from /proc/self/mountinfo with the per-mount flags
+// that a user namespace may not clear
+type mountPoint struct {
+	path        string
+	lockedFlags []string
+}
+
+// lockedMountFlags are the flags the kernel locks on mounts inherited into a
+// user namespace
+var lockedMountFlags = map[string]bool{
+	"nosuid": true, "nodev": true, "noexec": true,
+	"noatime": true, "nodiratime": true, "relatime": true, "strictatime": true,
+}
+
+// readMountPoints lists mount points from /proc/self/mountinfo, parents
+// first. A path mounted more than once gets the flags of the topmost mount,
+// which is the one a remount changes.
+func readMountPoints() ([]mountPoint, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	index := make(map[string]int)
+	var mounts []mountPoint
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		var flags []string
+		for _, opt := range strings.Split(fields[5], ",") {
+			if lockedMountFlags[opt] {
+				flags = append(flags, opt)
+			}
+		}
+		mp := mountPoint{path: unescapeMountPath(fields[4]), lockedFlags: flags}
+		if i, seen := index[mp.path]; seen {
+			mounts[i] = mp
+			continue
+		}
+		index[mp.path] = len(mounts)
+		mounts = append(mounts, mp)
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space) used in
+// /proc/self/mountinfo
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
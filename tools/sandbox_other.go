@@ -0,0 +1,12 @@
+//go:build !linux
+
+package tools
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func applySandbox(cmd *exec.Cmd, policy *sandboxPolicy) error {
+	return fmt.Errorf("sandbox: CLYDE_SANDBOX is only supported on Linux. Set CLYDE_SANDBOX=off")
+}
@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Files clyde writes for the model to read back later (the full output of
+// a truncated command) go in a per-session scratch directory. File tools
+// may always read it, whatever the workspace roots, and Shutdown removes it.
+
+var (
+	scratchMu  sync.Mutex
+	scratchDir string
+)
+
+func init() {
+	registerCleanup(removeScratchDir)
+}
+
+// getScratchDir returns the session's scratch directory, creating it on
+// first use
+func getScratchDir() (string, error) {
+	scratchMu.Lock()
+	defer scratchMu.Unlock()
+
+	if scratchDir != "" {
+		if _, err := os.Stat(scratchDir); err == nil {
+			return scratchDir, nil
+		}
+	}
+	dir, err := os.MkdirTemp("", "clyde-session-")
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	scratchDir = dir
+	return dir, nil
+}
+
+// inScratchDir reports whether a resolved path is inside the scratch
+// directory
+func inScratchDir(resolved string) bool {
+	scratchMu.Lock()
+	defer scratchMu.Unlock()
+	return scratchDir != "" && isWithin(resolved, scratchDir)
+}
+
+func removeScratchDir() {
+	scratchMu.Lock()
+	defer scratchMu.Unlock()
+
+	if scratchDir != "" {
+		os.RemoveAll(scratchDir)
+		scratchDir = ""
+	}
+}
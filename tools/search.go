@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SearchQuery is a web search with optional refinements. Providers map the
+// fields onto their own parameters.
+type SearchQuery struct {
+	Query     string
+	Count     int
+	Site      string // restrict to a domain
+	Freshness string // "day", "week", "month" or "year"
+	Language  string // ISO 639-1 code, e.g. "en"
+	Offset    int    // results to skip, for paging
+	Refresh   bool   // bypass cached results
+}
+
+// SearchResult is one hit
+type SearchResult struct {
+	Title   string
+	URL     string
+	Snippet string
+	Age     string // publication date or age, when the provider knows it
+}
+
+// SearchProvider is a web search backend
+type SearchProvider interface {
+	Name() string
+	Search(q SearchQuery) ([]SearchResult, error)
+}
+
+// searchFreshness lists the accepted freshness windows
+var searchFreshness = []string{"day", "week", "month", "year"}
+
+// searchProviders returns the configured providers in the order to try
+// them. CLYDE_SEARCH_PROVIDERS lists them explicitly; otherwise every
+// provider with settings is used, Brave first. With nothing configured,
+// Brave is returned so its missing-key error explains the setup.
+func searchProviders() ([]SearchProvider, error) {
+	names := envList("CLYDE_SEARCH_PROVIDERS")
+	if len(names) == 0 {
+		if os.Getenv("BRAVE_SEARCH_API_KEY") != "" {
+			names = append(names, "brave")
+		}
+		if os.Getenv("CLYDE_SEARXNG_URL") != "" {
+			names = append(names, "searxng")
+		}
+		if os.Getenv("CLYDE_SEARCH_COMMAND") != "" {
+			names = append(names, "command")
+		}
+		if len(names) == 0 {
+			names = []string{"brave"}
+		}
+	}
+
+	var providers []SearchProvider
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "brave":
+			providers = append(providers, newBraveProvider())
+		case "searxng":
+			providers = append(providers, newSearxngProvider())
+		case "command":
+			providers = append(providers, newCommandProvider())
+		default:
+			return nil, fmt.Errorf("unknown search provider '%s' in CLYDE_SEARCH_PROVIDERS. Use brave, searxng or command", name)
+		}
+	}
+	return providers, nil
+}
+
+// runSearch tries each provider in turn until one succeeds. A provider
+// that returns no results counts as a success.
+func runSearch(q SearchQuery) ([]SearchResult, string, error) {
+	providers, err := searchProviders()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var failures []string
+	for i, p := range providers {
+		results, err := p.Search(q)
+		if err == nil {
+			return results, p.Name(), nil
+		}
+		if len(providers) == 1 {
+			return nil, "", err
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", p.Name(), err))
+		if i+1 < len(providers) {
+			reportProgress("  ↪ %s search failed, trying %s", p.Name(), providers[i+1].Name())
+		}
+	}
+	return nil, "", fmt.Errorf("all search providers failed:\n\n%s", strings.Join(failures, "\n\n"))
+}
+
+// effectiveQuery adds the site filter to the query text, which every
+// provider understands
+func (q SearchQuery) effectiveQuery() string {
+	if q.Site == "" {
+		return q.Query
+	}
+	return "site:" + q.Site + " " + q.Query
+}
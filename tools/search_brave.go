@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultBraveURL = "https://api.search.brave.com/res/v1/web/search"
+
+// Brave's limits on count and on offset, which counts pages of count results
+const (
+	braveMaxCount = 20
+	braveMaxPage  = 9
+)
+
+// braveProvider uses the Brave Search API
+type braveProvider struct {
+	apiKey   string
+	endpoint string
+}
+
+func newBraveProvider() *braveProvider {
+	endpoint := os.Getenv("CLYDE_BRAVE_URL")
+	if endpoint == "" {
+		endpoint = defaultBraveURL
+	}
+	return &braveProvider{apiKey: os.Getenv("BRAVE_SEARCH_API_KEY"), endpoint: endpoint}
+}
+
+func (b *braveProvider) Name() string { return "brave" }
+
+var braveFreshness = map[string]string{"day": "pd", "week": "pw", "month": "pm", "year": "py"}
+
+func (b *braveProvider) Search(q SearchQuery) ([]SearchResult, error) {
+	if b.apiKey == "" {
+		return nil, fmt.Errorf("BRAVE_SEARCH_API_KEY not found in .env file.\n\nTo fix this:\n  1. Sign up for a free API key at https://brave.com/search/api/\n  2. Add to your .env file: BRAVE_SEARCH_API_KEY=your-key-here\n  3. Free tier includes 2,000 searches per month\n\nOr configure another backend with CLYDE_SEARXNG_URL or CLYDE_SEARCH_COMMAND")
+	}
+
+	pageSize, page, skip, ok := braveWindow(q.Offset, q.Count)
+	if !ok {
+		return nil, fmt.Errorf("Brave can't return results %d to %d: it pages in fixed steps and stops after %d pages. Use an offset that is a multiple of num_results", q.Offset+1, q.Offset+q.Count, braveMaxPage+1)
+	}
+	params := url.Values{}
+	params.Set("q", q.effectiveQuery())
+	params.Set("count", strconv.Itoa(pageSize))
+	if page > 0 {
+		params.Set("offset", strconv.Itoa(page))
+	}
+	if f, ok := braveFreshness[q.Freshness]; ok {
+		params.Set("freshness", f)
+	}
+	if q.Language != "" {
+		params.Set("search_lang", q.Language)
+	}
+
+	req, err := http.NewRequest("GET", b.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create search request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Subscription-Token", b.apiKey)
+
+	// Repeated queries are answered from the cache to save search quota
+	resp, err := cachedFetch("web_search", req, 30*time.Second, cacheOptions{refresh: q.Refresh, apiResponse: true})
+	if err != nil {
+		if isEgressBlocked(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("search request failed: %w\n\nCheck your internet connection", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read search response: %w", err)
+	}
+
+	// Handle HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		switch resp.StatusCode {
+		case 401:
+			return nil, fmt.Errorf("search API authentication failed (401)\n\nYour API key may be invalid:\n  - Verify BRAVE_SEARCH_API_KEY in .env file\n  - Try generating a new key at https://brave.com/search/api/")
+		case 429:
+			return nil, fmt.Errorf("search rate limit exceeded (429)\n\nYou've reached your monthly search limit (2000 free searches).\n  - Wait until next month for limit reset\n  - Or upgrade at https://brave.com/search/api/ ($5/mo for 20K searches)\n  - Or add a fallback backend with CLYDE_SEARXNG_URL or CLYDE_SEARCH_COMMAND")
+		case 400:
+			return nil, fmt.Errorf("invalid search query (400): %s\n\nCheck your query syntax", string(body))
+		default:
+			return nil, fmt.Errorf("search API error (status %d): %s", resp.StatusCode, string(body))
+		}
+	}
+
+	// Parse JSON response
+	var result struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+				Age         string `json:"age"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse search results: %w\n\nResponse: %s", err, string(body))
+	}
+
+	var results []SearchResult
+	for _, r := range result.Web.Results {
+		results = append(results, SearchResult{Title: r.Title, URL: r.URL, Snippet: r.Description, Age: r.Age})
+	}
+	// Cut the requested window out of the page
+	results = results[min(skip, len(results)):]
+	return results[:min(len(results), q.Count)], nil
+}
+
+// braveWindow picks a page size and page whose results include the whole
+// window from offset to offset+count, and where the window starts in it.
+// Offsets that are multiples of count use pages of count results.
+func braveWindow(offset, count int) (pageSize, page, skip int, ok bool) {
+	for pageSize = max(count, 1); pageSize <= braveMaxCount; pageSize++ {
+		page, skip = offset/pageSize, offset%pageSize
+		if skip+count <= pageSize && page <= braveMaxPage {
+			return pageSize, page, skip, true
+		}
+	}
+	return 0, 0, 0, false
+}
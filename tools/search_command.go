@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const searchCommandTimeout = 30 * time.Second
+
+// commandProvider runs a user-supplied command. The query is passed as $1
+// (with any site: filter applied) and every option as an environment
+// variable. The command prints JSON: an array of {title, url, snippet}
+// objects, or an object with such an array under "results".
+type commandProvider struct {
+	command string
+}
+
+func newCommandProvider() *commandProvider {
+	return &commandProvider{command: os.Getenv("CLYDE_SEARCH_COMMAND")}
+}
+
+func (c *commandProvider) Name() string { return "command" }
+
+func (c *commandProvider) Search(q SearchQuery) ([]SearchResult, error) {
+	if c.command == "" {
+		return nil, fmt.Errorf("CLYDE_SEARCH_COMMAND is not set. Point it at a script that prints search results as JSON")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), searchCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "bash", "-c", c.command, "clyde-search", q.effectiveQuery())
+	cmd.Env = append(os.Environ(),
+		"CLYDE_SEARCH_QUERY="+q.Query,
+		"CLYDE_SEARCH_COUNT="+strconv.Itoa(q.Count),
+		"CLYDE_SEARCH_SITE="+q.Site,
+		"CLYDE_SEARCH_FRESHNESS="+q.Freshness,
+		"CLYDE_SEARCH_LANGUAGE="+q.Language,
+		"CLYDE_SEARCH_OFFSET="+strconv.Itoa(q.Offset),
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("search command timed out after %s", searchCommandTimeout)
+		}
+		return nil, fmt.Errorf("search command failed: %v\n\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	type item struct {
+		Title       string `json:"title"`
+		URL         string `json:"url"`
+		Snippet     string `json:"snippet"`
+		Description string `json:"description"`
+		Content     string `json:"content"`
+		Age         string `json:"age"`
+	}
+	var items []item
+	out := bytes.TrimSpace(stdout.Bytes())
+	if err := json.Unmarshal(out, &items); err != nil {
+		var wrapped struct {
+			Results []item `json:"results"`
+		}
+		if err2 := json.Unmarshal(out, &wrapped); err2 != nil {
+			return nil, fmt.Errorf("search command output is not a JSON array of results: %w\n\nOutput: %s", err, string(out[:min(len(out), 500)]))
+		}
+		items = wrapped.Results
+	}
+
+	var results []SearchResult
+	for _, it := range items {
+		if len(results) == q.Count {
+			break
+		}
+		results = append(results, SearchResult{
+			Title:   it.Title,
+			URL:     it.URL,
+			Snippet: firstNonEmpty(it.Snippet, it.Description, it.Content),
+			Age:     it.Age,
+		})
+	}
+	return results, nil
+}
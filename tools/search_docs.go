@@ -0,0 +1,380 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/this-is-alpha-iota/clyde/api"
+)
+
+func init() {
+	Register(searchDocsTool, executeSearchDocs, displaySearchDocs)
+}
+
+var searchDocsTool = api.Tool{
+	Name:        "search_docs",
+	Description: "Search documentation corpora saved by crawl. Returns the best-matching sections with their page, URL and an excerpt. Pass file to read a stored page in full. With no query, lists the available corpora. Use before browsing when the docs for a library have been crawled.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Keywords to search for, e.g. 'retry backoff config'",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: corpus to search (default: all corpora)",
+			},
+			"file": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: read this stored page (as shown in search results) instead of searching. Requires name",
+			},
+			"page": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional, with file: which page of a long document to return (default 1)",
+			},
+			"max_results": map[string]interface{}{
+				"type":        "integer",
+				"description": "Number of sections to return (default 8, max 30)",
+				"default":     defaultDocsResults,
+			},
+		},
+	},
+}
+
+const (
+	defaultDocsResults = 8
+	maxDocsResults     = 30
+	docsExcerptChars   = 400
+)
+
+// docsSection is one heading-delimited part of a stored page
+type docsSection struct {
+	corpus  string
+	page    docsPage
+	heading string
+	text    string
+	score   float64
+	matched int // distinct query terms found
+}
+
+func executeSearchDocs(input map[string]interface{}, apiClient *api.Client, conversationHistory []api.Message) (string, error) {
+	root, err := docsDir()
+	if err != nil {
+		return "", err
+	}
+	name, _ := input["name"].(string)
+	name = strings.TrimSpace(name)
+	if name != "" && !corpusNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid corpus name '%s'", name)
+	}
+
+	if file, _ := input["file"].(string); file != "" {
+		if name == "" {
+			return "", fmt.Errorf("name is required with file. Example: search_docs(name=\"docs.example.com\", file=\"guide/intro.md\")")
+		}
+		page := 1
+		if pageVal, ok := input["page"].(float64); ok {
+			page = int(pageVal)
+		}
+		return readDocsPage(root, name, file, page)
+	}
+
+	var corpora []*docsIndex
+	if name != "" {
+		index, err := loadDocsIndex(root, name)
+		if err != nil {
+			return "", err
+		}
+		corpora = append(corpora, index)
+	} else {
+		corpora = listDocsCorpora(root)
+	}
+
+	query, _ := input["query"].(string)
+	terms := docsTerms(query)
+	if len(terms) == 0 {
+		if len(corpora) == 0 {
+			return "No documentation has been crawled yet. Use crawl(url=...) to build a corpus.", nil
+		}
+		var b strings.Builder
+		b.WriteString("Documentation corpora:\n")
+		for _, c := range corpora {
+			fmt.Fprintf(&b, "  - %s: %d pages from %s (crawled %s)\n", c.Name, len(c.Pages), c.StartURL, c.CrawledAt.Local().Format("2006-01-02 15:04"))
+		}
+		return strings.TrimRight(b.String(), "\n"), nil
+	}
+	if len(corpora) == 0 {
+		return "", fmt.Errorf("no documentation has been crawled yet. Use crawl(url=...) to build a corpus first")
+	}
+
+	maxResults := defaultDocsResults
+	if v, ok := input["max_results"].(float64); ok && v > 0 {
+		maxResults = min(int(v), maxDocsResults)
+	}
+
+	var matches []*docsSection
+	for _, c := range corpora {
+		dir := filepath.Join(root, c.Name)
+		for _, p := range c.Pages {
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(p.File)))
+			if err != nil {
+				continue
+			}
+			_, markdown, _ := parseStoredPage(string(data))
+			for _, s := range splitDocsSections(markdown) {
+				s.corpus, s.page = c.Name, p
+				scoreDocsSection(s, terms)
+				if s.matched > 0 {
+					matches = append(matches, s)
+				}
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return fmt.Sprintf("No matches for \"%s\" in %s. Try other keywords or fewer of them.", query, corpusLabel(corpora)), nil
+	}
+
+	// Sections matching more of the query rank first, then by score
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].matched != matches[j].matched {
+			return matches[i].matched > matches[j].matched
+		}
+		return matches[i].score > matches[j].score
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d matching sections for \"%s\" in %s:\n\n", len(matches), query, corpusLabel(corpora))
+	for i, s := range matches[:min(len(matches), maxResults)] {
+		title := firstNonEmpty(s.page.Title, s.page.File)
+		if s.heading != "" && s.heading != s.page.Title {
+			title += " › " + s.heading
+		}
+		fmt.Fprintf(&b, "%d. %s\n   %s\n   file: %s (corpus %s)\n", i+1, title, s.page.URL, s.page.File, s.corpus)
+		if excerpt := docsExcerpt(s.text, terms); excerpt != "" {
+			fmt.Fprintf(&b, "   %s\n", excerpt)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Read a page with search_docs(name=..., file=...).")
+	return b.String(), nil
+}
+
+// readDocsPage returns a stored page, paginated like browse. Its links are
+// remembered so browse(link=N) can follow them.
+func readDocsPage(root, name, file string, page int) (string, error) {
+	index, err := loadDocsIndex(root, name)
+	if err != nil {
+		return "", err
+	}
+	var entry *docsPage
+	for i := range index.Pages {
+		if index.Pages[i].File == file {
+			entry = &index.Pages[i]
+			break
+		}
+	}
+	if entry == nil {
+		return "", fmt.Errorf("'%s' is not a page in corpus '%s'. Use a file from the search results", file, name)
+	}
+	data, err := os.ReadFile(filepath.Join(root, name, filepath.FromSlash(entry.File)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read stored page: %w", err)
+	}
+
+	kind, markdown, links := parseStoredPage(string(data))
+	stored := &browsePage{url: entry.URL, kind: kind, title: entry.Title, markdown: markdown, links: links}
+	chunk, err := paginate(markdown, defaultBrowsePageKB*1024, page, -1)
+	if err != nil {
+		return "", err
+	}
+	rememberLinks(entry.URL, links)
+	return formatBrowsePage(stored, chunk), nil
+}
+
+// loadDocsIndex reads a corpus manifest, explaining what exists when the
+// corpus doesn't
+func loadDocsIndex(root, name string) (*docsIndex, error) {
+	index, err := readDocsIndex(root, name)
+	if os.IsNotExist(err) {
+		var available []string
+		for _, c := range listDocsCorpora(root) {
+			available = append(available, c.Name)
+		}
+		if len(available) == 0 {
+			return nil, fmt.Errorf("no corpus named '%s'. Nothing has been crawled yet; use crawl(url=...) first", name)
+		}
+		return nil, fmt.Errorf("no corpus named '%s'. Available: %s", name, strings.Join(available, ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("corpus '%s' can't be read; crawl it again: %w", name, err)
+	}
+	return index, nil
+}
+
+func readDocsIndex(root, name string) (*docsIndex, error) {
+	data, err := os.ReadFile(filepath.Join(root, name, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	var index docsIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+// listDocsCorpora loads every corpus under root, sorted by name
+func listDocsCorpora(root string) []*docsIndex {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+	var corpora []*docsIndex
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if index, err := readDocsIndex(root, e.Name()); err == nil {
+			corpora = append(corpora, index)
+		}
+	}
+	return corpora
+}
+
+// parseStoredPage splits a page written by crawl (the browse format:
+// title, URL line, markdown, link list) back into its parts
+func parseStoredPage(content string) (kind, markdown string, links []string) {
+	kind = kindHTML
+	header, body, _ := strings.Cut(content, "\n\n")
+	for k, label := range kindLabels {
+		if strings.HasSuffix(header, " ("+label+")") {
+			kind = k
+		}
+	}
+	if i := strings.LastIndex(body, "\nLinks (follow with link=N):\n"); i >= 0 {
+		for _, line := range strings.Split(body[i:], "\n") {
+			if _, target, ok := strings.Cut(line, "] "); ok && strings.HasPrefix(line, "[") {
+				links = append(links, target)
+			}
+		}
+		body = body[:i]
+	}
+	return kind, strings.TrimSpace(body), links
+}
+
+// splitDocsSections breaks markdown at headings
+func splitDocsSections(markdown string) []*docsSection {
+	var sections []*docsSection
+	current := &docsSection{}
+	var text strings.Builder
+	flush := func() {
+		current.text = strings.TrimSpace(text.String())
+		if current.text != "" || current.heading != "" {
+			sections = append(sections, current)
+		}
+		text.Reset()
+	}
+	for _, line := range strings.Split(markdown, "\n") {
+		if strings.HasPrefix(line, "#") {
+			if heading := strings.TrimSpace(strings.TrimLeft(line, "#")); heading != "" {
+				flush()
+				current = &docsSection{heading: heading}
+				continue
+			}
+		}
+		text.WriteString(line + "\n")
+	}
+	flush()
+	return sections
+}
+
+// docsTerms lowercases the query and splits it into words
+func docsTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, t := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' && r != '-'
+	}) {
+		t = strings.Trim(t, ".-")
+		if t != "" && !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// scoreDocsSection counts term occurrences, weighting headings and titles
+// three times and damping long sections so they don't win on length alone
+func scoreDocsSection(s *docsSection, terms []string) {
+	heading := strings.ToLower(s.heading + " " + s.page.Title)
+	text := strings.ToLower(s.text)
+	words := float64(len(strings.Fields(text)) + 20)
+	for _, t := range terms {
+		inText := strings.Count(text, t)
+		inHeading := strings.Count(heading, t)
+		if inText+inHeading == 0 {
+			continue
+		}
+		s.matched++
+		s.score += 3*float64(inHeading) + float64(inText)*50/words
+	}
+}
+
+// docsExcerpt returns text around the first matching term
+func docsExcerpt(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	pos := -1
+	for _, t := range terms {
+		if i := strings.Index(lower, t); i >= 0 && (pos < 0 || i < pos) {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	start := max(pos-docsExcerptChars/3, 0)
+	end := min(start+docsExcerptChars, len(text))
+	for start > 0 && text[start]&0xC0 == 0x80 {
+		start--
+	}
+	for end < len(text) && text[end]&0xC0 == 0x80 {
+		end++
+	}
+	excerpt := collapseSpace(text[start:end])
+	if start > 0 {
+		excerpt = "..." + excerpt
+	}
+	if end < len(text) {
+		excerpt += "..."
+	}
+	return excerpt
+}
+
+func corpusLabel(corpora []*docsIndex) string {
+	if len(corpora) == 1 {
+		return "corpus " + corpora[0].Name
+	}
+	return fmt.Sprintf("%d corpora", len(corpora))
+}
+
+func displaySearchDocs(input map[string]interface{}) string {
+	name, _ := input["name"].(string)
+	if file, _ := input["file"].(string); file != "" {
+		return fmt.Sprintf("→ Reading docs: %s/%s", name, file)
+	}
+	query, _ := input["query"].(string)
+	if query == "" {
+		return "→ Listing doc corpora"
+	}
+	if name != "" {
+		return fmt.Sprintf("→ Searching docs: \"%s\" (in %s)", query, name)
+	}
+	return fmt.Sprintf("→ Searching docs: \"%s\"", query)
+}
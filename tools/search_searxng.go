@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searxngProvider queries a self-hosted SearXNG instance through its JSON
+// API. The instance must have "json" in search.formats of settings.yml.
+type searxngProvider struct {
+	baseURL string
+}
+
+func newSearxngProvider() *searxngProvider {
+	return &searxngProvider{baseURL: strings.TrimRight(os.Getenv("CLYDE_SEARXNG_URL"), "/")}
+}
+
+func (s *searxngProvider) Name() string { return "searxng" }
+
+func (s *searxngProvider) Search(q SearchQuery) ([]SearchResult, error) {
+	if s.baseURL == "" {
+		return nil, fmt.Errorf("CLYDE_SEARXNG_URL is not set. Add the address of your SearXNG instance, e.g. CLYDE_SEARXNG_URL=http://localhost:8888")
+	}
+
+	params := url.Values{}
+	params.Set("q", q.effectiveQuery())
+	params.Set("format", "json")
+	params.Set("pageno", strconv.Itoa(q.Offset/max(q.Count, 1)+1))
+	if q.Freshness != "" {
+		params.Set("time_range", q.Freshness)
+	}
+	if q.Language != "" {
+		params.Set("language", q.Language)
+	}
+
+	req, err := http.NewRequest("GET", s.baseURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CLYDE_SEARXNG_URL: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := cachedFetch("web_search", req, 30*time.Second, cacheOptions{refresh: q.Refresh, apiResponse: true})
+	if err != nil {
+		if isEgressBlocked(err) {
+			return nil, fmt.Errorf("%w\n\nA SearXNG instance on your network needs CLYDE_FETCH_ALLOW_PRIVATE=true", err)
+		}
+		return nil, fmt.Errorf("SearXNG request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SearXNG response: %w", err)
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("SearXNG refused the JSON format (403). Enable it by adding 'json' to search.formats in settings.yml")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SearXNG error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Results []struct {
+			Title         string `json:"title"`
+			URL           string `json:"url"`
+			Content       string `json:"content"`
+			PublishedDate string `json:"publishedDate"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse SearXNG results: %w", err)
+	}
+
+	var results []SearchResult
+	for _, r := range result.Results {
+		if len(results) == q.Count {
+			break
+		}
+		results = append(results, SearchResult{Title: r.Title, URL: r.URL, Snippet: r.Content, Age: r.PublishedDate})
+	}
+	return results, nil
+}
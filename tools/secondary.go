@@ -0,0 +1,42 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/this-is-alpha-iota/clyde/api"
+)
+
+// defaultSecondaryMaxTokens bounds the output of secondary calls, which
+// produce extracts and summaries rather than long answers
+const defaultSecondaryMaxTokens = 4096
+
+// secondaryMaxTokens returns CLYDE_SECONDARY_MAX_TOKENS, the usual limit
+// for secondary calls
+func secondaryMaxTokens() int {
+	return envInt("CLYDE_SECONDARY_MAX_TOKENS", defaultSecondaryMaxTokens)
+}
+
+// secondaryCall makes a one-shot model call outside the conversation, for
+// work like extracting passages from a page. It uses CLYDE_SECONDARY_MODEL
+// when set, so this can run on a cheaper model, and returns the text of
+// the reply. maxTokens caps the reply; 0 keeps the conversation's limit.
+func secondaryCall(apiClient *api.Client, systemPrompt, prompt string, maxTokens int) (string, error) {
+	if apiClient == nil {
+		return "", fmt.Errorf("no API client available for the model call")
+	}
+	client := apiClient.WithModel(strings.TrimSpace(os.Getenv("CLYDE_SECONDARY_MODEL")), maxTokens)
+
+	resp, err := client.Call(systemPrompt, []api.Message{{Role: "user", Content: prompt}}, []api.Tool{})
+	if err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, block := range resp.Content {
+		if block.Type == "text" && block.Text != "" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
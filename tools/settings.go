@@ -0,0 +1,46 @@
+package tools
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Tool settings are read from the environment, which config.LoadFromFile
+// populates from ~/.clyde/config. Unset or malformed values fall back to
+// the given default.
+
+func envInt(name string, def int) int {
+	val := strings.TrimSpace(os.Getenv(name))
+	if val == "" {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func envBool(name string, def bool) bool {
+	val := strings.TrimSpace(os.Getenv(name))
+	if val == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// envList splits a comma-separated setting, dropping empty entries
+func envList(name string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,339 @@
+package tools
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shellSession is a long-lived bash process that run_bash can feed commands
+// to, so cd, export, source and friends carry over between calls. Each
+// command is written to a temp script and sourced; a random sentinel printed
+// afterwards marks the end of its output and carries its exit code and the
+// shell's working directory.
+type shellSession struct {
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	sentinel string
+	cwd      string // last known working directory of the shell
+	alive    bool
+	exited   chan struct{} // closed when the bash process has been reaped
+
+	stdoutRuns chan *shellRun
+	stderrRuns chan *shellRun
+}
+
+// shellRun tracks the output of one command in the session
+type shellRun struct {
+	stdout    *outputCapture
+	stderr    *outputCapture
+	status    chan shellStatus // sent by the stdout reader
+	stderrEOF chan struct{}    // closed by the stderr reader
+}
+
+type shellStatus struct {
+	exitCode int
+	cwd      string
+	died     bool // the shell exited before printing the sentinel
+}
+
+var (
+	sharedShellMu sync.Mutex
+	sharedShell   *shellSession
+)
+
+func init() {
+	registerCleanup(closeSharedShell)
+}
+
+// getSharedShell returns the agent's shell session, starting it on first use
+func getSharedShell() *shellSession {
+	sharedShellMu.Lock()
+	defer sharedShellMu.Unlock()
+	if sharedShell == nil {
+		sharedShell = &shellSession{}
+	}
+	return sharedShell
+}
+
+// sharedShellCwd returns the session's working directory, or "" if no
+// session has run yet
+func sharedShellCwd() string {
+	sharedShellMu.Lock()
+	s := sharedShell
+	sharedShellMu.Unlock()
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cwd
+}
+
+// ResetShellSession kills the persistent shell. The next persistent command
+// starts a fresh shell in Clyde's own working directory with a clean
+// environment.
+func ResetShellSession() {
+	sharedShellMu.Lock()
+	s := sharedShell
+	sharedShell = nil
+	sharedShellMu.Unlock()
+	if s != nil {
+		s.close()
+	}
+}
+
+func closeSharedShell() {
+	ResetShellSession()
+}
+
+// start launches bash. Caller must hold s.mu.
+func (s *shellSession) start() error {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	s.sentinel = "__CLYDE_DONE_" + hex.EncodeToString(buf) + "__"
+
+	// The previous session's directory may have been removed since
+	if info, err := os.Stat(s.cwd); s.cwd != "" && (err != nil || !info.IsDir()) {
+		s.cwd = ""
+	}
+
+	cmd := exec.Command("bash", "--noprofile", "--norc")
+	cmd.Dir = s.cwd
+	setProcessGroup(cmd)
+	if err := sandboxCommand(cmd); err != nil {
+		return err
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	s.cmd = cmd
+	s.stdin = stdin
+	s.alive = true
+	s.exited = make(chan struct{})
+	s.stdoutRuns = make(chan *shellRun, 1)
+	s.stderrRuns = make(chan *shellRun, 1)
+
+	// The readers get this shell's sentinel, since a restart replaces
+	// s.sentinel while the old readers may still be draining
+	go readShellStdout(stdout, s.sentinel, s.stdoutRuns)
+	go readShellStderr(stderr, s.sentinel, s.stderrRuns)
+	go func(exited chan struct{}) {
+		cmd.Wait()
+		close(exited)
+	}(s.exited)
+
+	if s.cwd == "" {
+		s.cwd, _ = os.Getwd()
+	}
+	return nil
+}
+
+// readShellStdout copies each command's stdout into its run until the
+// sentinel line, which also carries the exit code and working directory
+func readShellStdout(r io.Reader, sentinel string, runs chan *shellRun) {
+	reader := bufio.NewReader(r)
+	prefix := sentinel + " "
+	for run := range runs {
+		var pending []byte
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				// Shell died: flush whatever we have
+				run.stdout.Write(pending)
+				run.stdout.Write(line)
+				run.status <- shellStatus{died: true}
+				for run := range runs {
+					run.status <- shellStatus{died: true}
+				}
+				return
+			}
+			if text := string(line); strings.HasPrefix(text, prefix) {
+				// Drop the newline the sentinel printf added before itself
+				if len(pending) > 0 {
+					run.stdout.Write(pending[:len(pending)-1])
+				}
+				fields := strings.SplitN(strings.TrimSuffix(text[len(prefix):], "\n"), " ", 2)
+				status := shellStatus{}
+				status.exitCode, _ = strconv.Atoi(fields[0])
+				if len(fields) == 2 {
+					status.cwd = fields[1]
+				}
+				run.status <- status
+				break
+			}
+			run.stdout.Write(pending)
+			pending = line
+		}
+	}
+}
+
+// readShellStderr copies each command's stderr into its run until the
+// sentinel
+func readShellStderr(r io.Reader, sentinel string, runs chan *shellRun) {
+	reader := bufio.NewReader(r)
+	for run := range runs {
+		var pending []byte
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				run.stderr.Write(pending)
+				run.stderr.Write(line)
+				close(run.stderrEOF)
+				for run := range runs {
+					close(run.stderrEOF)
+				}
+				return
+			}
+			if strings.TrimSuffix(string(line), "\n") == sentinel {
+				if len(pending) > 0 {
+					run.stderr.Write(pending[:len(pending)-1])
+				}
+				close(run.stderrEOF)
+				break
+			}
+			run.stderr.Write(pending)
+			pending = line
+		}
+	}
+}
+
+// run executes one command in the session
+func (s *shellSession) run(req *bashRequest) (*bashResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notes []string
+	if !s.alive {
+		restarted := s.cmd != nil
+		if err := s.start(); err != nil {
+			return nil, fmt.Errorf("failed to start shell session: %w", err)
+		}
+		if restarted {
+			notes = append(notes, fmt.Sprintf("Previous shell session ended; started a new one in %s (exported variables were lost)", s.cwd))
+		}
+	}
+
+	script, err := os.CreateTemp("", "clyde-cmd-*.sh")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(script.Name())
+
+	var body strings.Builder
+	if req.cwd != "" {
+		body.WriteString("cd " + shellQuote(req.cwd) + " || return\n")
+	}
+	for _, kv := range req.env {
+		body.WriteString("export " + shellQuote(kv) + "\n")
+	}
+	body.WriteString(req.command)
+	body.WriteString("\n")
+	script.WriteString(body.String())
+	script.Close()
+
+	limit := envInt("CLYDE_BASH_MAX_OUTPUT_KB", defaultBashOutputKB) * 1024
+	run := &shellRun{
+		stdout:    newOutputCapture("stdout", limit),
+		stderr:    newOutputCapture("stderr", limit),
+		status:    make(chan shellStatus, 1),
+		stderrEOF: make(chan struct{}),
+	}
+	defer run.stdout.Close()
+	defer run.stderr.Close()
+
+	s.stdoutRuns <- run
+	s.stderrRuns <- run
+
+	// Source the script so state changes persist; stdin is detached so the
+	// command can't consume the session's control stream
+	wrapper := fmt.Sprintf("{ . %s; } </dev/null\n__clyde_ec=$?; printf '\\n%s %%d %%s\\n' \"$__clyde_ec\" \"$PWD\"; printf '\\n%s\\n' >&2\n",
+		shellQuote(script.Name()), s.sentinel, s.sentinel)
+	if _, err := io.WriteString(s.stdin, wrapper); err != nil {
+		s.kill()
+		return nil, fmt.Errorf("shell session is not accepting input: %w", err)
+	}
+
+	result := &bashResult{stdout: run.stdout, stderr: run.stderr, notes: notes}
+
+	select {
+	case status := <-run.status:
+		// The stderr sentinel follows right after; don't hang if a
+		// leftover child is still holding the pipe open
+		select {
+		case <-run.stderrEOF:
+		case <-time.After(2 * time.Second):
+		}
+		if status.died {
+			s.kill()
+			result.exitCode = -1
+			if s.cmd.ProcessState != nil {
+				result.exitCode = s.cmd.ProcessState.ExitCode()
+			}
+			result.notes = append(result.notes, "The shell session exited during this command; the next persistent command starts a new session")
+			break
+		}
+		result.exitCode = status.exitCode
+		if status.cwd != "" {
+			s.cwd = status.cwd
+		}
+	case <-time.After(req.timeout):
+		result.timedOut = true
+		s.kill()
+		result.notes = append(result.notes, fmt.Sprintf("The shell session was killed, losing its exported variables, functions and any directory change made by this command; the next persistent command starts a new session in %s", s.cwd))
+	}
+
+	return result, nil
+}
+
+// kill terminates the shell and everything it started. Caller must hold s.mu.
+func (s *shellSession) kill() {
+	if s.cmd == nil || !s.alive {
+		return
+	}
+	s.alive = false
+	s.stdin.Close()
+	killProcessGroup(s.cmd)
+	select {
+	case <-s.exited:
+	case <-time.After(5 * time.Second):
+	}
+	close(s.stdoutRuns)
+	close(s.stderrRuns)
+}
+
+func (s *shellSession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kill()
+}
+
+// shellQuote wraps s in single quotes for safe use in a bash command line
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
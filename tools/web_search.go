@@ -1,15 +1,11 @@
 package tools
 
 import (
-	"github.com/this-is-alpha-iota/clyde/api"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
-	"os"
+	"slices"
 	"strings"
-	"time"
+
+	"github.com/this-is-alpha-iota/clyde/api"
 )
 
 func init() {
@@ -18,7 +14,7 @@ func init() {
 
 var webSearchTool = api.Tool{
 	Name:        "web_search",
-	Description: "Search the internet using Brave Search API. Returns titles, URLs, and snippets for search results. Use for finding current documentation, error solutions, package versions, recent news, or any information beyond your training data.",
+	Description: "Search the internet. Returns titles, URLs, and snippets for search results. Use for finding current documentation, error solutions, package versions, recent news, or any information beyond your training data.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
@@ -31,6 +27,27 @@ var webSearchTool = api.Tool{
 				"description": "Number of results to return (1-10, default 5)",
 				"default":     5,
 			},
+			"site": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: only return results from this domain, e.g. 'pkg.go.dev'",
+			},
+			"freshness": map[string]interface{}{
+				"type":        "string",
+				"enum":        searchFreshness,
+				"description": "Optional: only return results published within this window",
+			},
+			"language": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: result language as a two-letter code, e.g. 'en' or 'de'",
+			},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional: number of results to skip, for the next page of results (use a multiple of num_results)",
+			},
+			"refresh": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Optional: bypass cached results for this query (default false)",
+			},
 		},
 		"required": []string{"query"},
 	},
@@ -44,7 +61,7 @@ func executeWebSearch(input map[string]interface{}, apiClient *api.Client, conve
 
 	// Default to 5 results if not specified
 	numResults := 5
-	if numVal, ok := input["num_results"].(float64); ok {
+	if numVal, ok := input["num_results"].(float64); ok && numVal > 0 {
 		numResults = int(numVal)
 	}
 	// Cap at 10 results
@@ -52,79 +69,41 @@ func executeWebSearch(input map[string]interface{}, apiClient *api.Client, conve
 		numResults = 10
 	}
 
-	// Get API key from environment
-	apiKey := os.Getenv("BRAVE_SEARCH_API_KEY")
-	if apiKey == "" {
-		return "", fmt.Errorf("BRAVE_SEARCH_API_KEY not found in .env file.\n\nTo fix this:\n  1. Sign up for a free API key at https://brave.com/search/api/\n  2. Add to your .env file: BRAVE_SEARCH_API_KEY=your-key-here\n  3. Free tier includes 2,000 searches per month")
+	q := SearchQuery{Query: query, Count: numResults}
+	q.Site, _ = input["site"].(string)
+	q.Site = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(q.Site, "https://"), "http://"), "/")
+	q.Freshness, _ = input["freshness"].(string)
+	if q.Freshness != "" && !slices.Contains(searchFreshness, q.Freshness) {
+		return "", fmt.Errorf("invalid freshness '%s'. Use one of: %s", q.Freshness, strings.Join(searchFreshness, ", "))
 	}
-
-	// Build API request
-	apiURL := fmt.Sprintf("https://api.search.brave.com/res/v1/web/search?q=%s&count=%d",
-		url.QueryEscape(query), numResults)
-
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create search request: %w", err)
+	q.Language, _ = input["language"].(string)
+	if offsetVal, ok := input["offset"].(float64); ok && offsetVal > 0 {
+		q.Offset = int(offsetVal)
 	}
+	q.Refresh, _ = input["refresh"].(bool)
 
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("X-Subscription-Token", apiKey)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	results, provider, err := runSearch(q)
 	if err != nil {
-		return "", fmt.Errorf("search request failed: %w\n\nCheck your internet connection", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read search response: %w", err)
-	}
-
-	// Handle HTTP errors
-	if resp.StatusCode != http.StatusOK {
-		switch resp.StatusCode {
-		case 401:
-			return "", fmt.Errorf("search API authentication failed (401)\n\nYour API key may be invalid:\n  - Verify BRAVE_SEARCH_API_KEY in .env file\n  - Try generating a new key at https://brave.com/search/api/")
-		case 429:
-			return "", fmt.Errorf("search rate limit exceeded (429)\n\nYou've reached your monthly search limit (2000 free searches).\n  - Wait until next month for limit reset\n  - Or upgrade at https://brave.com/search/api/ ($5/mo for 20K searches)")
-		case 400:
-			return "", fmt.Errorf("invalid search query (400): %s\n\nCheck your query syntax", string(body))
-		default:
-			return "", fmt.Errorf("search API error (status %d): %s", resp.StatusCode, string(body))
-		}
-	}
-
-	// Parse JSON response
-	var result struct {
-		Web struct {
-			Results []struct {
-				Title       string `json:"title"`
-				URL         string `json:"url"`
-				Description string `json:"description"`
-			} `json:"results"`
-		} `json:"web"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("failed to parse search results: %w\n\nResponse: %s", err, string(body))
+		return "", err
 	}
 
 	// Check if we got any results
-	if len(result.Web.Results) == 0 {
+	if len(results) == 0 {
 		return fmt.Sprintf("No results found for '%s'.\n\nSuggestions:\n  - Try different keywords\n  - Check spelling\n  - Use more general terms\n  - Try removing quotes or special characters", query), nil
 	}
 
 	// Format results
 	var output strings.Builder
-	output.WriteString(fmt.Sprintf("Found %d results for \"%s\":\n\n", len(result.Web.Results), query))
+	output.WriteString(fmt.Sprintf("Found %d results for \"%s\" (via %s):\n\n", len(results), query, provider))
 
-	for i, res := range result.Web.Results {
-		output.WriteString(fmt.Sprintf("%d. [%s] - %s\n", i+1, res.Title, res.URL))
-		if res.Description != "" {
+	for i, res := range results {
+		output.WriteString(fmt.Sprintf("%d. [%s] - %s\n", q.Offset+i+1, res.Title, res.URL))
+		if res.Age != "" {
+			output.WriteString(fmt.Sprintf("   %s\n", res.Age))
+		}
+		if res.Snippet != "" {
 			// Truncate description if too long
-			desc := res.Description
+			desc := collapseSpace(res.Snippet)
 			if len(desc) > 200 {
 				desc = desc[:197] + "..."
 			}
@@ -138,11 +117,21 @@ func executeWebSearch(input map[string]interface{}, apiClient *api.Client, conve
 
 func displayWebSearch(input map[string]interface{}) string {
 	query, _ := input["query"].(string)
-	
+
 	// Truncate long queries for display
 	displayQuery := query
 	if len(displayQuery) > 50 {
 		displayQuery = displayQuery[:47] + "..."
 	}
+	var filters []string
+	if site, _ := input["site"].(string); site != "" {
+		filters = append(filters, "site:"+site)
+	}
+	if freshness, _ := input["freshness"].(string); freshness != "" {
+		filters = append(filters, "past "+freshness)
+	}
+	if len(filters) > 0 {
+		return fmt.Sprintf("→ Searching web: \"%s\" (%s)", displayQuery, strings.Join(filters, ", "))
+	}
 	return fmt.Sprintf("→ Searching web: \"%s\"", displayQuery)
 }
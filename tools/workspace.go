@@ -0,0 +1,222 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// File tools only touch paths inside the workspace roots: the launch
+// directory plus CLYDE_WORKSPACE_ROOTS. Paths are resolved through symlinks
+// before the check, so a link inside the project cannot reach outside it.
+// CLYDE_FILE_DENY globs are refused even inside the workspace;
+// CLYDE_FILE_ALLOW globs are permitted even outside it. The session's
+// scratch directory (see scratch.go) is always readable.
+
+// launchDir is the directory clyde was started in, the default workspace root
+var launchDir, _ = os.Getwd()
+
+// defaultDenyRules keep secrets out of the conversation unless the user
+// overrides CLYDE_FILE_DENY (set it to "none" to disable)
+var defaultDenyRules = []string{
+	".env",
+	".env.local",
+	".env.*.local",
+	"~/.ssh",
+	"~/.aws",
+	"~/.gnupg",
+	"~/.clyde/config",
+}
+
+// workspacePolicy is the set of rules file tools validate paths against
+type workspacePolicy struct {
+	roots    []string // absolute, symlink-resolved
+	allow    []string
+	deny     []string
+	confined bool
+}
+
+func currentWorkspacePolicy() *workspacePolicy {
+	policy := &workspacePolicy{
+		allow:    envList("CLYDE_FILE_ALLOW"),
+		deny:     envList("CLYDE_FILE_DENY"),
+		confined: envBool("CLYDE_WORKSPACE_CONFINE", true),
+	}
+	if len(policy.deny) == 0 {
+		policy.deny = defaultDenyRules
+	} else if len(policy.deny) == 1 && strings.EqualFold(policy.deny[0], "none") {
+		policy.deny = nil
+	}
+
+	for _, root := range append([]string{launchDir}, envList("CLYDE_WORKSPACE_ROOTS")...) {
+		policy.roots = append(policy.roots, resolvePath(expandHome(root)))
+	}
+	return policy
+}
+
+// workspaceRoots returns the resolved workspace roots
+func workspaceRoots() []string {
+	return currentWorkspacePolicy().roots
+}
+
+// checkWorkspacePath returns an error naming the rule that blocks access to
+// path, or nil if file tools may use it
+func checkWorkspacePath(path string) error {
+	return currentWorkspacePolicy().check(path)
+}
+
+func (p *workspacePolicy) check(path string) error {
+	abs, err := filepath.Abs(expandHome(path))
+	if err != nil {
+		return fmt.Errorf("invalid path '%s': %w", path, err)
+	}
+	resolved := resolvePath(abs)
+
+	if rule := p.denyRule(abs, resolved); rule != "" {
+		return fmt.Errorf("access to '%s' is blocked by deny rule '%s' (CLYDE_FILE_DENY)", path, rule)
+	}
+	if !p.confined {
+		return nil
+	}
+	for _, root := range p.roots {
+		if isWithin(resolved, root) {
+			return nil
+		}
+	}
+	if inScratchDir(resolved) {
+		return nil
+	}
+	for _, rule := range p.allow {
+		if p.matchRule(rule, resolved) {
+			return nil
+		}
+	}
+
+	location := resolved
+	if resolved != abs {
+		location = fmt.Sprintf("%s (symlink target)", resolved)
+	}
+	return fmt.Errorf("'%s' resolves to %s, which is outside the workspace (%s). Add the directory to CLYDE_WORKSPACE_ROOTS or an allow glob to CLYDE_FILE_ALLOW",
+		path, location, strings.Join(p.roots, ", "))
+}
+
+// denyRule returns the first deny rule matching either the path as given or
+// its symlink target
+func (p *workspacePolicy) denyRule(paths ...string) string {
+	for _, rule := range p.deny {
+		for _, path := range paths {
+			if p.matchRule(rule, path) {
+				return rule
+			}
+		}
+	}
+	return ""
+}
+
+// isDenied reports whether a path found while searching (grep, glob) must be
+// left out of the results
+func (p *workspacePolicy) isDenied(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return p.denyRule(abs, resolvePath(abs)) != ""
+}
+
+// matchRule matches a glob against an absolute path or any of its parent
+// directories, so a rule for a directory covers everything inside it.
+// Rules without a slash match a single path component anywhere (".env");
+// relative rules with a slash are anchored at each workspace root. "**"
+// matches any number of directories.
+func (p *workspacePolicy) matchRule(rule, path string) bool {
+	rule = expandHome(rule)
+
+	if !strings.Contains(rule, "/") {
+		re := globToRegexp(rule)
+		for dir := path; ; dir = filepath.Dir(dir) {
+			if re.MatchString(filepath.Base(dir)) {
+				return true
+			}
+			if parent := filepath.Dir(dir); parent == dir {
+				return false
+			}
+		}
+	}
+
+	patterns := []string{rule}
+	if !filepath.IsAbs(rule) {
+		patterns = nil
+		for _, root := range p.roots {
+			patterns = append(patterns, filepath.Join(root, rule))
+		}
+	}
+	for _, pattern := range patterns {
+		re := globToRegexp(filepath.Clean(pattern))
+		for dir := path; ; dir = filepath.Dir(dir) {
+			if re.MatchString(dir) {
+				return true
+			}
+			if parent := filepath.Dir(dir); parent == dir {
+				break
+			}
+		}
+	}
+	return false
+}
+
+// globToRegexp converts a glob with *, ? and ** into an anchored regexp
+func globToRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// resolvePath follows symlinks in the longest existing prefix of an absolute
+// path, so files that don't exist yet are checked against where they would
+// be created
+func resolvePath(abs string) string {
+	var missing []string
+	dir := filepath.Clean(abs)
+	for {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return filepath.Clean(abs)
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+		dir = parent
+	}
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/this-is-alpha-iota/clyde/api"
@@ -14,7 +15,7 @@ func init() {
 
 var writeFileTool = api.Tool{
 	Name:        "write_file",
-	Description: "Write content to a file. This will create a new file or completely replace the contents of an existing file. Use this for creating new files or when you need to replace the entire file contents. For partial edits, use patch_file instead.",
+	Description: "Write content to a file. This will create a new file or completely replace the contents of an existing file. Use this for creating new files or when you need to replace the entire file contents. For partial edits, use patch_file instead. Writes are atomic, keep the existing file's permissions and ownership, and missing parent directories are created automatically.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
@@ -26,11 +27,31 @@ var writeFileTool = api.Tool{
 				"type":        "string",
 				"description": "The complete content to write to the file.",
 			},
+			"create_dirs": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Create missing parent directories (default true)",
+				"default":     true,
+			},
+			"preserve_format": map[string]interface{}{
+				"type":        "boolean",
+				"description": "When replacing a file, keep its line endings (LF/CRLF) and trailing-newline convention (default true)",
+				"default":     true,
+			},
+			"allow_large_overwrite": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Allow replacing a file larger than the configured overwrite limit (default false)",
+				"default":     false,
+			},
 		},
 		"required": []string{"path", "content"},
 	},
 }
 
+// defaultMaxOverwriteKB is the size above which write_file refuses to replace
+// an existing file unless allow_large_overwrite is set. Configurable with
+// CLYDE_WRITE_FILE_MAX_OVERWRITE_KB; 0 disables the check.
+const defaultMaxOverwriteKB = 100
+
 func executeWriteFile(input map[string]interface{}, apiClient *api.Client, conversationHistory []api.Message) (string, error) {
 	path, pathOk := input["path"].(string)
 	content, contentOk := input["content"].(string)
@@ -41,55 +62,141 @@ func executeWriteFile(input map[string]interface{}, apiClient *api.Client, conve
 	if !contentOk {
 		return "", fmt.Errorf("content parameter is required")
 	}
+	if err := checkWorkspacePath(path); err != nil {
+		return "", err
+	}
+
+	createDirs := true
+	if val, ok := input["create_dirs"].(bool); ok {
+		createDirs = val
+	}
+	preserveFormat := true
+	if val, ok := input["preserve_format"].(bool); ok {
+		preserveFormat = val
+	}
+	allowLarge := false
+	if val, ok := input["allow_large_overwrite"].(bool); ok {
+		allowLarge = val
+	}
 
 	// Check if file exists to provide appropriate message
 	fileExists := false
 	existingSize := int64(0)
 	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return "", fmt.Errorf("'%s' is a directory. Provide a file path instead", path)
+		}
 		fileExists = true
 		existingSize = info.Size()
 
-		// Warn if overwriting a large file
-		if existingSize > 100*1024 { // 100KB
+		// Guard against accidentally replacing a large file
+		maxKB := envInt("CLYDE_WRITE_FILE_MAX_OVERWRITE_KB", defaultMaxOverwriteKB)
+		if maxKB > 0 && existingSize > int64(maxKB)*1024 && !allowLarge {
 			suggestions := []string{
 				fmt.Sprintf("Warning: You are about to replace the entire contents of '%s' (%d KB).",
 					path, existingSize/1024),
 				"",
 				"If you meant to edit part of the file, use patch_file instead.",
 				"write_file will completely replace all existing content.",
+				fmt.Sprintf("To replace it anyway, call write_file again with allow_large_overwrite=true (limit: %d KB).", maxKB),
 			}
 			return "", fmt.Errorf("%s", strings.Join(suggestions, "\n"))
 		}
 	}
 
-	// Check directory exists
-	dir := path
-	if lastSlash := strings.LastIndex(path, "/"); lastSlash > 0 {
-		dir = path[:lastSlash]
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
-			return "", fmt.Errorf("directory '%s' does not exist. Create it first with: run_bash(\"mkdir -p %s\")", dir, dir)
+	// Make sure the parent directory exists
+	var createdDir string
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if !createDirs {
+			return "", fmt.Errorf("directory '%s' does not exist. Call write_file with create_dirs=true to create it", dir)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			if os.IsPermission(err) {
+				return "", fmt.Errorf("permission denied creating directory '%s'. Check directory permissions", dir)
+			}
+			return "", fmt.Errorf("failed to create directory '%s': %w", dir, err)
+		}
+		createdDir = dir
+	}
+
+	// Keep the original file's line endings and trailing newline
+	var notes []string
+	if fileExists && preserveFormat {
+		if original, err := os.ReadFile(path); err == nil {
+			var adjusted bool
+			content, adjusted = matchTextFormat(string(original), content)
+			if adjusted {
+				notes = append(notes, "kept original line endings and trailing newline")
+			}
 		}
 	}
 
+	checkpointBeforeWrite(path)
+	autoCommitNoteWrite(path)
+	check := beforeEdit(path)
+
 	// Write the content
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	if err := writeFileAtomic(path, []byte(content)); err != nil {
 		if os.IsPermission(err) {
 			return "", fmt.Errorf("permission denied writing to '%s'. Check directory and file permissions", path)
 		}
 		return "", fmt.Errorf("failed to write file '%s': %w", path, err)
 	}
 
+	if createdDir != "" {
+		notes = append(notes, fmt.Sprintf("created directory %s", createdDir))
+	}
+	suffix := ""
+	if len(notes) > 0 {
+		suffix = " [" + strings.Join(notes, "; ") + "]"
+	}
+
 	if fileExists {
-		return fmt.Sprintf("Successfully replaced contents of %s (%d bytes written, was %d bytes)",
-			path, len(content), existingSize), nil
+		return withEditReport(fmt.Sprintf("Successfully replaced contents of %s (%d bytes written, was %d bytes)%s",
+			path, len(content), existingSize, suffix), check), nil
 	}
-	return fmt.Sprintf("Successfully created %s (%d bytes written)", path, len(content)), nil
+	return withEditReport(fmt.Sprintf("Successfully created %s (%d bytes written)%s", path, len(content), suffix), check), nil
+}
+
+// matchTextFormat rewrites content to use the line-ending style and
+// trailing-newline convention of original. It reports whether anything
+// changed. Binary-looking originals are left alone.
+func matchTextFormat(original, content string) (string, bool) {
+	if original == "" || strings.IndexByte(original, 0) >= 0 {
+		return content, false
+	}
+
+	adjusted := content
+
+	// Treat the file as CRLF if most of its line breaks are CRLF
+	crlf := strings.Count(original, "\r\n")
+	lf := strings.Count(original, "\n")
+	newline := "\n"
+	if crlf > 0 && crlf*2 >= lf {
+		newline = "\r\n"
+		adjusted = strings.ReplaceAll(adjusted, "\r\n", "\n")
+		adjusted = strings.ReplaceAll(adjusted, "\n", "\r\n")
+	}
+
+	if adjusted != "" {
+		hadTrailing := strings.HasSuffix(original, "\n")
+		hasTrailing := strings.HasSuffix(adjusted, "\n")
+		if hadTrailing && !hasTrailing {
+			adjusted += newline
+		} else if !hadTrailing && hasTrailing {
+			adjusted = strings.TrimSuffix(adjusted, "\n")
+			adjusted = strings.TrimSuffix(adjusted, "\r")
+		}
+	}
+
+	return adjusted, adjusted != content
 }
 
 func displayWriteFile(input map[string]interface{}) string {
 	path, _ := input["path"].(string)
 	content, _ := input["content"].(string)
-	
+
 	// Format file size nicely
 	size := len(content)
 	var sizeStr string